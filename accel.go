@@ -0,0 +1,164 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/crate-crypto/go-ipa/bandersnatch"
+	"github.com/crate-crypto/go-ipa/banderwagon"
+	"github.com/crate-crypto/go-ipa/ipa"
+)
+
+// Acceleration reports the optimized code paths used by a configuration.
+// Some are selected when building, some are detected at runtime, and
+// some can be disabled with options, see WithPrecomputedTables. The field
+// assembly can't be disabled by an option, see FieldAssembly.
+type Acceleration struct {
+	Arch string // GOARCH the package was built for
+
+	// FieldAssembly is true if field multiplications use the ADX/BMI2
+	// assembly of go-ipa. This requires an amd64 CPU supporting these
+	// instructions, and a build without the noadx tag. go-ipa selects it
+	// once for the whole process, and doesn't allow changing it, so it
+	// can only be disabled by building with the noadx tag, and applies
+	// to all configurations.
+	FieldAssembly bool
+
+	// PrecomputedTables is true if commitments are computed with the
+	// precomputed tables of the CRS points, instead of a plain
+	// multi-scalar multiplication.
+	PrecomputedTables bool
+
+	Workers int // number of goroutines used by batch operations
+}
+
+func (a Acceleration) String() string {
+	var active []string
+	if a.FieldAssembly {
+		active = append(active, "field assembly")
+	}
+	if a.PrecomputedTables {
+		active = append(active, "precomputed tables")
+	}
+	if len(active) == 0 {
+		active = append(active, "none")
+	}
+	return fmt.Sprintf("%s (%s), %d workers", strings.Join(active, ", "), a.Arch, a.Workers)
+}
+
+// Acceleration returns the optimized code paths used by this
+// configuration.
+func (conf *IPAConfig) Acceleration() Acceleration {
+	return Acceleration{
+		Arch:              runtime.GOARCH,
+		FieldAssembly:     fieldAssembly,
+		PrecomputedTables: conf.precomputedTables(),
+		Workers:           conf.numWorkers(),
+	}
+}
+
+// WithPrecomputedTables enables or disables the use of the precomputed
+// tables of the CRS points to compute commitments. They are enabled by
+// default, except in builds with the verkle_small tag, where they aren't
+// available. Disabling them is much slower, and is mostly useful to
+// compare both code paths. There is no such option for the field
+// assembly, see Acceleration.
+func WithPrecomputedTables(enabled bool) Option {
+	return func(conf *IPAConfig) error {
+		if enabled && smallFootprint {
+			return fmt.Errorf("precomputed tables aren't available in verkle_small builds")
+		}
+		conf.noPrecomputedTables = !enabled
+		return nil
+	}
+}
+
+func (conf *IPAConfig) precomputedTables() bool {
+	return !smallFootprint && !conf.noPrecomputedTables
+}
+
+// precompWindowBits returns the size, in bits, of the windows of the
+// precomputed tables of the wide and narrow CRS points.
+func (conf *IPAConfig) precompWindowBits() (wide, narrow int) {
+	if conf.precompWideBits == 0 {
+		return precompWideWindowBits, precompNarrowWindowBits
+	}
+	return conf.precompWideBits, conf.precompNarrowBits
+}
+
+// buildPrecompTables builds the tables of the CRS points, if the window
+// sizes set with WithPrecompSize differ from those of go-ipa's tables.
+// It is called once all the options have been applied.
+func (conf *IPAConfig) buildPrecompTables() error {
+	wide, narrow := conf.precompWindowBits()
+	if !conf.precomputedTables() || (wide == precompWideWindowBits && narrow == precompNarrowWindowBits) {
+		return nil
+	}
+	conf.precomp = make([]banderwagon.PrecompPoint, len(conf.conf.SRS))
+	for i := range conf.conf.SRS {
+		bits := narrow
+		if i < precompWideWindowPoints {
+			bits = wide
+		}
+		var err error
+		if conf.precomp[i], err = banderwagon.NewPrecompPoint(conf.conf.SRS[i], bits); err != nil {
+			return fmt.Errorf("building precomputed table of CRS point %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// commit computes the commitment to poly, which must not be longer than
+// the CRS.
+func (conf *IPAConfig) commit(poly []Fr) Point {
+	if conf.precomp != nil {
+		var (
+			acc    = bandersnatch.IdentityExt
+			affine bandersnatch.PointAffine
+			ret    Point
+		)
+		for i := range poly {
+			if !poly[i].IsZero() {
+				conf.precomp[i].ScalarMul(poly[i], &acc)
+			}
+		}
+		affine.FromExtended(&acc)
+		ret.SetIdentity()
+		ret.AddMixed(&ret, affine)
+		return ret
+	}
+	if conf.precomputedTables() {
+		return conf.conf.Commit(poly)
+	}
+	ret, err := ipa.MultiScalar(conf.conf.SRS[:len(poly)], poly)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
@@ -0,0 +1,237 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Operation is the kind of tree operation an OperationCost refers to.
+type Operation uint8
+
+const (
+	OpInsert Operation = iota
+	OpGet
+	OpDelete
+	OpCommit
+)
+
+func (op Operation) String() string {
+	switch op {
+	case OpInsert:
+		return "insert"
+	case OpGet:
+		return "get"
+	case OpDelete:
+		return "delete"
+	case OpCommit:
+		return "commit"
+	default:
+		return "unknown"
+	}
+}
+
+// OperationCost is the cost of a single operation on a tree.
+type OperationCost struct {
+	Op            Operation
+	Stem          []byte // stem the operation applies to, nil for a commit
+	Time          time.Duration
+	NodesResolved int // calls to the resolver
+	BytesResolved int // serialized bytes returned by the resolver
+	PointsUpdated int // leaf commitments updated, or internal node commitments recomputed by a commit
+}
+
+// StemCost sums the costs of the operations on a stem.
+type StemCost struct {
+	Stem          []byte
+	Operations    int
+	Time          time.Duration
+	NodesResolved int
+	BytesResolved int
+	PointsUpdated int
+}
+
+// AccountingReport records the cost of each operation done on the root
+// of the trees using a configuration created WithAccounting. It is meant
+// to calibrate the gas cost of state accesses against real workloads.
+// It is safe for concurrent use.
+type AccountingReport struct {
+	lock sync.Mutex
+	ops  []OperationCost
+}
+
+func NewAccountingReport() *AccountingReport {
+	return &AccountingReport{}
+}
+
+// WithAccounting makes the trees using the configuration record the cost
+// of their insertions, reads, deletions and commitments in report.
+// Commits with nothing to recompute aren't recorded. Passing nil disables
+// accounting.
+func WithAccounting(report *AccountingReport) Option {
+	return func(conf *IPAConfig) error {
+		conf.accounting = report
+		return nil
+	}
+}
+
+// Operations returns the costs recorded so far, in the order of the
+// operations.
+func (r *AccountingReport) Operations() []OperationCost {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]OperationCost{}, r.ops...)
+}
+
+// Stems returns the costs recorded so far, summed by stem and sorted by
+// stem. Commits don't apply to a single stem, and aren't included.
+func (r *AccountingReport) Stems() []StemCost {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	byStem := map[string]*StemCost{}
+	var stems []StemCost
+	for _, op := range r.ops {
+		if op.Op == OpCommit {
+			continue
+		}
+		sc, ok := byStem[string(op.Stem)]
+		if !ok {
+			sc = &StemCost{Stem: op.Stem}
+			byStem[string(op.Stem)] = sc
+		}
+		sc.Operations++
+		sc.Time += op.Time
+		sc.NodesResolved += op.NodesResolved
+		sc.BytesResolved += op.BytesResolved
+		sc.PointsUpdated += op.PointsUpdated
+	}
+	for _, sc := range byStem {
+		stems = append(stems, *sc)
+	}
+	sort.Slice(stems, func(i, j int) bool {
+		return bytes.Compare(stems[i].Stem, stems[j].Stem) < 0
+	})
+	return stems
+}
+
+// Reset drops the costs recorded so far.
+func (r *AccountingReport) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.ops = nil
+}
+
+func (r *AccountingReport) add(cost OperationCost) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.ops = append(r.ops, cost)
+}
+
+// accountingReport returns the report in which the operations on n are
+// recorded, nil if they aren't. Only the operations on the root of a
+// tree are recorded, so that the recursive calls down the tree aren't
+// counted twice.
+func (n *InternalNode) accountingReport() *AccountingReport {
+	if n.depth != 0 {
+		return nil
+	}
+	return n.config().accounting
+}
+
+// record runs op on stem, calling f with a resolver counting the nodes
+// it resolves, and records its cost.
+func (r *AccountingReport) record(root *InternalNode, op Operation, stem []byte, resolver NodeResolverFn, f func(NodeResolverFn) error) error {
+	var (
+		cost   = OperationCost{Op: op, Stem: append([]byte{}, stem[:StemSize]...)}
+		before [3]*Point
+	)
+	if op != OpGet {
+		before = root.leafCommitments(stem)
+	}
+	if resolver != nil {
+		inner := resolver
+		resolver = func(path []byte) ([]byte, error) {
+			serialized, err := inner(path)
+			cost.NodesResolved++
+			cost.BytesResolved += len(serialized)
+			// If the leaf of stem wasn't in memory, its commitments
+			// before the operation are those it is resolved with.
+			if err == nil && op != OpGet && before[0] == nil {
+				if leaf, perr := ParseNode(serialized, byte(len(path))); perr == nil {
+					if leaf, ok := leaf.(*LeafNode); ok && equalPaths(leaf.stem, stem) {
+						before = [3]*Point{leaf.commitment, leaf.c1, leaf.c2}
+					}
+				}
+			}
+			return serialized, err
+		}
+	}
+
+	start := time.Now()
+	err := f(resolver)
+	cost.Time = time.Since(start)
+
+	if op != OpGet {
+		after := root.leafCommitments(stem)
+		for i := range after {
+			if after[i] != nil && (before[i] == nil || !before[i].Equal(after[i])) {
+				cost.PointsUpdated++
+			}
+		}
+	}
+	r.add(cost)
+	return err
+}
+
+// leafCommitments returns a copy of the C, C1 and C2 commitments of the
+// leaf holding stem, if it is in memory. Missing commitments are nil.
+func (n *InternalNode) leafCommitments(stem []byte) [3]*Point {
+	var comms [3]*Point
+	node := VerkleNode(n)
+	for {
+		switch child := node.(type) {
+		case *InternalNode:
+			node = child.children[offset2key(stem, child.depth)]
+			continue
+		case *LeafNode:
+			if equalPaths(child.stem, stem) {
+				for i, c := range []*Point{child.commitment, child.c1, child.c2} {
+					if c != nil {
+						comms[i] = new(Point).Set(c)
+					}
+				}
+			}
+		}
+		return comms
+	}
+}
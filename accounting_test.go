@@ -0,0 +1,62 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAccountingReport(t *testing.T) {
+	t.Parallel()
+
+	report := NewAccountingReport()
+	conf, err := NewConfig(WithAccounting(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, resolver := flushedTree(t, conf, []keyValue{{zeroKeyTest, fourtyKeyTest}, {ffx32KeyTest, fourtyKeyTest}})
+	if err := root.Insert(oneKeyTest, fourtyKeyTest, resolver); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flushing commits the tree. A new leaf has all three commitments
+	// computed, updating a value only changes C and C1.
+	ops := report.Operations()
+	if len(ops) != 4 {
+		t.Fatalf("expected 4 operations, got %+v", ops)
+	}
+	for i, expected := range []struct {
+		op     Operation
+		points int
+	}{{OpInsert, 3}, {OpInsert, 3}, {OpCommit, 1}, {OpInsert, 2}} {
+		if ops[i].Op != expected.op || ops[i].PointsUpdated != expected.points {
+			t.Fatalf("invalid cost for operation %d: %+v", i, ops[i])
+		}
+	}
+	if ops[3].NodesResolved != 1 || ops[3].BytesResolved == 0 {
+		t.Fatalf("the flushed leaf should have been resolved: %+v", ops[3])
+	}
+
+	report.Reset()
+	root.Commit()
+	if _, err := root.Get(ffx32KeyTest, resolver); err != nil {
+		t.Fatal(err)
+	}
+	ops = report.Operations()
+	if len(ops) != 2 || ops[0].Op != OpCommit || ops[0].PointsUpdated != 1 {
+		t.Fatalf("invalid commit cost: %+v", ops)
+	}
+	if ops[1].Op != OpGet || ops[1].NodesResolved != 1 || ops[1].PointsUpdated != 0 {
+		t.Fatalf("invalid read cost: %+v", ops[1])
+	}
+
+	if _, err := root.Delete(oneKeyTest, resolver); err != nil {
+		t.Fatal(err)
+	}
+	stems := report.Stems()
+	if len(stems) != 2 || !bytes.Equal(stems[0].Stem, zeroKeyTest[:StemSize]) || !bytes.Equal(stems[1].Stem, ffx32KeyTest[:StemSize]) {
+		t.Fatalf("invalid stems %+v", stems)
+	}
+	if stems[0].Operations != 1 || stems[0].PointsUpdated == 0 {
+		t.Fatalf("invalid deletion cost %+v", stems[0])
+	}
+}
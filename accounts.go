@@ -0,0 +1,398 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Tree layout of accounts, as specified by EIP-6800.
+const (
+	VersionLeafKey    = 0
+	BalanceLeafKey    = 1
+	NonceLeafKey      = 2
+	CodeKeccakLeafKey = CodeHashVectorPosition
+	CodeSizeLeafKey   = 4
+
+	HeaderStorageOffset = 64
+	CodeOffset          = 128
+)
+
+// MainStorageOffset is the position of the first storage slot that
+// doesn't fit in the account header, i.e. 256**31.
+var MainStorageOffset = new(big.Int).Lsh(big.NewInt(1), 8*StemSize)
+
+var (
+	treeIndexModulus = new(big.Int).Lsh(big.NewInt(1), 256)
+	headerSlots      = big.NewInt(CodeOffset - HeaderStorageOffset)
+	bigNodeWidth     = big.NewInt(NodeWidth)
+)
+
+// GetTreeKey returns the key of the value at subIndex, in the subtree of
+// the account at address indexed by treeIndex. address is either a
+// 20-byte address, or its 32-byte zero-padded form.
+func GetTreeKey(address []byte, treeIndex *big.Int, subIndex byte) ([]byte, error) {
+	var addr32 [32]byte
+	switch len(address) {
+	case 20:
+		copy(addr32[12:], address)
+	case 32:
+		copy(addr32[:], address)
+	default:
+		return nil, fmt.Errorf("invalid address length %d", len(address))
+	}
+	if treeIndex.Sign() < 0 || treeIndex.Cmp(treeIndexModulus) >= 0 {
+		return nil, fmt.Errorf("tree index %s out of range", treeIndex)
+	}
+
+	// The tree index is hashed in little-endian form
+	var index [32]byte
+	treeIndex.FillBytes(index[:])
+	for i := 0; i < len(index)/2; i++ {
+		index[i], index[len(index)-1-i] = index[len(index)-1-i], index[i]
+	}
+
+	// Pedersen hash of the 64-byte address || tree index, as a
+	// sequence of 16-byte little-endian integers prefixed with
+	// 2 + 256 * input length.
+	var poly [5]Fr
+	poly[0].SetUint64(2 + 256*64)
+	for i, chunk := range [][]byte{addr32[:16], addr32[16:], index[:16], index[16:]} {
+		if err := FromLEBytes(&poly[i+1], chunk); err != nil {
+			return nil, err
+		}
+	}
+	var hash Fr
+	GetConfig().CommitToPoly(poly[:], 0).MapToScalarField(&hash)
+
+	key := hash.BytesLE()
+	key[StemSize] = subIndex
+	return key[:], nil
+}
+
+func getHeaderKey(address []byte, subIndex byte) ([]byte, error) {
+	return GetTreeKey(address, new(big.Int), subIndex)
+}
+
+// GetTreeKeyCodeChunk returns the key of the code chunk chunkID of the
+// account at address.
+func GetTreeKeyCodeChunk(address []byte, chunkID uint64) ([]byte, error) {
+	pos := new(big.Int).SetUint64(chunkID)
+	pos.Add(pos, big.NewInt(CodeOffset))
+	return getTreeKeyAtPosition(address, pos)
+}
+
+// GetTreeKeyStorageSlot returns the key of the 32-byte big-endian storage
+// slot of the account at address.
+func GetTreeKeyStorageSlot(address []byte, slot []byte) ([]byte, error) {
+	if len(slot) > 32 {
+		return nil, fmt.Errorf("invalid storage slot length %d", len(slot))
+	}
+	pos := new(big.Int).SetBytes(slot)
+	if pos.Cmp(headerSlots) < 0 {
+		pos.Add(pos, big.NewInt(HeaderStorageOffset))
+	} else {
+		pos.Add(pos, MainStorageOffset)
+		pos.Mod(pos, treeIndexModulus)
+	}
+	return getTreeKeyAtPosition(address, pos)
+}
+
+func getTreeKeyAtPosition(address []byte, pos *big.Int) ([]byte, error) {
+	treeIndex, subIndex := new(big.Int).DivMod(pos, bigNodeWidth, new(big.Int))
+	return GetTreeKey(address, treeIndex, byte(subIndex.Uint64()))
+}
+
+// Accounts reads and writes account fields in a tree, hiding the key
+// derivation and value encodings of EIP-6800. Missing fields read as
+// zero.
+type Accounts struct {
+	root     VerkleNode
+	resolver NodeResolverFn
+}
+
+// NewAccounts returns an account view over root, resolving missing nodes
+// with resolver.
+func NewAccounts(root VerkleNode, resolver NodeResolverFn) *Accounts {
+	return &Accounts{root: root, resolver: resolver}
+}
+
+func (a *Accounts) get(key []byte, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	return a.root.Get(key, a.resolver)
+}
+
+func (a *Accounts) set(key []byte, value []byte) error {
+	return a.root.Insert(key, value, a.resolver)
+}
+
+// GetVersion returns the version of the account at address.
+func (a *Accounts) GetVersion(address []byte) (uint64, error) {
+	value, err := a.get(getHeaderKey(address, VersionLeafKey))
+	if err != nil {
+		return 0, err
+	}
+	return decodeLEUint64(value)
+}
+
+// SetVersion sets the version of the account at address.
+func (a *Accounts) SetVersion(address []byte, version uint64) error {
+	key, err := getHeaderKey(address, VersionLeafKey)
+	if err != nil {
+		return err
+	}
+	return a.set(key, encodeLEUint64(version))
+}
+
+// GetBalance returns the balance of the account at address.
+func (a *Accounts) GetBalance(address []byte) (*big.Int, error) {
+	value, err := a.get(getHeaderKey(address, BalanceLeafKey))
+	if err != nil {
+		return nil, err
+	}
+	return decodeLEBigInt(value)
+}
+
+// SetBalance sets the balance of the account at address. It must fit in
+// 256 bits.
+func (a *Accounts) SetBalance(address []byte, balance *big.Int) error {
+	value, err := encodeLEBigInt(balance)
+	if err != nil {
+		return err
+	}
+	key, err := getHeaderKey(address, BalanceLeafKey)
+	if err != nil {
+		return err
+	}
+	return a.set(key, value)
+}
+
+// GetNonce returns the nonce of the account at address.
+func (a *Accounts) GetNonce(address []byte) (uint64, error) {
+	value, err := a.get(getHeaderKey(address, NonceLeafKey))
+	if err != nil {
+		return 0, err
+	}
+	return decodeLEUint64(value)
+}
+
+// SetNonce sets the nonce of the account at address.
+func (a *Accounts) SetNonce(address []byte, nonce uint64) error {
+	key, err := getHeaderKey(address, NonceLeafKey)
+	if err != nil {
+		return err
+	}
+	return a.set(key, encodeLEUint64(nonce))
+}
+
+// GetCodeKeccak returns the hash of the code of the account at address,
+// or nil if it isn't set.
+func (a *Accounts) GetCodeKeccak(address []byte) ([]byte, error) {
+	return a.get(getHeaderKey(address, CodeKeccakLeafKey))
+}
+
+// SetCodeKeccak sets the hash of the code of the account at address.
+func (a *Accounts) SetCodeKeccak(address []byte, hash []byte) error {
+	if len(hash) != LeafValueSize {
+		return fmt.Errorf("invalid code hash length %d", len(hash))
+	}
+	key, err := getHeaderKey(address, CodeKeccakLeafKey)
+	if err != nil {
+		return err
+	}
+	return a.set(key, hash)
+}
+
+// GetCodeSize returns the size of the code of the account at address.
+func (a *Accounts) GetCodeSize(address []byte) (uint64, error) {
+	value, err := a.get(getHeaderKey(address, CodeSizeLeafKey))
+	if err != nil {
+		return 0, err
+	}
+	return decodeLEUint64(value)
+}
+
+// SetCodeSize sets the size of the code of the account at address.
+func (a *Accounts) SetCodeSize(address []byte, size uint64) error {
+	key, err := getHeaderKey(address, CodeSizeLeafKey)
+	if err != nil {
+		return err
+	}
+	return a.set(key, encodeLEUint64(size))
+}
+
+// GetCodeChunk returns the 32-byte code chunk chunkID of the account at
+// address, or nil if it isn't set.
+func (a *Accounts) GetCodeChunk(address []byte, chunkID uint64) ([]byte, error) {
+	return a.get(GetTreeKeyCodeChunk(address, chunkID))
+}
+
+// SetCodeChunk sets the 32-byte code chunk chunkID of the account at
+// address.
+func (a *Accounts) SetCodeChunk(address []byte, chunkID uint64, chunk []byte) error {
+	if len(chunk) != LeafValueSize {
+		return fmt.Errorf("invalid code chunk length %d", len(chunk))
+	}
+	key, err := GetTreeKeyCodeChunk(address, chunkID)
+	if err != nil {
+		return err
+	}
+	return a.set(key, chunk)
+}
+
+// GetStorage returns the value of a storage slot of the account at
+// address, or nil if it isn't set.
+func (a *Accounts) GetStorage(address []byte, slot []byte) ([]byte, error) {
+	return a.get(GetTreeKeyStorageSlot(address, slot))
+}
+
+// SetStorage sets the value of a storage slot of the account at address.
+func (a *Accounts) SetStorage(address []byte, slot []byte, value []byte) error {
+	if len(value) != LeafValueSize {
+		return fmt.Errorf("invalid storage value length %d", len(value))
+	}
+	key, err := GetTreeKeyStorageSlot(address, slot)
+	if err != nil {
+		return err
+	}
+	return a.set(key, value)
+}
+
+// Account is the header of an account, decoded from the leaves of its
+// header stem.
+type Account struct {
+	Stem     [StemSize]byte
+	Version  uint64
+	Balance  *big.Int
+	Nonce    uint64
+	CodeSize uint64
+	CodeHash []byte
+}
+
+// ForEach calls fn for each account of the tree, in increasing stem
+// order, until it returns false. The address of an account can't be
+// recovered from its stem, so account headers are recognized by their
+// version and code hash leaves, which are set when an account is created
+// and are never both set on a storage or code stem. Only the header
+// fields are decoded: the storage and code of an account can be read with
+// the other methods, once its address is known.
+func (a *Accounts) ForEach(fn func(*Account) bool) error {
+	root, ok := a.root.(*InternalNode)
+	if !ok {
+		return errors.New("accounts can only be iterated from an internal node")
+	}
+	var err error
+	visit := func(leaf *LeafNode) bool {
+		if leaf.isPOAStub {
+			err = fmt.Errorf("reading stem %x: %w", leaf.stem, ErrIsPOAStub)
+			return false
+		}
+		if leaf.values[VersionLeafKey] == nil || leaf.values[CodeKeccakLeafKey] == nil {
+			return true
+		}
+		var account *Account
+		if account, err = decodeAccount(leaf); err != nil {
+			err = fmt.Errorf("decoding account at stem %x: %w", leaf.stem, err)
+			return false
+		}
+		return fn(account)
+	}
+	if _, werr := root.walkStems(root.subtreePath(), nil, false, false, a.resolver, visit); werr != nil {
+		return werr
+	}
+	return err
+}
+
+func decodeAccount(leaf *LeafNode) (*Account, error) {
+	account := &Account{CodeHash: leaf.values[CodeKeccakLeafKey]}
+	copy(account.Stem[:], leaf.stem)
+	var err error
+	if account.Version, err = decodeLEUint64(leaf.values[VersionLeafKey]); err != nil {
+		return nil, fmt.Errorf("version: %w", err)
+	}
+	if account.Balance, err = decodeLEBigInt(leaf.values[BalanceLeafKey]); err != nil {
+		return nil, fmt.Errorf("balance: %w", err)
+	}
+	if account.Nonce, err = decodeLEUint64(leaf.values[NonceLeafKey]); err != nil {
+		return nil, fmt.Errorf("nonce: %w", err)
+	}
+	if account.CodeSize, err = decodeLEUint64(leaf.values[CodeSizeLeafKey]); err != nil {
+		return nil, fmt.Errorf("code size: %w", err)
+	}
+	return account, nil
+}
+
+func encodeLEUint64(v uint64) []byte {
+	value := make([]byte, LeafValueSize)
+	binary.LittleEndian.PutUint64(value, v)
+	return value
+}
+
+func decodeLEUint64(value []byte) (uint64, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+	if len(value) != LeafValueSize {
+		return 0, fmt.Errorf("invalid value length %d", len(value))
+	}
+	for _, b := range value[8:] {
+		if b != 0 {
+			return 0, fmt.Errorf("value %x overflows 64 bits", value)
+		}
+	}
+	return binary.LittleEndian.Uint64(value), nil
+}
+
+func encodeLEBigInt(v *big.Int) ([]byte, error) {
+	if v.Sign() < 0 || v.BitLen() > 8*LeafValueSize {
+		return nil, fmt.Errorf("value %s doesn't fit in %d unsigned bytes", v, LeafValueSize)
+	}
+	value := make([]byte, LeafValueSize)
+	v.FillBytes(value)
+	for i := 0; i < len(value)/2; i++ {
+		value[i], value[len(value)-1-i] = value[len(value)-1-i], value[i]
+	}
+	return value, nil
+}
+
+func decodeLEBigInt(value []byte) (*big.Int, error) {
+	if len(value) == 0 {
+		return new(big.Int), nil
+	}
+	if len(value) != LeafValueSize {
+		return nil, fmt.Errorf("invalid value length %d", len(value))
+	}
+	be := make([]byte, len(value))
+	for i := range value {
+		be[len(value)-1-i] = value[i]
+	}
+	return new(big.Int).SetBytes(be), nil
+}
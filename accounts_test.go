@@ -0,0 +1,197 @@
+package verkle
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+func TestAccountTreeKeys(t *testing.T) {
+	t.Parallel()
+
+	address := bytes.Repeat([]byte{0xaa}, 20)
+	padded := append(make([]byte, 12), address...)
+
+	balance, err := getHeaderKey(address, BalanceLeafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance[StemSize] != BalanceLeafKey {
+		t.Fatalf("invalid suffix %d", balance[StemSize])
+	}
+	if k, _ := getHeaderKey(padded, BalanceLeafKey); !bytes.Equal(k, balance) {
+		t.Fatal("padded address leads to a different key")
+	}
+	if k, _ := getHeaderKey(address, NonceLeafKey); !bytes.Equal(k[:StemSize], balance[:StemSize]) {
+		t.Fatal("header fields should share a stem")
+	}
+	if k, _ := getHeaderKey(bytes.Repeat([]byte{0xbb}, 20), BalanceLeafKey); bytes.Equal(k[:StemSize], balance[:StemSize]) {
+		t.Fatal("different accounts should have different stems")
+	}
+
+	// The first storage slots and code chunks are in the header
+	slot, err := GetTreeKeyStorageSlot(address, []byte{5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(slot[:StemSize], balance[:StemSize]) || slot[StemSize] != HeaderStorageOffset+5 {
+		t.Fatalf("invalid header storage key %x", slot)
+	}
+	chunk, err := GetTreeKeyCodeChunk(address, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chunk[:StemSize], balance[:StemSize]) || chunk[StemSize] != CodeOffset+3 {
+		t.Fatalf("invalid header code chunk key %x", chunk)
+	}
+
+	// ... and the other ones in their own subtrees
+	chunk, err = GetTreeKeyCodeChunk(address, 128+2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k, _ := GetTreeKey(address, big.NewInt(1), 2); !bytes.Equal(chunk, k) {
+		t.Fatalf("invalid code chunk key %x", chunk)
+	}
+	slot, err = GetTreeKeyStorageSlot(address, []byte{0x01, 0x03})
+	if err != nil {
+		t.Fatal(err)
+	}
+	treeIndex := new(big.Int).Add(new(big.Int).Div(MainStorageOffset, big.NewInt(NodeWidth)), big.NewInt(1))
+	if k, _ := GetTreeKey(address, treeIndex, 3); !bytes.Equal(slot, k) {
+		t.Fatalf("invalid storage key %x", slot)
+	}
+
+	if _, err := GetTreeKey(address[:19], new(big.Int), 0); err == nil {
+		t.Fatal("invalid address length should be rejected")
+	}
+}
+
+func TestAccountsAccessors(t *testing.T) {
+	t.Parallel()
+
+	address := bytes.Repeat([]byte{0xaa}, 20)
+	accounts := NewAccounts(New(), nil)
+
+	// Missing fields read as zero
+	if balance, err := accounts.GetBalance(address); err != nil || balance.Sign() != 0 {
+		t.Fatalf("invalid balance of a missing account: %v %v", balance, err)
+	}
+
+	balance, _ := new(big.Int).SetString("1000000000000000000000", 10)
+	if err := accounts.SetBalance(address, balance); err != nil {
+		t.Fatal(err)
+	}
+	if err := accounts.SetNonce(address, 42); err != nil {
+		t.Fatal(err)
+	}
+	if err := accounts.SetCodeSize(address, 100); err != nil {
+		t.Fatal(err)
+	}
+	code := bytes.Repeat([]byte{0x60}, 32)
+	if err := accounts.SetCodeChunk(address, 1, code); err != nil {
+		t.Fatal(err)
+	}
+	slot, value := []byte{0x12, 0x34}, bytes.Repeat([]byte{0x01}, 32)
+	if err := accounts.SetStorage(address, slot, value); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := accounts.GetBalance(address); err != nil || got.Cmp(balance) != 0 {
+		t.Fatalf("invalid balance %v: %v", got, err)
+	}
+	if got, err := accounts.GetNonce(address); err != nil || got != 42 {
+		t.Fatalf("invalid nonce %d: %v", got, err)
+	}
+	if got, err := accounts.GetCodeSize(address); err != nil || got != 100 {
+		t.Fatalf("invalid code size %d: %v", got, err)
+	}
+	if got, err := accounts.GetCodeChunk(address, 1); err != nil || !bytes.Equal(got, code) {
+		t.Fatalf("invalid code chunk %x: %v", got, err)
+	}
+	if got, err := accounts.GetStorage(address, slot); err != nil || !bytes.Equal(got, value) {
+		t.Fatalf("invalid storage value %x: %v", got, err)
+	}
+
+	// The balance is stored in little-endian form
+	key, _ := getHeaderKey(address, BalanceLeafKey)
+	raw, err := accounts.root.Get(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw[:10], []byte{0x00, 0x00, 0xa0, 0xde, 0xc5, 0xad, 0xc9, 0x35, 0x36, 0x00}) {
+		t.Fatalf("invalid balance encoding %x", raw)
+	}
+
+	if err := accounts.SetBalance(address, new(big.Int).Lsh(big.NewInt(1), 256)); err == nil {
+		t.Fatal("balance overflow should be rejected")
+	}
+	if err := accounts.SetStorage(address, slot, value[:31]); err == nil {
+		t.Fatal("short storage value should be rejected")
+	}
+}
+
+func TestAccountsForEach(t *testing.T) {
+	t.Parallel()
+
+	accounts := NewAccounts(New(), nil)
+	codeHash := bytes.Repeat([]byte{0xc5}, 32)
+	expected := map[[StemSize]byte]uint64{}
+	for i := byte(1); i <= 3; i++ {
+		address := bytes.Repeat([]byte{i}, 20)
+		if err := accounts.SetVersion(address, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := accounts.SetBalance(address, big.NewInt(int64(i)*1000)); err != nil {
+			t.Fatal(err)
+		}
+		if err := accounts.SetNonce(address, uint64(i)); err != nil {
+			t.Fatal(err)
+		}
+		if err := accounts.SetCodeKeccak(address, codeHash); err != nil {
+			t.Fatal(err)
+		}
+		if err := accounts.SetCodeSize(address, 10*uint64(i)); err != nil {
+			t.Fatal(err)
+		}
+		// Main storage lives in another stem
+		if err := accounts.SetStorage(address, bytes.Repeat([]byte{0xff}, 32), codeHash); err != nil {
+			t.Fatal(err)
+		}
+		key, _ := getHeaderKey(address, VersionLeafKey)
+		var stem [StemSize]byte
+		copy(stem[:], key)
+		expected[stem] = uint64(i)
+	}
+
+	var (
+		seen int
+		prev []byte
+	)
+	err := accounts.ForEach(func(account *Account) bool {
+		i, ok := expected[account.Stem]
+		if !ok {
+			t.Fatalf("unexpected account at stem %x", account.Stem)
+		}
+		if prev != nil && bytes.Compare(prev, account.Stem[:]) >= 0 {
+			t.Fatal("accounts aren't in increasing stem order")
+		}
+		prev = append([]byte{}, account.Stem[:]...)
+		if account.Nonce != i || account.CodeSize != 10*i || account.Balance.Int64() != int64(i)*1000 || !bytes.Equal(account.CodeHash, codeHash) {
+			t.Fatalf("invalid account %+v", account)
+		}
+		seen++
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != len(expected) {
+		t.Fatalf("found %d accounts, expected %d", seen, len(expected))
+	}
+
+	seen = 0
+	if err := accounts.ForEach(func(*Account) bool { seen++; return false }); err != nil || seen != 1 {
+		t.Fatalf("iteration didn't stop: %d accounts, %v", seen, err)
+	}
+}
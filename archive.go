@@ -0,0 +1,205 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/crate-crypto/go-ipa/banderwagon"
+)
+
+// archivedInternalSize is the size of the serialized internal node at the
+// start of an archived internal node record, which is followed by the
+// compressed commitments of its non-empty children.
+const archivedInternalSize = nodeTypeSize + bitlistSize + banderwagon.UncompressedSize
+
+// ArchiveTree stores the nodes of the committed tree root in store, keyed
+// by their compressed commitment, so that proofs can later be made against
+// root with ProveAtRoot, even once the tree has moved on. Keys are 32 bytes
+// long, so they can't collide with node paths. Internal nodes are stored
+// along with the commitments of their children, which is what lets
+// ProveAtRoot only load the nodes along the proven paths.
+//
+// Subtrees that aren't in memory are expected to have been archived when
+// they were last modified, and aren't written again: the resolver is only
+// used to read their commitment.
+func ArchiveTree(store NodeStore, root VerkleNode, resolver NodeResolverFn) error {
+	if _, err := commitTree(root); err != nil {
+		return err
+	}
+	return archiveNode(store, root, nil, resolver)
+}
+
+func archiveNode(store NodeStore, node VerkleNode, path []byte, resolver NodeResolverFn) error {
+	switch n := node.(type) {
+	case *InternalNode:
+		record, err := n.Serialize()
+		if err != nil {
+			return err
+		}
+		for i, child := range n.children {
+			childpath := append(append([]byte{}, path...), byte(i))
+			var comm *Point
+			switch c := child.(type) {
+			case Empty:
+				continue
+			case HashedNode:
+				if resolver == nil {
+					return fmt.Errorf("no resolver for path %x: %w", childpath, ErrReadFromInvalid)
+				}
+				serialized, err := resolveNode(resolver, childpath)
+				if err != nil {
+					return err
+				}
+				resolved, err := n.parseChild(byte(i), serialized, childpath)
+				if err != nil {
+					return err
+				}
+				comm = resolved.Commitment()
+			default:
+				if err := archiveNode(store, c, childpath, resolver); err != nil {
+					return err
+				}
+				comm = c.Commitment()
+			}
+			compressed := comm.Bytes()
+			record = append(record, compressed[:]...)
+		}
+		key := n.commitment.Bytes()
+		return store.Put(key[:], record)
+	case *LeafNode:
+		record, err := n.Serialize()
+		if err != nil {
+			return err
+		}
+		key := n.commitment.Bytes()
+		return store.Put(key[:], record)
+	default:
+		return fmt.Errorf("can not archive node of type %T at path %x", node, path)
+	}
+}
+
+// ProveAtRoot makes a proof of keys in the tree of root commitment root,
+// as archived in store by ArchiveTree. Only the nodes along the paths of
+// keys are loaded, the other nodes being represented by their commitment.
+func ProveAtRoot(store NodeStore, root [32]byte, keys [][]byte) (*Proof, []*Point, []byte, []*Fr, error) {
+	if len(keys) == 0 {
+		return nil, nil, nil, nil, errors.New("no key provided for proof")
+	}
+	rootC, err := RootFromBytes(root)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	node, err := loadArchivedNode(store, rootC, 0, nil)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	tree, ok := node.(*InternalNode)
+	if !ok {
+		return nil, nil, nil, nil, fmt.Errorf("archived root %x isn't an internal node", root)
+	}
+
+	sort.Sort(keylist(keys))
+	if err := tree.loadArchivedPaths(store, keys); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return MakeVerkleMultiProof(tree, nil, keys, nil)
+}
+
+// loadArchivedPaths replaces the children of n along the paths of keys,
+// which are sorted, with the nodes archived in store.
+func (n *InternalNode) loadArchivedPaths(store NodeStore, keys keylist) error {
+	for _, group := range groupKeys(keys, n.depth) {
+		idx := offset2key(group[0], n.depth)
+		if _, ok := n.children[idx].(Empty); ok {
+			continue
+		}
+		child, err := loadArchivedNode(store, n.children[idx].Commitment(), n.depth+1, group[0][:n.depth+1])
+		if err != nil {
+			return err
+		}
+		n.children[idx] = child
+		if in, ok := child.(*InternalNode); ok {
+			if err := in.loadArchivedPaths(store, group); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadArchivedNode reads the node of commitment comm, at the given depth
+// and path, from store. The children of an internal node are stateless
+// nodes only holding their commitment.
+func loadArchivedNode(store NodeStore, comm *Point, depth byte, path []byte) (VerkleNode, error) {
+	key := comm.Bytes()
+	record, err := store.Get(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("reading archived node %x at path %x: %w", key, path, err)
+	}
+	var node VerkleNode
+	if len(record) > archivedInternalSize && record[0] == internalRLPType {
+		node, err = parseArchivedInternalNode(record, depth, path)
+	} else {
+		node, err = parseResolvedNode(nil, record, depth, path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !node.Commitment().Equal(comm) {
+		return nil, fmt.Errorf("archived node at path %x doesn't match its commitment %x", path, key)
+	}
+	return node, nil
+}
+
+func parseArchivedInternalNode(record []byte, depth byte, path []byte) (VerkleNode, error) {
+	node, err := parseResolvedNode(nil, record[:archivedInternalSize], depth, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	n := node.(*InternalNode)
+	comms := record[archivedInternalSize:]
+	for i, child := range n.children {
+		if _, ok := child.(HashedNode); !ok {
+			continue
+		}
+		if len(comms) < banderwagon.CompressedSize {
+			return nil, fmt.Errorf("archived node at path %x is missing child commitments: %w", path, errSerializedPayloadTooShort)
+		}
+		var comm Point
+		if err := comm.SetBytes(comms[:banderwagon.CompressedSize]); err != nil {
+			return nil, fmt.Errorf("invalid commitment of child %d of archived node at path %x: %w", i, path, err)
+		}
+		n.children[i] = NewStatelessInternal(depth+1, &comm)
+		comms = comms[banderwagon.CompressedSize:]
+	}
+	if len(comms) != 0 {
+		return nil, fmt.Errorf("archived node at path %x has %d extra bytes: %w", path, len(comms), ErrInvalidNodeEncoding)
+	}
+	return n, nil
+}
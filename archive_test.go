@@ -0,0 +1,108 @@
+package verkle
+
+import (
+	"bytes"
+	"crypto/rand"
+	"reflect"
+	"testing"
+)
+
+type countingStore struct {
+	NodeStore
+	gets int
+}
+
+func (s *countingStore) Get(key []byte) ([]byte, error) {
+	s.gets++
+	return s.NodeStore.Get(key)
+}
+
+func TestProveAtRoot(t *testing.T) {
+	t.Parallel()
+
+	archive := &countingStore{NodeStore: NewMemoryStore()}
+	db := map[string][]byte{}
+	flush := func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = s
+	}
+	resolver := func(path []byte) ([]byte, error) {
+		return db[string(path)], nil
+	}
+
+	root := New()
+	keys := make([][]byte, 200)
+	for i := range keys {
+		keys[i] = make([]byte, 32)
+		if _, err := rand.Read(keys[i]); err != nil {
+			t.Fatal(err)
+		}
+		if err := root.Insert(keys[i], fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root.Commit()
+	if err := ArchiveTree(archive, root, nil); err != nil {
+		t.Fatal(err)
+	}
+	historical := root.Copy()
+	oldRoot := root.Commitment().Bytes()
+	root.(*InternalNode).Flush(flush)
+
+	// Move the tree on, with most of it only available in the database
+	for _, key := range keys[:10] {
+		if err := root.Insert(key, zeroKeyTest, resolver); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ArchiveTree(archive, root, resolver); err != nil {
+		t.Fatal(err)
+	}
+	newRoot := root.Commitment().Bytes()
+
+	proven := [][]byte{keys[0], keys[5], keys[100], ffx32KeyTest}
+	archive.gets = 0
+	proof, _, _, _, err := ProveAtRoot(archive, oldRoot, append([][]byte{}, proven...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.gets > len(proven)*4 {
+		t.Fatalf("%d nodes read from the archive to prove %d keys", archive.gets, len(proven))
+	}
+	expected, _, _, _, err := MakeVerkleMultiProof(historical, nil, append([][]byte{}, proven...), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evp, esd, err := SerializeProof(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vp, evp) || !reflect.DeepEqual(sd, esd) {
+		t.Fatal("proof against the archived root differs from the one made from the tree")
+	}
+
+	proof, _, _, _, err = ProveAtRoot(archive, newRoot, [][]byte{keys[5]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(proof.PreValues[0], zeroKeyTest) {
+		t.Fatalf("invalid value at the new root %x", proof.PreValues[0])
+	}
+
+	var unknown [32]byte
+	copy(unknown[:], oldRoot[:])
+	unknown[0] ^= 1
+	if _, _, _, _, err := ProveAtRoot(archive, newRoot, nil); err == nil {
+		t.Fatal("proving no key should fail")
+	}
+	if _, _, _, _, err := ProveAtRoot(archive, unknown, [][]byte{keys[0]}); err == nil {
+		t.Fatal("proving against an unknown root should fail")
+	}
+}
@@ -0,0 +1,150 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
+)
+
+// Names of the metrics reported by the audit mode, see SetAuditRate.
+const (
+	MetricAuditChecks   = "verkle/audit/checks"   // counter: incremental updates cross-checked
+	MetricAuditFailures = "verkle/audit/failures" // counter: incremental updates that didn't match
+)
+
+// SetAuditRate enables the audit mode, in which incremental commitment
+// updates are cross-checked against a full recomputation of the updated
+// node: leaves are recomputed from their values when they are written
+// to, and internal nodes from the commitments of their children when
+// they are committed. rate is the fraction of the updates that are
+// checked, between 0 (the default, which disables the audit mode) and 1.
+//
+// Mismatches are logged and reported through MetricAuditFailures, but
+// don't interrupt the operation, so that the mode can be used on
+// production canaries. The commitments of unresolved children aren't
+// available, so internal nodes that have some, as is common in trees
+// backed by a database or rebuilt from a proof, are only checked against their previous
+// commitment updated with the children that changed. Leaves that only
+// hold some of their values, e.g. rebuilt from a proof, aren't checked.
+func (conf *IPAConfig) SetAuditRate(rate float64) {
+	if rate < 0 || math.IsNaN(rate) {
+		rate = 0
+	}
+	if rate > 1 {
+		rate = 1
+	}
+	atomic.StoreUint64(&conf.auditRate, math.Float64bits(rate))
+}
+
+// AuditRate returns the fraction of the incremental commitment updates
+// that are cross-checked, see SetAuditRate.
+func (conf *IPAConfig) AuditRate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&conf.auditRate))
+}
+
+// WithAuditRate sets the fraction of the incremental commitment updates
+// that are cross-checked, see SetAuditRate.
+func WithAuditRate(rate float64) Option {
+	return func(conf *IPAConfig) error {
+		if rate < 0 || rate > 1 || math.IsNaN(rate) {
+			return fmt.Errorf("invalid audit rate %v", rate)
+		}
+		conf.SetAuditRate(rate)
+		return nil
+	}
+}
+
+// sampleAudit decides whether the current update should be audited.
+func (conf *IPAConfig) sampleAudit() bool {
+	rate := conf.AuditRate()
+	return rate > 0 && (rate >= 1 || rand.Float64() < rate)
+}
+
+// auditLeaf cross-checks the commitments of a leaf that has just been
+// updated incrementally.
+func auditLeaf(n *LeafNode) {
+	if n.isPOAStub || n.isPartial || !n.config().sampleAudit() {
+		return
+	}
+	reportAudit(checkNodeCommitment(n), "stem", hexBytes(n.stem))
+}
+
+// auditInternalNode cross-checks the commitment of an internal node that
+// has just been committed incrementally, from prev, its commitment
+// before the update, and cow, the previous commitments of the children
+// that changed. The children must have been committed already. Whether
+// the update is audited is decided by the caller, with sampleAudit,
+// before prev and cow are lost.
+func auditInternalNode(n *InternalNode, prev *Point, cow map[byte]*Point) {
+	var (
+		poly     [NodeWidth]Fr
+		resolved = true
+	)
+	for i, child := range n.children {
+		switch c := child.(type) {
+		case Empty:
+		case HashedNode, UnknownNode:
+			resolved = false
+		default:
+			c.Commitment().MapToScalarField(&poly[i])
+		}
+	}
+	var (
+		expected *Point
+		what     string
+	)
+	if resolved {
+		expected, what = n.config().CommitToPoly(poly[:], 0), "the children commitments"
+	} else {
+		// The commitments of the other children aren't available,
+		// so only check the update applied to the previous commitment.
+		var diff [NodeWidth]Fr
+		for idx, old := range cow {
+			var before Fr
+			old.MapToScalarField(&before)
+			diff[idx].Sub(&poly[idx], &before)
+		}
+		expected = new(Point).Add(prev, n.config().CommitToPoly(diff[:], 0))
+		what = "the update of the children commitments"
+	}
+	var err error
+	if !expected.Equal(n.commitment) {
+		err = fmt.Errorf("commitment does not match %s", what)
+	}
+	reportAudit(err, "depth", n.depth)
+}
+
+func reportAudit(err error, ctx ...interface{}) {
+	m := getMetrics()
+	m.IncCounter(MetricAuditChecks, 1)
+	if err != nil {
+		m.IncCounter(MetricAuditFailures, 1)
+		getLogger().Error("Incremental commitment update mismatch", append(ctx, "err", err)...)
+	}
+}
@@ -0,0 +1,184 @@
+package verkle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAuditMode(t *testing.T) {
+	m := newRecordingMetrics()
+	SetMetrics(m)
+	defer SetMetrics(nil)
+	GetConfig().SetAuditRate(1)
+	defer GetConfig().SetAuditRate(0)
+
+	root := New()
+	for _, key := range [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest} {
+		if err := root.Insert(key, testValue, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root.Commit()
+	if _, err := root.Delete(oneKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	if m.counters[MetricAuditChecks] == 0 {
+		t.Fatal("no update was audited")
+	}
+	if m.counters[MetricAuditFailures] != 0 {
+		t.Fatalf("%d audit failures on a correct tree", m.counters[MetricAuditFailures])
+	}
+
+	// Corrupt C1 behind the back of the leaf: the next incremental
+	// update starts from a wrong value.
+	leaf := root.(*InternalNode).children[0].(*LeafNode)
+	leaf.c1.Add(leaf.c1, leaf.c1)
+	if err := root.Insert(oneKeyTest, testValue, nil); err != nil {
+		t.Fatal(err)
+	}
+	if m.counters[MetricAuditFailures] != 1 {
+		t.Fatalf("leaf mismatch wasn't caught, %d failures", m.counters[MetricAuditFailures])
+	}
+
+	// Same thing with the commitment of the root
+	internal := root.(*InternalNode)
+	root.Commit()
+	internal.commitment.Add(internal.commitment, internal.commitment)
+	if err := root.Insert(forkOneKeyTest, testValue, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	if m.counters[MetricAuditFailures] < 2 {
+		t.Fatal("internal node mismatch wasn't caught")
+	}
+
+	GetConfig().SetAuditRate(0)
+	checks := m.counters[MetricAuditChecks]
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	if m.counters[MetricAuditChecks] != checks {
+		t.Fatal("updates were audited with the audit mode disabled")
+	}
+
+	if _, err := NewConfig(WithAuditRate(2)); err == nil {
+		t.Fatal("invalid audit rate was accepted")
+	}
+}
+
+func TestAuditPartialLeaves(t *testing.T) {
+	m := newRecordingMetrics()
+	SetMetrics(m)
+	defer SetMetrics(nil)
+	GetConfig().SetAuditRate(1)
+	defer GetConfig().SetAuditRate(0)
+
+	root := New()
+	for _, key := range [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest} {
+		if err := root.Insert(key, testValue, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rootC := root.Commit()
+	post := root.Copy()
+	if err := post.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	post.Commit()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, post, [][]byte{zeroKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dproof, err := DeserializeProof(vp, sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pre, err := PreStateTreeFromProof(dproof, rootC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The leaf of the proof only holds the proven value, from which its
+	// commitments can't be recomputed.
+	postroot, err := PostStateTreeFromStateDiff(pre, sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !postroot.Commitment().Equal(post.Commitment()) {
+		t.Fatal("invalid post-state root")
+	}
+	if m.counters[MetricAuditFailures] != 0 {
+		t.Fatalf("%d audit failures on a partial tree", m.counters[MetricAuditFailures])
+	}
+}
+
+func TestAuditUnresolvedChildren(t *testing.T) {
+	m := newRecordingMetrics()
+	SetMetrics(m)
+	defer SetMetrics(nil)
+
+	root := New()
+	for _, key := range [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest} {
+		if err := root.Insert(key, testValue, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root.Commit()
+	db := map[string][]byte{}
+	root.(*InternalNode).Flush(func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = s
+	})
+	resolver := func(path []byte) ([]byte, error) {
+		if s, ok := db[string(path)]; ok {
+			return s, nil
+		}
+		return nil, errors.New("not found")
+	}
+	reloaded, err := ParseNode(db[""], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the first child of the root is resolved
+	GetConfig().SetAuditRate(1)
+	defer GetConfig().SetAuditRate(0)
+	if err := reloaded.Insert(oneKeyTest, fourtyKeyTest, resolver); err != nil {
+		t.Fatal(err)
+	}
+	reloaded.Commit()
+	if m.counters[MetricAuditChecks] != 2 {
+		t.Fatalf("%d updates audited, expected the leaf and the root", m.counters[MetricAuditChecks])
+	}
+	if m.counters[MetricAuditFailures] != 0 {
+		t.Fatalf("%d audit failures on a correct tree", m.counters[MetricAuditFailures])
+	}
+
+	// The update of the root is checked, but not the commitment it
+	// started from.
+	internal := reloaded.(*InternalNode)
+	if err := reloaded.Insert(oneKeyTest, testValue, resolver); err != nil {
+		t.Fatal(err)
+	}
+	prev := new(Point).Set(internal.commitment)
+	cow := map[byte]*Point{0: new(Point).Set(internal.cow[0])}
+	reloaded.Commit()
+	checks := m.counters[MetricAuditChecks]
+	auditInternalNode(internal, prev, cow)
+	if m.counters[MetricAuditChecks] != checks+1 || m.counters[MetricAuditFailures] != 0 {
+		t.Fatal("correct update wasn't audited")
+	}
+	auditInternalNode(internal, prev, map[byte]*Point{0: new(Point).Set(prev)})
+	if m.counters[MetricAuditFailures] != 1 {
+		t.Fatal("update from a wrong child commitment wasn't caught")
+	}
+}
@@ -0,0 +1,184 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"container/list"
+	"sync"
+)
+
+// NodeCache caches serialized nodes between the tree and its backing
+// store. It is made of two generations: nodes near the root, which are
+// touched by every operation, are pinned and never evicted, while deeper
+// nodes are kept in a LRU cache.
+type NodeCache struct {
+	lock sync.Mutex
+
+	// Near-root generation: nodes whose path is at most pinnedLevels
+	// bytes long. Once pinnedSize entries are stored, extra near-root
+	// nodes are stored in the LRU generation.
+	pinnedLevels int
+	pinnedSize   int
+	pinned       map[string][]byte
+
+	// Deep generation
+	lruSize int
+	lru     *list.List
+	entries map[string]*list.Element
+
+	hits, misses uint64
+}
+
+type nodeCacheEntry struct {
+	path       string
+	serialized []byte
+}
+
+// NodeCacheStats reports the occupancy and efficiency of a NodeCache.
+type NodeCacheStats struct {
+	Pinned, PinnedCapacity int
+	LRU, LRUCapacity       int
+	Hits, Misses           uint64
+}
+
+// NewNodeCache creates a cache pinning up to pinnedSize nodes from the
+// first pinnedLevels levels of the tree (the root being at level 0), and
+// storing up to lruSize other nodes.
+func NewNodeCache(pinnedLevels, pinnedSize, lruSize int) *NodeCache {
+	return &NodeCache{
+		pinnedLevels: pinnedLevels,
+		pinnedSize:   pinnedSize,
+		pinned:       make(map[string][]byte),
+		lruSize:      lruSize,
+		lru:          list.New(),
+		entries:      make(map[string]*list.Element),
+	}
+}
+
+// Get returns the serialized node at the given path, if it's in the cache.
+func (c *NodeCache) Get(path []byte) ([]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if serialized, ok := c.pinned[string(path)]; ok {
+		c.hits++
+		return serialized, true
+	}
+	if elem, ok := c.entries[string(path)]; ok {
+		c.lru.MoveToFront(elem)
+		c.hits++
+		return elem.Value.(*nodeCacheEntry).serialized, true
+	}
+	c.misses++
+	return nil, false
+}
+
+// Put adds or replaces the serialized node at the given path.
+func (c *NodeCache) Put(path []byte, serialized []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := string(path)
+	if len(path) <= c.pinnedLevels {
+		if _, ok := c.pinned[key]; ok || len(c.pinned) < c.pinnedSize {
+			c.pinned[key] = serialized
+			return
+		}
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*nodeCacheEntry).serialized = serialized
+		c.lru.MoveToFront(elem)
+		return
+	}
+	if c.lruSize <= 0 {
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&nodeCacheEntry{path: key, serialized: serialized})
+	for c.lru.Len() > c.lruSize {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*nodeCacheEntry).path)
+	}
+}
+
+// Invalidate removes the node at the given path from both generations.
+func (c *NodeCache) Invalidate(path []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.pinned, string(path))
+	if elem, ok := c.entries[string(path)]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, string(path))
+	}
+}
+
+// Stats returns a snapshot of the cache statistics.
+func (c *NodeCache) Stats() NodeCacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return NodeCacheStats{
+		Pinned:         len(c.pinned),
+		PinnedCapacity: c.pinnedSize,
+		LRU:            c.lru.Len(),
+		LRUCapacity:    c.lruSize,
+		Hits:           c.hits,
+		Misses:         c.misses,
+	}
+}
+
+// Resolver wraps a resolver so that it is only called on a cache miss,
+// and its results are stored in the cache.
+func (c *NodeCache) Resolver(resolver NodeResolverFn) NodeResolverFn {
+	return func(path []byte) ([]byte, error) {
+		if serialized, ok := c.Get(path); ok {
+			getMetrics().IncCounter(MetricNodeCacheHits, 1)
+			return serialized, nil
+		}
+		getMetrics().IncCounter(MetricNodeCacheMisses, 1)
+		serialized, err := resolver(path)
+		if err != nil {
+			return nil, err
+		}
+		c.Put(path, serialized)
+
+		stats := c.Stats()
+		getMetrics().UpdateGauge(MetricNodeCachePinned, int64(stats.Pinned))
+		getMetrics().UpdateGauge(MetricNodeCacheLRU, int64(stats.LRU))
+		return serialized, nil
+	}
+}
+
+// FlushFn wraps a flush function so that the cached version of each
+// flushed node is dropped, since it is now stale.
+func (c *NodeCache) FlushFn(flush NodeFlushFn) NodeFlushFn {
+	return func(path []byte, node VerkleNode) {
+		c.Invalidate(path)
+		flush(path, node)
+	}
+}
@@ -0,0 +1,85 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestNodeCacheGenerations(t *testing.T) {
+	t.Parallel()
+
+	c := NewNodeCache(1, 2, 2)
+	c.Put(nil, []byte{0})
+	c.Put([]byte{1}, []byte{1})
+	// The pinned generation is full, this goes to the LRU
+	c.Put([]byte{2}, []byte{2})
+	c.Put([]byte{1, 1}, []byte{3})
+	// This evicts path 02, but not the pinned entries
+	c.Put([]byte{1, 2}, []byte{4})
+
+	if _, ok := c.Get([]byte{2}); ok {
+		t.Fatal("oldest LRU entry should have been evicted")
+	}
+	for _, path := range [][]byte{nil, {1}, {1, 1}, {1, 2}} {
+		if _, ok := c.Get(path); !ok {
+			t.Fatalf("path %x should be in the cache", path)
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Pinned != 2 || stats.LRU != 2 {
+		t.Fatalf("invalid occupancy: %d pinned, %d in LRU", stats.Pinned, stats.LRU)
+	}
+	if stats.Hits != 4 || stats.Misses != 1 {
+		t.Fatalf("invalid hit/miss count: %d/%d", stats.Hits, stats.Misses)
+	}
+
+	c.Invalidate([]byte{1})
+	if _, ok := c.Get([]byte{1}); ok {
+		t.Fatal("invalidated entry should not be in the cache")
+	}
+}
+
+func TestNodeCacheResolver(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewNodeCache(1, 16, 16)
+	db := map[string][]byte{}
+	root.(*InternalNode).Flush(cache.FlushFn(func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = s
+	}))
+
+	var count int
+	resolver := cache.Resolver(func(path []byte) ([]byte, error) {
+		count++
+		if s, ok := db[string(path)]; ok {
+			return s, nil
+		}
+		return nil, errors.New("not found")
+	})
+	for i := 0; i < 3; i++ {
+		// Use a fresh copy of the tree to force a resolution
+		val, err := root.Copy().Get(zeroKeyTest, resolver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(val, fourtyKeyTest) {
+			t.Fatalf("invalid value %x", val)
+		}
+	}
+	if count != 1 {
+		t.Fatalf("backing store was accessed %d times", count)
+	}
+}
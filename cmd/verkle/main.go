@@ -0,0 +1,463 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+// Command verkle is a small tool to build, prove and inspect verkle
+// trees from the command line.
+//
+// Usage:
+//
+//	verkle build  -in <file>                        print the root commitment of the tree
+//	verkle get    -in <file> -keys <k1,k2,...>      print the values of the given keys
+//	verkle prove  -in <file> -keys <k1,k2,...>      produce a proof for the given keys
+//	verkle verify -proof <file> [-root <hex>]       verify a proof against a root commitment
+//	verkle stats  -in <file>                        dump statistics about the tree
+//	verkle bench  -leaves <n> [-out <file>]         measure insert, commit, prove and verify throughput
+//	verkle soak   -duration <d>                     run randomized cycles with periodic integrity checks
+//
+// Key-value files are either a JSON object mapping hex keys to hex values, or
+// a CSV file with one "key,value" pair per line. The format is inferred from
+// the extension, unless -format is specified.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gballet/go-verkle"
+	"github.com/gballet/go-verkle/testutil"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, out io.Writer) error
+}
+
+var commands = []command{
+	{"build", "build a tree from a key-value file and print its root commitment", runBuild},
+	{"get", "print the values of a set of keys", runGet},
+	{"prove", "produce a proof for a set of keys", runProve},
+	{"verify", "verify a serialized proof against a root commitment", runVerify},
+	{"stats", "dump statistics about a tree built from a key-value file", runStats},
+	{"bench", "benchmark a random tree and print a JSON report", runBench},
+	{"soak", "run a soak test, printing progress as JSON lines", runSoak},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [arguments]\n\ncommands:\n", filepath.Base(os.Args[0]))
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:], os.Stdout); err != nil {
+				if errors.Is(err, flag.ErrHelp) {
+					os.Exit(2)
+				}
+				fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(2)
+}
+
+// proofFile is the format in which proofs are written by the prove
+// command, and read by the verify command.
+type proofFile struct {
+	Root      string              `json:"root"`
+	Proof     *verkle.VerkleProof `json:"verkleProof"`
+	StateDiff verkle.StateDiff    `json:"stateDiff"`
+}
+
+func runBuild(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	in := fs.String("in", "", "key-value file")
+	format := fs.String("format", "", "format of the key-value file: json or csv")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := buildTree(*in, *format)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%x\n", root.Commit().Bytes())
+	return nil
+}
+
+func runGet(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	in := fs.String("in", "", "key-value file")
+	format := fs.String("format", "", "format of the key-value file: json or csv")
+	keyList := fs.String("keys", "", "comma-separated list of hex keys to look up")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := buildTree(*in, *format)
+	if err != nil {
+		return err
+	}
+	keys, err := parseKeys(*keyList)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		value, err := root.Get(key, nil)
+		if err != nil {
+			return fmt.Errorf("getting key %x: %w", key, err)
+		}
+		if value == nil {
+			fmt.Fprintf(out, "%x: absent\n", key)
+			continue
+		}
+		fmt.Fprintf(out, "%x: %x\n", key, value)
+	}
+	return nil
+}
+
+func runProve(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("prove", flag.ContinueOnError)
+	in := fs.String("in", "", "key-value file")
+	format := fs.String("format", "", "format of the key-value file: json or csv")
+	keyList := fs.String("keys", "", "comma-separated list of hex keys to prove")
+	outPath := fs.String("out", "", "output file, defaults to stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := buildTree(*in, *format)
+	if err != nil {
+		return err
+	}
+	keys, err := parseKeys(*keyList)
+	if err != nil {
+		return err
+	}
+
+	rootC := root.Commit()
+	proof, _, _, _, err := verkle.MakeVerkleMultiProof(root, nil, keys, nil)
+	if err != nil {
+		return fmt.Errorf("creating proof: %w", err)
+	}
+	vp, sd, err := verkle.SerializeProof(proof)
+	if err != nil {
+		return fmt.Errorf("serializing proof: %w", err)
+	}
+	rootBytes := rootC.Bytes()
+	encoded, err := json.MarshalIndent(proofFile{
+		Root:      verkle.HexToPrefixedString(rootBytes[:]),
+		Proof:     vp,
+		StateDiff: sd,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *outPath == "" {
+		fmt.Fprintln(out, string(encoded))
+		return nil
+	}
+	return os.WriteFile(*outPath, encoded, 0o600)
+}
+
+func runVerify(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	proofPath := fs.String("proof", "", "proof file, as produced by the prove command")
+	rootHex := fs.String("root", "", "trusted root commitment, defaults to the one in the proof file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(*proofPath)
+	if err != nil {
+		return err
+	}
+	var pf proofFile
+	if err := json.Unmarshal(data, &pf); err != nil {
+		return fmt.Errorf("decoding proof file: %w", err)
+	}
+	if pf.Proof == nil {
+		return errors.New("proof file contains no proof")
+	}
+	if *rootHex == "" {
+		*rootHex = pf.Root
+	}
+	rootBytes, err := verkle.PrefixedHexStringToBytes(*rootHex)
+	if err != nil {
+		return fmt.Errorf("invalid root: %w", err)
+	}
+	if err := verkle.VerifySerializedProof(pf.Proof, pf.StateDiff, rootBytes); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "proof is valid")
+	return nil
+}
+
+type treeStats struct {
+	internalNodes int
+	leafNodes     int
+	values        int
+	maxDepth      int
+	leavesByDepth map[int]int
+}
+
+func (s *treeStats) walk(node verkle.VerkleNode, depth int) {
+	switch n := node.(type) {
+	case *verkle.InternalNode:
+		s.internalNodes++
+		for _, child := range n.Children() {
+			s.walk(child, depth+1)
+		}
+	case *verkle.LeafNode:
+		s.leafNodes++
+		s.leavesByDepth[depth]++
+		if depth > s.maxDepth {
+			s.maxDepth = depth
+		}
+		for _, v := range n.Values() {
+			if v != nil {
+				s.values++
+			}
+		}
+	}
+}
+
+func runStats(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	in := fs.String("in", "", "key-value file")
+	format := fs.String("format", "", "format of the key-value file: json or csv")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := buildTree(*in, *format)
+	if err != nil {
+		return err
+	}
+	stats := treeStats{leavesByDepth: map[int]int{}}
+	stats.walk(root, 0)
+
+	fmt.Fprintf(out, "root commitment: %x\n", root.Commit().Bytes())
+	fmt.Fprintf(out, "internal nodes:  %d\n", stats.internalNodes)
+	fmt.Fprintf(out, "leaf nodes:      %d\n", stats.leafNodes)
+	fmt.Fprintf(out, "values:          %d\n", stats.values)
+	fmt.Fprintf(out, "max leaf depth:  %d\n", stats.maxDepth)
+	for depth := 1; depth <= stats.maxDepth; depth++ {
+		fmt.Fprintf(out, "  leaves at depth %d: %d\n", depth, stats.leavesByDepth[depth])
+	}
+	return nil
+}
+
+var valueDistributions = map[string]testutil.ValueDistribution{
+	"random": testutil.RandomValues,
+	"small":  testutil.SmallValues,
+	"zero":   testutil.ZeroValues,
+	"mixed":  testutil.MixedValues,
+}
+
+func runBench(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	seed := fs.Int64("seed", 0, "seed of the random tree")
+	leaves := fs.Int("leaves", 10000, "number of distinct stems in the tree")
+	valuesPerLeaf := fs.Int("values-per-leaf", 1, "number of values written at each stem")
+	clusterSize := fs.Int("cluster-size", 0, "number of consecutive stems sharing a common prefix")
+	clusterPrefixLen := fs.Int("cluster-prefix-len", 2, "length of the prefix shared by clustered stems")
+	values := fs.String("values", "random", "value distribution: random, small, zero or mixed")
+	proofs := fs.Int("proofs", 10, "number of proofs to produce and verify")
+	proofKeys := fs.Int("proof-keys", 100, "number of keys in each proof")
+	outPath := fs.String("out", "", "output file, defaults to stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dist, ok := valueDistributions[*values]
+	if !ok {
+		return fmt.Errorf("unsupported value distribution %q", *values)
+	}
+	report, err := testutil.RunBenchmark(testutil.BenchmarkConfig{
+		Tree: testutil.TreeConfig{
+			Seed:             *seed,
+			Leaves:           *leaves,
+			ValuesPerLeaf:    *valuesPerLeaf,
+			ClusterSize:      *clusterSize,
+			ClusterPrefixLen: *clusterPrefixLen,
+			Values:           dist,
+		},
+		Proofs:    *proofs,
+		ProofKeys: *proofKeys,
+	})
+	if err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *outPath == "" {
+		fmt.Fprintln(out, string(encoded))
+		return nil
+	}
+	return os.WriteFile(*outPath, encoded, 0o600)
+}
+
+func runSoak(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("soak", flag.ContinueOnError)
+	seed := fs.Int64("seed", time.Now().UnixNano(), "seed of the random operations")
+	duration := fs.Duration("duration", time.Hour, "duration of the test")
+	cycles := fs.Int("cycles", 0, "maximum number of cycles, 0 for no limit")
+	ops := fs.Int("ops", 100, "number of writes per cycle")
+	deleteRatio := fs.Float64("delete-ratio", 0.25, "fraction of the writes that are deletions")
+	proofKeys := fs.Int("proof-keys", 16, "number of keys proven at each cycle")
+	checkEvery := fs.Int("check-every", 10, "number of cycles between integrity checks")
+	values := fs.String("values", "mixed", "value distribution: random, small, zero or mixed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dist, ok := valueDistributions[*values]
+	if !ok {
+		return fmt.Errorf("unsupported value distribution %q", *values)
+	}
+	enc := json.NewEncoder(out)
+	stats, err := testutil.RunSoak(context.Background(), testutil.SoakConfig{
+		Seed:        *seed,
+		Duration:    *duration,
+		Cycles:      *cycles,
+		OpsPerCycle: *ops,
+		DeleteRatio: *deleteRatio,
+		ProofKeys:   *proofKeys,
+		CheckEvery:  *checkEvery,
+		Values:      dist,
+		Progress:    func(stats testutil.SoakStats) { _ = enc.Encode(stats) },
+	})
+	_ = enc.Encode(stats)
+	return err
+}
+
+// parseKeys parses a comma-separated list of hex keys.
+func parseKeys(list string) ([][]byte, error) {
+	if list == "" {
+		return nil, errors.New("no keys specified")
+	}
+	var keys [][]byte
+	for _, k := range strings.Split(list, ",") {
+		key, err := verkle.PrefixedHexStringToBytes(strings.TrimSpace(k))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", k, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func buildTree(path, format string) (verkle.VerkleNode, error) {
+	if path == "" {
+		return nil, errors.New("no key-value file specified")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	var kvs [][2]string
+	switch format {
+	case "json":
+		kvs, err = readJSON(f)
+	case "csv":
+		kvs, err = readCSV(f)
+	default:
+		return nil, fmt.Errorf("unsupported key-value format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	root := verkle.New()
+	for _, kv := range kvs {
+		key, err := verkle.PrefixedHexStringToBytes(kv[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", kv[0], err)
+		}
+		value, err := verkle.PrefixedHexStringToBytes(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q: %w", kv[1], err)
+		}
+		if err := root.Insert(key, value, nil); err != nil {
+			return nil, fmt.Errorf("inserting key %x: %w", key, err)
+		}
+	}
+	root.Commit()
+	return root, nil
+}
+
+func readJSON(r io.Reader) ([][2]string, error) {
+	var m map[string]string
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("decoding JSON key-value file: %w", err)
+	}
+	kvs := make([][2]string, 0, len(m))
+	for k, v := range m {
+		kvs = append(kvs, [2]string{k, v})
+	}
+	return kvs, nil
+}
+
+func readCSV(r io.Reader) ([][2]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("decoding CSV key-value file: %w", err)
+	}
+	kvs := make([][2]string, 0, len(records))
+	for _, record := range records {
+		kvs = append(kvs, [2]string{record[0], record[1]})
+	}
+	return kvs, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gballet/go-verkle"
+)
+
+const (
+	key1   = "0x0000000000000000000000000000000000000000000000000000000000000001"
+	key2   = "0x0000000000000000000000000000000000000000000000000000000000000002"
+	absent = "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+	value1 = "0x01"
+	value2 = "0x0202"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func expectedRoot(t *testing.T) string {
+	t.Helper()
+	root := verkle.New()
+	for _, kv := range [][2]string{{key1, value1}, {key2, value2}} {
+		key, _ := verkle.PrefixedHexStringToBytes(kv[0])
+		value, _ := verkle.PrefixedHexStringToBytes(kv[1])
+		if err := root.Insert(key, value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fmt.Sprintf("%x", root.Commit().Bytes())
+}
+
+func TestCommands(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	jsonFile := writeFile(t, dir, "kv.json", fmt.Sprintf(`{%q: %q, %q: %q}`, key1, value1, key2, value2))
+	csvFile := writeFile(t, dir, "kv.csv", fmt.Sprintf("%s,%s\n%s,%s\n", key1, value1, key2, value2))
+	txtFile := writeFile(t, dir, "kv.txt", fmt.Sprintf("%s,%s\n%s,%s\n", key1, value1, key2, value2))
+	badKey := writeFile(t, dir, "badkey.csv", fmt.Sprintf("0xzz,%s\n", value1))
+	badValue := writeFile(t, dir, "badvalue.json", fmt.Sprintf(`{%q: "0x0g"}`, key1))
+	root := expectedRoot(t)
+
+	tests := []struct {
+		name string
+		run  func([]string, io.Writer) error
+		args []string
+		want string // expected output
+		err  string // substring of the expected error, empty for none
+	}{
+		{name: "build json", run: runBuild, args: []string{"-in", jsonFile}, want: root + "\n"},
+		{name: "build csv", run: runBuild, args: []string{"-in", csvFile}, want: root + "\n"},
+		{name: "build explicit format", run: runBuild, args: []string{"-in", txtFile, "-format", "csv"}, want: root + "\n"},
+		{name: "build unknown format", run: runBuild, args: []string{"-in", txtFile}, err: `unsupported key-value format "txt"`},
+		{name: "build missing file", run: runBuild, err: "no key-value file specified"},
+		{name: "build unknown flag", run: runBuild, args: []string{"-bogus"}, err: "flag provided but not defined"},
+		{name: "build bad key", run: runBuild, args: []string{"-in", badKey}, err: `invalid key "0xzz"`},
+		{name: "build bad value", run: runBuild, args: []string{"-in", badValue}, err: `invalid value "0x0g"`},
+		{
+			name: "get",
+			run:  runGet,
+			args: []string{"-in", jsonFile, "-keys", key1 + ", " + absent},
+			want: key1[2:] + ": 01\n" + absent[2:] + ": absent\n",
+		},
+		{name: "get bad key", run: runGet, args: []string{"-in", jsonFile, "-keys", key1 + ",0x0"}, err: `invalid key "0x0"`},
+		{name: "get no keys", run: runGet, args: []string{"-in", jsonFile}, err: "no keys specified"},
+		{
+			name: "stats",
+			run:  runStats,
+			args: []string{"-in", csvFile},
+			want: "root commitment: " + root + "\n" +
+				"internal nodes:  1\n" +
+				"leaf nodes:      1\n" +
+				"values:          2\n" +
+				"max leaf depth:  1\n" +
+				"  leaves at depth 1: 1\n",
+		},
+		{name: "bench unknown distribution", run: runBench, args: []string{"-values", "bogus"}, err: `unsupported value distribution "bogus"`},
+		{name: "soak unknown distribution", run: runSoak, args: []string{"-values", "bogus"}, err: `unsupported value distribution "bogus"`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			err := tt.run(tt.args, &out)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, expected %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Fatalf("got output %q, expected %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestProveVerify(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	kvFile := writeFile(t, dir, "kv.json", fmt.Sprintf(`{%q: %q, %q: %q}`, key1, value1, key2, value2))
+	proofFile := filepath.Join(dir, "proof.json")
+	if err := runProve([]string{"-in", kvFile, "-keys", key1 + "," + absent, "-out", proofFile}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if err := runProve([]string{"-in", kvFile, "-keys", "0xzz"}, io.Discard); err == nil {
+		t.Fatal("invalid key was accepted")
+	}
+
+	var out bytes.Buffer
+	if err := runVerify([]string{"-proof", proofFile}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "proof is valid\n" {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	if err := runVerify([]string{"-proof", proofFile, "-root", "0x" + expectedRoot(t)}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if err := runVerify([]string{"-proof", proofFile, "-root", "0xzz"}, io.Discard); err == nil || !strings.Contains(err.Error(), "invalid root") {
+		t.Fatalf("got error %v for an invalid root", err)
+	}
+	if err := runVerify([]string{"-proof", proofFile, "-root", "0x" + strings.Repeat("00", 32)}, io.Discard); err == nil {
+		t.Fatal("proof verified against the wrong root")
+	}
+}
@@ -0,0 +1,186 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/crate-crypto/go-ipa/banderwagon"
+)
+
+var commitmentCacheMagic = []byte("verkle-commitment-cache-v1")
+
+// CommitmentCache maps the paths of the nodes near the root of a tree to
+// their commitment. When proving keys in a flushed tree, the commitments
+// of the siblings of the proven paths are read from the cache instead of
+// resolving the sibling nodes, see WithCommitmentCache. The cache can be
+// saved with WriteTo and loaded with ReadFrom, e.g. at shutdown and
+// startup, so that it is warm when a node restarts. It is up to the caller
+// to save it along with the flushed nodes, as a stale cache leads to
+// invalid proofs. A CommitmentCache is safe for concurrent use.
+type CommitmentCache struct {
+	lock        sync.RWMutex
+	maxDepth    int
+	commitments map[string]Point
+}
+
+// NewCommitmentCache creates a cache for the commitments of the nodes
+// whose path is at most maxDepth bytes long.
+func NewCommitmentCache(maxDepth int) *CommitmentCache {
+	return &CommitmentCache{
+		maxDepth:    maxDepth,
+		commitments: make(map[string]Point),
+	}
+}
+
+// Get returns the commitment of the node at path, if it's in the cache.
+func (c *CommitmentCache) Get(path []byte) (*Point, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	comm, ok := c.commitments[string(path)]
+	if !ok {
+		return nil, false
+	}
+	return &comm, true
+}
+
+// Put records the commitment of the node at path. Paths longer than the
+// maximum depth of the cache are ignored.
+func (c *CommitmentCache) Put(path []byte, comm *Point) {
+	if len(path) > c.maxDepth {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.commitments[string(path)] = *comm
+}
+
+// Len returns the number of commitments in the cache.
+func (c *CommitmentCache) Len() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return len(c.commitments)
+}
+
+// FlushFn wraps a flush function so that the commitment of each flushed
+// node is recorded in the cache.
+func (c *CommitmentCache) FlushFn(flush NodeFlushFn) NodeFlushFn {
+	return func(path []byte, node VerkleNode) {
+		c.Put(path, node.Commitment())
+		flush(path, node)
+	}
+}
+
+// WriteTo saves the content of the cache, sorted by path. The format is a
+// header followed by one <path length><path><uncompressed commitment>
+// record per cached node.
+func (c *CommitmentCache) WriteTo(w io.Writer) (int64, error) {
+	c.lock.RLock()
+	paths := make([]string, 0, len(c.commitments))
+	for path := range c.commitments {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	records := make([]byte, 0, len(paths)*(1+banderwagon.UncompressedSize))
+	for _, path := range paths {
+		comm := c.commitments[path]
+		serialized := comm.BytesUncompressed()
+		records = append(records, byte(len(path)))
+		records = append(records, path...)
+		records = append(records, serialized[:]...)
+	}
+	c.lock.RUnlock()
+
+	n, err := w.Write(commitmentCacheMagic)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(records)
+	return int64(n + m), err
+}
+
+// ReadFrom loads commitments saved by WriteTo, in addition to the ones
+// already in the cache. Every commitment is checked to be a valid point.
+func (c *CommitmentCache) ReadFrom(r io.Reader) (int64, error) {
+	var (
+		br     = bufio.NewReader(r)
+		read   int64
+		header = make([]byte, len(commitmentCacheMagic))
+		record [StemSize + banderwagon.UncompressedSize]byte
+	)
+	n, err := io.ReadFull(br, header)
+	read += int64(n)
+	if err != nil {
+		return read, fmt.Errorf("reading commitment cache header: %w", err)
+	}
+	if !bytes.Equal(header, commitmentCacheMagic) {
+		return read, errors.New("invalid commitment cache header")
+	}
+
+	loaded := make(map[string]Point)
+	for {
+		pathLen, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return read, err
+		}
+		read++
+		if int(pathLen) > StemSize {
+			return read, fmt.Errorf("invalid path length %d in commitment cache", pathLen)
+		}
+		buf := record[:int(pathLen)+banderwagon.UncompressedSize]
+		n, err := io.ReadFull(br, buf)
+		read += int64(n)
+		if err != nil {
+			return read, fmt.Errorf("reading commitment cache record: %w", err)
+		}
+		var comm Point
+		if err := comm.SetBytesUncompressed(buf[pathLen:], false); err != nil {
+			return read, fmt.Errorf("invalid commitment at path %x: %w", buf[:pathLen], err)
+		}
+		loaded[string(buf[:pathLen])] = comm
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for path, comm := range loaded {
+		if len(path) <= c.maxDepth {
+			c.commitments[path] = comm
+		}
+	}
+	return read, nil
+}
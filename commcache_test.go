@@ -0,0 +1,99 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCommitmentCache(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := make([][]byte, 0, 64)
+	for i := 0; i < 64; i++ {
+		key := append([]byte{byte(i * 4), byte(i)}, zeroKeyTest[2:]...)
+		if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	rootC := root.Commit().Bytes()
+	expected, _, _, _, err := MakeVerkleMultiProof(root, nil, keys[:1], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewCommitmentCache(1)
+	db := map[string][]byte{}
+	root.(*InternalNode).Flush(cache.FlushFn(func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = s
+	}))
+	if cache.Len() != 65 {
+		t.Fatalf("invalid number of cached commitments %d", cache.Len())
+	}
+
+	// Simulate a restart
+	var saved bytes.Buffer
+	if _, err := cache.WriteTo(&saved); err != nil {
+		t.Fatal(err)
+	}
+	serialized := saved.Bytes()
+	loaded := NewCommitmentCache(1)
+	if _, err := loaded.ReadFrom(bytes.NewReader(serialized)); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != cache.Len() {
+		t.Fatalf("loaded %d commitments, expected %d", loaded.Len(), cache.Len())
+	}
+
+	for _, tc := range []struct {
+		cache    *CommitmentCache
+		resolves int
+	}{
+		{nil, 64},
+		{loaded, 1},
+	} {
+		var count int
+		resolver := func(path []byte) ([]byte, error) {
+			count++
+			if s, ok := db[string(path)]; ok {
+				return s, nil
+			}
+			return nil, errors.New("not found")
+		}
+		reloaded, err := ParseNode(db[""], 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf, err := NewConfig(WithCommitmentCache(tc.cache))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reloaded.(*InternalNode).SetConfig(conf)
+		proof, _, _, _, err := MakeVerkleMultiProof(reloaded, nil, [][]byte{keys[0]}, resolver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != tc.resolves {
+			t.Fatalf("%d nodes resolved, expected %d", count, tc.resolves)
+		}
+		if !proof.Equal(expected) {
+			t.Fatal("proof differs from the one made from the full tree")
+		}
+		if err := VerifyProofAtRoot(proof, rootC); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := NewCommitmentCache(1).ReadFrom(bytes.NewReader(serialized[:len(serialized)-1])); err == nil {
+		t.Fatal("truncated cache should be rejected")
+	}
+	if _, err := NewCommitmentCache(1).ReadFrom(bytes.NewReader(serialized[1:])); err == nil {
+		t.Fatal("invalid header should be rejected")
+	}
+}
@@ -0,0 +1,132 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"sort"
+)
+
+// StemChange describes a stem whose leaf was created, modified or
+// deleted since the previous commit.
+type StemChange struct {
+	Stem []byte
+
+	// Values holds the NodeWidth values of the stem after the commit,
+	// with nil for absent values, or is nil if the stem was deleted.
+	// Neither the slice nor the values may be modified.
+	Values [][]byte
+}
+
+// CommitHook is notified of the stems changed by each commit, so that
+// indexes and caches built on top of the tree can be updated
+// incrementally.
+type CommitHook interface {
+	// OnCommit is called by Commit and Flush, once the new root has
+	// been computed, with the changed stems in increasing order. It is
+	// called from the committing goroutine before Commit returns, and
+	// must not access the tree. Stems whose leaf was only moved deeper
+	// in the tree, by the insertion of a stem sharing a prefix with
+	// them, are reported with unchanged values.
+	OnCommit(root *Point, changes []StemChange)
+}
+
+// WithCommitHook sets the hook notified of the stems changed by each
+// commit. Passing nil removes it.
+func WithCommitHook(hook CommitHook) Option {
+	return func(conf *IPAConfig) error {
+		conf.commitHook = hook
+		return nil
+	}
+}
+
+// recordDeletion remembers the stems deleted along with child, so that
+// they can be reported at the next commit, since the removed node can
+// no longer be found from the root.
+func (n *InternalNode) recordDeletion(child VerkleNode) {
+	if n.config().commitHook == nil {
+		return
+	}
+	switch c := child.(type) {
+	case *LeafNode:
+		n.deletedStems = append(n.deletedStems, c.stem)
+	case *InternalNode:
+		n.deletedStems = append(n.deletedStems, c.deletedStems...)
+	}
+}
+
+// collectStemChanges lists the leaves modified below the nodes about to
+// be committed, and the stems deleted below them. It must be called
+// before the nodes are committed, since that clears their list of
+// modified children.
+func collectStemChanges(levels [][]*InternalNode) []StemChange {
+	var (
+		changes []StemChange
+		seen    = make(map[string]bool)
+		deleted [][]byte
+	)
+	for _, nodes := range levels {
+		for _, node := range nodes {
+			for idx := range node.cow {
+				if leaf, ok := node.children[idx].(*LeafNode); ok && !leaf.isPOAStub {
+					changes = append(changes, StemChange{Stem: leaf.stem, Values: append([][]byte{}, leaf.values...)})
+					seen[string(leaf.stem)] = true
+				}
+			}
+			deleted = append(deleted, node.deletedStems...)
+			node.deletedStems = nil
+		}
+	}
+	// A deleted stem may have been inserted again before the commit.
+	for _, stem := range deleted {
+		if !seen[string(stem)] {
+			changes = append(changes, StemChange{Stem: stem})
+			seen[string(stem)] = true
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return bytes.Compare(changes[i].Stem, changes[j].Stem) < 0
+	})
+	return changes
+}
+
+// mergeStemChanges merges the changes collected by successive partial
+// commits, keeping the most recent change of each stem.
+func mergeStemChanges(older, newer []StemChange) []StemChange {
+	all := append(append(make([]StemChange, 0, len(older)+len(newer)), older...), newer...)
+	sort.SliceStable(all, func(i, j int) bool {
+		return bytes.Compare(all[i].Stem, all[j].Stem) < 0
+	})
+	merged := all[:0]
+	for _, change := range all {
+		if n := len(merged); n > 0 && bytes.Equal(merged[n-1].Stem, change.Stem) {
+			merged[n-1] = change
+			continue
+		}
+		merged = append(merged, change)
+	}
+	return merged
+}
@@ -0,0 +1,83 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+type recordingHook struct {
+	root    *Point
+	changes []StemChange
+	calls   int
+}
+
+func (h *recordingHook) OnCommit(root *Point, changes []StemChange) {
+	h.root = root
+	h.changes = changes
+	h.calls++
+}
+
+func TestCommitHook(t *testing.T) {
+	t.Parallel()
+
+	hook := &recordingHook{}
+	conf, err := NewConfig(WithCommitHook(hook))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := NewWithConfig(conf)
+	for _, key := range [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest} {
+		if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	comm := root.Commit()
+	if hook.calls != 1 || !hook.root.Equal(comm) {
+		t.Fatalf("hook wasn't called with the new root: %d calls", hook.calls)
+	}
+	if len(hook.changes) != 2 || !bytes.Equal(hook.changes[0].Stem, zeroKeyTest[:StemSize]) || !bytes.Equal(hook.changes[1].Stem, ffx32KeyTest[:StemSize]) {
+		t.Fatalf("invalid changes %v", hook.changes)
+	}
+	if !bytes.Equal(hook.changes[0].Values[0], fourtyKeyTest) || !bytes.Equal(hook.changes[0].Values[1], fourtyKeyTest) || hook.changes[0].Values[2] != nil {
+		t.Fatal("invalid values for the zero stem")
+	}
+
+	// Nothing changed, the hook isn't called again
+	root.Commit()
+	if hook.calls != 1 {
+		t.Fatalf("hook was called %d times", hook.calls)
+	}
+
+	// Deleting a whole stem reports it with nil values
+	if _, err := root.Delete(ffx32KeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(forkOneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	if hook.calls != 2 || len(hook.changes) != 3 {
+		t.Fatalf("invalid changes after deletion: %v", hook.changes)
+	}
+	// The zero stem was moved deeper by the insertion of forkOneKeyTest
+	for i, stem := range [][]byte{zeroKeyTest[:StemSize], forkOneKeyTest[:StemSize], ffx32KeyTest[:StemSize]} {
+		if !bytes.Equal(hook.changes[i].Stem, stem) {
+			t.Fatalf("invalid stem %x at index %d, expected %x", hook.changes[i].Stem, i, stem)
+		}
+	}
+	if hook.changes[2].Values != nil {
+		t.Fatal("deleted stem should have no values")
+	}
+
+	// A stem deleted and inserted again is reported with its values
+	if _, err := root.Delete(forkOneKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(forkOneKeyTest, zeroKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	if len(hook.changes) != 1 || !bytes.Equal(hook.changes[0].Values[forkOneKeyTest[StemSize]], zeroKeyTest) {
+		t.Fatalf("invalid changes after reinsertion: %v", hook.changes)
+	}
+}
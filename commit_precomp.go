@@ -0,0 +1,51 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+//go:build !verkle_small
+
+package verkle
+
+import (
+	ipa "github.com/crate-crypto/go-ipa"
+	"github.com/crate-crypto/go-ipa/common"
+	ipaconf "github.com/crate-crypto/go-ipa/ipa"
+)
+
+// smallFootprint is true in builds with the verkle_small tag.
+const smallFootprint = false
+
+func newIPASettings() (*ipaconf.IPAConfig, error) {
+	return ipaconf.NewIPASettings()
+}
+
+func verifyMultiProof(transcript *common.Transcript, conf *ipaconf.IPAConfig, proof *ipa.MultiProof, cs []*Point, ys []*Fr, zs []byte) (bool, error) {
+	return ipa.CheckMultiProof(transcript, conf, proof, cs, ys, zs)
+}
+
+// proverSettings returns the go-ipa settings used to generate proofs
+// from a configuration's settings, which are complete in this build.
+func proverSettings(conf *ipaconf.IPAConfig) (*ipaconf.IPAConfig, error) {
+	return conf, nil
+}
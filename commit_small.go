@@ -0,0 +1,83 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+//go:build verkle_small
+
+package verkle
+
+import (
+	"sync"
+
+	ipa "github.com/crate-crypto/go-ipa"
+	"github.com/crate-crypto/go-ipa/banderwagon"
+	"github.com/crate-crypto/go-ipa/common"
+	ipaconf "github.com/crate-crypto/go-ipa/ipa"
+)
+
+// The verkle_small build tag trades speed for memory, for environments
+// like WASM where the precomputed tables of the CRS points are too large
+// to keep around. Commitments are computed with a plain multi-scalar
+// multiplication, which still allows building trees and verifying
+// proofs. go-ipa's prover requires the tables, so they are only built
+// when the first proof is generated, unless a custom prover is set with
+// WithProver.
+
+// smallFootprint is true in builds with the verkle_small tag.
+const smallFootprint = true
+
+// newIPASettings creates the go-ipa settings like ipa.NewIPASettings,
+// without building the precomputed tables, so that they aren't even
+// allocated. go-ipa has no constructor for that, and only sets the
+// number of rounds of the IPA argument in ipa.NewIPASettings, so the
+// settings are only used with checkMultiProof, which doesn't need it.
+func newIPASettings() (*ipaconf.IPAConfig, error) {
+	return &ipaconf.IPAConfig{
+		SRS:                ipaconf.GenerateRandomPoints(common.VectorLength),
+		Q:                  banderwagon.Generator,
+		PrecomputedWeights: ipaconf.NewPrecomputedWeights(),
+	}, nil
+}
+
+func verifyMultiProof(transcript *common.Transcript, conf *ipaconf.IPAConfig, proof *ipa.MultiProof, cs []*Point, ys []*Fr, zs []byte) (bool, error) {
+	return checkMultiProof(transcript, conf, proof, cs, ys, zs)
+}
+
+var (
+	proverSettingsOnce sync.Once
+	proverConf         *ipaconf.IPAConfig
+	proverErr          error
+)
+
+// proverSettings returns the go-ipa settings used to generate proofs.
+// The settings of the configurations lack the precomputed tables that
+// go-ipa's prover requires, so complete settings are built on demand,
+// the first time a proof is generated, and kept afterwards. They hold
+// the default CRS, whatever the CRS of conf.
+func proverSettings(*ipaconf.IPAConfig) (*ipaconf.IPAConfig, error) {
+	proverSettingsOnce.Do(func() {
+		proverConf, proverErr = ipaconf.NewIPASettings()
+	})
+	return proverConf, proverErr
+}
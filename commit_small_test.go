@@ -0,0 +1,64 @@
+//go:build verkle_small
+
+package verkle
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSmallFootprintVerification(t *testing.T) {
+	t.Parallel()
+
+	f, err := os.Open("testdata/interop/fixtures.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fixtures, err := ReadInteropFixtures(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fixture := range fixtures {
+		// Commitments computed without the precomputed tables
+		// must match the ones of the fixtures.
+		root, err := fixture.buildTree()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rootC := root.Commit()
+		rootBytes := rootC.Bytes()
+		if got := HexToPrefixedString(rootBytes[:]); got != fixture.Root {
+			t.Fatalf("%s: root mismatch: got %s, expected %s", fixture.Name, got, fixture.Root)
+		}
+		if fixture.Proof == nil {
+			continue
+		}
+
+		proof, err := DeserializeProof(fixture.Proof, fixture.StateDiff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pretree, err := PreStateTreeFromProof(proof, rootC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyVerkleProofWithPreState(proof, pretree); err != nil {
+			t.Fatalf("%s: %v", fixture.Name, err)
+		}
+
+		keys, err := decodeHexStrings(fixture.ProofKeys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The precomputed tables are built on demand to prove
+		proof, _, _, _, err = MakeVerkleMultiProof(root, nil, keys, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", fixture.Name, err)
+		}
+		if err := VerifyProofAtRoot(proof, rootBytes); err != nil {
+			t.Fatalf("%s: %v", fixture.Name, err)
+		}
+	}
+}
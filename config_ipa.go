@@ -27,8 +27,13 @@ package verkle
 
 import (
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime"
 	"sync"
+	"sync/atomic"
 
+	"github.com/crate-crypto/go-ipa/banderwagon"
 	"github.com/crate-crypto/go-ipa/ipa"
 )
 
@@ -50,8 +55,11 @@ var (
 	FrZero Fr
 	FrOne  Fr
 
-	cfg     *Config
-	onceCfg sync.Once
+	defaultCfg *Config
+	onceCfg    sync.Once
+
+	// currentCfg holds the *Config returned by GetConfig.
+	currentCfg atomic.Value
 )
 
 func init() {
@@ -61,17 +69,53 @@ func init() {
 
 type IPAConfig struct {
 	conf *ipa.IPAConfig
+
+	// checkCorruption is non-zero if nodes read through a resolver
+	// have to be checked against their commitment.
+	checkCorruption int32
+
+	// auditRate holds the float64 bits of the fraction of commitment
+	// updates that are cross-checked, see SetAuditRate.
+	auditRate uint64
+
+	parallelism     int    // number of goroutines used by batch operations, 0 for runtime.NumCPU()
+	transcriptLabel string // domain separator of the proof transcripts
+	maxProofKeys    int    // maximum number of keys in a proof, 0 for no limit
+	splitProofs     bool   // see WithProofSplitting
+
+	valueAlignment  ValueAlignment   // see WithValueAlignment
+	valueValidation ValueValidation  // see WithValueValidation
+	commitments     *CommitmentCache // see WithCommitmentCache
+
+	noPrecomputedTables bool // see WithPrecomputedTables
+	precompWideBits     int  // see WithPrecompSize, 0 for the sizes of go-ipa's tables
+	precompNarrowBits   int  // see WithPrecompSize
+
+	// precomp holds the tables of the CRS points built for the window
+	// sizes set with WithPrecompSize, nil to use go-ipa's tables.
+	precomp []banderwagon.PrecompPoint
+
+	constantTime bool   // see WithConstantTimeVerification
+	prover       Prover // see WithProver, nil for LocalProver
+
+	commitHook CommitHook // see WithCommitHook
+	evictor    *Evictor   // see WithEvictor
+
+	accounting     *AccountingReport // see WithAccounting
+	flushWitnesses FlushWitnessFn    // see WithFlushWitnesses
 }
 
 type Config = IPAConfig
 
+// GetConfig returns the configuration used by the package, which is the
+// default one unless replaced with SetConfig.
 func GetConfig() *Config {
 	onceCfg.Do(func() {
-		conf, err := ipa.NewIPASettings()
+		conf, err := newIPASettings()
 		if err != nil {
 			panic(err)
 		}
-		cfg = &IPAConfig{conf: conf}
+		defaultCfg = &IPAConfig{conf: conf, transcriptLabel: defaultTranscriptLabel}
 
 		// Initialize the empty code cached values.
 		emptyHashCode, _ := hex.DecodeString("c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470")
@@ -81,14 +125,261 @@ func GetConfig() *Config {
 		if _, err := fillSuffixTreePoly(c1poly[:], values[:NodeWidth/2]); err != nil {
 			panic(err)
 		}
-		EmptyCodeHashPoint = *cfg.CommitToPoly(c1poly[:], 0)
+		EmptyCodeHashPoint = *defaultCfg.CommitToPoly(c1poly[:], 0)
 		EmptyCodeHashFirstHalfValue = c1poly[EmptyCodeHashFirstHalfIdx]
 		EmptyCodeHashSecondHalfValue = c1poly[EmptyCodeHashSecondHalfIdx]
+
+		currentCfg.Store(defaultCfg)
 	})
-	return cfg
+	return currentCfg.Load().(*Config)
+}
+
+// Option customizes a configuration created by NewConfig.
+type Option func(*IPAConfig) error
+
+// NewConfig creates a configuration from the default one, modified by
+// opts. The CRS and precomputed tables are shared with the default
+// configuration, so this is cheap, unless other tables are built for
+// WithPrecompSize.
+func NewConfig(opts ...Option) (*Config, error) {
+	GetConfig() // make sure the default configuration is initialized
+	conf := &IPAConfig{
+		conf:            defaultCfg.conf,
+		transcriptLabel: defaultTranscriptLabel,
+	}
+	for _, opt := range opts {
+		if err := opt(conf); err != nil {
+			return nil, err
+		}
+	}
+	if err := conf.buildPrecompTables(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// NewConfigWithCRS creates a configuration from the go-ipa settings conf,
+// which hold the CRS points, modified by opts. Unlike NewConfig, it
+// neither reads nor initializes the default configuration, so a verifier
+// holding its own settings, e.g. created once with ipa.NewIPASettings,
+// doesn't wait on or depend on the default configuration. conf is shared,
+// and must not be modified afterwards.
+//
+// The configuration is meant for verifying proofs, e.g. with
+// VerifyVerkleProof. Trees assume that all configurations share the CRS
+// of the default one, e.g. to reuse cached commitments, so it must not
+// be passed to NewWithConfig or SetConfig unless conf holds that CRS.
+func NewConfigWithCRS(conf *ipa.IPAConfig, opts ...Option) (*Config, error) {
+	if conf == nil || conf.PrecomputedWeights == nil {
+		return nil, errors.New("missing IPA settings")
+	}
+	if len(conf.SRS) != NodeWidth {
+		return nil, fmt.Errorf("invalid CRS size %d, expected %d", len(conf.SRS), NodeWidth)
+	}
+	ret := &IPAConfig{
+		conf:            conf,
+		transcriptLabel: defaultTranscriptLabel,
+	}
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			return nil, err
+		}
+	}
+	if err := ret.buildPrecompTables(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// SetConfig replaces the configuration returned by GetConfig, and used by
+// all tree and proof operations. Passing nil restores the default one.
+// Trees built with a different configuration must be recommitted from
+// scratch, as their commitments aren't updated. Trees that have their
+// own configuration, see NewWithConfig, aren't affected.
+func SetConfig(conf *Config) {
+	GetConfig() // make sure the default configuration is initialized
+	if conf == nil {
+		conf = defaultCfg
+	}
+	currentCfg.Store(conf)
+}
+
+// WithParallelism sets the number of goroutines used to commit to the tree
+// and to build leaves in batch. The default, 0, uses runtime.NumCPU().
+// Results, including which error is reported when several operations
+// fail, are the same whatever the parallelism.
+func WithParallelism(n int) Option {
+	return func(conf *IPAConfig) error {
+		if n < 0 {
+			return fmt.Errorf("invalid parallelism %d", n)
+		}
+		conf.parallelism = n
+		return nil
+	}
+}
+
+// WithPrecompSize sets the size, in bits, of the windows of the tables
+// precomputed for the commitments: the first CRS points, see Params, use
+// wideWindowBits-bit windows, and the other ones narrowWindowBits-bit
+// windows. Sizes must be powers of two between 2 and 16; larger windows
+// make commitments faster, at the cost of memory and of the time taken
+// to build the tables. The default, 16/8, uses go-ipa's tables; other
+// sizes build new tables when the configuration is created.
+func WithPrecompSize(wideWindowBits, narrowWindowBits int) Option {
+	return func(conf *IPAConfig) error {
+		if smallFootprint {
+			return fmt.Errorf("precomputed tables aren't available in verkle_small builds")
+		}
+		if !validPrecompWindow(wideWindowBits) || !validPrecompWindow(narrowWindowBits) {
+			return fmt.Errorf("invalid precomputed window sizes %d/%d: must be powers of two between 2 and 16", wideWindowBits, narrowWindowBits)
+		}
+		conf.precompWideBits, conf.precompNarrowBits = wideWindowBits, narrowWindowBits
+		return nil
+	}
+}
+
+func validPrecompWindow(bits int) bool {
+	return bits >= 2 && bits <= 16 && bits&(bits-1) == 0
+}
+
+// WithTranscriptLabel sets the domain separator of the proof transcripts.
+// Proofs generated with a label can only be verified with the same one.
+func WithTranscriptLabel(label string) Option {
+	return func(conf *IPAConfig) error {
+		if label == "" {
+			return errors.New("empty transcript label")
+		}
+		conf.transcriptLabel = label
+		return nil
+	}
+}
+
+// WithMaxProofKeys limits the number of keys that a proof can cover, both
+// when generating and verifying it. The default, 0, means no limit.
+func WithMaxProofKeys(n int) Option {
+	return func(conf *IPAConfig) error {
+		if n < 0 {
+			return fmt.Errorf("invalid maximum number of proof keys %d", n)
+		}
+		conf.maxProofKeys = n
+		return nil
+	}
+}
+
+// WithProofSplitting makes MakeVerkleMultiProofs split the keys that
+// exceed the limit set by WithMaxProofKeys over several proofs, instead of
+// returning a ProofKeysError.
+func WithProofSplitting(enabled bool) Option {
+	return func(conf *IPAConfig) error {
+		conf.splitProofs = enabled
+		return nil
+	}
+}
+
+// WithValueAlignment sets how values shorter than LeafValueSize bytes are
+// padded when they are inserted in a tree. The default, AlignLeft, is how
+// short values are committed to, so they are stored as is. With AlignRight,
+// e.g. for big-endian integers, they are padded before being stored, and
+// read back as LeafValueSize-byte values. Serialized proofs always
+// contain the committed form of the values.
+func WithValueAlignment(align ValueAlignment) Option {
+	return func(conf *IPAConfig) error {
+		if align != AlignLeft && align != AlignRight {
+			return fmt.Errorf("invalid value alignment %d", align)
+		}
+		conf.valueAlignment = align
+		return nil
+	}
+}
+
+// WithValueValidation sets which values Insert and InsertValuesAtStem
+// accept. The default, ValuesPermissive, accepts any value of up to
+// LeafValueSize bytes, padding the shorter ones. ValuesStrict rejects any
+// other size with a ValueSizeError, including empty values, which Insert
+// would otherwise treat as leaving the key untouched.
+func WithValueValidation(validation ValueValidation) Option {
+	return func(conf *IPAConfig) error {
+		if validation != ValuesPermissive && validation != ValuesStrict {
+			return fmt.Errorf("invalid value validation mode %d", validation)
+		}
+		conf.valueValidation = validation
+		return nil
+	}
+}
+
+// WithCommitmentCache makes proof generation read the commitments of the
+// unresolved siblings of the proven paths from cache, when it has them,
+// instead of resolving the sibling nodes.
+func WithCommitmentCache(cache *CommitmentCache) Option {
+	return func(conf *IPAConfig) error {
+		conf.commitments = cache
+		return nil
+	}
+}
+
+// alignValue validates value, and returns the form in which it has to be
+// stored according to WithValueAlignment.
+func (conf *IPAConfig) alignValue(value []byte) ([]byte, error) {
+	padded, err := PadValue(value, conf.valueAlignment)
+	if err != nil {
+		return nil, err
+	}
+	if conf.valueAlignment == AlignLeft || len(value) == 0 || len(value) == LeafValueSize {
+		return value, nil
+	}
+	return padded[:], nil
+}
+
+// checkValue returns a ValueSizeError if value, inserted at key, isn't
+// accepted by WithValueValidation.
+func (conf *IPAConfig) checkValue(key, value []byte) error {
+	if conf.valueValidation == ValuesStrict && len(value) != LeafValueSize {
+		return &ValueSizeError{Key: append([]byte{}, key...), Size: len(value)}
+	}
+	return nil
+}
+
+// WithCorruptionDetection enables or disables the verification of nodes
+// as they are read through a resolver, see SetCorruptionDetection.
+func WithCorruptionDetection(enabled bool) Option {
+	return func(conf *IPAConfig) error {
+		conf.SetCorruptionDetection(enabled)
+		return nil
+	}
+}
+
+// SetCorruptionDetection enables or disables the verification of nodes
+// as they are read through a resolver. See CorruptionError.
+func (conf *IPAConfig) SetCorruptionDetection(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&conf.checkCorruption, v)
+}
+
+func (conf *IPAConfig) corruptionDetection() bool {
+	return atomic.LoadInt32(&conf.checkCorruption) != 0
+}
+
+// numWorkers returns the number of goroutines batch operations should use.
+func (conf *IPAConfig) numWorkers() int {
+	if conf.parallelism > 0 {
+		return conf.parallelism
+	}
+	return runtime.NumCPU()
+}
+
+// checkProofKeys returns an error if a proof over count keys isn't
+// allowed by the configuration.
+func (conf *IPAConfig) checkProofKeys(count int) error {
+	if conf.maxProofKeys > 0 && count > conf.maxProofKeys {
+		return &ProofKeysError{Keys: count, Max: conf.maxProofKeys}
+	}
+	return nil
 }
 
 func (conf *IPAConfig) CommitToPoly(poly []Fr, _ int) *Point {
-	ret := conf.conf.Commit(poly)
+	ret := conf.commit(poly)
 	return &ret
 }
@@ -0,0 +1,546 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	mRand "math/rand"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/crate-crypto/go-ipa/ipa"
+)
+
+func TestNewConfigOptions(t *testing.T) {
+	t.Parallel()
+
+	conf, err := NewConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Params() != GetConfig().Params() {
+		t.Fatalf("default parameters differ: %+v != %+v", conf.Params(), GetConfig().Params())
+	}
+
+	if !smallFootprint {
+		if _, err := NewConfig(WithPrecompSize(16, 8)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := NewConfig(WithPrecompSize(12, 8)); err == nil {
+		t.Fatal("invalid precomputed table size should be rejected")
+	}
+	if _, err := NewConfig(WithPrecompSize(32, 8)); err == nil {
+		t.Fatal("too large precomputed table size should be rejected")
+	}
+	if _, err := NewConfig(WithTranscriptLabel("")); err == nil {
+		t.Fatal("empty transcript label should be rejected")
+	}
+	if _, err := NewConfig(WithParallelism(-1)); err == nil {
+		t.Fatal("negative parallelism should be rejected")
+	}
+
+	conf, err = NewConfig(WithCorruptionDetection(true), WithTranscriptLabel("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := conf.Params(); !p.CorruptionDetection || p.TranscriptLabel != "test" {
+		t.Fatalf("options weren't applied: %+v", p)
+	}
+	if GetConfig().Params().CorruptionDetection {
+		t.Fatal("default configuration was modified")
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	keys := [][]byte{zeroKeyTest, ffx32KeyTest}
+	proof, cis, zis, yis, err := MakeVerkleMultiProof(root, nil, keys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyVerkleProof(proof, cis, zis, yis, GetConfig()); !ok || err != nil {
+		t.Fatalf("could not verify proof: %v", err)
+	}
+
+	conf, err := NewConfig(WithTranscriptLabel("test"), WithMaxProofKeys(1), WithParallelism(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetConfig(conf)
+	defer SetConfig(nil)
+	if GetConfig() != conf {
+		t.Fatal("configuration wasn't installed")
+	}
+
+	// The transcript label is part of the proof
+	proof.Keys = keys[:1]
+	if ok, err := VerifyVerkleProof(proof, cis, zis, yis, conf); ok || err != nil {
+		t.Fatalf("proof verified with a different transcript label: %v", err)
+	}
+
+	if _, _, _, _, err := MakeVerkleMultiProof(root, nil, keys, nil); !errors.Is(err, ErrTooManyProofKeys) {
+		t.Fatalf("expected ErrTooManyProofKeys, got %v", err)
+	}
+	proof.Keys = keys
+	if _, err := VerifyVerkleProof(proof, cis, zis, yis, conf); !errors.Is(err, ErrTooManyProofKeys) {
+		t.Fatalf("expected ErrTooManyProofKeys, got %v", err)
+	}
+
+	proof, cis, zis, yis, err = MakeVerkleMultiProof(root, nil, keys[:1], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyVerkleProof(proof, cis, zis, yis, conf); !ok || err != nil {
+		t.Fatalf("proof didn't verify with its own transcript label: %v", err)
+	}
+
+	SetConfig(nil)
+	if GetConfig().Params().TranscriptLabel != defaultTranscriptLabel {
+		t.Fatal("default configuration wasn't restored")
+	}
+}
+
+func TestPerTreeConfig(t *testing.T) {
+	t.Parallel()
+
+	confA, err := NewConfig(WithTranscriptLabel("a"), WithParallelism(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	confB, err := NewConfig(WithTranscriptLabel("b"), WithMaxProofKeys(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both keys share their first byte, so that the tree has a
+	// second level of internal nodes.
+	keys := [][]byte{zeroKeyTest, forkOneKeyTest}
+	build := func(conf *Config) (VerkleNode, *Proof, error) {
+		root := NewWithConfig(conf)
+		for _, key := range keys {
+			if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+				return nil, nil, err
+			}
+		}
+		root.Commit()
+		proof, _, _, _, err := MakeVerkleMultiProof(root, nil, keys[:1], nil)
+		return root, proof, err
+	}
+
+	// Both trees are used concurrently, to let the race detector
+	// catch any shared state.
+	var (
+		roots  [2]VerkleNode
+		proofs [2]*Proof
+		errs   [2]error
+		done   = make(chan struct{})
+	)
+	for i, conf := range []*Config{confA, confB} {
+		i, conf := i, conf
+		go func() {
+			roots[i], proofs[i], errs[i] = build(conf)
+			done <- struct{}{}
+		}()
+	}
+	<-done
+	<-done
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !roots[0].Commit().Equal(roots[1].Commit()) {
+		t.Fatal("configurations sharing the CRS produced different commitments")
+	}
+	if roots[1].(*InternalNode).children[0].(*InternalNode).Config() != confB {
+		t.Fatal("internal node did not inherit the configuration of its tree")
+	}
+
+	for i, proof := range proofs {
+		if err := VerifyVerkleProofWithPreState(proof, roots[i]); err != nil {
+			t.Fatalf("proof %d didn't verify with its own configuration: %v", i, err)
+		}
+	}
+	if err := VerifyVerkleProofWithPreState(proofs[0], roots[1]); err == nil {
+		t.Fatal("proof verified with a different transcript label")
+	}
+	if _, _, _, _, err := MakeVerkleMultiProof(roots[1], nil, keys, nil); !errors.Is(err, ErrTooManyProofKeys) {
+		t.Fatalf("expected ErrTooManyProofKeys, got %v", err)
+	}
+	if _, _, _, _, err := MakeVerkleMultiProof(roots[0], nil, keys, nil); err != nil {
+		t.Fatalf("limit of another tree was applied: %v", err)
+	}
+
+	// Resolved nodes inherit the configuration
+	db := map[string][]byte{}
+	roots[1].(*InternalNode).Flush(func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = s
+	})
+	serialized := db[""]
+	stored, err := ParseNode(serialized, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.(*InternalNode).SetConfig(confB)
+	if _, err := stored.Get(zeroKeyTest, func(path []byte) ([]byte, error) {
+		return db[string(path)], nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if stored.(*InternalNode).children[0].(*InternalNode).Config() != confB {
+		t.Fatal("resolved internal node did not inherit the configuration")
+	}
+}
+
+func TestPerTreeConfigLeaves(t *testing.T) {
+	m := newRecordingMetrics()
+	SetMetrics(m)
+	defer SetMetrics(nil)
+
+	conf, err := NewConfig(WithAuditRate(1), WithValueAlignment(AlignRight), WithPrecomputedTables(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := NewWithConfig(conf)
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+
+	// Leaf updates are audited with the configuration of the tree,
+	// not the default one, which has the audit mode disabled.
+	checks := m.counters[MetricAuditChecks]
+	if err := root.Insert(zeroKeyTest, ffx32KeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if m.counters[MetricAuditChecks] == checks {
+		t.Fatal("leaf update wasn't audited")
+	}
+	if _, err := root.Delete(zeroKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Values inserted directly into a leaf of the tree are aligned
+	// according to its configuration.
+	key := append(zeroKeyTest[:StemSize:StemSize], 1)
+	if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	leaf := root.(*InternalNode).children[0].(*LeafNode)
+	if err := leaf.Insert(zeroKeyTest, []byte{1, 2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := PadValue([]byte{1, 2}, AlignRight)
+	if !bytes.Equal(leaf.values[0], expected[:]) {
+		t.Fatalf("value wasn't aligned by the tree configuration: %x", leaf.values[0])
+	}
+
+	// The commitments computed without the precomputed tables match
+	// the ones of the default configuration.
+	defaultRoot := New()
+	for _, k := range [][]byte{key, zeroKeyTest} {
+		if err := defaultRoot.Insert(k, leaf.values[k[StemSize]], nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !root.Commit().Equal(defaultRoot.Commit()) {
+		t.Fatal("commitments differ from the default configuration")
+	}
+	if m.counters[MetricAuditFailures] != 0 {
+		t.Fatalf("%d audit failures", m.counters[MetricAuditFailures])
+	}
+}
+
+func TestPrecompSize(t *testing.T) {
+	t.Parallel()
+	if smallFootprint {
+		t.Skip("precomputed tables aren't available in verkle_small builds")
+	}
+
+	conf, err := NewConfig(WithPrecompSize(8, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := conf.Params(); p.PrecompWideWindowBits != 8 || p.PrecompNarrowWindowBits != 4 {
+		t.Fatalf("invalid window sizes %d/%d", p.PrecompWideWindowBits, p.PrecompNarrowWindowBits)
+	}
+	if conf.precomp == nil {
+		t.Fatal("tables weren't built")
+	}
+
+	// The commitments are the same whatever the tables
+	var poly [NodeWidth]Fr
+	for i := range poly {
+		poly[i].SetUint64(uint64(i * i))
+	}
+	poly[1].SetZero()
+	poly[NodeWidth-1].Neg(&FrOne)
+	if !conf.CommitToPoly(poly[:], 0).Equal(GetConfig().CommitToPoly(poly[:], 0)) {
+		t.Fatal("commitment differs with other window sizes")
+	}
+	tree := NewWithConfig(conf)
+	ref := New()
+	for _, key := range [][]byte{zeroKeyTest, ffx32KeyTest, forkOneKeyTest} {
+		if err := tree.Insert(key, testValue, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := ref.Insert(key, testValue, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !tree.Commit().Equal(ref.Commit()) {
+		t.Fatal("root commitment differs with other window sizes")
+	}
+
+	// No table is built if they aren't used
+	plain, err := NewConfig(WithPrecompSize(8, 4), WithPrecomputedTables(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain.precomp != nil {
+		t.Fatal("tables were built while disabled")
+	}
+}
+
+func TestPrecomputedTablesToggle(t *testing.T) {
+	t.Parallel()
+
+	plain, err := NewConfig(WithPrecomputedTables(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain.Acceleration().PrecomputedTables {
+		t.Fatal("precomputed tables should be disabled")
+	}
+	if GetConfig().Acceleration().PrecomputedTables == smallFootprint {
+		t.Fatal("precomputed tables should only be disabled in small footprint builds")
+	}
+	if a := plain.Acceleration(); a.Arch != runtime.GOARCH || a.Workers <= 0 || a.FieldAssembly != fieldAssembly {
+		t.Fatalf("invalid acceleration report %+v", a)
+	}
+
+	// Both code paths produce the same commitments
+	var poly [NodeWidth]Fr
+	for i := range poly {
+		poly[i].SetUint64(uint64(i * i))
+	}
+	if !plain.CommitToPoly(poly[:], 0).Equal(GetConfig().CommitToPoly(poly[:], 0)) {
+		t.Fatal("commitment differs without precomputed tables")
+	}
+	tree := NewWithConfig(plain)
+	ref := New()
+	for _, key := range [][]byte{zeroKeyTest, ffx32KeyTest, forkOneKeyTest} {
+		if err := tree.Insert(key, testValue, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := ref.Insert(key, testValue, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !tree.Commit().Equal(ref.Commit()) {
+		t.Fatal("root commitment differs without precomputed tables")
+	}
+}
+
+func TestProofSplitting(t *testing.T) {
+	t.Parallel()
+
+	conf, err := NewConfig(WithMaxProofKeys(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := NewWithConfig(conf)
+	keys := [][]byte{ffx32KeyTest, zeroKeyTest, oneKeyTest, forkOneKeyTest, fourtyKeyTest}
+	for _, key := range keys {
+		if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root.Commit()
+
+	_, err = MakeVerkleMultiProofs(root, nil, keys, nil)
+	var keysErr *ProofKeysError
+	if !errors.As(err, &keysErr) || !errors.Is(err, ErrTooManyProofKeys) || keysErr.Keys != 5 || keysErr.Max != 2 {
+		t.Fatalf("expected a ProofKeysError, got %v", err)
+	}
+	proofs, err := MakeVerkleMultiProofs(root, nil, keys[:2], nil)
+	if err != nil || len(proofs) != 1 {
+		t.Fatalf("expected a single proof, got %d (%v)", len(proofs), err)
+	}
+
+	split, err := NewConfig(WithMaxProofKeys(2), WithProofSplitting(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.(*InternalNode).SetConfig(split)
+	proofs, err = MakeVerkleMultiProofs(root, nil, keys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proofs) != 3 {
+		t.Fatalf("expected 3 proofs, got %d", len(proofs))
+	}
+	var proven int
+	for _, proof := range proofs {
+		if len(proof.Keys) > 2 {
+			t.Fatalf("proof covers %d keys", len(proof.Keys))
+		}
+		proven += len(proof.Keys)
+		if err := VerifyVerkleProofWithPreState(proof, root); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if proven != len(keys) {
+		t.Fatalf("%d keys proven, expected %d", proven, len(keys))
+	}
+}
+
+// parallelRun gathers the serialized results of the operations that are
+// spread over several goroutines.
+func parallelRun(t *testing.T, conf *Config) []string {
+	t.Helper()
+
+	var results []string
+	kvs := genRandomKeyValues(mRand.New(mRand.NewSource(42)), 500) //skipcq: GSC-G404
+	root := NewWithConfig(conf)
+	for _, kv := range kvs {
+		if err := root.Insert(kv.key, kv.value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	comm := root.Commit().Bytes()
+	results = append(results, string(comm[:]))
+
+	// Prove unsorted keys, some of them absent
+	keys := [][]byte{kvs[42].key, zeroKeyTest, kvs[7].key, ffx32KeyTest, kvs[300].key}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, keys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var diff bytes.Buffer
+	if _, err := sd.WriteTo(&diff); err != nil {
+		t.Fatal(err)
+	}
+	results = append(results, string(vp.Serialize()), diff.String())
+
+	batch := make([]BatchNewLeafNodeData, 100)
+	for i := range batch {
+		batch[i] = BatchNewLeafNodeData{Stem: kvs[i].key[:StemSize], Values: map[byte][]byte{kvs[i].key[StemSize]: kvs[i].value}}
+	}
+	leaves, err := BatchNewLeafNode(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrated := NewWithConfig(conf).(*InternalNode)
+	if err := migrated.InsertMigratedLeaves(leaves, nil); err != nil {
+		t.Fatal(err)
+	}
+	comm = migrated.Commit().Bytes()
+	results = append(results, string(comm[:]))
+
+	// Several batches fail, the first one is reported
+	batch[10].Values[0] = make([]byte, 33)
+	batch[90].Values[0] = make([]byte, 40)
+	if _, err := BatchNewLeafNode(batch); err == nil {
+		t.Fatal("invalid values were accepted")
+	} else {
+		results = append(results, err.Error())
+	}
+	return results
+}
+
+func TestParallelismDeterminism(t *testing.T) {
+	defer SetConfig(nil)
+
+	var expected []string
+	for _, parallelism := range []int{1, 3, 16} {
+		conf, err := NewConfig(WithParallelism(parallelism))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// BatchNewLeafNode uses the global configuration
+		SetConfig(conf)
+		results := parallelRun(t, conf)
+		if expected == nil {
+			expected = results
+			continue
+		}
+		for i := range results {
+			if results[i] != expected[i] {
+				t.Fatalf("result %d differs with a parallelism of %d", i, parallelism)
+			}
+		}
+	}
+}
+
+func TestNewConfigWithCRS(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	proof, cis, zis, yis, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, oneKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings, err := ipa.NewIPASettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := NewConfigWithCRS(settings, WithMaxProofKeys(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Verifiers share the configuration
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 4; j++ {
+				if ok, err := VerifyVerkleProof(proof, cis, zis, yis, conf); !ok || err != nil {
+					errs[i] = fmt.Errorf("verification failed: %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := NewConfigWithCRS(nil); err == nil {
+		t.Fatal("missing settings should be rejected")
+	}
+	if _, err := NewConfigWithCRS(&ipa.IPAConfig{PrecomputedWeights: settings.PrecomputedWeights, SRS: settings.SRS[:16]}); err == nil {
+		t.Fatal("short CRS should be rejected")
+	}
+}
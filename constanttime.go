@@ -0,0 +1,123 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"crypto/subtle"
+	"fmt"
+)
+
+// WithConstantTimeVerification makes verification avoid revealing, through
+// its timing or its errors, which part of a proof didn't match. This is
+// meant for proofs about private state, where which key or value was
+// wrong is sensitive:
+//
+//   - VerifyVerkleProofWithPreState returns ErrProofInvalid instead of
+//     a detailed error;
+//   - CheckProofValues compares every value, without stopping at the
+//     first mismatch, and returns ErrProofInvalid.
+//
+// Only the values are treated as secret: the time taken still depends on
+// the number of keys and on the shape of the proof.
+func WithConstantTimeVerification(enabled bool) Option {
+	return func(conf *IPAConfig) error {
+		conf.constantTime = enabled
+		return nil
+	}
+}
+
+// verificationError hides the details of err if this configuration
+// verifies proofs in constant time.
+func (conf *IPAConfig) verificationError(err error) error {
+	if conf.constantTime {
+		return ErrProofInvalid
+	}
+	return err
+}
+
+// CheckProofValues checks that a verified proof attests the given values,
+// nil meaning that the key is absent. The keys must all be covered by the
+// proof. If conf is nil, the configuration returned by GetConfig is used.
+func CheckProofValues(proof *Proof, keys, values [][]byte, conf *Config) error {
+	if conf == nil {
+		conf = GetConfig()
+	}
+	if len(keys) != len(values) {
+		return fmt.Errorf("got %d keys and %d values", len(keys), len(values))
+	}
+	// Which keys are covered is public, only the values are compared in
+	// constant time.
+	index := make(map[string]int, len(proof.Keys))
+	for i, key := range proof.Keys {
+		index[string(key)] = i
+	}
+	positions := make([]int, len(keys))
+	for i, key := range keys {
+		pos, ok := index[string(key)]
+		if !ok || pos >= len(proof.PreValues) {
+			return fmt.Errorf("key %x isn't covered by the proof", key)
+		}
+		positions[i] = pos
+	}
+
+	equal := 1
+	for i, pos := range positions {
+		expected, err := paddedValue(values[i], conf.valueAlignment)
+		if err != nil {
+			return fmt.Errorf("value for key %x: %w", keys[i], err)
+		}
+		proven, err := paddedValue(proof.PreValues[pos], conf.valueAlignment)
+		if err != nil {
+			return fmt.Errorf("proof value for key %x: %w", keys[i], err)
+		}
+		eq := subtle.ConstantTimeCompare(expected, proven)
+		if eq == 0 && !conf.constantTime {
+			return fmt.Errorf("proof has value %x for key %x, expected %x", proof.PreValues[pos], keys[i], values[i])
+		}
+		equal &= eq
+	}
+	if equal == 0 {
+		return ErrProofInvalid
+	}
+	return nil
+}
+
+// paddedValue encodes a value as a fixed-size buffer holding its presence
+// and its canonical form, as returned by PadValue, so that any two values
+// can be compared in constant time, and that a short value is equal to
+// its padded form. Values longer than LeafValueSize are rejected.
+func paddedValue(value []byte, align ValueAlignment) ([]byte, error) {
+	var buf [1 + LeafValueSize]byte
+	if value != nil {
+		padded, err := PadValue(value, align)
+		if err != nil {
+			return nil, err
+		}
+		buf[0] = 1
+		copy(buf[1:], padded[:])
+	}
+	return buf[:], nil
+}
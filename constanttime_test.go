@@ -0,0 +1,86 @@
+package verkle
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestConstantTimeVerification(t *testing.T) {
+	t.Parallel()
+
+	ct, err := NewConfig(WithConstantTimeVerification(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, testValue, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	keys := [][]byte{zeroKeyTest, ffx32KeyTest, forkOneKeyTest}
+	// MakeVerkleMultiProof sorts the keys it is passed
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, append([][]byte{}, keys...), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := [][]byte{fourtyKeyTest, testValue, nil}
+	for _, conf := range []*Config{nil, ct} {
+		if err := CheckProofValues(proof, keys, values, conf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A value differing for the last key only
+	wrong := [][]byte{fourtyKeyTest, testValue, testValue}
+	err = CheckProofValues(proof, keys, wrong, nil)
+	if err == nil || !strings.Contains(err.Error(), "expected") {
+		t.Fatalf("expected a detailed error, got %v", err)
+	}
+	if err := CheckProofValues(proof, keys, wrong, ct); err != ErrProofInvalid {
+		t.Fatalf("expected ErrProofInvalid, got %v", err)
+	}
+	if err := CheckProofValues(proof, [][]byte{oneKeyTest}, [][]byte{nil}, ct); err == nil || errors.Is(err, ErrProofInvalid) {
+		t.Fatalf("keys missing from the proof should be reported, got %v", err)
+	}
+
+	// Values are compared in their padded form, and too long values are
+	// rejected instead of being truncated.
+	short := [][]byte{fourtyKeyTest[:1], testValue, nil}
+	for _, conf := range []*Config{nil, ct} {
+		if err := CheckProofValues(proof, keys, short, conf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	long := [][]byte{append(append([]byte{}, fourtyKeyTest...), 1), testValue, nil}
+	if err := CheckProofValues(proof, keys, long, ct); !errors.Is(err, ErrValueTooLong) {
+		t.Fatalf("expected ErrValueTooLong, got %v", err)
+	}
+
+	// Proof verification errors are hidden in constant-time mode
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd[0].SuffixDiffs[0].CurrentValue[0] ^= 1
+	dproof, err := DeserializeProof(vp, sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pretree, err := PreStateTreeFromProof(dproof, root.Commitment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VerifyVerkleProofWithPreState(dproof, pretree)
+	if err == nil || err == ErrProofInvalid {
+		t.Fatalf("expected a detailed error, got %v", err)
+	}
+	pretree.(*InternalNode).SetConfig(ct)
+	if err := VerifyVerkleProofWithPreState(dproof, pretree); err != ErrProofInvalid {
+		t.Fatalf("expected ErrProofInvalid, got %v", err)
+	}
+}
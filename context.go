@@ -0,0 +1,77 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import "context"
+
+// NodeResolverContextFn is a NodeResolverFn that also receives the context
+// of the operation it is called for, e.g. to pass it to a database query.
+type NodeResolverContextFn func(ctx context.Context, path []byte) ([]byte, error)
+
+// withContext turns a context-aware resolver into a NodeResolverFn. The
+// context is checked before each resolution, so that an operation stops
+// at the first resolution following the cancellation of ctx. A nil
+// resolver is left nil.
+func (fn NodeResolverContextFn) withContext(ctx context.Context) NodeResolverFn {
+	if fn == nil {
+		return nil
+	}
+	return func(path []byte) ([]byte, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return fn(ctx, path)
+	}
+}
+
+// GetContext is like Get, but passes ctx to the resolver. If ctx is done
+// before a node has to be resolved, the returned error wraps ctx.Err().
+func (n *InternalNode) GetContext(ctx context.Context, key []byte, resolver NodeResolverContextFn) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return n.Get(key, resolver.withContext(ctx))
+}
+
+// InsertContext is like Insert, but passes ctx to the resolver. If ctx is
+// done before a node has to be resolved, the returned error wraps
+// ctx.Err() and the value isn't inserted.
+func (n *InternalNode) InsertContext(ctx context.Context, key []byte, value []byte, resolver NodeResolverContextFn) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return n.Insert(key, value, resolver.withContext(ctx))
+}
+
+// DeleteContext is like Delete, but passes ctx to the resolver. If ctx is
+// done before a node has to be resolved, the returned error wraps
+// ctx.Err() and the value isn't deleted.
+func (n *InternalNode) DeleteContext(ctx context.Context, key []byte, resolver NodeResolverContextFn) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return n.Delete(key, resolver.withContext(ctx))
+}
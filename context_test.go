@@ -0,0 +1,69 @@
+package verkle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+type contextKey struct{}
+
+func TestContextVariants(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	db := map[string][]byte{}
+	root.(*InternalNode).Flush(func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = s
+	})
+	resolver := func(ctx context.Context, path []byte) ([]byte, error) {
+		if ctx.Value(contextKey{}) != "request" {
+			return nil, errors.New("context wasn't passed to the resolver")
+		}
+		return db[string(path)], nil
+	}
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "request")
+	tree := root.Copy().(*InternalNode)
+	val, err := tree.GetContext(ctx, zeroKeyTest, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, fourtyKeyTest) {
+		t.Fatalf("invalid value %x", val)
+	}
+	if err := tree.InsertContext(ctx, ffx32KeyTest, zeroKeyTest, resolver); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.DeleteContext(ctx, zeroKeyTest, resolver); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the context is canceled, the resolver isn't called anymore
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	tree = root.Copy().(*InternalNode)
+	if _, err := tree.GetContext(canceled, zeroKeyTest, resolver); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation error, got %v", err)
+	}
+	if err := tree.InsertContext(canceled, zeroKeyTest, zeroKeyTest, resolver); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation error, got %v", err)
+	}
+	if _, err := tree.DeleteContext(canceled, zeroKeyTest, resolver); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation error, got %v", err)
+	}
+	if val, err := tree.GetContext(ctx, zeroKeyTest, resolver); err != nil || !bytes.Equal(val, fourtyKeyTest) {
+		t.Fatalf("tree was modified by canceled operations: %x %v", val, err)
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"runtime"
 	"sort"
+	"time"
 
 	"github.com/crate-crypto/go-ipa/banderwagon"
 	"golang.org/x/sync/errgroup"
@@ -22,10 +22,14 @@ type BatchNewLeafNodeData struct {
 func BatchNewLeafNode(nodesValues []BatchNewLeafNodeData) ([]LeafNode, error) {
 	cfg := GetConfig()
 	ret := make([]LeafNode, len(nodesValues))
+	started := time.Now()
 
-	numBatches := runtime.NumCPU()
+	numBatches := cfg.numWorkers()
 	batchSize := len(nodesValues) / numBatches
 
+	// Errors are reported by order of the batches, so that the
+	// result doesn't depend on the scheduling of the goroutines.
+	errs := make([]error, numBatches)
 	group, _ := errgroup.WithContext(context.Background())
 	for i := 0; i < numBatches; i++ {
 		start := i * batchSize
@@ -73,11 +77,19 @@ func BatchNewLeafNode(nodesValues []BatchNewLeafNodeData) ([]LeafNode, error) {
 				return nil
 			}
 		}
-		group.Go(work(ret[start:end], nodesValues[start:end]))
+		i, batch := i, work(ret[start:end], nodesValues[start:end])
+		group.Go(func() error {
+			errs[i] = batch()
+			return nil
+		})
 	}
-	if err := group.Wait(); err != nil {
-		return nil, fmt.Errorf("creating leaf node: %s", err)
+	_ = group.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("creating leaf node: %s", err)
+		}
 	}
+	getLogger().Debug("Created leaf nodes", "count", len(ret), "elapsed", time.Since(started))
 
 	sort.Slice(ret, func(i, j int) bool {
 		return bytes.Compare(ret[i].stem, ret[j].stem) < 0
@@ -98,6 +110,9 @@ func firstDiffByteIdx(stem1 []byte, stem2 []byte) int {
 }
 
 func (n *InternalNode) InsertMigratedLeaves(leaves []LeafNode, resolver NodeResolverFn) error {
+	started := time.Now()
+	getLogger().Info("Inserting migrated leaves", "count", len(leaves))
+
 	sort.Slice(leaves, func(i, j int) bool {
 		return bytes.Compare(leaves[i].stem, leaves[j].stem) < 0
 	})
@@ -109,13 +124,13 @@ func (n *InternalNode) InsertMigratedLeaves(leaves []LeafNode, resolver NodeReso
 		if int(leaves[i].stem[0]) != lastChildrenIdx {
 			lastChildrenIdx = int(leaves[i].stem[0])
 			if _, ok := n.children[lastChildrenIdx].(HashedNode); ok {
-				serialized, err := resolver([]byte{byte(lastChildrenIdx)})
+				serialized, err := resolveNode(resolver, []byte{byte(lastChildrenIdx)})
 				if err != nil {
-					return fmt.Errorf("resolving node: %s", err)
+					return err
 				}
-				resolved, err := ParseNode(serialized, 1)
+				resolved, err := n.parseChild(byte(lastChildrenIdx), serialized, []byte{byte(lastChildrenIdx)})
 				if err != nil {
-					return fmt.Errorf("parsing node %x: %w", serialized, err)
+					return err
 				}
 				n.children[lastChildrenIdx] = resolved
 			}
@@ -124,44 +139,65 @@ func (n *InternalNode) InsertMigratedLeaves(leaves []LeafNode, resolver NodeReso
 	}
 
 	// We insert the migrated leaves for each subtree of the root node.
-	group, _ := errgroup.WithContext(context.Background())
-	group.SetLimit(runtime.NumCPU())
-	currStemFirstByte := 0
+	// Errors are reported by order of the subtrees, so that the result
+	// doesn't depend on the scheduling of the goroutines.
+	var (
+		subtrees          [][]LeafNode
+		currStemFirstByte = 0
+	)
 	for i := range leaves {
 		if leaves[currStemFirstByte].stem[0] != leaves[i].stem[0] {
-			start := currStemFirstByte
-			end := i
-			group.Go(func() error {
-				return n.insertMigratedLeavesSubtree(leaves[start:end], resolver)
-			})
+			subtrees = append(subtrees, leaves[currStemFirstByte:i])
 			currStemFirstByte = i
 		}
 	}
-	group.Go(func() error {
-		return n.insertMigratedLeavesSubtree(leaves[currStemFirstByte:], resolver)
-	})
-	if err := group.Wait(); err != nil {
-		return fmt.Errorf("inserting migrated leaves: %w", err)
+	subtrees = append(subtrees, leaves[currStemFirstByte:])
+	errs := make([]error, len(subtrees))
+	group, _ := errgroup.WithContext(context.Background())
+	group.SetLimit(n.config().numWorkers())
+	for i := range subtrees {
+		i := i
+		group.Go(func() error {
+			errs[i] = n.insertMigratedLeavesSubtree(subtrees[i], resolver)
+			return nil
+		})
 	}
+	_ = group.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return fmt.Errorf("inserting migrated leaves: %w", err)
+		}
+	}
+	getLogger().Info("Inserted migrated leaves", "count", len(leaves), "elapsed", time.Since(started))
 
 	return nil
 }
 
 func (n *InternalNode) insertMigratedLeavesSubtree(leaves []LeafNode, resolver NodeResolverFn) error { // skipcq: GO-R1005
+	// The children of n that the leaves are inserted under have been
+	// marked as written to by InsertMigratedLeaves, before starting the
+	// goroutines. n is shared by all of them, so it mustn't be written
+	// to here.
+	cowChild := func(parent *InternalNode, index byte) {
+		if parent != n {
+			parent.cowChild(index)
+		}
+	}
 	for i := range leaves {
 		ln := leaves[i]
+		ln.cfg = n.cfg
 		parent := n
 
 		// Look for the appropriate parent for the leaf node.
 		for {
 			if _, ok := parent.children[ln.stem[parent.depth]].(HashedNode); ok {
-				serialized, err := resolver(ln.stem[:parent.depth+1])
+				serialized, err := resolveNode(resolver, ln.stem[:parent.depth+1])
 				if err != nil {
-					return fmt.Errorf("resolving node path=%x: %w", ln.stem[:parent.depth+1], err)
+					return err
 				}
-				resolved, err := ParseNode(serialized, parent.depth+1)
+				resolved, err := parent.parseChild(ln.stem[parent.depth], serialized, ln.stem[:parent.depth+1])
 				if err != nil {
-					return fmt.Errorf("parsing node %x: %w", serialized, err)
+					return err
 				}
 				parent.children[ln.stem[parent.depth]] = resolved
 			}
@@ -171,13 +207,13 @@ func (n *InternalNode) insertMigratedLeavesSubtree(leaves []LeafNode, resolver N
 				break
 			}
 
-			parent.cowChild(ln.stem[parent.depth])
+			cowChild(parent, ln.stem[parent.depth])
 			parent = nextParent
 		}
 
 		switch node := parent.children[ln.stem[parent.depth]].(type) {
 		case Empty:
-			parent.cowChild(ln.stem[parent.depth])
+			cowChild(parent, ln.stem[parent.depth])
 			parent.children[ln.stem[parent.depth]] = &ln
 			ln.setDepth(parent.depth + 1)
 		case *LeafNode:
@@ -207,15 +243,16 @@ func (n *InternalNode) insertMigratedLeavesSubtree(leaves []LeafNode, resolver N
 			// Create the missing internal nodes.
 			for i := parent.depth + 1; i <= byte(idx); i++ {
 				nextParent := newInternalNode(parent.depth + 1).(*InternalNode)
-				parent.cowChild(ln.stem[parent.depth])
+				nextParent.cfg = parent.cfg
+				cowChild(parent, ln.stem[parent.depth])
 				parent.children[ln.stem[parent.depth]] = nextParent
 				parent = nextParent
 			}
 			// Add old and new leaf node to the latest created parent.
-			parent.cowChild(node.stem[parent.depth])
+			cowChild(parent, node.stem[parent.depth])
 			parent.children[node.stem[parent.depth]] = node
 			node.setDepth(parent.depth + 1)
-			parent.cowChild(ln.stem[parent.depth])
+			cowChild(parent, ln.stem[parent.depth])
 			parent.children[ln.stem[parent.depth]] = &ln
 			ln.setDepth(parent.depth + 1)
 		default:
@@ -0,0 +1,165 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CorruptionError is returned when corruption detection is enabled (see
+// IPAConfig.SetCorruptionDetection), and a node read through a resolver
+// does not match its commitment.
+type CorruptionError struct {
+	Path []byte // path of the corrupted node
+	Err  error  // what the check found
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("corrupted node at path %x: %v", e.Path, e.Err)
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return e.Err
+}
+
+// parseResolvedNode deserializes a node returned by a resolver and, if
+// corruption detection is enabled in conf, checks it for consistency and,
+// if expected isn't nil, that its commitment is the one recorded by its
+// parent. A resolved internal node inherits conf, which is nil for the
+// global configuration.
+func parseResolvedNode(conf *Config, serialized []byte, depth byte, path []byte, expected *Point) (VerkleNode, error) {
+	node, err := ParseNode(serialized, depth)
+	if err != nil {
+		return nil, fmt.Errorf("parsing node at path %x: %w", path, err)
+	}
+	switch n := node.(type) {
+	case *InternalNode:
+		n.cfg = conf
+	case *LeafNode:
+		n.cfg = conf
+	}
+	if conf == nil {
+		conf = GetConfig()
+	}
+	if conf.corruptionDetection() {
+		err := checkNodeCommitment(node)
+		if err == nil && expected != nil && !node.Commitment().Equal(expected) {
+			err = errors.New("commitment does not match the one recorded by its parent")
+		}
+		if err != nil {
+			getLogger().Error("Corrupted node detected", "path", hexBytes(path), "err", err)
+			return nil, &CorruptionError{Path: append([]byte{}, path...), Err: err}
+		}
+	}
+	switch n := node.(type) {
+	case *InternalNode:
+		n.clean = true
+	case *LeafNode:
+		n.clean = true
+	}
+	return node, nil
+}
+
+// parseChild deserializes the resolved child i of n, found at path, and
+// checks it against the commitment n recorded for it, if any.
+func (n *InternalNode) parseChild(i byte, serialized []byte, path []byte) (VerkleNode, error) {
+	return parseResolvedNode(n.cfg, serialized, n.depth+1, path, n.childCommitment(i, path))
+}
+
+// hashChild replaces child i of n with a HashedNode, after recording its
+// commitment if corruption detection is enabled.
+func (n *InternalNode) hashChild(i int) {
+	if n.config().corruptionDetection() {
+		if n.hashedComms == nil {
+			n.hashedComms = make(map[byte]*Point)
+		}
+		n.hashedComms[byte(i)] = new(Point).Set(n.children[i].Commitment())
+	}
+	n.children[i] = HashedNode{}
+}
+
+// childCommitment returns the commitment that the resolved child i of n,
+// found at path, is expected to have: the one recorded when it was hashed,
+// or else the one from the commitment cache. It returns nil if it isn't
+// known, e.g. if n was itself deserialized, as a serialized internal node
+// doesn't contain the commitments of its children.
+func (n *InternalNode) childCommitment(i byte, path []byte) *Point {
+	conf := n.config()
+	if !conf.corruptionDetection() {
+		return nil
+	}
+	if comm, ok := n.hashedComms[i]; ok {
+		return comm
+	}
+	if conf.commitments != nil {
+		if comm, ok := conf.commitments.Get(path); ok {
+			return comm
+		}
+	}
+	return nil
+}
+
+// checkNodeCommitment verifies that the commitments of a freshly-deserialized
+// node are consistent: the commitments of a leaf node are recomputed from
+// its values and compared to the stored ones. Since the children of an
+// internal node aren't available at that stage, its commitment can only be
+// checked for being a valid group element; it is compared to the one known
+// to its parent by parseResolvedNode.
+func checkNodeCommitment(node VerkleNode) error {
+	switch n := node.(type) {
+	case *LeafNode:
+		recomputed, err := newLeafNode(n.cfg, n.stem, n.values)
+		if err != nil {
+			return fmt.Errorf("recomputing leaf commitment: %w", err)
+		}
+		if !recomputed.c1.Equal(n.c1) {
+			return errors.New("C1 does not match the leaf values")
+		}
+		if !recomputed.c2.Equal(n.c2) {
+			return errors.New("C2 does not match the leaf values")
+		}
+		if !recomputed.commitment.Equal(n.commitment) {
+			return errors.New("leaf commitment does not match its stem and suffix commitments")
+		}
+	case *InternalNode:
+		if err := validatePoint(n.commitment); err != nil {
+			return fmt.Errorf("invalid internal node commitment: %w", err)
+		}
+	}
+	return nil
+}
+
+// validatePoint checks that a point read from an untrusted source is on
+// the curve and in the correct subgroup.
+func validatePoint(p *Point) error {
+	if !p.IsOnCurve() {
+		return errors.New("point is not on the curve")
+	}
+	var check Point
+	serialized := p.Bytes()
+	return check.SetBytes(serialized[:])
+}
@@ -0,0 +1,130 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCorruptionDetection(t *testing.T) {
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	db := map[string][]byte{}
+	root.(*InternalNode).Flush(func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = s
+	})
+
+	// Flip a bit in the last byte of the leaf value, which leaves the
+	// serialized node structurally valid.
+	leaf := db[string(zeroKeyTest[:1])]
+	leaf[len(leaf)-1] ^= 1
+	resolver := func(path []byte) ([]byte, error) {
+		return db[string(path)], nil
+	}
+
+	// Without corruption detection, the corrupted value is returned.
+	val, err := root.Copy().Get(zeroKeyTest, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(val, fourtyKeyTest) {
+		t.Fatal("corrupted value should have been returned")
+	}
+
+	GetConfig().SetCorruptionDetection(true)
+	defer GetConfig().SetCorruptionDetection(false)
+	logger := &recordingLogger{}
+	SetLogger(logger)
+	defer SetLogger(nil)
+
+	_, err = root.Copy().Get(zeroKeyTest, resolver)
+	var cerr *CorruptionError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected a corruption error, got %v", err)
+	}
+	if !bytes.Equal(cerr.Path, zeroKeyTest[:1]) {
+		t.Fatalf("invalid corruption path %x", cerr.Path)
+	}
+	if logger.find("error", "Corrupted node detected") == nil {
+		t.Fatal("corruption wasn't logged")
+	}
+
+	// The uncorrupted leaf still resolves
+	val, err = root.Copy().Get(ffx32KeyTest, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, fourtyKeyTest) {
+		t.Fatalf("invalid value %x", val)
+	}
+}
+
+func TestCorruptionDetectionParentCommitment(t *testing.T) {
+	t.Parallel()
+
+	conf, err := NewConfig(WithCorruptionDetection(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := NewWithConfig(conf)
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	stale, err := root.(*InternalNode).children[0].Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatal(err)
+	}
+	db := map[string][]byte{}
+	root.(*InternalNode).Flush(func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = s
+	})
+	resolver := func(path []byte) ([]byte, error) {
+		return db[string(path)], nil
+	}
+
+	val, err := root.Copy().Get(zeroKeyTest, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, testValue) {
+		t.Fatalf("invalid value %x", val)
+	}
+
+	// A stale version of the leaf is internally consistent, but doesn't
+	// match the commitment recorded by the root.
+	db[string(zeroKeyTest[:1])] = stale
+	_, err = root.Copy().Get(zeroKeyTest, resolver)
+	var cerr *CorruptionError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected a corruption error, got %v", err)
+	}
+	if !bytes.Equal(cerr.Path, zeroKeyTest[:1]) {
+		t.Fatalf("invalid corruption path %x", cerr.Path)
+	}
+
+	// So is a node stored at the wrong path.
+	db[string(zeroKeyTest[:1])] = db[string(ffx32KeyTest[:1])]
+	if _, err := root.Copy().Get(zeroKeyTest, resolver); !errors.As(err, &cerr) {
+		t.Fatalf("expected a corruption error, got %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+// Package debughttp provides a net/http handler to inspect a verkle tree
+// at runtime, meant to be mounted on a node's debug port. It exposes the
+// following read-only endpoints, relative to where it is mounted:
+//
+//	GET stats                   statistics about the in-memory part of the tree
+//	GET cache                   statistics of the node cache, if any
+//	GET get?key=<hex>           value stored at a key
+//	GET prove?keys=<hex,...>    proof for a set of keys, with its state diff
+//
+// All responses are JSON-encoded.
+package debughttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gballet/go-verkle"
+)
+
+// Config describes the tree served by the handler.
+type Config struct {
+	// Root returns the root of the tree to inspect. It is called on
+	// each request, so that the handler follows the current tree.
+	Root func() verkle.VerkleNode
+
+	// Resolver is used to resolve the nodes that aren't in memory.
+	// When it is nil, only the in-memory part of the tree is served.
+	Resolver verkle.NodeResolverFn
+
+	// Cache is the node cache whose statistics are reported, if any.
+	Cache *verkle.NodeCache
+
+	// Lock, if not nil, is held while a request accesses the tree.
+	// Committing and proving modify the tree, so it must be the lock
+	// guarding the tree against concurrent writes.
+	Lock sync.Locker
+}
+
+type handler struct {
+	config Config
+	mux    *http.ServeMux
+}
+
+// NewHandler creates a handler serving the tree described by config.
+func NewHandler(config Config) http.Handler {
+	h := &handler{config: config, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/stats", h.serveStats)
+	h.mux.HandleFunc("/cache", h.serveCache)
+	h.mux.HandleFunc("/get", h.serveGet)
+	h.mux.HandleFunc("/prove", h.serveProve)
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only GET requests are supported"))
+		return
+	}
+	// Accept both relative and absolute paths, so that the handler
+	// can be mounted with or without http.StripPrefix.
+	if !strings.HasPrefix(r.URL.Path, "/") {
+		r.URL.Path = "/" + r.URL.Path
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// withTree calls fn with the root of the tree, holding the lock if any.
+func (h *handler) withTree(fn func(root verkle.VerkleNode) error) error {
+	if h.config.Lock != nil {
+		h.config.Lock.Lock()
+		defer h.config.Lock.Unlock()
+	}
+	root := h.config.Root()
+	if root == nil {
+		return errors.New("no tree available")
+	}
+	return fn(root)
+}
+
+// TreeStats is the response of the stats endpoint. Only the in-memory
+// part of the tree is walked: nodes that haven't been resolved are
+// counted as HashedNodes.
+type TreeStats struct {
+	Root          string      `json:"root"`
+	InternalNodes int         `json:"internalNodes"`
+	LeafNodes     int         `json:"leafNodes"`
+	HashedNodes   int         `json:"hashedNodes"`
+	Values        int         `json:"values"`
+	MaxDepth      int         `json:"maxDepth"`
+	LeavesByDepth map[int]int `json:"leavesByDepth"`
+}
+
+func (s *TreeStats) walk(node verkle.VerkleNode, depth int) {
+	switch n := node.(type) {
+	case *verkle.InternalNode:
+		s.InternalNodes++
+		for _, child := range n.Children() {
+			s.walk(child, depth+1)
+		}
+	case verkle.HashedNode:
+		s.HashedNodes++
+	case *verkle.LeafNode:
+		s.LeafNodes++
+		s.LeavesByDepth[depth]++
+		if depth > s.MaxDepth {
+			s.MaxDepth = depth
+		}
+		for _, v := range n.Values() {
+			if v != nil {
+				s.Values++
+			}
+		}
+	}
+}
+
+func (h *handler) serveStats(w http.ResponseWriter, _ *http.Request) {
+	stats := TreeStats{LeavesByDepth: map[int]int{}}
+	err := h.withTree(func(root verkle.VerkleNode) error {
+		rootBytes := root.Commit().Bytes()
+		stats.Root = verkle.HexToPrefixedString(rootBytes[:])
+		stats.walk(root, 0)
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, stats)
+}
+
+func (h *handler) serveCache(w http.ResponseWriter, _ *http.Request) {
+	if h.config.Cache == nil {
+		writeError(w, http.StatusNotFound, errors.New("no node cache configured"))
+		return
+	}
+	writeJSON(w, h.config.Cache.Stats())
+}
+
+// GetResponse is the response of the get endpoint. Value is empty if
+// the key isn't present in the tree.
+type GetResponse struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+func (h *handler) serveGet(w http.ResponseWriter, r *http.Request) {
+	key, err := verkle.PrefixedHexStringToBytes(r.URL.Query().Get("key"))
+	if err != nil || len(key) != verkle.StemSize+1 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid key %q", r.URL.Query().Get("key")))
+		return
+	}
+	resp := GetResponse{Key: verkle.HexToPrefixedString(key)}
+	err = h.withTree(func(root verkle.VerkleNode) error {
+		value, err := root.Get(key, h.config.Resolver)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			resp.Value = verkle.HexToPrefixedString(value)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// ProveResponse is the response of the prove endpoint, in the format
+// of the verkle command's proof files.
+type ProveResponse struct {
+	Root      string              `json:"root"`
+	Proof     *verkle.VerkleProof `json:"verkleProof"`
+	StateDiff verkle.StateDiff    `json:"stateDiff"`
+}
+
+func (h *handler) serveProve(w http.ResponseWriter, r *http.Request) {
+	list := r.URL.Query().Get("keys")
+	if list == "" {
+		writeError(w, http.StatusBadRequest, errors.New("no keys to prove"))
+		return
+	}
+	var keys [][]byte
+	for _, k := range strings.Split(list, ",") {
+		key, err := verkle.PrefixedHexStringToBytes(strings.TrimSpace(k))
+		if err != nil || len(key) != verkle.StemSize+1 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid key %q", k))
+			return
+		}
+		keys = append(keys, key)
+	}
+
+	var resp ProveResponse
+	err := h.withTree(func(root verkle.VerkleNode) error {
+		rootBytes := root.Commit().Bytes()
+		proof, _, _, _, err := verkle.MakeVerkleMultiProof(root, nil, keys, h.config.Resolver)
+		if err != nil {
+			return fmt.Errorf("creating proof: %w", err)
+		}
+		resp.Proof, resp.StateDiff, err = verkle.SerializeProof(proof)
+		if err != nil {
+			return fmt.Errorf("serializing proof: %w", err)
+		}
+		resp.Root = verkle.HexToPrefixedString(rootBytes[:])
+		return nil
+	})
+	if errors.Is(err, verkle.ErrTooManyProofKeys) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
@@ -0,0 +1,128 @@
+package debughttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gballet/go-verkle"
+)
+
+var (
+	key1  = "0x" + strings.Repeat("00", 32)
+	key2  = "0x" + strings.Repeat("ff", 32)
+	value = "0x" + strings.Repeat("01", 32)
+)
+
+func newTestServer(t *testing.T, cache *verkle.NodeCache) *httptest.Server {
+	t.Helper()
+
+	root := verkle.New()
+	for _, k := range []string{key1, key2} {
+		key, _ := verkle.PrefixedHexStringToBytes(k)
+		val, _ := verkle.PrefixedHexStringToBytes(value)
+		if err := root.Insert(key, val, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/debug/verkle/", http.StripPrefix("/debug/verkle/", NewHandler(Config{
+		Root:  func() verkle.VerkleNode { return root },
+		Cache: cache,
+		Lock:  &sync.Mutex{},
+	})))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, url string, status int, v interface{}) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		t.Fatalf("GET %s: got status %d, expected %d", url, resp.StatusCode, status)
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t, verkle.NewNodeCache(1, 16, 16))
+	base := srv.URL + "/debug/verkle/"
+
+	var stats TreeStats
+	get(t, base+"stats", http.StatusOK, &stats)
+	if stats.InternalNodes != 1 || stats.LeafNodes != 2 || stats.Values != 2 || stats.MaxDepth != 1 {
+		t.Fatalf("invalid stats %+v", stats)
+	}
+
+	var cacheStats verkle.NodeCacheStats
+	get(t, base+"cache", http.StatusOK, &cacheStats)
+	if cacheStats.PinnedCapacity != 16 {
+		t.Fatalf("invalid cache stats %+v", cacheStats)
+	}
+
+	var got GetResponse
+	get(t, base+"get?key="+key1, http.StatusOK, &got)
+	if got.Value != value {
+		t.Fatalf("invalid value %s", got.Value)
+	}
+	got = GetResponse{}
+	get(t, base+"get?key=0x"+strings.Repeat("00", 31)+"01", http.StatusOK, &got)
+	if got.Value != "" {
+		t.Fatalf("absent key has value %s", got.Value)
+	}
+	get(t, base+"get?key=0x00", http.StatusBadRequest, nil)
+
+	var proof ProveResponse
+	get(t, base+"prove?keys="+key1+","+key2, http.StatusOK, &proof)
+	if proof.Root != stats.Root || proof.Proof == nil || len(proof.StateDiff) != 2 {
+		t.Fatalf("invalid proof response %+v", proof)
+	}
+	rootBytes, _ := verkle.PrefixedHexStringToBytes(proof.Root)
+	var rootC verkle.Point
+	if err := rootC.SetBytes(rootBytes); err != nil {
+		t.Fatal(err)
+	}
+	dproof, err := verkle.DeserializeProof(proof.Proof, proof.StateDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preroot, err := verkle.PreStateTreeFromProof(dproof, &rootC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verkle.VerifyVerkleProofWithPreState(dproof, preroot); err != nil {
+		t.Fatalf("served proof does not verify: %v", err)
+	}
+	get(t, base+"prove", http.StatusBadRequest, nil)
+
+	resp, err := http.Post(base+"stats", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("POST request got status %d", resp.StatusCode)
+	}
+}
+
+func TestHandlerWithoutCache(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t, nil)
+	get(t, srv.URL+"/debug/verkle/cache", http.StatusNotFound, nil)
+}
@@ -0,0 +1,111 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The Decode* functions below are entry points for decoding untrusted
+// input, e.g. proofs received from the network. They behave like the
+// functions they wrap, except that they never panic: a panic in the
+// decoder is reported as a *DecodePanicError. Since such a panic is a
+// bug, the fuzz tests fail when one is returned.
+
+// DecodePanicError is returned by the Decode* functions when decoding
+// the input triggered a panic.
+type DecodePanicError struct {
+	Value interface{} // value passed to panic
+}
+
+func (e *DecodePanicError) Error() string {
+	return fmt.Sprintf("panic while decoding: %v", e.Value)
+}
+
+func recoverDecodePanic(err *error) {
+	if r := recover(); r != nil {
+		*err = &DecodePanicError{Value: r}
+	}
+}
+
+var errNilProof = errors.New("nil proof")
+
+// DecodeVerkleProofJSON decodes a JSON-encoded VerkleProof.
+func DecodeVerkleProofJSON(data []byte) (vp *VerkleProof, err error) {
+	defer recoverDecodePanic(&err)
+
+	vp = new(VerkleProof)
+	if err := json.Unmarshal(data, vp); err != nil {
+		return nil, err
+	}
+	return vp, nil
+}
+
+// DecodeStateDiffJSON decodes a JSON-encoded StateDiff.
+func DecodeStateDiffJSON(data []byte) (sd StateDiff, err error) {
+	defer recoverDecodePanic(&err)
+
+	if err := json.Unmarshal(data, &sd); err != nil {
+		return nil, err
+	}
+	return sd, nil
+}
+
+// DecodeProof turns a VerkleProof and its StateDiff into a Proof. See
+// DeserializeProof.
+func DecodeProof(vp *VerkleProof, statediff StateDiff) (proof *Proof, err error) {
+	defer recoverDecodePanic(&err)
+
+	if vp == nil {
+		return nil, errNilProof
+	}
+	return DeserializeProof(vp, statediff)
+}
+
+// DecodeProofStrict is DecodeProof, rejecting malformed inputs. See
+// DeserializeProofStrict.
+func DecodeProofStrict(vp *VerkleProof, statediff StateDiff) (proof *Proof, err error) {
+	defer recoverDecodePanic(&err)
+
+	return DeserializeProofStrict(vp, statediff)
+}
+
+// DecodeNode deserializes a node. See ParseNode.
+func DecodeNode(serialized []byte, depth byte) (node VerkleNode, err error) {
+	defer recoverDecodePanic(&err)
+
+	return ParseNode(serialized, depth)
+}
+
+// DecodeRustProof decodes a proof serialized by rust-verkle, and pairs
+// it with its StateDiff. See DeserializeRustProof.
+func DecodeRustProof(serialized []byte, statediff StateDiff) (proof *Proof, err error) {
+	defer recoverDecodePanic(&err)
+
+	return DeserializeRustProof(serialized, statediff)
+}
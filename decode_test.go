@@ -0,0 +1,144 @@
+package verkle
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// proofFixture returns a serialized proof covering a presence, an absence
+// with another stem, and an absence with an empty path.
+func proofFixture(tb testing.TB) (*VerkleProof, StateDiff) {
+	tb.Helper()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		tb.Fatal(err)
+	}
+	if err := root.Insert(forkOneKeyTest, fourtyKeyTest, nil); err != nil {
+		tb.Fatal(err)
+	}
+	root.Commit()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest}, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return vp, sd
+}
+
+func checkNoDecodePanic(t *testing.T, err error) {
+	t.Helper()
+	var perr *DecodePanicError
+	if errors.As(err, &perr) {
+		t.Fatal(perr)
+	}
+}
+
+func FuzzDecodeVerkleProofJSON(f *testing.F) {
+	vp, _ := proofFixture(f)
+	encoded, err := json.Marshal(vp)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(encoded)
+	f.Add([]byte(`{}`))
+	f.Add([]byte(`{"ipaProof":null}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		vp, err := DecodeVerkleProofJSON(data)
+		checkNoDecodePanic(t, err)
+		if err == nil {
+			_, err = DecodeProof(vp, nil)
+			checkNoDecodePanic(t, err)
+		}
+	})
+}
+
+func FuzzDecodeStateDiffJSON(f *testing.F) {
+	_, sd := proofFixture(f)
+	encoded, err := json.Marshal(sd)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(encoded)
+	f.Add([]byte(`[]`))
+	f.Add([]byte(`[{"stem":"0x00","suffixDiffs":[{"suffix":1}]}]`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, err := DecodeStateDiffJSON(data)
+		checkNoDecodePanic(t, err)
+	})
+}
+
+func FuzzDecodeProof(f *testing.F) {
+	vp, sd := proofFixture(f)
+	encodedProof, err := json.Marshal(vp)
+	if err != nil {
+		f.Fatal(err)
+	}
+	encodedDiff, err := json.Marshal(sd)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(encodedProof, encodedDiff)
+
+	f.Fuzz(func(t *testing.T, proofData, diffData []byte) {
+		vp, err := DecodeVerkleProofJSON(proofData)
+		checkNoDecodePanic(t, err)
+		if err != nil {
+			return
+		}
+		sd, err := DecodeStateDiffJSON(diffData)
+		checkNoDecodePanic(t, err)
+		if err != nil {
+			return
+		}
+		_, err = DecodeProofStrict(vp, sd)
+		checkNoDecodePanic(t, err)
+		proof, err := DecodeProof(vp, sd)
+		checkNoDecodePanic(t, err)
+		if err == nil {
+			// Reconstruct the tree as a stateless client would
+			_, err = PreStateTreeFromProof(proof, new(Point))
+			checkNoDecodePanic(t, err)
+		}
+	})
+}
+
+func FuzzDecodeRustProof(f *testing.F) {
+	vp, sd := proofFixture(f)
+	f.Add(rustProofBytes(vp))
+	f.Add(make([]byte, 12+rustMultiproofSize))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, err := DecodeRustProof(data, sd)
+		checkNoDecodePanic(t, err)
+	})
+}
+
+func FuzzDecodeNode(f *testing.F) {
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		f.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		f.Fatal(err)
+	}
+	root.(*InternalNode).Flush(func(_ []byte, n VerkleNode) {
+		serialized, err := n.Serialize()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(serialized, byte(len(serialized)%2))
+	})
+	f.Add([]byte{leafRLPType}, byte(1))
+
+	f.Fuzz(func(t *testing.T, data []byte, depth byte) {
+		_, err := DecodeNode(data, depth)
+		checkNoDecodePanic(t, err)
+	})
+}
@@ -0,0 +1,189 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/crate-crypto/go-ipa/banderwagon"
+)
+
+const (
+	// dedupLeafType marks a leaf record whose contents are stored
+	// separately. It can't collide with internalRLPType/leafRLPType.
+	dedupLeafType byte = 0xd1
+
+	dedupRefSize    = sha256.Size
+	dedupRecordSize = nodeTypeSize + StemSize + banderwagon.UncompressedSize + dedupRefSize
+	dedupCountSize  = 8
+)
+
+var dedupContentPrefix = []byte("verkle-leaf-content-")
+
+// DedupStore is a NodeStore storing the contents of serialized leaf nodes
+// (bitlist, C1, C2 and values) once, whatever the number of leaves sharing
+// them. Each leaf is replaced with a record holding its stem, commitment
+// and the hash of its contents, and the contents are reference-counted.
+// Other values are passed through unchanged.
+type DedupStore struct {
+	lock    sync.Mutex
+	backend NodeStore
+}
+
+func NewDedupStore(backend NodeStore) *DedupStore {
+	return &DedupStore{backend: backend}
+}
+
+func dedupContentKey(ref []byte) []byte {
+	return append(append([]byte{}, dedupContentPrefix...), ref...)
+}
+
+func (s *DedupStore) Get(key []byte) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	record, err := s.backend.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(record) == 0 || record[0] != dedupLeafType {
+		return record, nil
+	}
+	if len(record) != dedupRecordSize {
+		return nil, fmt.Errorf("invalid deduplicated leaf record size %d", len(record))
+	}
+	content, err := s.backend.Get(dedupContentKey(record[dedupRecordSize-dedupRefSize:]))
+	if err != nil {
+		return nil, fmt.Errorf("reading leaf contents: %w", err)
+	}
+	if len(content) < dedupCountSize {
+		return nil, errors.New("invalid leaf content record")
+	}
+	content = content[dedupCountSize:]
+
+	// Rebuild the leaf: <nodeType><stem><bitlist><comm><c1comm><c2comm><children...>
+	stemAndComm := record[nodeTypeSize : dedupRecordSize-dedupRefSize]
+	serialized := make([]byte, 0, nodeTypeSize+len(stemAndComm)+len(content))
+	serialized = append(serialized, leafRLPType)
+	serialized = append(serialized, stemAndComm[:StemSize]...)
+	serialized = append(serialized, content[:bitlistSize]...)
+	serialized = append(serialized, stemAndComm[StemSize:]...)
+	serialized = append(serialized, content[bitlistSize:]...)
+	return serialized, nil
+}
+
+func (s *DedupStore) Put(key []byte, value []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.release(key); err != nil {
+		return err
+	}
+	if len(value) < leafChildrenOffset || value[0] != leafRLPType {
+		return s.backend.Put(key, value)
+	}
+
+	// Split the leaf between what is specific to this stem, and
+	// what only depends on the values.
+	content := make([]byte, 0, bitlistSize+len(value)-leafC1CommitmentOffset)
+	content = append(content, value[leafBitlistOffset:leafCommitmentOffset]...)
+	content = append(content, value[leafC1CommitmentOffset:]...)
+	ref := sha256.Sum256(content)
+
+	contentKey := dedupContentKey(ref[:])
+	stored, err := s.backend.Get(contentKey)
+	switch {
+	case err == nil:
+		if len(stored) < dedupCountSize {
+			return errors.New("invalid leaf content record")
+		}
+		updated := append([]byte{}, stored...)
+		binary.BigEndian.PutUint64(updated, binary.BigEndian.Uint64(stored)+1)
+		if err := s.backend.Put(contentKey, updated); err != nil {
+			return err
+		}
+	case errors.Is(err, ErrNotFound):
+		stored = make([]byte, dedupCountSize+len(content))
+		binary.BigEndian.PutUint64(stored, 1)
+		copy(stored[dedupCountSize:], content)
+		if err := s.backend.Put(contentKey, stored); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	record := make([]byte, 0, dedupRecordSize)
+	record = append(record, dedupLeafType)
+	record = append(record, value[leafSteamOffset:leafSteamOffset+StemSize]...)
+	record = append(record, value[leafCommitmentOffset:leafC1CommitmentOffset]...)
+	record = append(record, ref[:]...)
+	return s.backend.Put(key, record)
+}
+
+func (s *DedupStore) Delete(key []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.release(key); err != nil {
+		return err
+	}
+	return s.backend.Delete(key)
+}
+
+// release drops the reference held by the record at key, if any. The
+// content is deleted once it is no longer referenced.
+func (s *DedupStore) release(key []byte) error {
+	record, err := s.backend.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(record) != dedupRecordSize || record[0] != dedupLeafType {
+		return nil
+	}
+	contentKey := dedupContentKey(record[dedupRecordSize-dedupRefSize:])
+	stored, err := s.backend.Get(contentKey)
+	if err != nil {
+		return fmt.Errorf("reading leaf contents: %w", err)
+	}
+	if len(stored) < dedupCountSize {
+		return errors.New("invalid leaf content record")
+	}
+	count := binary.BigEndian.Uint64(stored)
+	if count <= 1 {
+		return s.backend.Delete(contentKey)
+	}
+	updated := append([]byte{}, stored...)
+	binary.BigEndian.PutUint64(updated, count-1)
+	return s.backend.Put(contentKey, updated)
+}
@@ -0,0 +1,80 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDedupStore(t *testing.T) {
+	t.Parallel()
+
+	var stem1, stem2 [StemSize]byte
+	stem2[0] = 1
+	values := make([][]byte, NodeWidth)
+	values[0] = testValue
+	values[200] = fourtyKeyTest
+	leaf1, err := NewLeafNode(stem1[:], values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf2, err := NewLeafNode(stem2[:], values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ser1, _ := leaf1.Serialize()
+	ser2, _ := leaf2.Serialize()
+	internal, _ := New().Serialize()
+
+	backend := NewMemoryStore()
+	store := NewDedupStore(backend)
+	for key, value := range map[string][]byte{"a": ser1, "b": ser2, "c": internal} {
+		if err := store.Put([]byte(key), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 3 records + a single shared leaf content
+	if backend.Len() != 4 {
+		t.Fatalf("invalid number of entries in backend: %d", backend.Len())
+	}
+
+	for key, value := range map[string][]byte{"a": ser1, "b": ser2, "c": internal} {
+		got, err := store.Get([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, value) {
+			t.Fatalf("invalid value for key %s: %x != %x", key, got, value)
+		}
+	}
+	node, err := ParseNode(mustGet(t, store, "b"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !node.Commitment().Equal(leaf2.Commitment()) {
+		t.Fatal("invalid commitment after deserialization")
+	}
+
+	// Deleting one of the leaves keeps the shared contents
+	if err := store.Delete([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	// Overwriting the last reference drops the shared contents
+	if err := store.Put([]byte("b"), internal); err != nil {
+		t.Fatal(err)
+	}
+	if backend.Len() != 2 {
+		t.Fatalf("unreferenced content wasn't deleted: %d entries left", backend.Len())
+	}
+}
+
+func mustGet(t *testing.T, store NodeStore, key string) []byte {
+	t.Helper()
+	value, err := store.Get([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
@@ -25,22 +25,228 @@
 
 package verkle
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
+// Errors returned by tree operations. They are usually wrapped with the
+// path of the node where the error occurred, so errors.Is has to be used
+// to check for them.
 var (
-	errInsertIntoHash         = errors.New("trying to insert into hashed node")
-	errDeleteHash             = errors.New("trying to delete from a hashed subtree")
-	errReadFromInvalid        = errors.New("trying to read from an invalid child")
-	errSerializeHashedNode    = errors.New("trying to serialize a hashed internal node")
-	errInsertIntoOtherStem    = errors.New("insert splits a stem where it should not happen")
-	errUnknownNodeType        = errors.New("unknown node type detected")
-	errMissingNodeInStateless = errors.New("trying to access a node that is missing from the stateless view")
-	errIsPOAStub              = errors.New("trying to read/write a proof of absence leaf node")
+	ErrInsertIntoHash         = errors.New("trying to insert into hashed node")
+	ErrDeleteHash             = errors.New("trying to delete from a hashed subtree")
+	ErrReadFromInvalid        = errors.New("trying to read from an invalid child")
+	ErrSerializeHashedNode    = errors.New("trying to serialize a hashed internal node")
+	ErrInsertIntoOtherStem    = errors.New("insert splits a stem where it should not happen")
+	ErrUnknownNodeType        = errors.New("unknown node type detected")
+	ErrMissingNodeInStateless = errors.New("trying to access a node that is missing from the stateless view")
+	ErrIsPOAStub              = errors.New("trying to read/write a proof of absence leaf node")
+
+	// ErrNotResolvable is matched by the errors returned when a resolver
+	// fails, see ResolveError. Whether the operation can be retried
+	// depends on the underlying resolver error.
+	ErrNotResolvable = errors.New("node could not be resolved")
+
+	// ErrValueTooLong is returned when a value is longer than
+	// LeafValueSize.
+	ErrValueTooLong = errors.New("value is too long")
+
+	// ErrInvalidValue is returned when a value isn't accepted by the
+	// validation mode set with WithValueValidation, see ValueSizeError.
+	ErrInvalidValue = errors.New("invalid value")
+
+	// ErrConcurrentAccess is returned when an internal node is used by
+	// several goroutines at the same time. Commit and Flush, which can't
+	// return an error, only log it, see TryCommit and TryFlush.
+	ErrConcurrentAccess = errors.New("concurrent use of a tree node")
+
+	// ErrTooManyProofKeys is returned when a proof covers more keys than
+	// allowed by WithMaxProofKeys.
+	ErrTooManyProofKeys = errors.New("too many keys in proof")
+
+	// ErrProofInvalid is returned instead of a detailed error when a
+	// proof fails to verify with WithConstantTimeVerification.
+	ErrProofInvalid = errors.New("invalid proof")
+
+	// ErrProvingUnsupported is returned when generating a proof with
+	// LocalProver fails because the precomputed tables it requires, which
+	// verkle_small builds only build on demand, can't be created.
+	ErrProvingUnsupported = errors.New("proof generation isn't supported")
+
+	// ErrStatelessProof is returned when proving keys in a stateless
+	// tree, such as one rebuilt from a proof. Creating a proof requires
+	// the polynomials of all the nodes along the proven paths, i.e. the
+	// commitments of all the children of their internal nodes and all the
+	// values of their leaves, which a proof doesn't contain.
+	ErrStatelessProof = errors.New("can't prove keys in a stateless tree")
+
+	// ErrCommitment is matched by errors happening while computing a
+	// commitment, which usually means that the node values are invalid.
+	ErrCommitment = errors.New("commitment computation failed")
 )
 
+// ResolveError is returned when a resolver fails to return the node at
+// a given path. It matches ErrNotResolvable, and wraps the error returned
+// by the resolver.
+type ResolveError struct {
+	Path []byte // path of the node that couldn't be resolved
+	Err  error  // error returned by the resolver
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("resolving node at path %x: %v", e.Path, e.Err)
+}
+
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ResolveError) Is(target error) bool {
+	return target == ErrNotResolvable
+}
+
+// CommitmentError is returned when the commitment of the node at a given
+// path can't be computed. It matches ErrCommitment.
+type CommitmentError struct {
+	Path []byte // path of the node
+	Err  error  // underlying error
+}
+
+func (e *CommitmentError) Error() string {
+	return fmt.Sprintf("computing commitment at path %x: %v", e.Path, e.Err)
+}
+
+func (e *CommitmentError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CommitmentError) Is(target error) bool {
+	return target == ErrCommitment
+}
+
+// ProofKeysError is returned when a proof covers more keys than allowed
+// by WithMaxProofKeys. It matches ErrTooManyProofKeys.
+type ProofKeysError struct {
+	Keys int // number of keys in the proof
+	Max  int // maximum number of keys allowed
+}
+
+func (e *ProofKeysError) Error() string {
+	return fmt.Sprintf("%v: %d keys, at most %d allowed", ErrTooManyProofKeys, e.Keys, e.Max)
+}
+
+func (e *ProofKeysError) Is(target error) bool {
+	return target == ErrTooManyProofKeys
+}
+
+// ValueSizeError is returned when inserting a value whose size isn't
+// allowed by WithValueValidation. It matches ErrInvalidValue.
+type ValueSizeError struct {
+	Key  []byte // key of the value
+	Size int    // size of the value
+}
+
+func (e *ValueSizeError) Error() string {
+	return fmt.Sprintf("%v: %d-byte value at key %x, expected %d", ErrInvalidValue, e.Size, e.Key, LeafValueSize)
+}
+
+func (e *ValueSizeError) Is(target error) bool {
+	return target == ErrInvalidValue
+}
+
+// VerificationStep is the step at which a proof failed to verify, see
+// VerificationError.
+type VerificationStep int
+
+const (
+	StepInputs     VerificationStep = iota // the openings or the proof are malformed
+	StepOpenings                           // two openings of the same commitment at the same point disagree
+	StepTranscript                         // the proof was made with another transcript label
+	StepMultipoint                         // the multipoint argument doesn't check out
+)
+
+func (s VerificationStep) String() string {
+	switch s {
+	case StepInputs:
+		return "inputs"
+	case StepOpenings:
+		return "openings"
+	case StepTranscript:
+		return "transcript"
+	case StepMultipoint:
+		return "multipoint"
+	default:
+		return fmt.Sprintf("invalid (%d)", int(s))
+	}
+}
+
+// VerificationError is returned by CheckVerkleProof when a proof fails to
+// verify. It matches ErrProofInvalid.
+type VerificationError struct {
+	Step  VerificationStep
+	Index int   // index of the opening at fault, -1 if the failure can't be attributed to one
+	Err   error // what went wrong
+}
+
+func (e *VerificationError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("%v: %s check failed: %v", ErrProofInvalid, e.Step, e.Err)
+	}
+	return fmt.Sprintf("%v: %s check failed at opening %d: %v", ErrProofInvalid, e.Step, e.Index, e.Err)
+}
+
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *VerificationError) Is(target error) bool {
+	return target == ErrProofInvalid
+}
+
 const (
 	// Extension status
-	extStatusAbsentEmpty = byte(iota) // missing child node along the path
-	extStatusAbsentOther              // path led to a node with a different stem
-	extStatusPresent                  // stem was present
+	extStatusAbsentEmpty = byte(ExtStatusAbsentEmpty)
+	extStatusAbsentOther = byte(ExtStatusAbsentOther)
+	extStatusPresent     = byte(ExtStatusPresent)
 )
+
+// ExtStatus is the extension status of a stem in a proof, which tells
+// what was found at the end of its path in the tree.
+type ExtStatus byte
+
+const (
+	ExtStatusAbsentEmpty ExtStatus = iota // missing child node along the path
+	ExtStatusAbsentOther                  // path led to a node with a different stem
+	ExtStatusPresent                      // stem was present
+)
+
+const (
+	extStatusMask       = 3 // bits of an encoded extension status holding the status
+	extStatusDepthShift = 3 // shift of the depth in an encoded extension status
+)
+
+func (s ExtStatus) String() string {
+	switch s {
+	case ExtStatusAbsentEmpty:
+		return "absent (empty)"
+	case ExtStatusAbsentOther:
+		return "absent (other stem)"
+	case ExtStatusPresent:
+		return "present"
+	default:
+		return fmt.Sprintf("invalid (%d)", byte(s))
+	}
+}
+
+// DecodeExtStatus splits an item of Proof.ExtStatus, or of the
+// DepthExtensionPresent field of a VerkleProof, into the depth of the
+// stem in the tree and its extension status.
+func DecodeExtStatus(b byte) (depth byte, status ExtStatus) {
+	return b >> extStatusDepthShift, ExtStatus(b & extStatusMask)
+}
+
+// EncodeExtStatus is the reverse of DecodeExtStatus.
+func EncodeExtStatus(depth byte, status ExtStatus) byte {
+	return depth<<extStatusDepthShift | byte(status)&extStatusMask
+}
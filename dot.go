@@ -0,0 +1,116 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dotCommitmentBytes is the number of commitment bytes displayed in
+// the labels of the compact DOT output.
+const dotCommitmentBytes = 4
+
+func truncatedCommitment(p *Point) string {
+	if p == nil {
+		return "nil"
+	}
+	b := p.Bytes()
+	return fmt.Sprintf("%x…", b[:dotCommitmentBytes])
+}
+
+// ToDotCompact renders the tree in DOT format, like ToDot, but with
+// short labels: each node only shows its depth and a truncated
+// commitment, and leaves show their stem and number of values instead
+// of the values themselves. This keeps large trees readable.
+func ToDotCompact(root VerkleNode) string {
+	root.Commit()
+	var sb strings.Builder
+	sb.WriteString("digraph D {\n")
+	writeDotNode(&sb, root, "", nil)
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// ProofToDot renders the part of the tree covered by a proof, given the
+// root commitment it was created against. The tree is rebuilt from the
+// proof, so this doesn't require access to the full tree, which makes
+// it possible to compare the witness of a block with what a full node
+// would have produced.
+func ProofToDot(proof *Proof, rootC *Point) (string, error) {
+	root, err := PreStateTreeFromProof(proof, rootC)
+	if err != nil {
+		return "", fmt.Errorf("rebuilding tree from proof: %w", err)
+	}
+	var sb strings.Builder
+	sb.WriteString("digraph D {\n")
+	writeDotNode(&sb, root, "", nil)
+	sb.WriteString("}\n")
+	return sb.String(), nil
+}
+
+func dotName(prefix string, path []byte) string {
+	return fmt.Sprintf("%s%x", prefix, path)
+}
+
+func writeDotNode(sb *strings.Builder, node VerkleNode, parent string, path []byte) {
+	var me string
+	switch n := node.(type) {
+	case *InternalNode:
+		me = dotName("internal", path)
+		fmt.Fprintf(sb, "%s [label=\"I depth=%d\\nC: %s\"]\n", me, n.depth, truncatedCommitment(n.commitment))
+		for i, child := range n.children {
+			if _, ok := child.(Empty); ok || child == nil {
+				continue
+			}
+			childPath := append(append([]byte{}, path...), byte(i))
+			writeDotNode(sb, child, me, childPath)
+		}
+	case *LeafNode:
+		me = dotName("leaf", path)
+		var count int
+		for _, v := range n.values {
+			if v != nil {
+				count++
+			}
+		}
+		kind := "L"
+		if n.isPOAStub {
+			kind = "L (absence proof stub)"
+		}
+		fmt.Fprintf(sb, "%s [label=\"%s depth=%d\\nStem: %x…\\nC: %s\\nC₁: %s\\nC₂: %s\\nvalues: %d\"]\n",
+			me, kind, n.depth, n.stem[:dotCommitmentBytes], truncatedCommitment(n.commitment),
+			truncatedCommitment(n.c1), truncatedCommitment(n.c2), count)
+	case HashedNode:
+		me = dotName("hash", path)
+		fmt.Fprintf(sb, "%s [label=\"unresolved depth=%d\"]\n", me, len(path))
+	default:
+		return
+	}
+	if len(parent) > 0 {
+		fmt.Fprintf(sb, "%s -> %s\n", parent, me)
+	}
+}
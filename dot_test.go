@@ -0,0 +1,64 @@
+package verkle
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToDotCompact(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(forkOneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	dot := ToDotCompact(root)
+	for _, expected := range []string{
+		"digraph D {",
+		"internal [label=\"I depth=0",
+		"internal -> internal00",
+		"internal00 -> leaf0000",
+		"internal00 -> leaf0001",
+		"values: 1",
+	} {
+		if !strings.Contains(dot, expected) {
+			t.Fatalf("missing %q in output", expected)
+		}
+	}
+	if strings.Contains(dot, "-> val") {
+		t.Fatal("compact output should not contain values")
+	}
+}
+
+func TestProofToDot(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	rootC := root.Commit()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot, err := ProofToDot(proof, rootC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dot, "internal -> leaf00") {
+		t.Fatal("proven leaf missing from output")
+	}
+	if strings.Contains(dot, "leafff") {
+		t.Fatal("unproven leaf present in output")
+	}
+}
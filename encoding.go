@@ -106,7 +106,7 @@ func parseLeafNode(serialized []byte, depth byte) (VerkleNode, error) {
 
 	// Sanity check that we have at least 3*banderwagon.UncompressedSize bytes left in the serialized payload.
 	if len(serialized[leafCommitmentOffset:]) < 3*banderwagon.UncompressedSize {
-		return nil, fmt.Errorf("leaf node commitments are not the correct size, expected at least %d, got %d", 3*banderwagon.UncompressedSize, len(serialized[leafC1CommitmentOffset:]))
+		return nil, fmt.Errorf("leaf node commitments are not the correct size, expected at least %d, got %d", 3*banderwagon.UncompressedSize, len(serialized[leafCommitmentOffset:]))
 	}
 
 	if err := ln.c1.SetBytesUncompressed(serialized[leafC1CommitmentOffset:leafC1CommitmentOffset+banderwagon.UncompressedSize], true); err != nil {
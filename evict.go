@@ -0,0 +1,153 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"runtime"
+	"runtime/metrics"
+	"sync/atomic"
+)
+
+// heapObjectsMetric is the runtime metric compared to the heap limit of
+// an Evictor. Unlike runtime.ReadMemStats, reading it doesn't stop the
+// world.
+const heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+// Evictor evicts the clean parts of the trees using it, see EvictClean,
+// when the heap grows past a limit. This bounds the memory used by long-
+// running processes holding several large trees, without having to flush
+// them. The heap is checked at the end of each GC cycle, but since trees
+// aren't safe for concurrent use, the eviction itself is done by the next
+// call to Insert, InsertValuesAtStem, Delete or Commit on the root of each
+// tree. The resolver of the backing store then has to be passed to all
+// the operations on the tree, as evicted nodes are resolved again when
+// they are accessed.
+type Evictor struct {
+	heapLimit  uint64
+	keepLevels int
+
+	pressure uint64 // number of GC cycles that ended over the limit
+	stopped  int32
+}
+
+// evictorSentinel is unreachable as soon as it is allocated, so that its
+// finalizer is run at the end of the next GC cycle.
+type evictorSentinel struct {
+	e *Evictor
+}
+
+// NewEvictor creates an evictor that requests the eviction of the clean
+// nodes below the first keepLevels levels of the trees using it, when the
+// heap holds more than heapLimit bytes at the end of a GC cycle.
+func NewEvictor(heapLimit uint64, keepLevels int) *Evictor {
+	e := &Evictor{heapLimit: heapLimit, keepLevels: keepLevels}
+	e.arm()
+	return e
+}
+
+func (e *Evictor) arm() {
+	runtime.SetFinalizer(&evictorSentinel{e}, onGCCycle)
+}
+
+func onGCCycle(s *evictorSentinel) {
+	e := s.e
+	if atomic.LoadInt32(&e.stopped) != 0 {
+		return
+	}
+	sample := []metrics.Sample{{Name: heapObjectsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() == metrics.KindUint64 && sample[0].Value.Uint64() > e.heapLimit {
+		atomic.AddUint64(&e.pressure, 1)
+	}
+	e.arm()
+}
+
+// Stop stops watching the heap. Evictions that were already requested
+// are still done.
+func (e *Evictor) Stop() {
+	atomic.StoreInt32(&e.stopped, 1)
+}
+
+// WithEvictor makes the trees using the configuration evict their clean
+// nodes when e requests it. Passing nil disables automatic eviction.
+func WithEvictor(e *Evictor) Option {
+	return func(conf *IPAConfig) error {
+		conf.evictor = e
+		return nil
+	}
+}
+
+// maybeEvict evicts the clean nodes of the tree rooted at n, if its
+// evictor requested it since the last eviction. n must be acquired.
+func (n *InternalNode) maybeEvict() {
+	e := n.config().evictor
+	if e == nil || n.depth != 0 {
+		return
+	}
+	if pressure := atomic.LoadUint64(&e.pressure); pressure != n.evictions {
+		n.evictions = pressure
+		n.evictClean(e.keepLevels)
+	}
+}
+
+// EvictClean replaces the subtrees that were resolved, and haven't been
+// modified since, with HashedNode, so that they can be garbage-collected.
+// Nodes in the first keepLevels levels of the tree, the root being at
+// level 0, are kept. Evicted nodes are resolved again when they are
+// accessed, so the resolver has to be passed to all the operations on the
+// tree. It returns the number of evicted subtrees.
+func (n *InternalNode) EvictClean(keepLevels int) (int, error) {
+	if !n.acquire() {
+		return 0, ErrConcurrentAccess
+	}
+	defer n.release()
+	return n.evictClean(keepLevels), nil
+}
+
+func (n *InternalNode) evictClean(keepLevels int) int {
+	var evicted int
+	for i, child := range n.children {
+		var clean bool
+		switch c := child.(type) {
+		case *InternalNode:
+			if !c.clean || int(c.depth) < keepLevels {
+				evicted += c.evictClean(keepLevels)
+				continue
+			}
+			clean = true
+		case *LeafNode:
+			clean = c.clean
+		}
+		if clean && int(n.depth)+1 >= keepLevels {
+			n.hashChild(i)
+			evicted++
+		}
+	}
+	if n.depth == 0 {
+		getMetrics().IncCounter(MetricEvictions, int64(evicted))
+	}
+	return evicted
+}
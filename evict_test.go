@@ -0,0 +1,128 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	mRand "math/rand"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flushedTree builds a tree from kvs using conf, and flushes it to a map
+// so that it can only be accessed through the returned resolver.
+func flushedTree(t *testing.T, conf *Config, kvs []keyValue) (VerkleNode, NodeResolverFn) {
+	t.Helper()
+
+	root := NewWithConfig(conf)
+	for _, kv := range kvs {
+		if err := root.Insert(kv.key, kv.value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db := map[string][]byte{}
+	root.(*InternalNode).Flush(func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = s
+	})
+	return root, func(path []byte) ([]byte, error) {
+		if s, ok := db[string(path)]; ok {
+			return s, nil
+		}
+		return nil, errors.New("not found")
+	}
+}
+
+func TestEvictClean(t *testing.T) {
+	t.Parallel()
+
+	kvs := genRandomKeyValues(mRand.New(mRand.NewSource(42)), 100) //skipcq: GSC-G404
+	root, resolver := flushedTree(t, nil, kvs)
+	for _, kv := range kvs {
+		if _, err := root.Get(kv.key, resolver); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Modify one key: its path must survive the eviction.
+	if err := root.Insert(kvs[0].key, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	evicted, err := root.(*InternalNode).EvictClean(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evicted == 0 {
+		t.Fatal("nothing was evicted")
+	}
+	modified := offset2key(kvs[0].key, 0)
+	for i, child := range root.(*InternalNode).children {
+		switch child.(type) {
+		case HashedNode:
+			if i == int(modified) {
+				t.Fatal("modified subtree was evicted")
+			}
+		case Empty:
+		default:
+			if i != int(modified) {
+				t.Fatalf("clean child %d of the root wasn't evicted", i)
+			}
+		}
+	}
+
+	expected := New()
+	for _, kv := range kvs[1:] {
+		if err := expected.Insert(kv.key, kv.value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := expected.Insert(kvs[0].key, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !root.Commit().Equal(expected.Commit()) {
+		t.Fatal("eviction changed the root commitment")
+	}
+	for _, kv := range kvs[1:] {
+		if val, err := root.Get(kv.key, resolver); err != nil || !bytes.Equal(val, kv.value) {
+			t.Fatalf("invalid value for key %x after eviction: %x, %v", kv.key, val, err)
+		}
+	}
+}
+
+func TestEvictor(t *testing.T) {
+	t.Parallel()
+
+	// A zero limit is always exceeded
+	e := NewEvictor(0, 1)
+	defer e.Stop()
+	conf, err := NewConfig(WithEvictor(e))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, resolver := flushedTree(t, conf, []keyValue{{zeroKeyTest, fourtyKeyTest}, {ffx32KeyTest, fourtyKeyTest}})
+	if _, err := root.Get(zeroKeyTest, resolver); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := root.(*InternalNode).children[0].(*LeafNode); !ok {
+		t.Fatal("leaf wasn't resolved")
+	}
+
+	// Wait for a GC cycle after the resolution, earlier ones have
+	// already been handled by the insertions.
+	seen := atomic.LoadUint64(&e.pressure)
+	for deadline := time.Now().Add(10 * time.Second); atomic.LoadUint64(&e.pressure) == seen; {
+		if time.Now().After(deadline) {
+			t.Fatal("evictor wasn't notified of any GC cycle")
+		}
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	root.Commit()
+	if _, ok := root.(*InternalNode).children[0].(HashedNode); !ok {
+		t.Fatal("leaf wasn't evicted")
+	}
+}
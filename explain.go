@@ -0,0 +1,299 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Explain returns a human-readable description of the proof: the depth
+// and extension status of each stem, the values of each key, which path
+// each commitment is the commitment of, and which stem each proof-of-
+// absence stem stands for. It is meant for debugging and doesn't check
+// the proof.
+func (proof *Proof) Explain() string {
+	var sb strings.Builder
+
+	stems := make([][]byte, 0, len(proof.Keys))
+	for _, k := range proof.Keys {
+		if len(k) < StemSize {
+			fmt.Fprintf(&sb, "invalid key %x\n", k)
+			return sb.String()
+		}
+		if len(stems) == 0 || !bytes.Equal(stems[len(stems)-1], k[:StemSize]) {
+			stems = append(stems, k[:StemSize])
+		}
+	}
+	fmt.Fprintf(&sb, "proof for %d keys in %d stems, with %d commitments (root excluded) and %d proof-of-absence stems\n",
+		len(proof.Keys), len(stems), len(proof.Cs), len(proof.PoaStems))
+	if len(stems) != len(proof.ExtStatus) {
+		fmt.Fprintf(&sb, "WARNING: %d stems but %d extension statuses\n", len(stems), len(proof.ExtStatus))
+	}
+
+	// Rebuilding the tree is the most reliable way to figure out which
+	// commitment belongs to which node, as it follows the same logic as
+	// the verifier. The root commitment isn't part of the proof, and it
+	// isn't needed here.
+	root, err := PreStateTreeFromProof(proof, new(Point))
+	if err != nil {
+		fmt.Fprintf(&sb, "WARNING: could not rebuild the tree from the proof: %v\n", err)
+	}
+
+	sb.WriteString("stems:\n")
+	for i, stem := range stems {
+		if i >= len(proof.ExtStatus) {
+			break
+		}
+		depth, status := DecodeExtStatus(proof.ExtStatus[i])
+		fmt.Fprintf(&sb, "  #%d %x: depth %d, %s", i, stem, depth, status)
+		if status == ExtStatusAbsentOther && root != nil {
+			if leaf := leafAtPath(root, stem[:depth]); leaf != nil {
+				if leaf.isPOAStub {
+					fmt.Fprintf(&sb, ", proven by proof-of-absence stem %x", leaf.stem)
+				} else {
+					fmt.Fprintf(&sb, ", proven by present stem %x", leaf.stem)
+				}
+			}
+		}
+		sb.WriteString("\n")
+		for j, k := range proof.Keys {
+			if !bytes.Equal(k[:StemSize], stem) {
+				continue
+			}
+			fmt.Fprintf(&sb, "    suffix %02x: pre=%s", k[StemSize], explainValue(proof.PreValues, j))
+			if j < len(proof.PostValues) && proof.PostValues[j] != nil {
+				fmt.Fprintf(&sb, " post=%x", proof.PostValues[j])
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	sb.WriteString("commitments:\n")
+	paths := map[*Point]string{}
+	if root != nil {
+		describeCommitments(root, nil, paths)
+	}
+	for i, c := range proof.Cs {
+		desc, ok := paths[c]
+		if !ok {
+			desc = "unused"
+		}
+		fmt.Fprintf(&sb, "  C[%d] %x: %s\n", i, truncatedBytes(c), desc)
+	}
+
+	if len(proof.PoaStems) > 0 {
+		sb.WriteString("proof-of-absence stems:\n")
+		for i, poa := range proof.PoaStems {
+			fmt.Fprintf(&sb, "  #%d %x\n", i, poa)
+		}
+	}
+	return sb.String()
+}
+
+// Explain deserializes the proof and its state diff, and returns the
+// explanation of the resulting proof. See (*Proof).Explain.
+func (vp *VerkleProof) Explain(statediff StateDiff) (string, error) {
+	proof, err := DeserializeProof(vp, statediff)
+	if err != nil {
+		return "", fmt.Errorf("deserializing proof: %w", err)
+	}
+	return proof.Explain(), nil
+}
+
+// CommitmentKind tells which part of the tree a proof commitment is the
+// commitment of.
+type CommitmentKind int
+
+const (
+	InternalCommitment CommitmentKind = iota // commitment of an internal node
+	LeafCommitment                           // commitment of a leaf, or of a proof-of-absence stub
+	C1Commitment                             // commitment to the first half of the values of a leaf
+	C2Commitment                             // commitment to the second half of the values of a leaf
+)
+
+func (k CommitmentKind) String() string {
+	switch k {
+	case InternalCommitment:
+		return "internal"
+	case LeafCommitment:
+		return "leaf"
+	case C1Commitment:
+		return "C1"
+	case C2Commitment:
+		return "C2"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(k))
+	}
+}
+
+// CommitmentUse describes what an entry of Proof.Cs is used for.
+type CommitmentUse struct {
+	Kind CommitmentKind
+	Path []byte // path of the node the commitment belongs to, for C1 and C2 the path of their leaf
+	Stem []byte // stem of the leaf, for leaf, C1 and C2 commitments
+
+	// Keys are the keys of the proof whose opening goes through this
+	// commitment. A commitment serving no key is redundant.
+	Keys [][]byte
+}
+
+// CommitmentKeys returns, for each entry of proof.Cs, the node it is the
+// commitment of and the keys it serves. Like Explain, it is meant for
+// debugging and doesn't check the proof.
+func (proof *Proof) CommitmentKeys() ([]CommitmentUse, error) {
+	root, err := PreStateTreeFromProof(proof, new(Point))
+	if err != nil {
+		return nil, fmt.Errorf("rebuilding the tree from the proof: %w", err)
+	}
+
+	uses := make(map[*Point]*CommitmentUse, len(proof.Cs))
+	collectCommitmentUses(root, nil, uses)
+	for _, key := range proof.Keys {
+		var node VerkleNode = root
+		for depth := 0; depth < len(key); depth++ {
+			internal, ok := node.(*InternalNode)
+			if !ok {
+				break
+			}
+			if depth > 0 {
+				uses[internal.commitment].addKey(key)
+			}
+			node = internal.children[key[depth]]
+		}
+		leaf, ok := node.(*LeafNode)
+		if !ok {
+			continue
+		}
+		uses[leaf.commitment].addKey(key)
+		if leaf.isPOAStub || !bytes.Equal(leaf.stem, key[:StemSize]) {
+			continue
+		}
+		if key[StemSize] < NodeWidth/2 {
+			uses[leaf.c1].addKey(key)
+		} else {
+			uses[leaf.c2].addKey(key)
+		}
+	}
+
+	result := make([]CommitmentUse, len(proof.Cs))
+	for i, c := range proof.Cs {
+		if use, ok := uses[c]; ok {
+			result[i] = *use
+		}
+	}
+	return result, nil
+}
+
+// addKey adds key to the keys served by use, if use isn't nil and the
+// key isn't already there.
+func (use *CommitmentUse) addKey(key []byte) {
+	if use == nil {
+		return
+	}
+	if n := len(use.Keys); n > 0 && bytes.Equal(use.Keys[n-1], key) {
+		return
+	}
+	use.Keys = append(use.Keys, key)
+}
+
+func collectCommitmentUses(node VerkleNode, path []byte, uses map[*Point]*CommitmentUse) {
+	switch n := node.(type) {
+	case *InternalNode:
+		if len(path) > 0 {
+			uses[n.commitment] = &CommitmentUse{Kind: InternalCommitment, Path: path}
+		}
+		for i, child := range n.children {
+			collectCommitmentUses(child, append(append([]byte{}, path...), byte(i)), uses)
+		}
+	case *LeafNode:
+		uses[n.commitment] = &CommitmentUse{Kind: LeafCommitment, Path: path, Stem: n.stem}
+		if n.isPOAStub {
+			return
+		}
+		if n.c1 != nil {
+			uses[n.c1] = &CommitmentUse{Kind: C1Commitment, Path: path, Stem: n.stem}
+		}
+		if n.c2 != nil {
+			uses[n.c2] = &CommitmentUse{Kind: C2Commitment, Path: path, Stem: n.stem}
+		}
+	}
+}
+
+func explainValue(values [][]byte, i int) string {
+	if i >= len(values) {
+		return "missing"
+	}
+	if values[i] == nil {
+		return "absent"
+	}
+	return fmt.Sprintf("%x", values[i])
+}
+
+func truncatedBytes(p *Point) []byte {
+	if p == nil {
+		return nil
+	}
+	b := p.Bytes()
+	return b[:dotCommitmentBytes]
+}
+
+func describeCommitments(node VerkleNode, path []byte, paths map[*Point]string) {
+	switch n := node.(type) {
+	case *InternalNode:
+		if len(path) > 0 {
+			paths[n.commitment] = fmt.Sprintf("internal node at path %x", path)
+		}
+		for i, child := range n.children {
+			describeCommitments(child, append(append([]byte{}, path...), byte(i)), paths)
+		}
+	case *LeafNode:
+		if n.isPOAStub {
+			paths[n.commitment] = fmt.Sprintf("proof-of-absence leaf at path %x, stem %x", path, n.stem)
+			return
+		}
+		paths[n.commitment] = fmt.Sprintf("leaf at path %x, stem %x", path, n.stem)
+		if n.c1 != nil {
+			paths[n.c1] = fmt.Sprintf("C1 of stem %x", n.stem)
+		}
+		if n.c2 != nil {
+			paths[n.c2] = fmt.Sprintf("C2 of stem %x", n.stem)
+		}
+	}
+}
+
+func leafAtPath(node VerkleNode, path []byte) *LeafNode {
+	for _, b := range path {
+		internal, ok := node.(*InternalNode)
+		if !ok {
+			return nil
+		}
+		node = internal.children[b]
+	}
+	leaf, _ := node.(*LeafNode)
+	return leaf
+}
@@ -0,0 +1,142 @@
+package verkle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProofExplain(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(forkOneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	absentKey := append([]byte{}, zeroKeyTest...)
+	absentKey[2] = 1
+	root.Commit()
+
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, absentKey, ffx32KeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	explanation := proof.Explain()
+	for _, expected := range []string{
+		"proof for 3 keys in 3 stems",
+		"depth 2, present",
+		"depth 2, absent (other stem), proven by present stem 000000",
+		"depth 1, absent (empty)",
+		"internal node at path 00\n",
+		"C1 of stem 000000",
+	} {
+		if !strings.Contains(explanation, expected) {
+			t.Fatalf("missing %q in explanation:\n%s", expected, explanation)
+		}
+	}
+	if strings.Contains(explanation, "unused") || strings.Contains(explanation, "WARNING") {
+		t.Fatalf("unexpected explanation:\n%s", explanation)
+	}
+
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromSerialized, err := vp.Explain(sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromSerialized != explanation {
+		t.Fatalf("explanations differ:\n%s\n%s", fromSerialized, explanation)
+	}
+}
+
+func TestProofCommitmentKeys(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(forkOneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	absentKey := append([]byte{}, zeroKeyTest...)
+	absentKey[2] = 1
+	root.Commit()
+
+	keys := [][]byte{zeroKeyTest, oneKeyTest, absentKey, forkOneKeyTest, ffx32KeyTest}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, keys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uses, err := proof.CommitmentKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uses) != len(proof.Cs) {
+		t.Fatalf("got %d uses for %d commitments", len(uses), len(proof.Cs))
+	}
+
+	byKind := map[CommitmentKind][]CommitmentUse{}
+	for i, use := range uses {
+		if len(use.Keys) == 0 {
+			t.Fatalf("commitment %d serves no key: %+v", i, use)
+		}
+		byKind[use.Kind] = append(byKind[use.Kind], use)
+	}
+	// Internal node 00 serves all keys but ffx32KeyTest
+	if internal := byKind[InternalCommitment]; len(internal) != 1 || !bytes.Equal(internal[0].Path, []byte{0}) || len(internal[0].Keys) != 4 {
+		t.Fatalf("invalid internal node commitments: %+v", internal)
+	}
+	// The leaf at 0000 also proves the absence of absentKey
+	for _, leaf := range byKind[LeafCommitment] {
+		if bytes.Equal(leaf.Path, []byte{0, 0}) && len(leaf.Keys) != 3 {
+			t.Fatalf("invalid keys for leaf 0000: %x", leaf.Keys)
+		}
+	}
+	if c1 := byKind[C1Commitment]; len(c1) != 2 {
+		t.Fatalf("invalid C1 commitments: %+v", c1)
+	}
+	if len(byKind[C2Commitment]) != 0 {
+		t.Fatal("no key should be served by a C2 commitment")
+	}
+}
+
+func TestDecodeExtStatus(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(forkOneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, ffx32KeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.ExtStatus) != 2 {
+		t.Fatalf("expected 2 extension statuses, got %d", len(proof.ExtStatus))
+	}
+	if depth, status := DecodeExtStatus(proof.ExtStatus[0]); depth != 2 || status != ExtStatusPresent {
+		t.Fatalf("invalid status of the first stem: depth %d, %s", depth, status)
+	}
+	if depth, status := DecodeExtStatus(proof.ExtStatus[1]); depth != 1 || status != ExtStatusAbsentEmpty {
+		t.Fatalf("invalid status of the second stem: depth %d, %s", depth, status)
+	}
+
+	for _, status := range []ExtStatus{ExtStatusAbsentEmpty, ExtStatusAbsentOther, ExtStatusPresent} {
+		if depth, decoded := DecodeExtStatus(EncodeExtStatus(31, status)); depth != 31 || decoded != status {
+			t.Fatalf("%s: got depth %d, %s after round trip", status, depth, decoded)
+		}
+	}
+	if s := ExtStatus(3).String(); s != "invalid (3)" {
+		t.Fatalf("invalid description of an unknown status: %s", s)
+	}
+}
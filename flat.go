@@ -0,0 +1,132 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"errors"
+	"fmt"
+)
+
+// FlatStem is a row of the flat representation of a tree: a stem and
+// the NodeWidth values stored under it. Missing values are nil.
+type FlatStem struct {
+	Stem   []byte
+	Values [][]byte
+}
+
+// ExportFlatTable walks the tree and calls fn once per stem, in increasing
+// stem order. Hashed subtrees are resolved with the resolver, but are not
+// attached to the tree, so that exporting a large tree does not load it
+// into memory. The FlatStem passed to fn is only valid for the duration
+// of the call: its values are internal to the tree.
+func ExportFlatTable(root VerkleNode, resolver NodeResolverFn, fn func(*FlatStem) error) error {
+	return forEachLeaf(root, nil, resolver, func(leaf *LeafNode) error {
+		return fn(&FlatStem{Stem: leaf.stem, Values: leaf.values})
+	})
+}
+
+// ImportFlatTable builds a tree out of a flat table. Leaf commitments are
+// computed in parallel, and the returned tree is committed. Each stem can
+// only appear in one row.
+func ImportFlatTable(rows []FlatStem) (VerkleNode, error) {
+	var (
+		data  = make([]BatchNewLeafNodeData, len(rows))
+		stems = make(map[string]int, len(rows))
+	)
+	for i, row := range rows {
+		if len(row.Stem) != StemSize {
+			return nil, fmt.Errorf("invalid stem size %d in row %d", len(row.Stem), i)
+		}
+		if prev, ok := stems[string(row.Stem)]; ok {
+			return nil, fmt.Errorf("duplicate stem %x in rows %d and %d", row.Stem, prev, i)
+		}
+		stems[string(row.Stem)] = i
+		if len(row.Values) > NodeWidth {
+			return nil, fmt.Errorf("too many values (%d) for stem %x", len(row.Values), row.Stem)
+		}
+		data[i].Stem = row.Stem
+		data[i].Values = make(map[byte][]byte)
+		for j, v := range row.Values {
+			if v != nil {
+				data[i].Values[byte(j)] = v
+			}
+		}
+	}
+	leaves, err := BatchNewLeafNode(data)
+	if err != nil {
+		return nil, fmt.Errorf("computing leaf commitments: %w", err)
+	}
+
+	root := New().(*InternalNode)
+	if len(leaves) > 0 {
+		if err := root.InsertMigratedLeaves(leaves, nil); err != nil {
+			return nil, fmt.Errorf("inserting leaves: %w", err)
+		}
+	}
+	root.Commit()
+	return root, nil
+}
+
+// forEachLeaf calls fn for every leaf of the subtree rooted at node, in
+// increasing stem order. path is the path to node.
+func forEachLeaf(node VerkleNode, path []byte, resolver NodeResolverFn, fn func(*LeafNode) error) error {
+	switch n := node.(type) {
+	case *InternalNode:
+		for i, child := range n.children {
+			childpath := make([]byte, len(path)+1)
+			copy(childpath, path)
+			childpath[len(path)] = byte(i)
+
+			if _, ok := child.(HashedNode); ok {
+				if resolver == nil {
+					return fmt.Errorf("no resolver for path %x: %w", childpath, ErrReadFromInvalid)
+				}
+				serialized, err := resolveNode(resolver, childpath)
+				if err != nil {
+					return err
+				}
+				child, err = n.parseChild(byte(i), serialized, childpath)
+				if err != nil {
+					return err
+				}
+			}
+			if err := forEachLeaf(child, childpath, resolver, fn); err != nil {
+				return err
+			}
+		}
+	case *LeafNode:
+		if n.isPOAStub {
+			return nil
+		}
+		return fn(n)
+	case Empty:
+	case UnknownNode:
+		return ErrMissingNodeInStateless
+	default:
+		return errors.New("unexpected node type during tree walk")
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFlatTableRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, k := range randomKeys(t, 200) {
+		if err := root.Insert(k, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Add a few values under the same stem
+	for i := 0; i < 3; i++ {
+		key := append([]byte{}, zeroKeyTest...)
+		key[StemSize] = byte(i * 100)
+		if err := root.Insert(key, testValue, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	comm := root.Commit().Bytes()
+
+	db := map[string][]byte{}
+	root.(*InternalNode).Flush(func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = s
+	})
+	resolver := func(path []byte) ([]byte, error) {
+		if s, ok := db[string(path)]; ok {
+			return s, nil
+		}
+		return nil, errors.New("not found")
+	}
+
+	var rows []FlatStem
+	err := ExportFlatTable(root, resolver, func(row *FlatStem) error {
+		if len(rows) > 0 && bytes.Compare(rows[len(rows)-1].Stem, row.Stem) >= 0 {
+			t.Fatalf("stems are out of order: %x >= %x", rows[len(rows)-1].Stem, row.Stem)
+		}
+		rows = append(rows, FlatStem{Stem: row.Stem, Values: row.Values})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keys are random, so some of them might share a stem.
+	if len(rows) < 150 {
+		t.Fatalf("too few stems exported: %d", len(rows))
+	}
+
+	imported, err := ImportFlatTable(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := imported.Commitment().Bytes(); got != comm {
+		t.Fatalf("invalid root commitment after import: %x != %x", got, comm)
+	}
+
+	// The exporter must not have attached resolved nodes to the tree
+	if _, ok := root.(*InternalNode).children[0].(HashedNode); !ok {
+		t.Fatal("exporting the tree loaded it in memory")
+	}
+}
+
+func TestFlatTableInvalidStem(t *testing.T) {
+	t.Parallel()
+
+	if _, err := ImportFlatTable([]FlatStem{{Stem: []byte{1, 2, 3}}}); err == nil {
+		t.Fatal("expected an error for an invalid stem")
+	}
+}
+
+func TestFlatTableDuplicateStem(t *testing.T) {
+	t.Parallel()
+
+	rows := []FlatStem{
+		{Stem: zeroKeyTest[:StemSize], Values: [][]byte{fourtyKeyTest}},
+		{Stem: ffx32KeyTest[:StemSize], Values: [][]byte{fourtyKeyTest}},
+		{Stem: zeroKeyTest[:StemSize], Values: [][]byte{testValue}},
+	}
+	if _, err := ImportFlatTable(rows); err == nil || !strings.Contains(err.Error(), "duplicate stem") {
+		t.Fatalf("expected a duplicate stem error, got %v", err)
+	}
+}
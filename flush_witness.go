@@ -0,0 +1,318 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	ipa "github.com/crate-crypto/go-ipa"
+	"github.com/crate-crypto/go-ipa/banderwagon"
+	"github.com/crate-crypto/go-ipa/common"
+)
+
+// ErrInvalidWitness is returned when a subtree witness is malformed, or
+// doesn't match the subtree it is checked against.
+var ErrInvalidWitness = errors.New("invalid subtree witness")
+
+// SubtreeWitness links a subtree evicted from memory by a flush to the
+// root of the tree at the time of the flush. It holds the commitments of
+// the nodes along the path of the subtree, and a proof that each of them
+// is the child of the previous one, so that the subtree can be checked
+// when it is reloaded from cold storage, even after the nodes above it
+// were modified, as long as the caller trusts Root.
+type SubtreeWitness struct {
+	Path []byte
+	Root *Point
+
+	// Commitments holds the commitments of the nodes along Path, the
+	// root excluded, the last one being that of the subtree.
+	Commitments []*Point
+
+	Proof *ipa.MultiProof
+}
+
+// FlushWitnessFn receives the witness of each subtree evicted by Flush
+// or FlushAtDepth, once the nodes of the subtree were passed to the
+// NodeFlushFn. err is set if the witness couldn't be built.
+type FlushWitnessFn func(path []byte, w *SubtreeWitness, err error)
+
+// WithFlushWitnesses makes Flush and FlushAtDepth, when called on the
+// root, pass a SubtreeWitness of each subtree they evict to fn. Building
+// a witness takes one multiproof per subtree, over the nodes above it.
+// These nodes stay in memory, but their children that were evicted by a
+// previous flush have to be found in the cache set with
+// WithCommitmentCache, which the flushes then keep up to date; without
+// it, only the witnesses of a fully resolved tree can be built. Passing
+// nil disables the witnesses.
+func WithFlushWitnesses(fn FlushWitnessFn) Option {
+	return func(conf *IPAConfig) error {
+		conf.flushWitnesses = fn
+		return nil
+	}
+}
+
+type pendingWitness struct {
+	path    []byte
+	witness *SubtreeWitness
+	err     error
+}
+
+// buildFlushWitnesses commits the tree rooted at n, and builds the
+// witnesses of the subtrees that flushing it down to depth will evict,
+// which are the same in Flush and FlushAtDepth(0). It does nothing unless
+// n is the root and witnesses were requested. strict is as in enter.
+func (n *InternalNode) buildFlushWitnesses(depth uint8, strict bool) ([]pendingWitness, error) {
+	if n.config().flushWitnesses == nil || n.depth != 0 {
+		return nil, nil
+	}
+	if acquired, err := n.enter(strict); err != nil {
+		return nil, err
+	} else if acquired {
+		defer n.release()
+	}
+	n.commit()
+
+	var (
+		ancestors []*InternalNode
+		polys     [][]Fr
+		pending   []pendingWitness
+		walk      func(*InternalNode, []byte, []Fr, error)
+	)
+	walk = func(node *InternalNode, path []byte, poly []Fr, polyErr error) {
+		ancestors = append(ancestors, node)
+		polys = append(polys, poly)
+		for i, child := range node.children {
+			var comm *Point
+			switch c := child.(type) {
+			case *LeafNode:
+				comm = c.Commit()
+			case *InternalNode:
+				if node.depth < depth {
+					childpath := append(path[:len(path):len(path)], byte(i))
+					poly, err := c.witnessPoly(childpath)
+					if polyErr != nil {
+						err = polyErr
+					}
+					walk(c, childpath, poly, err)
+					continue
+				}
+				comm = c.commitment
+			default:
+				continue
+			}
+			w := pendingWitness{path: append(path[:len(path):len(path)], byte(i)), err: polyErr}
+			if w.err == nil {
+				w.witness, w.err = n.subtreeWitness(w.path, ancestors, polys, comm)
+			}
+			pending = append(pending, w)
+		}
+		ancestors = ancestors[:len(ancestors)-1]
+		polys = polys[:len(polys)-1]
+	}
+	poly, err := n.witnessPoly(nil)
+	walk(n, nil, poly, err)
+	return pending, nil
+}
+
+// witnessPoly returns the polynomial committed to by n, whose path is
+// passed, in evaluation form.
+func (n *InternalNode) witnessPoly(path []byte) ([]Fr, error) {
+	var (
+		fi     = make([]Fr, NodeWidth)
+		fiPtrs [NodeWidth]*Fr
+		points [NodeWidth]*Point
+		cache  = n.config().commitments
+	)
+	for i, child := range n.children {
+		fiPtrs[i] = &fi[i]
+		switch child.(type) {
+		case HashedNode:
+			childpath := append(path[:len(path):len(path)], byte(i))
+			if cache != nil {
+				points[i], _ = cache.Get(childpath)
+			}
+			if points[i] == nil {
+				return nil, fmt.Errorf("no commitment for the evicted node at %x: %w", childpath, ErrReadFromInvalid)
+			}
+		case UnknownNode:
+			return nil, fmt.Errorf("building witness at %x: %w", path, ErrMissingNodeInStateless)
+		default:
+			points[i] = child.Commitment()
+		}
+	}
+	if err := banderwagon.BatchMapToScalarField(fiPtrs[:], points[:]); err != nil {
+		return nil, fmt.Errorf("batch mapping to scalar fields: %s", err)
+	}
+	return fi, nil
+}
+
+// subtreeWitness proves that comm is the commitment of the node at path,
+// given the nodes above it and their polynomials.
+func (n *InternalNode) subtreeWitness(path []byte, ancestors []*InternalNode, polys [][]Fr, comm *Point) (*SubtreeWitness, error) {
+	cfg := n.config()
+	prover, err := cfg.getProver()
+	if err != nil {
+		return nil, err
+	}
+	w := &SubtreeWitness{
+		Path:        path,
+		Root:        new(Point).Set(n.commitment),
+		Commitments: make([]*Point, len(path)),
+	}
+	cs := make([]*Point, len(path))
+	for i, ancestor := range ancestors {
+		cs[i] = ancestor.commitment
+		if i > 0 {
+			w.Commitments[i-1] = new(Point).Set(ancestor.commitment)
+		}
+	}
+	w.Commitments[len(path)-1] = new(Point).Set(comm)
+
+	tr := common.NewTranscript(cfg.transcriptLabel)
+	if w.Proof, err = prover.CreateMultiProof(tr, cfg.conf, cs, polys, path); err != nil {
+		return nil, fmt.Errorf("creating witness proof at %x: %w", path, err)
+	}
+	return w, nil
+}
+
+// reportFlushWitnesses passes the witnesses built before a flush to the
+// configured FlushWitnessFn, and records the commitments of the evicted
+// subtrees in the commitment cache, for the witnesses of the next flushes.
+func (n *InternalNode) reportFlushWitnesses(pending []pendingWitness) {
+	if len(pending) == 0 {
+		return
+	}
+	cfg := n.config()
+	for _, p := range pending {
+		if cfg.commitments != nil && p.witness != nil {
+			cfg.commitments.Put(p.path, p.witness.Commitments[len(p.path)-1])
+		}
+		cfg.flushWitnesses(p.path, p.witness, p.err)
+	}
+}
+
+// Verify checks that serialized is the root node of the subtree at
+// w.Path, as flushed, and that its commitment is linked to w.Root. It
+// doesn't check the nodes below it, which are in turn checked against
+// their commitment in the serialized node when they are resolved.
+func (w *SubtreeWitness) Verify(serialized []byte) error {
+	depth := len(w.Path)
+	if depth == 0 || depth > StemSize || len(w.Commitments) != depth || w.Root == nil || w.Proof == nil {
+		return ErrInvalidWitness
+	}
+	node, err := ParseNode(serialized, byte(depth))
+	if err != nil {
+		return fmt.Errorf("%w: parsing subtree: %v", ErrInvalidWitness, err)
+	}
+	if leaf, ok := node.(*LeafNode); ok && !bytes.HasPrefix(leaf.stem, w.Path) {
+		return fmt.Errorf("%w: stem %x isn't in subtree %x", ErrInvalidWitness, leaf.stem, w.Path)
+	}
+	if !node.Commitment().Equal(w.Commitments[depth-1]) {
+		return fmt.Errorf("%w: subtree commitment mismatch", ErrInvalidWitness)
+	}
+
+	var (
+		cs     = append([]*Point{w.Root}, w.Commitments[:depth-1]...)
+		ys     = make([]Fr, depth)
+		ysPtrs = make([]*Fr, depth)
+	)
+	for i := range ys {
+		ysPtrs[i] = &ys[i]
+	}
+	if err := banderwagon.BatchMapToScalarField(ysPtrs, w.Commitments); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWitness, err)
+	}
+	cfg := GetConfig()
+	tr := common.NewTranscript(cfg.transcriptLabel)
+	ok, err := verifyMultiProof(tr, cfg.conf, w.Proof, cs, ysPtrs, w.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWitness, err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: proof doesn't verify", ErrInvalidWitness)
+	}
+	return nil
+}
+
+// Serialize encodes the witness as <path length><path><root><commitments>
+// <multiproof>, with compressed points.
+func (w *SubtreeWitness) Serialize() ([]byte, error) {
+	if len(w.Path) == 0 || len(w.Path) > StemSize || len(w.Commitments) != len(w.Path) || w.Root == nil || w.Proof == nil {
+		return nil, ErrInvalidWitness
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(byte(len(w.Path)))
+	buf.Write(w.Path)
+	root := w.Root.Bytes()
+	buf.Write(root[:])
+	for _, comm := range w.Commitments {
+		serialized := comm.Bytes()
+		buf.Write(serialized[:])
+	}
+	if err := w.Proof.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseSubtreeWitness decodes a witness encoded with Serialize.
+func ParseSubtreeWitness(serialized []byte) (*SubtreeWitness, error) {
+	if len(serialized) == 0 {
+		return nil, ErrInvalidWitness
+	}
+	depth := int(serialized[0])
+	if depth == 0 || depth > StemSize || len(serialized) < 1+depth+(depth+1)*banderwagon.CompressedSize {
+		return nil, ErrInvalidWitness
+	}
+	w := &SubtreeWitness{
+		Path:        append([]byte{}, serialized[1:1+depth]...),
+		Root:        new(Point),
+		Commitments: make([]*Point, depth),
+		Proof:       new(ipa.MultiProof),
+	}
+	rest := serialized[1+depth:]
+	for i := -1; i < depth; i++ {
+		p := w.Root
+		if i >= 0 {
+			p = new(Point)
+			w.Commitments[i] = p
+		}
+		if err := p.SetBytes(rest[:banderwagon.CompressedSize]); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidWitness, err)
+		}
+		rest = rest[banderwagon.CompressedSize:]
+	}
+	r := bytes.NewReader(rest)
+	if err := w.Proof.Read(r); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWitness, err)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrInvalidWitness, r.Len())
+	}
+	return w, nil
+}
@@ -0,0 +1,132 @@
+package verkle
+
+import (
+	"errors"
+	mRand "math/rand"
+	"testing"
+)
+
+func TestFlushWitnesses(t *testing.T) {
+	t.Parallel()
+
+	witnesses := map[string]*SubtreeWitness{}
+	var failures int
+	record := func(path []byte, w *SubtreeWitness, err error) {
+		if err != nil {
+			failures++
+			return
+		}
+		witnesses[string(path)] = w
+	}
+	cache := NewCommitmentCache(2)
+	conf, err := NewConfig(WithFlushWitnesses(record), WithCommitmentCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kvs := genRandomKeyValues(mRand.New(mRand.NewSource(42)), 50) //skipcq: GSC-G404
+	root := NewWithConfig(conf)
+	for _, kv := range kvs {
+		if err := root.Insert(kv.key, kv.value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db := map[string][]byte{}
+	flush := func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = s
+	}
+	resolver := func(path []byte) ([]byte, error) {
+		if s, ok := db[string(path)]; ok {
+			return s, nil
+		}
+		return nil, errors.New("not found")
+	}
+
+	root.(*InternalNode).FlushAtDepth(1, flush)
+	if failures != 0 || len(witnesses) == 0 {
+		t.Fatalf("got %d witnesses and %d failures", len(witnesses), failures)
+	}
+	first := root.Commitment().Bytes()
+	for path, w := range witnesses {
+		if len(path) < 2 && !isLeafRecord(db[path]) {
+			t.Fatalf("internal node at %x shouldn't have been evicted", path)
+		}
+		if w.Root.Bytes() != first {
+			t.Fatalf("invalid root in the witness of %x", path)
+		}
+		if err := w.Verify(db[path]); err != nil {
+			t.Fatalf("witness of %x: %v", path, err)
+		}
+		serialized, err := w.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseSubtreeWitness(serialized)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := parsed.Verify(db[path]); err != nil {
+			t.Fatalf("decoded witness of %x: %v", path, err)
+		}
+		if _, err := ParseSubtreeWitness(serialized[:len(serialized)-1]); !errors.Is(err, ErrInvalidWitness) {
+			t.Fatalf("decoding a truncated witness should fail, got %v", err)
+		}
+	}
+
+	// Modify the tree, and keep the witnesses of the first flush: the
+	// subtrees that didn't change can still be checked against the old
+	// root, and the modified one against the new root only.
+	old := witnesses
+	witnesses = map[string]*SubtreeWitness{}
+	if err := root.Insert(kvs[0].key, fourtyKeyTest, resolver); err != nil {
+		t.Fatal(err)
+	}
+	root.(*InternalNode).FlushAtDepth(1, flush)
+	if failures != 0 || len(witnesses) != 1 {
+		t.Fatalf("got %d witnesses and %d failures after the update", len(witnesses), failures)
+	}
+	for path, w := range witnesses {
+		if err := w.Verify(db[path]); err != nil {
+			t.Fatalf("witness of %x: %v", path, err)
+		}
+		if err := old[path].Verify(db[path]); !errors.Is(err, ErrInvalidWitness) {
+			t.Fatalf("the old witness of %x should not verify the updated subtree, got %v", path, err)
+		}
+		delete(old, path)
+	}
+	for path, w := range old {
+		if err := w.Verify(db[path]); err != nil {
+			t.Fatalf("old witness of unmodified subtree %x: %v", path, err)
+		}
+	}
+
+	// Without the commitment cache, the siblings of the modified subtree
+	// are unknown.
+	conf, err = NewConfig(WithFlushWitnesses(record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, resolver = flushedTree(t, nil, kvs)
+	serialized, err := resolver(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateless, err := parseResolvedNode(conf, serialized, 0, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stateless.Insert(kvs[1].key, fourtyKeyTest, resolver); err != nil {
+		t.Fatal(err)
+	}
+	stateless.(*InternalNode).Flush(flush)
+	if failures != 1 {
+		t.Fatalf("expected the witness to fail, got %d failures", failures)
+	}
+}
+
+func isLeafRecord(serialized []byte) bool {
+	return len(serialized) > 0 && serialized[0] == leafRLPType
+}
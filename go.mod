@@ -6,6 +6,7 @@ require (
 	github.com/crate-crypto/go-ipa v0.0.0-20231025140028-3c0104f4b233
 	github.com/davecgh/go-spew v1.1.1
 	golang.org/x/sync v0.1.0
+	golang.org/x/sys v0.9.0
 )
 
 require (
@@ -13,6 +14,5 @@ require (
 	github.com/consensys/bavard v0.1.13 // indirect
 	github.com/consensys/gnark-crypto v0.12.1 // indirect
 	github.com/mmcloughlin/addchain v0.4.0 // indirect
-	golang.org/x/sys v0.9.0 // indirect
 	rsc.io/tmplfunc v0.0.3 // indirect
 )
@@ -33,7 +33,7 @@ import (
 type HashedNode struct{}
 
 func (HashedNode) Insert([]byte, []byte, NodeResolverFn) error {
-	return errInsertIntoHash
+	return ErrInsertIntoHash
 }
 
 func (HashedNode) Delete([]byte, NodeResolverFn) (bool, error) {
@@ -63,7 +63,7 @@ func (HashedNode) GetProofItems(keylist, NodeResolverFn) (*ProofElements, []byte
 }
 
 func (HashedNode) Serialize() ([]byte, error) {
-	return nil, errSerializeHashedNode
+	return nil, ErrSerializeHashedNode
 }
 
 func (HashedNode) Copy() VerkleNode {
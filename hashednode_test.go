@@ -32,7 +32,7 @@ func TestHashedNodeFuncs(t *testing.T) {
 
 	e := HashedNode{}
 	err := e.Insert(zeroKeyTest, zeroKeyTest, nil)
-	if err != errInsertIntoHash {
+	if err != ErrInsertIntoHash {
 		t.Fatal("got nil error when inserting into a hashed node")
 	}
 	_, err = e.Delete(zeroKeyTest, nil)
@@ -49,7 +49,7 @@ func TestHashedNodeFuncs(t *testing.T) {
 	if _, _, _, err := e.GetProofItems(nil, nil); err == nil {
 		t.Fatal("got nil error when getting proof items from a hashed node")
 	}
-	if _, err := e.Serialize(); err != errSerializeHashedNode {
+	if _, err := e.Serialize(); err != ErrSerializeHashedNode {
 		t.Fatal("got nil error when serializing a hashed node")
 	}
 }
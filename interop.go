@@ -0,0 +1,261 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// InteropFixture is a test vector in the format shared with rust-verkle,
+// used to check that both implementations agree byte-for-byte on the
+// tree commitments and on the proof layout. All byte strings are encoded
+// as 0x-prefixed hex strings, commitments in their compressed form.
+type InteropFixture struct {
+	Name    string         `json:"name"`
+	Entries []InteropEntry `json:"entries"`
+
+	// Root is the commitment to the tree holding Entries, and Nodes
+	// lists every node of that tree, in depth-first order.
+	Root  string        `json:"root"`
+	Nodes []InteropNode `json:"nodes"`
+
+	// ProofKeys are the keys covered by Proof and StateDiff.
+	ProofKeys []string     `json:"proofKeys,omitempty"`
+	Proof     *VerkleProof `json:"proof,omitempty"`
+	StateDiff StateDiff    `json:"stateDiff,omitempty"`
+}
+
+// InteropEntry is a key/value pair inserted in the fixture tree.
+type InteropEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// InteropNode describes a node of the fixture tree by its path. C1, C2
+// and Stem are only set for leaf nodes.
+type InteropNode struct {
+	Path       string `json:"path"`
+	Commitment string `json:"commitment"`
+	Stem       string `json:"stem,omitempty"`
+	C1         string `json:"c1,omitempty"`
+	C2         string `json:"c2,omitempty"`
+}
+
+// NewInteropFixture builds the tree holding the given key/value pairs and
+// returns the corresponding fixture. If proofKeys isn't empty, a proof
+// for these keys is included.
+func NewInteropFixture(name string, keys, values [][]byte, proofKeys [][]byte) (*InteropFixture, error) {
+	if len(keys) != len(values) {
+		return nil, fmt.Errorf("got %d keys and %d values", len(keys), len(values))
+	}
+	f := &InteropFixture{Name: name}
+	for i := range keys {
+		f.Entries = append(f.Entries, InteropEntry{
+			Key:   HexToPrefixedString(keys[i]),
+			Value: HexToPrefixedString(values[i]),
+		})
+	}
+	for _, key := range proofKeys {
+		f.ProofKeys = append(f.ProofKeys, HexToPrefixedString(key))
+	}
+
+	root, err := f.buildTree()
+	if err != nil {
+		return nil, err
+	}
+	rootC := root.Commit().Bytes()
+	f.Root = HexToPrefixedString(rootC[:])
+	f.Nodes = interopNodes(root)
+	if len(proofKeys) > 0 {
+		f.Proof, f.StateDiff, err = interopProof(root, proofKeys)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Check rebuilds the fixture tree and returns an error describing the
+// first divergence from the expected root, nodes and proof. The proof
+// is then verified against the expected root.
+func (f *InteropFixture) Check() error {
+	root, err := f.buildTree()
+	if err != nil {
+		return err
+	}
+	rootC := root.Commit()
+	rootBytes := rootC.Bytes()
+	if got := HexToPrefixedString(rootBytes[:]); got != f.Root {
+		return fmt.Errorf("root mismatch: got %s, expected %s", got, f.Root)
+	}
+
+	nodes := interopNodes(root)
+	for i := 0; i < len(nodes) && i < len(f.Nodes); i++ {
+		if nodes[i] != f.Nodes[i] {
+			return fmt.Errorf("node mismatch at path %s: got %+v, expected %+v", nodes[i].Path, nodes[i], f.Nodes[i])
+		}
+	}
+	if len(nodes) != len(f.Nodes) {
+		return fmt.Errorf("got %d nodes, expected %d", len(nodes), len(f.Nodes))
+	}
+
+	if len(f.ProofKeys) == 0 {
+		return nil
+	}
+	if f.Proof == nil {
+		return errors.New("missing proof")
+	}
+	keys, err := decodeHexStrings(f.ProofKeys)
+	if err != nil {
+		return err
+	}
+	vp, statediff, err := interopProof(root, keys)
+	if err != nil {
+		return err
+	}
+	if err := sameJSON("proof", vp, f.Proof); err != nil {
+		return err
+	}
+	if err := sameJSON("state diff", statediff, f.StateDiff); err != nil {
+		return err
+	}
+
+	proof, err := DeserializeProof(f.Proof, f.StateDiff)
+	if err != nil {
+		return fmt.Errorf("deserializing proof: %w", err)
+	}
+	pretree, err := PreStateTreeFromProof(proof, rootC)
+	if err != nil {
+		return fmt.Errorf("rebuilding pre-state tree: %w", err)
+	}
+	if err := VerifyVerkleProofWithPreState(proof, pretree); err != nil {
+		return fmt.Errorf("verifying proof: %w", err)
+	}
+	return nil
+}
+
+// ReadInteropFixtures decodes a JSON list of fixtures.
+func ReadInteropFixtures(r io.Reader) ([]InteropFixture, error) {
+	var fixtures []InteropFixture
+	if err := json.NewDecoder(r).Decode(&fixtures); err != nil {
+		return nil, fmt.Errorf("decoding interop fixtures: %w", err)
+	}
+	return fixtures, nil
+}
+
+// WriteInteropFixtures encodes fixtures as an indented JSON list.
+func WriteInteropFixtures(w io.Writer, fixtures []InteropFixture) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(fixtures)
+}
+
+func (f *InteropFixture) buildTree() (VerkleNode, error) {
+	root := New()
+	for _, entry := range f.Entries {
+		key, err := PrefixedHexStringToBytes(entry.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", entry.Key, err)
+		}
+		value, err := PrefixedHexStringToBytes(entry.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q: %w", entry.Value, err)
+		}
+		if err := root.Insert(key, value, nil); err != nil {
+			return nil, fmt.Errorf("inserting %x: %w", key, err)
+		}
+	}
+	return root, nil
+}
+
+func interopProof(root VerkleNode, keys [][]byte) (*VerkleProof, StateDiff, error) {
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, keys, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating proof: %w", err)
+	}
+	return SerializeProof(proof)
+}
+
+// interopNodes lists the nodes of a committed, fully in-memory tree.
+func interopNodes(root VerkleNode) []InteropNode {
+	var nodes []InteropNode
+	var walk func(VerkleNode, []byte)
+	walk = func(node VerkleNode, path []byte) {
+		switch n := node.(type) {
+		case *InternalNode:
+			c := n.commitment.Bytes()
+			nodes = append(nodes, InteropNode{
+				Path:       HexToPrefixedString(path),
+				Commitment: HexToPrefixedString(c[:]),
+			})
+			for i, child := range n.children {
+				walk(child, append(path[:len(path):len(path)], byte(i)))
+			}
+		case *LeafNode:
+			c, c1, c2 := n.commitment.Bytes(), n.c1.Bytes(), n.c2.Bytes()
+			nodes = append(nodes, InteropNode{
+				Path:       HexToPrefixedString(path),
+				Commitment: HexToPrefixedString(c[:]),
+				Stem:       HexToPrefixedString(n.stem),
+				C1:         HexToPrefixedString(c1[:]),
+				C2:         HexToPrefixedString(c2[:]),
+			})
+		}
+	}
+	walk(root, nil)
+	return nodes
+}
+
+func decodeHexStrings(strs []string) ([][]byte, error) {
+	out := make([][]byte, len(strs))
+	for i, s := range strs {
+		b, err := PrefixedHexStringToBytes(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex string %q: %w", s, err)
+		}
+		out[i] = b
+	}
+	return out, nil
+}
+
+func sameJSON(what string, got, expected interface{}) error {
+	g, err := json.Marshal(got)
+	if err != nil {
+		return err
+	}
+	e, err := json.Marshal(expected)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(g, e) {
+		return fmt.Errorf("%s mismatch: got %s, expected %s", what, g, e)
+	}
+	return nil
+}
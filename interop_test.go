@@ -0,0 +1,69 @@
+package verkle
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestInteropFixtures(t *testing.T) {
+	t.Parallel()
+
+	f, err := os.Open("testdata/interop/fixtures.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fixtures, err := ReadInteropFixtures(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures found")
+	}
+	for _, fixture := range fixtures {
+		if err := fixture.Check(); err != nil {
+			t.Fatalf("%s: %v", fixture.Name, err)
+		}
+	}
+}
+
+func TestInteropFixtureMismatch(t *testing.T) {
+	t.Parallel()
+
+	fixture, err := NewInteropFixture("test", [][]byte{zeroKeyTest, ffx32KeyTest}, [][]byte{testValue, testValue}, [][]byte{zeroKeyTest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fixture.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Round-trip through the JSON encoding
+	var buf bytes.Buffer
+	if err := WriteInteropFixtures(&buf, []InteropFixture{*fixture}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ReadInteropFixtures(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded[0].Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := decoded[0]
+	tampered.Nodes = append([]InteropNode{}, decoded[0].Nodes...)
+	tampered.Nodes[1].C1 = tampered.Nodes[2].C1
+	if err := tampered.Check(); err == nil || !strings.Contains(err.Error(), "node mismatch") {
+		t.Fatalf("expected a node mismatch, got %v", err)
+	}
+
+	tampered = decoded[0]
+	tampered.Proof = decoded[0].Proof.Copy()
+	tampered.Proof.D[0] ^= 1
+	if err := tampered.Check(); err == nil || !strings.Contains(err.Error(), "proof mismatch") {
+		t.Fatalf("expected a proof mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// The invariant checkers below are meant to be used as properties in
+// property-based tests: they walk the in-memory part of a tree, and
+// return an *InvariantError describing the first violation found. Nodes
+// that haven't been resolved (HashedNode) are skipped.
+
+// Names of the checks reported in an InvariantError.
+const (
+	InvariantCommitments = "commitments"
+	InvariantStructure   = "structure"
+	InvariantProof       = "proof"
+)
+
+// InvariantError is returned by the invariant checkers.
+type InvariantError struct {
+	Check string // name of the failing check
+	Path  []byte // path of the offending node, if relevant
+	Err   error
+}
+
+func (e *InvariantError) Error() string {
+	return fmt.Sprintf("%s invariant violated at path %x: %v", e.Check, e.Path, e.Err)
+}
+
+func (e *InvariantError) Unwrap() error {
+	return e.Err
+}
+
+// CheckInvariants runs CheckCommitments and CheckStructure on the tree.
+func CheckInvariants(root VerkleNode) error {
+	if err := CheckStructure(root); err != nil {
+		return err
+	}
+	return CheckCommitments(root)
+}
+
+// CheckCommitments recomputes the commitment of every in-memory node of
+// a committed tree, and checks them against the stored ones. Leaves are
+// recomputed from their values, so this check only makes sense on full
+// trees, and not on stateless trees rebuilt from a proof.
+func CheckCommitments(root VerkleNode) error {
+	return checkCommitments(root, nil)
+}
+
+func checkCommitments(node VerkleNode, path []byte) error {
+	fail := func(err error) error {
+		return &InvariantError{Check: InvariantCommitments, Path: path, Err: err}
+	}
+	switch n := node.(type) {
+	case *InternalNode:
+		if len(n.cow) != 0 {
+			return fail(errors.New("node has uncommitted changes"))
+		}
+		var poly [NodeWidth]Fr
+		for i, child := range n.children {
+			childPath := append(append([]byte{}, path...), byte(i))
+			switch c := child.(type) {
+			case Empty:
+				continue
+			case HashedNode:
+				// The child commitment isn't available, so the
+				// node commitment can't be recomputed.
+				return nil
+			default:
+				if err := checkCommitments(c, childPath); err != nil {
+					return err
+				}
+				c.Commitment().MapToScalarField(&poly[i])
+			}
+		}
+		if !n.config().CommitToPoly(poly[:], 0).Equal(n.commitment) {
+			return fail(errors.New("commitment does not match the children commitments"))
+		}
+	case *LeafNode:
+		if n.isPOAStub {
+			return nil
+		}
+		if err := checkNodeCommitment(n); err != nil {
+			return fail(err)
+		}
+	}
+	return nil
+}
+
+// CheckStructure checks that the tree is well formed: depths increase
+// by one at each level, every leaf is placed at a path that is a prefix
+// of its stem, missing children are represented with Empty, no internal
+// node other than the root is empty, and leaves contain at least one
+// value, each no longer than LeafValueSize.
+func CheckStructure(root VerkleNode) error {
+	n, ok := root.(*InternalNode)
+	if !ok {
+		return &InvariantError{Check: InvariantStructure, Err: fmt.Errorf("root is a %T, not an internal node", root)}
+	}
+	if n.depth != 0 {
+		return &InvariantError{Check: InvariantStructure, Err: fmt.Errorf("root is at depth %d", n.depth)}
+	}
+	return checkStructure(n, nil)
+}
+
+func checkStructure(n *InternalNode, path []byte) error {
+	var nonEmpty int
+	for i, child := range n.children {
+		childPath := append(append([]byte{}, path...), byte(i))
+		fail := func(format string, args ...interface{}) error {
+			return &InvariantError{Check: InvariantStructure, Path: childPath, Err: fmt.Errorf(format, args...)}
+		}
+		switch c := child.(type) {
+		case nil:
+			return fail("nil child, Empty expected")
+		case Empty:
+			continue
+		case *InternalNode:
+			if c.depth != n.depth+1 {
+				return fail("internal node at depth %d, expected %d", c.depth, n.depth+1)
+			}
+			if err := checkStructure(c, childPath); err != nil {
+				return err
+			}
+		case *LeafNode:
+			if c.depth != n.depth+1 {
+				return fail("leaf at depth %d, expected %d", c.depth, n.depth+1)
+			}
+			if len(c.stem) != StemSize {
+				return fail("invalid stem length %d", len(c.stem))
+			}
+			if !bytes.HasPrefix(c.stem, childPath) {
+				return fail("stem %x is not under its path", c.stem)
+			}
+			if c.isPOAStub {
+				break
+			}
+			var count int
+			for suffix, v := range c.values {
+				if len(v) > LeafValueSize {
+					return fail("value at suffix %02x is %d bytes long", suffix, len(v))
+				}
+				if v != nil {
+					count++
+				}
+			}
+			if count == 0 {
+				return fail("leaf %x has no values", c.stem)
+			}
+		}
+		nonEmpty++
+	}
+	if nonEmpty == 0 && len(path) > 0 {
+		return &InvariantError{Check: InvariantStructure, Path: path, Err: errors.New("non-root internal node has no children")}
+	}
+	return nil
+}
+
+// CheckProofAgreement produces a proof for keys, round-trips it through
+// its serialized form, and checks that it verifies against the root
+// commitment, and that the proven values are the ones stored in the tree.
+// The tree must be committed.
+func CheckProofAgreement(root VerkleNode, keys [][]byte, resolver NodeResolverFn) error {
+	fail := func(format string, args ...interface{}) error {
+		return &InvariantError{Check: InvariantProof, Err: fmt.Errorf(format, args...)}
+	}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, keys, resolver)
+	if err != nil {
+		return fail("creating proof: %w", err)
+	}
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		return fail("serializing proof: %w", err)
+	}
+	dproof, err := DeserializeProof(vp, sd)
+	if err != nil {
+		return fail("deserializing proof: %w", err)
+	}
+	dpreroot, err := PreStateTreeFromProof(dproof, root.Commitment())
+	if err != nil {
+		return fail("rebuilding pre-state tree: %w", err)
+	}
+	if err := VerifyVerkleProofWithPreState(dproof, dpreroot); err != nil {
+		return fail("verifying proof: %w", err)
+	}
+	for i, key := range dproof.Keys {
+		expected, err := root.Get(key, resolver)
+		if err != nil {
+			return fail("reading key %x: %w", key, err)
+		}
+		if !bytes.Equal(expected, dproof.PreValues[i]) {
+			return fail("proof has value %x for key %x, tree has %x", dproof.PreValues[i], key, expected)
+		}
+	}
+	return nil
+}
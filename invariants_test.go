@@ -0,0 +1,46 @@
+package verkle
+
+import (
+	"errors"
+	mRand "math/rand"
+	"testing"
+)
+
+func TestInvariantCheckers(t *testing.T) {
+	t.Parallel()
+
+	root := genRandomTree(mRand.New(mRand.NewSource(42)), 200) //skipcq: GSC-G404
+	root.Commit()
+	if err := CheckInvariants(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckProofAgreement(root, [][]byte{zeroKeyTest, ffx32KeyTest, fourtyKeyTest}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Uncommitted changes are reported
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatal(err)
+	}
+	var ierr *InvariantError
+	if err := CheckCommitments(root); !errors.As(err, &ierr) || ierr.Check != InvariantCommitments {
+		t.Fatalf("expected a commitment invariant error, got %v", err)
+	}
+	root.Commit()
+
+	// Simulate a corrupted value
+	leaf, err := root.(*InternalNode).GetValuesAtStem(zeroKeyTest[:StemSize], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf[0] = fourtyKeyTest
+	if err := CheckCommitments(root); !errors.As(err, &ierr) || len(ierr.Path) == 0 {
+		t.Fatalf("expected a commitment invariant error on a leaf, got %v", err)
+	}
+
+	// Simulate a misplaced child
+	root.(*InternalNode).children[0xff] = root.(*InternalNode).children[zeroKeyTest[0]]
+	if err := CheckStructure(root); !errors.As(err, &ierr) || ierr.Check != InvariantStructure {
+		t.Fatalf("expected a structure invariant error, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+)
+
+// Logger receives the log messages of the package. Its method set is that
+// of the go-ethereum logger, which can therefore be passed as is. ctx is
+// a list of alternating keys and values.
+type Logger interface {
+	Debug(msg string, ctx ...interface{})
+	Info(msg string, ctx ...interface{})
+	Warn(msg string, ctx ...interface{})
+	Error(msg string, ctx ...interface{})
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Debug(string, ...interface{}) {}
+func (noopLogger) Info(string, ...interface{})  {}
+func (noopLogger) Warn(string, ...interface{})  {}
+func (noopLogger) Error(string, ...interface{}) {}
+
+// loggerHolder keeps the concrete type stored in loggerSink constant,
+// which atomic.Value requires.
+type loggerHolder struct {
+	Logger
+}
+
+var loggerSink atomic.Value
+
+// DefaultSlowThreshold is the duration above which an operation is
+// reported as slow, unless changed with SetSlowThreshold.
+const DefaultSlowThreshold = time.Second
+
+var slowThreshold = int64(DefaultSlowThreshold)
+
+func init() {
+	loggerSink.Store(loggerHolder{noopLogger{}})
+}
+
+// SetLogger installs the logger used by the package. Passing nil restores
+// the default, which discards everything.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = noopLogger{}
+	}
+	loggerSink.Store(loggerHolder{l})
+}
+
+// SetSlowThreshold sets the duration above which node resolutions, commits
+// and proof operations log a warning. A zero or negative duration disables
+// these warnings.
+func SetSlowThreshold(d time.Duration) {
+	atomic.StoreInt64(&slowThreshold, int64(d))
+}
+
+func getLogger() Logger {
+	return loggerSink.Load().(loggerHolder).Logger
+}
+
+// warnIfSlow logs a warning if more than the slow threshold has elapsed
+// since start.
+func warnIfSlow(msg string, start time.Time, ctx ...interface{}) {
+	if elapsed, slow := slowSince(start); slow {
+		getLogger().Warn(msg, append(ctx, "elapsed", elapsed)...)
+	}
+}
+
+// slowSince returns the time elapsed since start, and whether it exceeds
+// the slow threshold. It is for the hot paths that only build the context
+// of their warning when it is logged.
+func slowSince(start time.Time) (time.Duration, bool) {
+	threshold := time.Duration(atomic.LoadInt64(&slowThreshold))
+	if threshold <= 0 {
+		return 0, false
+	}
+	elapsed := time.Since(start)
+	return elapsed, elapsed > threshold
+}
+
+// hexBytes defers the hex encoding of byte strings passed to the logger
+// until they are actually printed.
+type hexBytes []byte
+
+func (b hexBytes) String() string {
+	return hex.EncodeToString(b)
+}
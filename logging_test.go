@@ -0,0 +1,100 @@
+package verkle
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type logRecord struct {
+	level, msg string
+	ctx        []interface{}
+}
+
+type recordingLogger struct {
+	lock    sync.Mutex
+	records []logRecord
+}
+
+func (l *recordingLogger) record(level, msg string, ctx []interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.records = append(l.records, logRecord{level, msg, ctx})
+}
+
+func (l *recordingLogger) Debug(msg string, ctx ...interface{}) { l.record("debug", msg, ctx) }
+func (l *recordingLogger) Info(msg string, ctx ...interface{})  { l.record("info", msg, ctx) }
+func (l *recordingLogger) Warn(msg string, ctx ...interface{})  { l.record("warn", msg, ctx) }
+func (l *recordingLogger) Error(msg string, ctx ...interface{}) { l.record("error", msg, ctx) }
+
+func (l *recordingLogger) find(level, msg string) *logRecord {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for i := range l.records {
+		if l.records[i].level == level && l.records[i].msg == msg {
+			return &l.records[i]
+		}
+	}
+	return nil
+}
+
+func TestLoggerSlowOperations(t *testing.T) {
+	logger := &recordingLogger{}
+	SetLogger(logger)
+	defer SetLogger(nil)
+	SetSlowThreshold(time.Hour)
+	defer SetSlowThreshold(DefaultSlowThreshold)
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	if len(logger.records) != 0 {
+		t.Fatalf("unexpected log messages below the threshold: %v", logger.records)
+	}
+
+	SetSlowThreshold(time.Nanosecond)
+
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	record := logger.find("warn", "Slow commitment")
+	if record == nil {
+		t.Fatal("slow commitment wasn't reported")
+	}
+	if len(record.ctx) != 4 || record.ctx[0] != "nodes" || record.ctx[2] != "elapsed" {
+		t.Fatalf("invalid context %v", record.ctx)
+	}
+
+	if _, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if logger.find("warn", "Slow proof generation") == nil {
+		t.Fatal("slow proof generation wasn't reported")
+	}
+
+	resolver := func(path []byte) ([]byte, error) {
+		return nil, fmt.Errorf("no node at %x", path)
+	}
+	_, _ = resolveNode(resolver, []byte{1, 2})
+	record = logger.find("warn", "Slow node resolution")
+	if record == nil {
+		t.Fatal("slow resolution wasn't reported")
+	}
+	if s := fmt.Sprint(record.ctx[1]); s != "0102" {
+		t.Fatalf("invalid path %s", s)
+	}
+
+	SetSlowThreshold(0)
+	logger.records = nil
+	root.Commit()
+	if _, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(logger.records) != 0 {
+		t.Fatalf("unexpected log messages with slow warnings disabled: %v", logger.records)
+	}
+}
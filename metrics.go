@@ -0,0 +1,154 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Names of the metrics reported by the package.
+const (
+	MetricResolverResolves  = "verkle/resolver/resolves"  // counter: calls to a NodeResolverFn
+	MetricResolverErrors    = "verkle/resolver/errors"    // counter: failed calls to a NodeResolverFn
+	MetricResolverBytesRead = "verkle/resolver/bytesread" // counter: total serialized bytes returned
+	MetricResolverLatency   = "verkle/resolver/latency"   // timer: resolver latency
+	MetricResolverNodeSize  = "verkle/resolver/nodesize"  // histogram: serialized bytes returned per call
+	MetricResolverMicros    = "verkle/resolver/micros"    // histogram: resolver latency, in microseconds
+	MetricCacheHits         = "verkle/cache/hits"         // counter: resolutions saved by resolved nodes kept in memory
+	MetricNodeCacheHits     = "verkle/nodecache/hits"     // counter: resolutions served by a NodeCache
+	MetricNodeCacheMisses   = "verkle/nodecache/misses"   // counter: resolutions a NodeCache had to forward
+	MetricNodeCachePinned   = "verkle/nodecache/pinned"   // gauge: entries in the pinned generation
+	MetricNodeCacheLRU      = "verkle/nodecache/lru"      // gauge: entries in the LRU generation
+
+	MetricCommitTime  = "verkle/commit/time"  // timer: time spent committing dirty internal nodes
+	MetricCommitNodes = "verkle/commit/nodes" // counter: internal nodes whose commitment was recomputed
+	MetricFlushTime   = "verkle/flush/time"   // timer: time spent in InternalNode.Flush
+	MetricFlushNodes  = "verkle/flush/nodes"  // counter: nodes passed to a NodeFlushFn
+	MetricEvictions   = "verkle/evict/nodes"  // counter: subtrees evicted by EvictClean
+
+	MetricProofTime      = "verkle/proof/time"           // timer: time spent in MakeVerkleMultiProof
+	MetricProofs         = "verkle/proof/proofs"         // counter: proofs generated
+	MetricProofKeys      = "verkle/proof/keys"           // counter: keys covered by the generated proofs
+	MetricVerifyTime     = "verkle/verify/time"          // timer: time spent in VerifyVerkleProof
+	MetricVerifications  = "verkle/verify/verifications" // counter: proofs verified
+	MetricVerifyFailures = "verkle/verify/failures"      // counter: proofs that failed to verify
+)
+
+// Metrics receives the instrumentation data produced by the tree.
+// Implementations must be safe for concurrent use, as the tree
+// commits and resolves nodes from several goroutines.
+type Metrics interface {
+	// IncCounter adds delta to the counter called name.
+	IncCounter(name string, delta int64)
+
+	// UpdateGauge sets the gauge called name to value.
+	UpdateGauge(name string, value int64)
+
+	// UpdateHistogram records a sample in the histogram called name.
+	UpdateHistogram(name string, value int64)
+
+	// UpdateTimer records a duration in the timer called name.
+	UpdateTimer(name string, d time.Duration)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) IncCounter(string, int64)          {}
+func (noopMetrics) UpdateGauge(string, int64)         {}
+func (noopMetrics) UpdateHistogram(string, int64)     {}
+func (noopMetrics) UpdateTimer(string, time.Duration) {}
+
+// metricsHolder keeps the concrete type stored in metricsSink constant,
+// which atomic.Value requires.
+type metricsHolder struct {
+	Metrics
+}
+
+var metricsSink atomic.Value
+
+func init() {
+	metricsSink.Store(metricsHolder{noopMetrics{}})
+}
+
+// SetMetrics installs the sink that will receive all metrics reported
+// by the package. Passing nil restores the default, which discards
+// everything.
+func SetMetrics(m Metrics) {
+	if m == nil {
+		m = noopMetrics{}
+	}
+	metricsSink.Store(metricsHolder{m})
+}
+
+func getMetrics() Metrics {
+	return metricsSink.Load().(metricsHolder).Metrics
+}
+
+// resolveNode calls the resolver for the node at the given path, and
+// reports the corresponding resolver metrics. Resolver errors are
+// wrapped in a ResolveError.
+func resolveNode(resolver NodeResolverFn, path []byte) ([]byte, error) {
+	m := getMetrics()
+	start := time.Now()
+	prof := startProfile()
+	serialized, err := resolver(path)
+	latency := time.Since(start)
+	m.UpdateTimer(MetricResolverLatency, latency)
+	m.UpdateHistogram(MetricResolverMicros, latency.Microseconds())
+	prof.report(MetricResolverAllocs, MetricResolverAllocBytes, MetricResolverCPU)
+	m.IncCounter(MetricResolverResolves, 1)
+	if elapsed, slow := slowSince(start); slow {
+		getLogger().Warn("Slow node resolution", "path", hexBytes(path), "elapsed", elapsed)
+	}
+	if err != nil {
+		m.IncCounter(MetricResolverErrors, 1)
+		return nil, &ResolveError{Path: append([]byte{}, path...), Err: err}
+	}
+	m.IncCounter(MetricResolverBytesRead, int64(len(serialized)))
+	m.UpdateHistogram(MetricResolverNodeSize, int64(len(serialized)))
+	return serialized, nil
+}
+
+// markCacheHit records that node was found in memory while it would have
+// to be resolved otherwise, i.e. that it was resolved and hasn't been
+// modified since, which is also what EvictClean evicts. Nodes created in
+// memory are never counted.
+func markCacheHit(node VerkleNode) {
+	switch n := node.(type) {
+	case *InternalNode:
+		if !n.clean {
+			return
+		}
+	case *LeafNode:
+		if !n.clean {
+			return
+		}
+	default:
+		return
+	}
+	getMetrics().IncCounter(MetricCacheHits, 1)
+}
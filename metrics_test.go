@@ -0,0 +1,164 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingMetrics struct {
+	lock       sync.Mutex
+	counters   map[string]int64
+	gauges     map[string]int64
+	histograms map[string][]int64
+	timers     map[string][]time.Duration
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{
+		counters:   map[string]int64{},
+		gauges:     map[string]int64{},
+		histograms: map[string][]int64{},
+		timers:     map[string][]time.Duration{},
+	}
+}
+
+func (m *recordingMetrics) IncCounter(name string, delta int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.counters[name] += delta
+}
+
+func (m *recordingMetrics) UpdateGauge(name string, value int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.gauges[name] = value
+}
+
+func (m *recordingMetrics) UpdateTimer(name string, d time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.timers[name] = append(m.timers[name], d)
+}
+
+func (m *recordingMetrics) UpdateHistogram(name string, value int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.histograms[name] = append(m.histograms[name], value)
+}
+
+func TestResolverMetrics(t *testing.T) {
+	m := newRecordingMetrics()
+	SetMetrics(m)
+	defer SetMetrics(nil)
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	db := map[string][]byte{}
+	root.(*InternalNode).Flush(func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = s
+	})
+	resolver := func(path []byte) ([]byte, error) {
+		if s, ok := db[string(path)]; ok {
+			return s, nil
+		}
+		return nil, errors.New("not found")
+	}
+
+	// First read resolves the leaf, the second one is served from memory.
+	for i := 0; i < 2; i++ {
+		val, err := root.Get(zeroKeyTest, resolver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(val, fourtyKeyTest) {
+			t.Fatalf("invalid value %x", val)
+		}
+	}
+
+	if m.counters[MetricResolverResolves] != 1 {
+		t.Fatalf("invalid resolve count %d", m.counters[MetricResolverResolves])
+	}
+	if m.counters[MetricResolverBytesRead] != int64(len(db[string(zeroKeyTest[:1])])) {
+		t.Fatalf("invalid byte count %d", m.counters[MetricResolverBytesRead])
+	}
+	if m.counters[MetricCacheHits] != 1 {
+		t.Fatalf("invalid cache hit count %d", m.counters[MetricCacheHits])
+	}
+	if len(m.timers[MetricResolverLatency]) != 1 || len(m.histograms[MetricResolverMicros]) != 1 {
+		t.Fatalf("invalid number of latency samples %d", len(m.timers[MetricResolverLatency]))
+	}
+	if sizes := m.histograms[MetricResolverNodeSize]; len(sizes) != 1 || sizes[0] != int64(len(db[string(zeroKeyTest[:1])])) {
+		t.Fatalf("invalid node sizes %v", sizes)
+	}
+
+	// The insertion is served from memory, but the modified leaf would
+	// not be resolved again, so reading it isn't a cache hit.
+	if err := root.Insert(zeroKeyTest, testValue, resolver); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.Get(zeroKeyTest, resolver); err != nil {
+		t.Fatal(err)
+	}
+	if m.counters[MetricCacheHits] != 2 {
+		t.Fatalf("invalid cache hit count %d", m.counters[MetricCacheHits])
+	}
+
+	// Check that a failing resolver is reported
+	failing := func([]byte) ([]byte, error) { return nil, errors.New("failure") }
+	if _, err := root.Get(ffx32KeyTest, failing); err == nil {
+		t.Fatal("expected an error")
+	}
+	if m.counters[MetricResolverErrors] != 1 {
+		t.Fatalf("invalid error count %d", m.counters[MetricResolverErrors])
+	}
+}
+
+func TestCommitAndProofMetrics(t *testing.T) {
+	m := newRecordingMetrics()
+	SetMetrics(m)
+	defer SetMetrics(nil)
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(oneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	if len(m.timers[MetricCommitTime]) != 1 || m.counters[MetricCommitNodes] != 1 {
+		t.Fatalf("invalid commit metrics: %d samples, %d nodes", len(m.timers[MetricCommitTime]), m.counters[MetricCommitNodes])
+	}
+
+	proof, cis, zis, yis, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, oneKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.counters[MetricProofs] != 1 || m.counters[MetricProofKeys] != 2 || len(m.timers[MetricProofTime]) != 1 {
+		t.Fatal("invalid proof generation metrics")
+	}
+	if ok, err := VerifyVerkleProof(proof, cis, zis, yis, GetConfig()); !ok || err != nil {
+		t.Fatalf("could not verify proof: %v", err)
+	}
+	if m.counters[MetricVerifications] != 1 || m.counters[MetricVerifyFailures] != 0 || len(m.timers[MetricVerifyTime]) != 1 {
+		t.Fatal("invalid verification metrics")
+	}
+
+	// The root and the leaf are flushed, and reported once.
+	root.(*InternalNode).Flush(func([]byte, VerkleNode) {})
+	if m.counters[MetricFlushNodes] != 2 || len(m.timers[MetricFlushTime]) != 1 {
+		t.Fatalf("invalid flush metrics: %d nodes, %d samples", m.counters[MetricFlushNodes], len(m.timers[MetricFlushTime]))
+	}
+}
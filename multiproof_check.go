@@ -0,0 +1,219 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	ipa "github.com/crate-crypto/go-ipa"
+	"github.com/crate-crypto/go-ipa/bandersnatch/fr"
+	"github.com/crate-crypto/go-ipa/common"
+	ipaconf "github.com/crate-crypto/go-ipa/ipa"
+)
+
+// Labels of the transcripts of the multipoint and IPA arguments, which
+// go-ipa doesn't export.
+var (
+	labelMultiproof  = []byte("multiproof")
+	labelIPA         = []byte("ipa")
+	labelC           = []byte("C")
+	labelZ           = []byte("z")
+	labelY           = []byte("y")
+	labelD           = []byte("D")
+	labelE           = []byte("E")
+	labelT           = []byte("t")
+	labelR           = []byte("r")
+	labelInputPoint  = []byte("input point")
+	labelOutputPoint = []byte("output point")
+	labelW           = []byte("w")
+	labelL           = []byte("L")
+	labelIPAR        = []byte("R")
+	labelX           = []byte("x")
+)
+
+// checkMultiProof verifies a multipoint argument like ipa.CheckMultiProof,
+// but only reads the exported fields of conf: the CRS points, Q and the
+// barycentric weights. This lets verkle_small builds create the settings
+// without ipa.NewIPASettings, which builds the precomputed tables, and
+// is the only way to set the number of rounds of the IPA argument.
+func checkMultiProof(transcript *common.Transcript, conf *ipaconf.IPAConfig, proof *ipa.MultiProof, cs []*Point, ys []*Fr, zs []byte) (bool, error) {
+	transcript.DomainSep(labelMultiproof)
+
+	if len(cs) != len(ys) {
+		return false, fmt.Errorf("number of commitments = %d, while number of output points = %d", len(cs), len(ys))
+	}
+	if len(cs) != len(zs) {
+		return false, fmt.Errorf("number of commitments = %d, while number of input points = %d", len(cs), len(zs))
+	}
+	if len(cs) == 0 {
+		return false, errors.New("number of queries is zero")
+	}
+
+	for i := range cs {
+		var z Fr
+		z.SetUint64(uint64(zs[i]))
+		transcript.AppendPoint(cs[i], labelC)
+		transcript.AppendScalar(&z, labelZ)
+		transcript.AppendScalar(ys[i], labelY)
+	}
+	r := transcript.ChallengeScalar(labelR)
+	powersOfR := common.PowersOf(r, len(cs))
+	transcript.AppendPoint(&proof.D, labelD)
+	t := transcript.ChallengeScalar(labelT)
+
+	// Group the evaluations by evaluation point, and compute 1/(t - z)
+	// for each point of the domain.
+	groupedEvals := make([]Fr, common.VectorLength)
+	for i := range cs {
+		var scaled Fr
+		scaled.Mul(&powersOfR[i], ys[i])
+		groupedEvals[zs[i]].Add(&groupedEvals[zs[i]], &scaled)
+	}
+	den := make([]Fr, common.VectorLength)
+	for i := range den {
+		var z Fr
+		z.SetUint64(uint64(i))
+		den[i].Sub(&t, &z)
+	}
+	den = fr.BatchInvert(den)
+
+	// g2(t) = sum(r^i * y_i / (t - z_i))
+	var g2t Fr
+	for i := range groupedEvals {
+		if groupedEvals[i].IsZero() {
+			continue
+		}
+		var tmp Fr
+		tmp.Mul(&groupedEvals[i], &den[i])
+		g2t.Add(&g2t, &tmp)
+	}
+
+	// E = sum(C_i * r^i / (t - z_i))
+	scalars := make([]Fr, len(cs))
+	points := make([]Point, len(cs))
+	for i := range cs {
+		points[i] = *cs[i]
+		scalars[i].Mul(&powersOfR[i], &den[zs[i]])
+	}
+	e, err := ipaconf.MultiScalar(points, scalars)
+	if err != nil {
+		return false, fmt.Errorf("could not compute E: %w", err)
+	}
+	transcript.AppendPoint(&e, labelE)
+
+	var eMinusD Point
+	eMinusD.Sub(&e, &proof.D)
+	ok, err := checkIPAProof(transcript, conf, eMinusD, &proof.IPA, t, g2t)
+	if err != nil {
+		return false, fmt.Errorf("could not check IPA proof: %w", err)
+	}
+	return ok, nil
+}
+
+// checkIPAProof verifies the IPA argument of a multipoint argument like
+// ipa.CheckIPAProof.
+func checkIPAProof(transcript *common.Transcript, conf *ipaconf.IPAConfig, commitment Point, proof *ipaconf.IPAProof, evalPoint, result Fr) (bool, error) {
+	transcript.DomainSep(labelIPA)
+
+	if len(proof.L) != len(proof.R) {
+		return false, errors.New("vectors L and R should be the same size")
+	}
+	if len(proof.L) != IPA_PROOF_DEPTH || len(conf.SRS) != common.VectorLength {
+		return false, errors.New("the number of points for L and R should be equal to the number of rounds")
+	}
+
+	// The evaluation vector b is the barycentric coefficients of the
+	// evaluation point, or a unit vector if it is in the domain.
+	var b []Fr
+	var maxInDomain Fr
+	maxInDomain.SetUint64(common.VectorLength - 1)
+	if evalPoint.Cmp(&maxInDomain) > 0 {
+		b = conf.PrecomputedWeights.ComputeBarycentricCoefficients(evalPoint)
+	} else {
+		var idx big.Int
+		evalPoint.ToBigIntRegular(&idx)
+		b = make([]Fr, common.VectorLength)
+		b[idx.Uint64()].SetOne()
+	}
+
+	transcript.AppendPoint(&commitment, labelC)
+	transcript.AppendScalar(&evalPoint, labelInputPoint)
+	transcript.AppendScalar(&result, labelOutputPoint)
+	w := transcript.ChallengeScalar(labelW)
+
+	// Rescale Q
+	var q, qy Point
+	q.ScalarMul(&conf.Q, &w)
+	qy.ScalarMul(&q, &result)
+	commitment.Add(&commitment, &qy)
+
+	challenges := make([]Fr, len(proof.L))
+	for i := range proof.L {
+		transcript.AppendPoint(&proof.L[i], labelL)
+		transcript.AppendPoint(&proof.R[i], labelIPAR)
+		challenges[i] = transcript.ChallengeScalar(labelX)
+	}
+	challengesInv := fr.BatchInvert(challenges)
+
+	// Expected commitment: C + sum(x_i * L_i + 1/x_i * R_i)
+	for i := range challenges {
+		var err error
+		commitment, err = ipaconf.MultiScalar([]Point{commitment, proof.L[i], proof.R[i]}, []Fr{fr.One(), challenges[i], challengesInv[i]})
+		if err != nil {
+			return false, fmt.Errorf("could not compute commitment+x*L+x^-1*R: %w", err)
+		}
+	}
+
+	// Fold the CRS points and b with the challenges
+	folding := make([]Fr, common.VectorLength)
+	for i := range folding {
+		folding[i].SetOne()
+		for j := range challengesInv {
+			if i&(1<<(IPA_PROOF_DEPTH-1-j)) != 0 {
+				folding[i].Mul(&folding[i], &challengesInv[j])
+			}
+		}
+	}
+	g0, err := ipaconf.MultiScalar(conf.SRS, folding)
+	if err != nil {
+		return false, fmt.Errorf("could not compute g0: %w", err)
+	}
+	b0, err := ipaconf.InnerProd(b, folding)
+	if err != nil {
+		return false, fmt.Errorf("could not compute b0: %w", err)
+	}
+
+	// g0 * a + (a * b0) * Q
+	var got, part Point
+	var ab Fr
+	got.ScalarMul(&g0, &proof.A_scalar)
+	ab.Mul(&b0, &proof.A_scalar)
+	part.ScalarMul(&q, &ab)
+	got.Add(&got, &part)
+	return got.Equal(&commitment), nil
+}
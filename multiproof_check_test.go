@@ -0,0 +1,69 @@
+package verkle
+
+import (
+	"testing"
+
+	ipa "github.com/crate-crypto/go-ipa"
+	"github.com/crate-crypto/go-ipa/common"
+	ipaconf "github.com/crate-crypto/go-ipa/ipa"
+)
+
+func TestCheckMultiProof(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, key := range [][]byte{zeroKeyTest, oneKeyTest, forkOneKeyTest, ffx32KeyTest} {
+		if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root.Commit()
+	proof, cs, zs, ys, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, fourtyKeyTest, ffx32KeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Settings without the number of rounds, as in verkle_small builds
+	full, err := proverSettings(GetConfig().conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	small := &ipaconf.IPAConfig{SRS: full.SRS, Q: full.Q, PrecomputedWeights: full.PrecomputedWeights}
+
+	tampered := *proof.Multipoint
+	tampered.IPA.A_scalar.Add(&tampered.IPA.A_scalar, &FrOne)
+	otherYs := append([]*Fr{}, ys...)
+	otherYs[0] = &FrOne
+
+	for _, tc := range []struct {
+		name  string
+		label string
+		mp    *ipa.MultiProof
+		ys    []*Fr
+		valid bool
+	}{
+		{"valid", defaultTranscriptLabel, proof.Multipoint, ys, true},
+		{"other label", "other", proof.Multipoint, ys, false},
+		{"tampered argument", defaultTranscriptLabel, &tampered, ys, false},
+		{"other values", defaultTranscriptLabel, proof.Multipoint, otherYs, false},
+	} {
+		expected, err := ipa.CheckMultiProof(common.NewTranscript(tc.label), full, tc.mp, cs, tc.ys, zs)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got, err := checkMultiProof(common.NewTranscript(tc.label), small, tc.mp, cs, tc.ys, zs)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got != expected || got != tc.valid {
+			t.Fatalf("%s: got %v, go-ipa %v, expected %v", tc.name, got, expected, tc.valid)
+		}
+	}
+
+	short := tampered
+	short.IPA.L = short.IPA.L[:IPA_PROOF_DEPTH-1]
+	short.IPA.R = short.IPA.R[:IPA_PROOF_DEPTH-1]
+	if _, err := checkMultiProof(common.NewTranscript(defaultTranscriptLabel), small, &short, cs, ys, zs); err == nil {
+		t.Fatal("argument with too few rounds was accepted")
+	}
+}
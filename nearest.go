@@ -0,0 +1,115 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// NearestStems returns the count stems of the tree that are the closest
+// to stem, in lexicographic order: before holds the stems smaller than
+// stem, the nearest first, and after those greater than stem, also the
+// nearest first. stem itself isn't returned, whether it is in the tree or
+// not. Fewer stems are returned if the tree doesn't hold as many on one
+// side. Only the subtrees holding the returned stems, and those along the
+// path of stem, are resolved.
+func (n *InternalNode) NearestStems(stem []byte, count int, resolver NodeResolverFn) (before, after [][]byte, err error) {
+	if len(stem) < StemSize {
+		return nil, nil, fmt.Errorf("invalid stem length %d, expected %d", len(stem), StemSize)
+	}
+	stem = stem[:StemSize]
+	for _, reverse := range []bool{true, false} {
+		var stems [][]byte
+		if count > 0 {
+			visit := func(leaf *LeafNode) bool {
+				if c := bytes.Compare(leaf.stem, stem); (reverse && c < 0) || (!reverse && c > 0) {
+					stems = append(stems, append([]byte{}, leaf.stem...))
+				}
+				return len(stems) < count
+			}
+			if _, err := n.walkStems(n.subtreePath(), stem, true, reverse, resolver, visit); err != nil {
+				return nil, nil, err
+			}
+		}
+		if reverse {
+			before = stems
+		} else {
+			after = stems
+		}
+	}
+	return before, after, nil
+}
+
+// walkStems calls visit for the leaves of the subtree of n, found at path,
+// in ascending order or, if reverse is set, in descending order. If
+// bounded is set, the children before the path of from, or after it if
+// reverse is set, are skipped. It stops as soon as visit returns false,
+// and returns false in that case.
+func (n *InternalNode) walkStems(path, from []byte, bounded, reverse bool, resolver NodeResolverFn, visit func(*LeafNode) bool) (bool, error) {
+	start, end, step := 0, NodeWidth, 1
+	if reverse {
+		start, end, step = NodeWidth-1, -1, -1
+	}
+	if bounded {
+		start = int(from[n.depth])
+	}
+	for i := start; i != end; i += step {
+		childpath := append(path[:len(path):len(path)], byte(i))
+		child := n.children[i]
+		if _, ok := child.(HashedNode); ok {
+			if resolver == nil {
+				return false, fmt.Errorf("walking path %x: %w", childpath, ErrReadFromInvalid)
+			}
+			serialized, err := resolveNode(resolver, childpath)
+			if err != nil {
+				return false, err
+			}
+			if child, err = n.parseChild(byte(i), serialized, childpath); err != nil {
+				return false, err
+			}
+			n.children[i] = child
+		}
+
+		switch c := child.(type) {
+		case Empty:
+		case *LeafNode:
+			if !visit(c) {
+				return false, nil
+			}
+		case *InternalNode:
+			more, err := c.walkStems(childpath, from, bounded && i == start, reverse, resolver, visit)
+			if !more || err != nil {
+				return false, err
+			}
+		case UnknownNode:
+			return false, fmt.Errorf("walking path %x: %w", childpath, ErrMissingNodeInStateless)
+		default:
+			return false, fmt.Errorf("walking path %x: %w", childpath, ErrUnknownNodeType)
+		}
+	}
+	return true, nil
+}
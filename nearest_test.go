@@ -0,0 +1,74 @@
+package verkle
+
+import (
+	"bytes"
+	mRand "math/rand"
+	"sort"
+	"testing"
+)
+
+func TestNearestStems(t *testing.T) {
+	t.Parallel()
+
+	kvs := genRandomKeyValues(mRand.New(mRand.NewSource(42)), 200) //skipcq: GSC-G404
+	root, resolver := flushedTree(t, nil, kvs)
+	var stems [][]byte
+	for _, kv := range kvs {
+		stems = append(stems, kv.key[:StemSize])
+	}
+	sort.Slice(stems, func(i, j int) bool { return bytes.Compare(stems[i], stems[j]) < 0 })
+
+	// Reload the root, so that the walk has to resolve the subtrees.
+	serialized, err := resolver(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateless, err := ParseNode(serialized, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	probes := [][]byte{stems[0], stems[57], append(append([]byte{}, stems[100][:StemSize-1]...), stems[100][StemSize-1]^1), zeroKeyTest[:StemSize], ffx32KeyTest[:StemSize]}
+	for _, probe := range probes {
+		i := sort.Search(len(stems), func(i int) bool { return bytes.Compare(stems[i], probe) >= 0 })
+		j := i
+		if j < len(stems) && bytes.Equal(stems[j], probe) {
+			j++
+		}
+		var expBefore, expAfter [][]byte
+		for k := i - 1; k >= 0 && len(expBefore) < 5; k-- {
+			expBefore = append(expBefore, stems[k])
+		}
+		for k := j; k < len(stems) && len(expAfter) < 5; k++ {
+			expAfter = append(expAfter, stems[k])
+		}
+
+		for _, tree := range []VerkleNode{root, stateless} {
+			before, after, err := tree.(*InternalNode).NearestStems(probe, 5, resolver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(before) != len(expBefore) || len(after) != len(expAfter) {
+				t.Fatalf("probe %x: got %d/%d stems, expected %d/%d", probe, len(before), len(after), len(expBefore), len(expAfter))
+			}
+			for k := range before {
+				if !bytes.Equal(before[k], expBefore[k]) {
+					t.Fatalf("probe %x: before[%d] = %x, expected %x", probe, k, before[k], expBefore[k])
+				}
+			}
+			for k := range after {
+				if !bytes.Equal(after[k], expAfter[k]) {
+					t.Fatalf("probe %x: after[%d] = %x, expected %x", probe, k, after[k], expAfter[k])
+				}
+			}
+		}
+	}
+
+	stateless, err = ParseNode(serialized, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := stateless.(*InternalNode).NearestStems(stems[0], 1, nil); err == nil {
+		t.Fatal("walking an unresolved tree without a resolver should fail")
+	}
+}
@@ -0,0 +1,222 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Overlay holds writes pending on top of a committed tree, like the state
+// changes of a block that is being built. It allows building the witness
+// of the block before the writes are applied to the tree. An Overlay is
+// safe for concurrent use.
+type Overlay struct {
+	lock   sync.RWMutex
+	values map[string][]byte
+}
+
+func NewOverlay() *Overlay {
+	return &Overlay{values: make(map[string][]byte)}
+}
+
+// Insert records a pending write of value at key.
+func (o *Overlay) Insert(key []byte, value []byte) error {
+	if len(key) != StemSize+1 {
+		return fmt.Errorf("invalid key size: %d", len(key))
+	}
+	if _, err := PadValue(value, AlignLeft); err != nil {
+		return err
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.values[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+// Get returns the pending write at key, if any.
+func (o *Overlay) Get(key []byte) ([]byte, bool) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	value, ok := o.values[string(key)]
+	return value, ok
+}
+
+// Len returns the number of pending writes.
+func (o *Overlay) Len() int {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	return len(o.values)
+}
+
+// Keys returns the keys of the pending writes, sorted.
+func (o *Overlay) Keys() [][]byte {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+
+	keys := make([][]byte, 0, len(o.values))
+	for key := range o.values {
+		keys = append(keys, []byte(key))
+	}
+	sort.Sort(keylist(keys))
+	return keys
+}
+
+// Apply inserts the pending writes into root, in key order.
+func (o *Overlay) Apply(root VerkleNode, resolver NodeResolverFn) error {
+	for _, key := range o.Keys() {
+		value, _ := o.Get(key)
+		if err := root.Insert(key, value, resolver); err != nil {
+			return fmt.Errorf("applying write at key %x: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// postValues returns the post-state values of a tree with the overlay
+// applied on top of it: the pending write of a key if there is one, and
+// its current value otherwise.
+func (o *Overlay) postValues(root VerkleNode, resolver NodeResolverFn) postValueFn {
+	return func(key []byte) ([]byte, error) {
+		if value, ok := o.Get(key); ok {
+			return configOf(root).alignValue(value)
+		}
+		return root.Get(key, resolver)
+	}
+}
+
+// MakeSpeculativeProof creates a proof against the committed root of base,
+// as if the writes of overlay had been applied on top of it: the keys
+// written by the overlay are proven along with keys, and their pending
+// values are reported as post-state values, which end up in the StateDiff
+// of the serialized proof. The result is the same as proving keys with a
+// post-state tree made of base with the overlay applied, without having
+// to copy and modify base.
+func MakeSpeculativeProof(base VerkleNode, overlay *Overlay, keys [][]byte, resolver NodeResolverFn) (*Proof, []*Point, []byte, []*Fr, error) {
+	all := make([][]byte, 0, len(keys)+overlay.Len())
+	all = append(all, keys...)
+	all = append(all, overlay.Keys()...)
+	sort.Sort(keylist(all))
+
+	// Keys that are both read and written are only proven once
+	deduped := all[:0]
+	for i, key := range all {
+		if i == 0 || !bytes.Equal(key, all[i-1]) {
+			deduped = append(deduped, key)
+		}
+	}
+	return makeVerkleMultiProof(base, overlay.postValues(base, resolver), deduped, resolver, nil)
+}
+
+// WitnessBuilder records the keys accessed while executing a block on
+// top of a committed tree, and builds the witness of the block. Writes
+// are kept in an Overlay, so that base isn't modified. A key that is
+// both read and written, in any order, appears once in the witness,
+// with its value in base as current value and its last written value as
+// new value. A WitnessBuilder is safe for concurrent use.
+type WitnessBuilder struct {
+	lock     sync.Mutex
+	base     VerkleNode
+	resolver NodeResolverFn
+	writes   *Overlay
+	reads    map[string]struct{}
+}
+
+func NewWitnessBuilder(base VerkleNode, resolver NodeResolverFn) *WitnessBuilder {
+	return &WitnessBuilder{
+		base:     base,
+		resolver: resolver,
+		writes:   NewOverlay(),
+		reads:    make(map[string]struct{}),
+	}
+}
+
+// Get returns the value of key as seen by the block, i.e. the last value
+// written to it if any, and its value in base otherwise.
+func (w *WitnessBuilder) Get(key []byte) ([]byte, error) {
+	if len(key) != StemSize+1 {
+		return nil, fmt.Errorf("invalid key size: %d", len(key))
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.reads[string(key)] = struct{}{}
+	if value, ok := w.writes.Get(key); ok {
+		return value, nil
+	}
+	return w.base.Get(key, w.resolver)
+}
+
+// Insert records a write of value at key.
+func (w *WitnessBuilder) Insert(key []byte, value []byte) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.writes.Insert(key, value)
+}
+
+// Writes returns the overlay holding the writes recorded so far.
+func (w *WitnessBuilder) Writes() *Overlay {
+	return w.writes
+}
+
+// Keys returns the keys that were read or written, sorted and without
+// duplicates.
+func (w *WitnessBuilder) Keys() [][]byte {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	keys := w.writes.Keys()
+	for key := range w.reads {
+		if _, ok := w.writes.Get([]byte(key)); !ok {
+			keys = append(keys, []byte(key))
+		}
+	}
+	sort.Sort(keylist(keys))
+	return keys
+}
+
+// Build proves the accessed keys against base, and serializes the proof
+// along with the state diff of the block.
+func (w *WitnessBuilder) Build() (*VerkleProof, StateDiff, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	reads := make([][]byte, 0, len(w.reads))
+	for key := range w.reads {
+		reads = append(reads, []byte(key))
+	}
+	proof, _, _, _, err := MakeSpeculativeProof(w.base, w.writes, reads, w.resolver)
+	if err != nil {
+		return nil, nil, err
+	}
+	return SerializeProof(proof)
+}
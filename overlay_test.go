@@ -0,0 +1,151 @@
+package verkle
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestSpeculativeProof(t *testing.T) {
+	t.Parallel()
+
+	base := New()
+	if err := base.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	base.Commit()
+
+	overlay := NewOverlay()
+	if err := overlay.Insert(zeroKeyTest, testValue); err != nil {
+		t.Fatal(err)
+	}
+	// Write to a stem that isn't in the tree yet
+	if err := overlay.Insert(forkOneKeyTest, testValue); err != nil {
+		t.Fatal(err)
+	}
+	reads := [][]byte{ffx32KeyTest, zeroKeyTest}
+	proof, _, _, _, err := MakeSpeculativeProof(base, overlay, reads, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.Keys) != 3 {
+		t.Fatalf("invalid number of proven keys %d", len(proof.Keys))
+	}
+
+	// Same proof as with the post-state tree
+	postroot := base.Copy()
+	if err := overlay.Apply(postroot, nil); err != nil {
+		t.Fatal(err)
+	}
+	postroot.Commit()
+	expected, _, _, _, err := MakeVerkleMultiProof(base, postroot, [][]byte{zeroKeyTest, forkOneKeyTest, ffx32KeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evp, esd, err := SerializeProof(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal([]interface{}{vp, sd})
+	want, _ := json.Marshal([]interface{}{evp, esd})
+	if !bytes.Equal(got, want) {
+		t.Fatalf("speculative proof differs from the post-state one:\n%s\n%s", got, want)
+	}
+	if sd[0].SuffixDiffs[0].NewValue == nil || sd[len(sd)-1].SuffixDiffs[0].NewValue != nil {
+		t.Fatal("invalid post-state values in the state diff")
+	}
+
+	droot, err := PreStateTreeFromProof(proof, base.Commitment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyVerkleProofWithPreState(proof, droot); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := overlay.Insert(zeroKeyTest[:StemSize], testValue); err == nil {
+		t.Fatal("invalid key should be rejected")
+	}
+}
+
+func TestWitnessBuilderReadThenWrite(t *testing.T) {
+	t.Parallel()
+
+	base := New()
+	if err := base.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	base.Commit()
+
+	w := NewWitnessBuilder(base, nil)
+	// Read, then write
+	if value, err := w.Get(zeroKeyTest); err != nil || !bytes.Equal(value, fourtyKeyTest) {
+		t.Fatalf("invalid value %x, err=%v", value, err)
+	}
+	if err := w.Insert(zeroKeyTest, testValue); err != nil {
+		t.Fatal(err)
+	}
+	// Write, then read back the pending value
+	if err := w.Insert(oneKeyTest, testValue); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := w.Get(oneKeyTest); err != nil || !bytes.Equal(value, testValue) {
+		t.Fatalf("invalid value %x, err=%v", value, err)
+	}
+	// Read only, twice
+	for i := 0; i < 2; i++ {
+		if _, err := w.Get(ffx32KeyTest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys := w.Keys()
+	if len(keys) != 3 || !bytes.Equal(keys[0], zeroKeyTest) || !bytes.Equal(keys[1], oneKeyTest) || !bytes.Equal(keys[2], ffx32KeyTest) {
+		t.Fatalf("invalid accessed keys %x", keys)
+	}
+
+	vp, sd, err := w.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sd) != 2 || len(sd[0].SuffixDiffs) != 2 || len(sd[1].SuffixDiffs) != 1 {
+		t.Fatalf("invalid state diff %+v", sd)
+	}
+	zero, one, ff := sd[0].SuffixDiffs[0], sd[0].SuffixDiffs[1], sd[1].SuffixDiffs[0]
+	if zero.CurrentValue == nil || !bytes.Equal(zero.CurrentValue[:], fourtyKeyTest) || zero.NewValue == nil || !bytes.Equal(zero.NewValue[:], testValue) {
+		t.Fatalf("invalid diff for the key read then written: %+v", zero)
+	}
+	if one.CurrentValue != nil || one.NewValue == nil || !bytes.Equal(one.NewValue[:], testValue) {
+		t.Fatalf("invalid diff for the key written then read: %+v", one)
+	}
+	if ff.CurrentValue == nil || ff.NewValue != nil {
+		t.Fatalf("invalid diff for the key only read: %+v", ff)
+	}
+
+	proof, err := DeserializeProof(vp, sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	droot, err := PreStateTreeFromProof(proof, base.Commitment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyVerkleProofWithPreState(proof, droot); err != nil {
+		t.Fatal(err)
+	}
+
+	// The base tree isn't modified
+	if value, err := base.Get(zeroKeyTest, nil); err != nil || !bytes.Equal(value, fourtyKeyTest) {
+		t.Fatalf("base tree was modified: %x, err=%v", value, err)
+	}
+}
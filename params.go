@@ -0,0 +1,129 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// defaultTranscriptLabel is the default domain separator of proof
+// transcripts.
+const defaultTranscriptLabel = "vt"
+
+// Values used internally by go-ipa, which it doesn't export. They are
+// reported by Params, and have to be kept in sync with go-ipa.
+const (
+	crsSeed                 = "eth_verkle_oct_2021"
+	precompWideWindowPoints = 5
+	precompWideWindowBits   = 16
+	precompNarrowWindowBits = 8
+)
+
+// Params describes the parameters and formats used by a configuration,
+// so that they can be logged and compared between deployments: two
+// nodes reporting the same Params produce the same commitments and
+// proofs.
+type Params struct {
+	Curve         string // elliptic curve used for the commitments
+	NodeWidth     int    // number of children of internal nodes, and of values in a leaf
+	StemSize      int    // size of a stem, in bytes
+	LeafValueSize int    // size of a value, in bytes
+
+	CRSSeed   string // seed the CRS points are derived from
+	CRSLength int    // number of CRS points
+	CRSHash   string // SHA256 of the CRS points in compressed form, hex-encoded
+
+	// The first PrecompWideWindows CRS points use a precomputed
+	// table with PrecompWideWindowBits-bit windows, and the other ones
+	// with PrecompNarrowWindowBits-bit windows.
+	PrecompWideWindows      int
+	PrecompWideWindowBits   int
+	PrecompNarrowWindowBits int
+
+	TranscriptLabel string // domain separator of the proof transcripts
+	IPAProofDepth   int    // number of L/R pairs in an IPA proof
+
+	// Serialization formats
+	InternalNodeType byte   // type byte of serialized internal nodes
+	LeafNodeType     byte   // type byte of serialized leaf nodes
+	ProofFormat      string // layout of serialized proofs
+
+	CorruptionDetection bool // see SetCorruptionDetection
+
+	Acceleration Acceleration // optimized code paths in use
+}
+
+// Params returns the parameters in use by this configuration.
+func (conf *IPAConfig) Params() Params {
+	wide, narrow := conf.precompWindowBits()
+	h := sha256.New()
+	for i := range conf.conf.SRS {
+		b := conf.conf.SRS[i].Bytes()
+		h.Write(b[:])
+	}
+	return Params{
+		Curve:                   "banderwagon",
+		NodeWidth:               NodeWidth,
+		StemSize:                StemSize,
+		LeafValueSize:           LeafValueSize,
+		CRSSeed:                 crsSeed,
+		CRSLength:               len(conf.conf.SRS),
+		CRSHash:                 fmt.Sprintf("%x", h.Sum(nil)),
+		PrecompWideWindows:      precompWideWindowPoints,
+		PrecompWideWindowBits:   wide,
+		PrecompNarrowWindowBits: narrow,
+		TranscriptLabel:         conf.transcriptLabel,
+		IPAProofDepth:           IPA_PROOF_DEPTH,
+		InternalNodeType:        internalRLPType,
+		LeafNodeType:            leafRLPType,
+		ProofFormat:             "rust-verkle",
+		CorruptionDetection:     conf.corruptionDetection(),
+		Acceleration:            conf.Acceleration(),
+	}
+}
+
+// Describe returns a human-readable summary of the parameters in use,
+// one "name: value" pair per line.
+func (conf *IPAConfig) Describe() string {
+	p := conf.Params()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "curve: %s\n", p.Curve)
+	fmt.Fprintf(&sb, "node width: %d\n", p.NodeWidth)
+	fmt.Fprintf(&sb, "stem size: %d\n", p.StemSize)
+	fmt.Fprintf(&sb, "value size: %d\n", p.LeafValueSize)
+	fmt.Fprintf(&sb, "crs: %d points from seed %q, sha256 %s\n", p.CRSLength, p.CRSSeed, p.CRSHash)
+	fmt.Fprintf(&sb, "precomputed tables: %d points with %d-bit windows, %d with %d-bit windows\n",
+		p.PrecompWideWindows, p.PrecompWideWindowBits, p.CRSLength-p.PrecompWideWindows, p.PrecompNarrowWindowBits)
+	fmt.Fprintf(&sb, "transcript label: %q\n", p.TranscriptLabel)
+	fmt.Fprintf(&sb, "ipa proof depth: %d\n", p.IPAProofDepth)
+	fmt.Fprintf(&sb, "node types: internal=%d leaf=%d\n", p.InternalNodeType, p.LeafNodeType)
+	fmt.Fprintf(&sb, "proof format: %s\n", p.ProofFormat)
+	fmt.Fprintf(&sb, "corruption detection: %v\n", p.CorruptionDetection)
+	fmt.Fprintf(&sb, "acceleration: %s\n", p.Acceleration)
+	return sb.String()
+}
@@ -0,0 +1,29 @@
+package verkle
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigParams(t *testing.T) {
+	t.Parallel()
+
+	p := GetConfig().Params()
+	if p.NodeWidth != NodeWidth || p.CRSLength != NodeWidth {
+		t.Fatalf("invalid widths: %+v", p)
+	}
+	// The CRS is fixed by the spec, its hash mustn't change.
+	if p.CRSHash != "1fcaea10bf24f750200e06fa473c76ff0468007291fa548e2d99f09ba9256fdb" {
+		t.Fatalf("unexpected CRS hash %s", p.CRSHash)
+	}
+	if p != GetConfig().Params() {
+		t.Fatal("params aren't deterministic")
+	}
+
+	desc := GetConfig().Describe()
+	for _, s := range []string{"curve: banderwagon", "node width: 256", p.CRSHash, `transcript label: "vt"`} {
+		if !strings.Contains(desc, s) {
+			t.Fatalf("description is missing %q:\n%s", s, desc)
+		}
+	}
+}
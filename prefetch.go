@@ -0,0 +1,134 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// codeChunkSize is the number of code bytes in a code chunk, the first
+// byte of a chunk being the number of leading push data bytes.
+const codeChunkSize = 31
+
+// AccessTuple is an entry of the access list of a transaction, as defined
+// by EIP-2930: an account, and the storage slots it is expected to touch.
+type AccessTuple struct {
+	Address     []byte   // 20-byte address, or its 32-byte zero-padded form
+	StorageKeys [][]byte // 32-byte big-endian storage slots
+}
+
+// PlanWitnessKeys returns the keys that a block is expected to read,
+// given the access lists of its transactions: the header fields of each
+// account, its storage slots and its code chunks, the number of which
+// is read from the code size stored in root. The keys are sorted and
+// each appears once. Accesses that aren't in the access lists, e.g. the
+// sender and recipient of a transaction, have to be added by the caller.
+func PlanWitnessKeys(root VerkleNode, resolver NodeResolverFn, accessLists ...[]AccessTuple) ([][]byte, error) {
+	accounts := NewAccounts(root, resolver)
+	planned := make(map[string][]byte)
+	add := func(key []byte) {
+		planned[string(key)] = key
+	}
+	done := make(map[string]bool)
+	for _, list := range accessLists {
+		for _, tuple := range list {
+			if !done[string(tuple.Address)] {
+				done[string(tuple.Address)] = true
+				if err := planAccountKeys(accounts, tuple.Address, add); err != nil {
+					return nil, fmt.Errorf("planning account %x: %w", tuple.Address, err)
+				}
+			}
+			for _, slot := range tuple.StorageKeys {
+				key, err := GetTreeKeyStorageSlot(tuple.Address, slot)
+				if err != nil {
+					return nil, fmt.Errorf("planning slot %x of account %x: %w", slot, tuple.Address, err)
+				}
+				add(key)
+			}
+		}
+	}
+
+	keys := make(keylist, 0, len(planned))
+	for _, key := range planned {
+		keys = append(keys, key)
+	}
+	sort.Sort(keys)
+	return keys, nil
+}
+
+// planAccountKeys adds the keys of the header fields and code chunks of
+// the account at address. The stem of each group of NodeWidth positions
+// is only computed once.
+func planAccountKeys(accounts *Accounts, address []byte, add func([]byte)) error {
+	header, err := getHeaderKey(address, VersionLeafKey)
+	if err != nil {
+		return err
+	}
+	for _, suffix := range []byte{VersionLeafKey, BalanceLeafKey, NonceLeafKey, CodeKeccakLeafKey, CodeSizeLeafKey} {
+		key := append(header[:StemSize:StemSize], suffix)
+		add(key)
+	}
+
+	size, err := accounts.GetCodeSize(address)
+	if err != nil {
+		return fmt.Errorf("reading code size: %w", err)
+	}
+	chunks := (size + codeChunkSize - 1) / codeChunkSize
+	stem := header[:StemSize]
+	var treeIndex uint64
+	for chunk := uint64(0); chunk < chunks; chunk++ {
+		pos := CodeOffset + chunk
+		if pos/NodeWidth != treeIndex {
+			treeIndex = pos / NodeWidth
+			key, err := GetTreeKey(address, new(big.Int).SetUint64(treeIndex), 0)
+			if err != nil {
+				return err
+			}
+			stem = key[:StemSize]
+		}
+		add(append(stem[:StemSize:StemSize], byte(pos%NodeWidth)))
+	}
+	return nil
+}
+
+// Prefetch adds the keys planned by PlanWitnessKeys for the access lists
+// to the builder, so that the nodes along their paths are resolved and
+// their openings computed before the block is executed, instead of when
+// its witness is needed. Wrapping the resolver of the builder with a
+// NodeCache keeps the resolved nodes around for the execution itself.
+// The planned keys are returned.
+func (b *ProofElementsBuilder) Prefetch(accessLists ...[]AccessTuple) ([][]byte, error) {
+	keys, err := PlanWitnessKeys(b.root, b.resolver, accessLists...)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.AddKeys(keys...); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
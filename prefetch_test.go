@@ -0,0 +1,77 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPlanWitnessKeys(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	accounts := NewAccounts(root, nil)
+	small, large := bytes.Repeat([]byte{1}, 20), bytes.Repeat([]byte{2}, 20)
+	if err := accounts.SetCodeSize(small, 200); err != nil {
+		t.Fatal(err)
+	}
+	// 130 chunks, spilling out of the header stem
+	if err := accounts.SetCodeSize(large, 130*codeChunkSize); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+
+	slot := []byte{0x42}
+	keys, err := PlanWitnessKeys(root, nil,
+		[]AccessTuple{{Address: small, StorageKeys: [][]byte{slot}}},
+		[]AccessTuple{{Address: large}, {Address: small, StorageKeys: [][]byte{slot}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]bool{}
+	for _, address := range [][]byte{small, large} {
+		for _, suffix := range []byte{VersionLeafKey, BalanceLeafKey, NonceLeafKey, CodeKeccakLeafKey, CodeSizeLeafKey} {
+			key, _ := getHeaderKey(address, suffix)
+			expected[string(key)] = true
+		}
+	}
+	for chunk := uint64(0); chunk < 7; chunk++ {
+		key, _ := GetTreeKeyCodeChunk(small, chunk)
+		expected[string(key)] = true
+	}
+	for chunk := uint64(0); chunk < 130; chunk++ {
+		key, _ := GetTreeKeyCodeChunk(large, chunk)
+		expected[string(key)] = true
+	}
+	key, _ := GetTreeKeyStorageSlot(small, slot)
+	expected[string(key)] = true
+
+	if len(keys) != len(expected) {
+		t.Fatalf("planned %d keys, expected %d", len(keys), len(expected))
+	}
+	for i, key := range keys {
+		if !expected[string(key)] {
+			t.Fatalf("unexpected key %x", key)
+		}
+		if i > 0 && bytes.Compare(keys[i-1], key) >= 0 {
+			t.Fatal("keys aren't sorted")
+		}
+	}
+
+	b := NewProofElementsBuilder(root, nil)
+	prefetched, err := b.Prefetch([]AccessTuple{{Address: small, StorageKeys: [][]byte{slot}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Keys()) != len(prefetched) {
+		t.Fatalf("builder has %d keys, %d were planned", len(b.Keys()), len(prefetched))
+	}
+	proof, _, _, _, err := b.Finalize(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyProofAtRoot(proof, root.Commitment().Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
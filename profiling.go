@@ -0,0 +1,108 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the metrics reported when profiling is enabled, see
+// SetProfiling. Allocations are reported as histograms, with one sample
+// per operation, and CPU time as timers.
+const (
+	MetricCommitAllocs     = "verkle/commit/allocs"     // histogram: objects allocated per Commit
+	MetricCommitAllocBytes = "verkle/commit/allocbytes" // histogram: bytes allocated per Commit
+	MetricCommitCPU        = "verkle/commit/cpu"        // timer: CPU time spent per Commit
+
+	MetricProofAllocs     = "verkle/proof/allocs"     // histogram: objects allocated per MakeVerkleMultiProof
+	MetricProofAllocBytes = "verkle/proof/allocbytes" // histogram: bytes allocated per MakeVerkleMultiProof
+	MetricProofCPU        = "verkle/proof/cpu"        // timer: CPU time spent per MakeVerkleMultiProof
+
+	MetricResolverAllocs     = "verkle/resolver/allocs"     // histogram: objects allocated per call to a NodeResolverFn
+	MetricResolverAllocBytes = "verkle/resolver/allocbytes" // histogram: bytes allocated per call to a NodeResolverFn
+	MetricResolverCPU        = "verkle/resolver/cpu"        // timer: CPU time spent per call to a NodeResolverFn
+)
+
+// profiling is non-zero if allocations and CPU time are reported.
+var profiling int32
+
+// SetProfiling enables or disables the reporting of the allocations and
+// CPU time of each Commit, proof generation and node resolution to the
+// metrics sink. The Go runtime only keeps process-wide counters, so the
+// reported values include whatever else the process does in the meantime:
+// they are meant to localize costs in benchmarks and quiet nodes, rather
+// than to be precise per-operation accounts. CPU time is only reported on
+// platforms where it can be measured. Profiling is disabled by default,
+// as each measurement briefly stops the world.
+func SetProfiling(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&profiling, v)
+}
+
+// profile holds the counters at the start of a profiled operation.
+type profile struct {
+	enabled bool
+	allocs  uint64
+	bytes   uint64
+	cpu     time.Duration
+}
+
+func readAllocs() (objects, bytes uint64) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Mallocs, stats.TotalAlloc
+}
+
+// startProfile starts profiling an operation, if profiling is enabled.
+func startProfile() profile {
+	if atomic.LoadInt32(&profiling) == 0 {
+		return profile{}
+	}
+	p := profile{enabled: true}
+	p.allocs, p.bytes = readAllocs()
+	p.cpu, _ = processCPUTime()
+	return p
+}
+
+// report sends the allocations and CPU time since the start of the
+// profile to the metrics sink.
+func (p profile) report(allocsMetric, bytesMetric, cpuMetric string) {
+	if !p.enabled {
+		return
+	}
+	allocs, bytes := readAllocs()
+	m := getMetrics()
+	m.UpdateHistogram(allocsMetric, int64(allocs-p.allocs))
+	m.UpdateHistogram(bytesMetric, int64(bytes-p.bytes))
+	if cpu, ok := processCPUTime(); ok {
+		m.UpdateTimer(cpuMetric, cpu-p.cpu)
+	}
+}
@@ -0,0 +1,57 @@
+package verkle
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestProfiling(t *testing.T) {
+	m := newRecordingMetrics()
+	SetMetrics(m)
+	defer SetMetrics(nil)
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	if len(m.histograms[MetricCommitAllocs]) != 0 {
+		t.Fatal("allocations were reported with profiling disabled")
+	}
+
+	SetProfiling(true)
+	defer SetProfiling(false)
+
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	if _, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest}, nil); err != nil {
+		t.Fatal(err)
+	}
+	serialized, err := root.(*InternalNode).children[0].Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolveNode(func([]byte) ([]byte, error) { return serialized, nil }, []byte{0}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, metric := range []string{MetricCommitAllocs, MetricProofAllocs, MetricResolverAllocs} {
+		if len(m.histograms[metric]) != 1 {
+			t.Fatalf("%d samples for %s", len(m.histograms[metric]), metric)
+		}
+	}
+	for _, metric := range []string{MetricCommitAllocBytes, MetricProofAllocBytes} {
+		if samples := m.histograms[metric]; len(samples) != 1 || samples[0] <= 0 {
+			t.Fatalf("invalid samples %v for %s", samples, metric)
+		}
+	}
+	if runtime.GOOS == "linux" {
+		for _, metric := range []string{MetricCommitCPU, MetricProofCPU, MetricResolverCPU} {
+			if len(m.timers[metric]) != 1 {
+				t.Fatalf("%d samples for %s", len(m.timers[metric]), metric)
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"errors"
+	"fmt"
+
+	ipa "github.com/crate-crypto/go-ipa"
+	"github.com/crate-crypto/go-ipa/common"
+)
+
+// AggregatedProof proves keys in several trees, e.g. the states a block
+// goes through, with a single multipoint argument. Each of Proofs is a
+// proof without its own argument, that is verified against the root of
+// its tree.
+type AggregatedProof struct {
+	Proofs     []*Proof
+	Multipoint *ipa.MultiProof
+}
+
+// AggregatedVerkleProof is the serialized form of an AggregatedProof.
+// The commitments of all the proofs are stored once, and each proof
+// refers to them by their index in Commitments.
+type AggregatedVerkleProof struct {
+	Commitments [][32]byte
+	Proofs      []AggregatedProofPart
+	D           [32]byte
+	IPAProof    *IPAProof
+}
+
+// AggregatedProofPart is a VerkleProof without a multipoint argument,
+// and whose commitments are found in the enclosing AggregatedVerkleProof.
+type AggregatedProofPart struct {
+	OtherStems            [][StemSize]byte
+	DepthExtensionPresent []byte
+	CommitmentIndices     []uint32
+}
+
+// aggregatedOpening identifies an opening of the multipoint argument. The
+// value is part of it, so that conflicting claims about the same opening
+// are both checked.
+type aggregatedOpening struct {
+	c [32]byte
+	z byte
+	y [32]byte
+}
+
+// aggregateOpenings concatenates the openings of several proofs, keeping
+// only the first occurrence of each of them.
+func aggregateOpenings(pes []*ProofElements) *ProofElements {
+	var (
+		agg  ProofElements
+		seen = make(map[aggregatedOpening]struct{})
+	)
+	for _, pe := range pes {
+		for i, ci := range pe.Cis {
+			key := aggregatedOpening{c: ci.Bytes(), z: pe.Zis[i], y: pe.Yis[i].Bytes()}
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+
+			agg.Cis = append(agg.Cis, ci)
+			agg.Zis = append(agg.Zis, pe.Zis[i])
+			agg.Yis = append(agg.Yis, pe.Yis[i])
+			if pe.Fis != nil {
+				agg.Fis = append(agg.Fis, pe.Fis[i])
+			}
+		}
+	}
+	return &agg
+}
+
+// MakeAggregatedProof proves keys[i] in preroots[i] for each tree, with a
+// single multipoint argument. postroots can be nil, and so can any of its
+// entries, if the corresponding keys aren't modified. The same commitment
+// opened at the same point by several proofs, e.g. the root of a tree
+// proven several times, is only opened once. The configuration of the
+// first tree is used.
+func MakeAggregatedProof(preroots, postroots []VerkleNode, keys [][][]byte, resolver NodeResolverFn) (*AggregatedProof, error) {
+	if len(preroots) == 0 {
+		return nil, errors.New("no tree to prove")
+	}
+	if len(keys) != len(preroots) || (postroots != nil && len(postroots) != len(preroots)) {
+		return nil, fmt.Errorf("mismatched number of trees and key sets: %d pre-state trees, %d post-state trees, %d key sets", len(preroots), len(postroots), len(keys))
+	}
+
+	cfg := configOf(preroots[0])
+	prover, err := cfg.getProver()
+	if err != nil {
+		return nil, err
+	}
+
+	agg := &AggregatedProof{Proofs: make([]*Proof, len(preroots))}
+	pes := make([]*ProofElements, len(preroots))
+	for i, preroot := range preroots {
+		var postroot VerkleNode
+		if postroots != nil {
+			postroot = postroots[i]
+		}
+		agg.Proofs[i], pes[i], err = prepareVerkleMultiProof(preroot, treePostValues(postroot, resolver), keys[i], resolver, nil)
+		if err != nil {
+			return nil, fmt.Errorf("proof %d: %w", i, err)
+		}
+	}
+
+	pe := aggregateOpenings(pes)
+	tr := common.NewTranscript(cfg.transcriptLabel)
+	agg.Multipoint, err = prover.CreateMultiProof(tr, cfg.conf, pe.Cis, pe.Fis, pe.Zis)
+	if err != nil {
+		return nil, fmt.Errorf("creating multiproof: %w", err)
+	}
+	return agg, nil
+}
+
+// VerifyAggregatedProof verifies each proof of agg against the root
+// commitment of its tree, found at the same index in roots. The proof is
+// verified with conf, which must be the configuration of the first tree
+// passed to MakeAggregatedProof; nil means GetConfig.
+func VerifyAggregatedProof(agg *AggregatedProof, roots []*Point, conf *Config) error {
+	if conf == nil {
+		conf = GetConfig()
+	}
+	if agg.Multipoint == nil {
+		return errors.New("missing multipoint argument")
+	}
+	if len(roots) != len(agg.Proofs) {
+		return fmt.Errorf("mismatched number of proofs and roots: %d != %d", len(agg.Proofs), len(roots))
+	}
+
+	pes := make([]*ProofElements, len(agg.Proofs))
+	for i, proof := range agg.Proofs {
+		if err := conf.checkProofKeys(len(proof.Keys)); err != nil {
+			return fmt.Errorf("proof %d: %w", i, err)
+		}
+		pretree, err := PreStateTreeFromProof(proof, roots[i])
+		if err != nil {
+			return fmt.Errorf("proof %d: rebuilding pre-state tree: %w", i, err)
+		}
+		if root, ok := pretree.(*InternalNode); ok {
+			root.SetConfig(conf)
+		}
+		pes[i], _, _, _, err = getProofElementsFromTree(pretree, nil, proof.Keys, nil)
+		if err != nil {
+			return conf.verificationError(fmt.Errorf("proof %d: error getting proof elements: %w", i, err))
+		}
+	}
+
+	pe := aggregateOpenings(pes)
+	if err := CheckVerkleProof(&Proof{Multipoint: agg.Multipoint}, pe.Cis, pe.Zis, pe.Yis, conf); err != nil {
+		return conf.verificationError(fmt.Errorf("error verifying proof: %w", err))
+	}
+	return nil
+}
+
+// SerializeAggregatedProof serializes an aggregated proof, along with the
+// state diff of each of its proofs.
+func SerializeAggregatedProof(agg *AggregatedProof) (*AggregatedVerkleProof, []StateDiff, error) {
+	if agg.Multipoint == nil {
+		return nil, nil, errors.New("missing multipoint argument")
+	}
+
+	var (
+		avp     = &AggregatedVerkleProof{Proofs: make([]AggregatedProofPart, len(agg.Proofs))}
+		diffs   = make([]StateDiff, len(agg.Proofs))
+		indices = make(map[[32]byte]uint32)
+	)
+	for i, proof := range agg.Proofs {
+		// Serialize the proof with the shared argument, which is then
+		// only kept once.
+		withArg := *proof
+		withArg.Multipoint = agg.Multipoint
+		vp, sd, err := SerializeProof(&withArg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("proof %d: %w", i, err)
+		}
+		if i == 0 {
+			avp.D, avp.IPAProof = vp.D, vp.IPAProof
+		}
+
+		part := AggregatedProofPart{
+			OtherStems:            vp.OtherStems,
+			DepthExtensionPresent: vp.DepthExtensionPresent,
+			CommitmentIndices:     make([]uint32, len(vp.CommitmentsByPath)),
+		}
+		for j, c := range vp.CommitmentsByPath {
+			idx, ok := indices[c]
+			if !ok {
+				idx = uint32(len(avp.Commitments))
+				indices[c] = idx
+				avp.Commitments = append(avp.Commitments, c)
+			}
+			part.CommitmentIndices[j] = idx
+		}
+		avp.Proofs[i] = part
+		diffs[i] = sd
+	}
+	return avp, diffs, nil
+}
+
+// DeserializeAggregatedProof deserializes an aggregated proof, pairing
+// each of its proofs with the state diff at the same index in statediffs.
+// Each commitment is only decompressed once.
+func DeserializeAggregatedProof(avp *AggregatedVerkleProof, statediffs []StateDiff) (*AggregatedProof, error) {
+	if len(statediffs) != len(avp.Proofs) {
+		return nil, fmt.Errorf("mismatched number of proofs and state diffs: %d != %d", len(avp.Proofs), len(statediffs))
+	}
+	multipoint, err := deserializeMultipoint(avp.D, avp.IPAProof)
+	if err != nil {
+		return nil, err
+	}
+	commitments := make([]Point, len(avp.Commitments))
+	for i := range avp.Commitments {
+		if err := commitments[i].SetBytes(avp.Commitments[i][:]); err != nil {
+			return nil, fmt.Errorf("commitment %d: %w", i, err)
+		}
+	}
+
+	agg := &AggregatedProof{Proofs: make([]*Proof, len(avp.Proofs)), Multipoint: multipoint}
+	for i, part := range avp.Proofs {
+		proof := &Proof{
+			ExtStatus: part.DepthExtensionPresent,
+			PoaStems:  make([][]byte, len(part.OtherStems)),
+			Cs:        make([]*Point, len(part.CommitmentIndices)),
+		}
+		for j := range part.OtherStems {
+			proof.PoaStems[j] = append([]byte{}, part.OtherStems[j][:]...)
+		}
+		for j, idx := range part.CommitmentIndices {
+			if int(idx) >= len(commitments) {
+				return nil, fmt.Errorf("proof %d: invalid commitment index %d", i, idx)
+			}
+			proof.Cs[j] = &commitments[idx]
+		}
+		for j := range statediffs[i] {
+			proof.appendStemDiff(&statediffs[i][j])
+		}
+		agg.Proofs[i] = proof
+	}
+	return agg, nil
+}
@@ -0,0 +1,98 @@
+package verkle
+
+import (
+	"testing"
+)
+
+func TestAggregatedProof(t *testing.T) {
+	t.Parallel()
+
+	first := New()
+	if err := first.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Insert(forkOneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	firstRoot := new(Point).Set(first.Commit())
+	second := first.Copy()
+	if err := second.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	secondRoot := new(Point).Set(second.Commit())
+
+	keys := [][][]byte{
+		{zeroKeyTest, ffx32KeyTest},
+		{zeroKeyTest, oneKeyTest, ffx32KeyTest},
+	}
+	agg, err := MakeAggregatedProof([]VerkleNode{first, second}, []VerkleNode{second, nil}, keys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := []*Point{firstRoot, secondRoot}
+	if err := VerifyAggregatedProof(agg, roots, nil); err != nil {
+		t.Fatal(err)
+	}
+	if string(agg.Proofs[0].PostValues[1]) != string(fourtyKeyTest) {
+		t.Fatal("post-state value of the first proof is missing")
+	}
+
+	avp, diffs, err := SerializeAggregatedProof(agg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int
+	for _, part := range avp.Proofs {
+		total += len(part.CommitmentIndices)
+	}
+	if len(avp.Commitments) >= total {
+		t.Fatalf("commitments weren't deduplicated: %d distinct out of %d", len(avp.Commitments), total)
+	}
+	decoded, err := DeserializeAggregatedProof(avp, diffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAggregatedProof(decoded, roots, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each proof is checked against its own root
+	if err := VerifyAggregatedProof(decoded, []*Point{secondRoot, firstRoot}, nil); err == nil {
+		t.Fatal("proof verified against swapped roots")
+	}
+	if err := VerifyAggregatedProof(decoded, roots[:1], nil); err == nil {
+		t.Fatal("proof verified with a missing root")
+	}
+	avp.Proofs[1].CommitmentIndices[0] = uint32(len(avp.Commitments))
+	if _, err := DeserializeAggregatedProof(avp, diffs); err == nil {
+		t.Fatal("invalid commitment index was accepted")
+	}
+}
+
+func TestAggregatedProofWithConfig(t *testing.T) {
+	t.Parallel()
+
+	conf, err := NewConfig(WithTranscriptLabel("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := NewWithConfig(conf)
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	rootC := new(Point).Set(root.Commit())
+
+	agg, err := MakeAggregatedProof([]VerkleNode{root}, nil, [][][]byte{{zeroKeyTest, oneKeyTest}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAggregatedProof(agg, []*Point{rootC}, conf); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAggregatedProof(agg, []*Point{rootC}, nil); err == nil {
+		t.Fatal("proof was accepted with the wrong transcript label")
+	}
+}
@@ -0,0 +1,139 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"errors"
+	"fmt"
+
+	ipa "github.com/crate-crypto/go-ipa"
+)
+
+// DeserializeProofs is DeserializeProof for many proofs at once, e.g. when
+// verifying historical witnesses in bulk. The points of all the proofs are
+// decompressed together, over one worker per CPU, and the points and keys
+// of the returned proofs share a few large allocations instead of being
+// allocated one by one. The proofs are returned in the order of vps, each
+// paired with the state diff of the same index. Like those of
+// DeserializeProof, they reference the values and extension statuses of
+// their inputs, as well as their proof-of-absence stems.
+func DeserializeProofs(vps []*VerkleProof, statediffs []StateDiff) ([]*Proof, error) {
+	return DeserializeProofsWithConfig(vps, statediffs, nil)
+}
+
+// DeserializeProofsWithConfig is DeserializeProofs, decompressing the
+// points over the workers of conf, see WithParallelism. A nil conf uses
+// one worker per CPU, without initializing the default configuration.
+func DeserializeProofsWithConfig(vps []*VerkleProof, statediffs []StateDiff, conf *Config) ([]*Proof, error) {
+	if len(vps) != len(statediffs) {
+		return nil, fmt.Errorf("got %d proofs and %d state diffs", len(vps), len(statediffs))
+	}
+
+	var (
+		sources []*[32]byte
+		offsets = make([]int, len(vps)+1) // index of the first point of each proof
+		nkeys   int
+	)
+	for i, vp := range vps {
+		if vp == nil {
+			return nil, fmt.Errorf("proof %d: %w", i, errNilProof)
+		}
+		if vp.IPAProof == nil {
+			return nil, fmt.Errorf("proof %d: %w", i, errors.New("missing IPA proof"))
+		}
+		sources = append(sources, proofPoints(vp)...)
+		offsets[i+1] = len(sources)
+		for _, stemdiff := range statediffs[i] {
+			nkeys += len(stemdiff.SuffixDiffs)
+		}
+	}
+
+	points := make([]Point, len(sources))
+	errs := make([]error, len(sources))
+	decompressPoints(conf, points, sources, errs)
+	for i, err := range errs {
+		if err != nil {
+			// Report the first invalid point of the first invalid proof
+			p := 0
+			for offsets[p+1] <= i {
+				p++
+			}
+			return nil, fmt.Errorf("proof %d: %w", p, pointError(vps[p], i-offsets[p], err))
+		}
+	}
+
+	var (
+		proofs      = make([]Proof, len(vps))
+		multipoints = make([]ipa.MultiProof, len(vps))
+		commitments = make([]*Point, 0, len(points))
+		keys        = make([]byte, 0, nkeys*(StemSize+1))
+		ret         = make([]*Proof, len(vps))
+	)
+	for i, vp := range vps {
+		pts := points[offsets[i]:offsets[i+1]]
+		n := len(vp.CommitmentsByPath)
+
+		start := len(commitments)
+		for j := 0; j < n; j++ {
+			commitments = append(commitments, &pts[j])
+		}
+
+		mp := &multipoints[i]
+		mp.D = pts[n]
+		mp.IPA.L = pts[n+1 : n+1+IPA_PROOF_DEPTH : n+1+IPA_PROOF_DEPTH]
+		mp.IPA.R = pts[n+1+IPA_PROOF_DEPTH:]
+		mp.IPA.A_scalar.SetBytes(vp.IPAProof.FinalEvaluation[:])
+
+		proof := &proofs[i]
+		proof.Multipoint = mp
+		proof.ExtStatus = vp.DepthExtensionPresent
+		proof.Cs = commitments[start:len(commitments):len(commitments)]
+		proof.PoaStems = make([][]byte, len(vp.OtherStems))
+		for j := range vp.OtherStems {
+			proof.PoaStems[j] = vp.OtherStems[j][:]
+		}
+
+		for _, stemdiff := range statediffs[i] {
+			for _, suffixdiff := range stemdiff.SuffixDiffs {
+				keys = append(keys, stemdiff.Stem[:]...)
+				keys = append(keys, suffixdiff.Suffix)
+				proof.Keys = append(proof.Keys, keys[len(keys)-StemSize-1:len(keys):len(keys)])
+				if suffixdiff.CurrentValue != nil {
+					proof.PreValues = append(proof.PreValues, suffixdiff.CurrentValue[:])
+				} else {
+					proof.PreValues = append(proof.PreValues, nil)
+				}
+				if suffixdiff.NewValue != nil {
+					proof.PostValues = append(proof.PostValues, suffixdiff.NewValue[:])
+				} else {
+					proof.PostValues = append(proof.PostValues, nil)
+				}
+			}
+		}
+		ret[i] = proof
+	}
+	return ret, nil
+}
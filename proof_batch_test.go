@@ -0,0 +1,92 @@
+package verkle
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeserializeProofs(t *testing.T) {
+	t.Parallel()
+
+	var (
+		vps   []*VerkleProof
+		sds   []StateDiff
+		roots []*Point
+	)
+	for i, keys := range [][][]byte{
+		{zeroKeyTest},
+		{zeroKeyTest, oneKeyTest, ffx32KeyTest},
+		{forkOneKeyTest, ffx32KeyTest},
+	} {
+		// Leave the last key out of every other tree, to also
+		// prove absences.
+		root := New()
+		for _, key := range keys[:len(keys)-1+i%2] {
+			if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		root.Commit()
+		proof, _, _, _, err := MakeVerkleMultiProof(root, nil, append([][]byte{}, keys...), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vp, sd, err := SerializeProof(proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vps, sds, roots = append(vps, vp), append(sds, sd), append(roots, root.Commitment())
+	}
+
+	proofs, err := DeserializeProofs(vps, sds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, proof := range proofs {
+		expected, err := DeserializeProof(vps[i], sds[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proof.Equal(expected) {
+			t.Fatalf("proof %d differs from the one deserialized alone", i)
+		}
+		pretree, err := PreStateTreeFromProof(proof, roots[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyVerkleProofWithPreState(proof, pretree); err != nil {
+			t.Fatalf("proof %d: %v", i, err)
+		}
+	}
+
+	conf, err := NewConfig(WithParallelism(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	configured, err := DeserializeProofsWithConfig(vps, sds, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range proofs {
+		if !configured[i].Equal(proofs[i]) {
+			t.Fatalf("proof %d differs with an explicit configuration", i)
+		}
+	}
+
+	invalid := vps[1].Copy()
+	invalid.CommitmentsByPath[0] = [32]byte{0xff, 0xff, 0xff, 0xff}
+	for _, tc := range []struct {
+		name string
+		vps  []*VerkleProof
+		sds  []StateDiff
+		err  string
+	}{
+		{"length mismatch", vps, sds[:2], "got 3 proofs and 2 state diffs"},
+		{"nil proof", []*VerkleProof{vps[0], nil}, sds[:2], "proof 1: nil proof"},
+		{"invalid point", []*VerkleProof{vps[0], invalid, vps[2]}, sds, "proof 1: invalid commitment 0"},
+	} {
+		if _, err := DeserializeProofs(tc.vps, tc.sds); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
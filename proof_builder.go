@@ -0,0 +1,144 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ProofElementsBuilder gathers the elements of a proof over keys that are
+// known incrementally, e.g. to build the witness of a block transaction
+// by transaction. Each call to AddKeys only walks the paths of the keys
+// that weren't added before, and the polynomials it computes are reused
+// by the next calls and by Finalize. The tree must not be modified while
+// the builder is in use.
+type ProofElementsBuilder struct {
+	root     VerkleNode
+	resolver NodeResolverFn
+	rootComm Point
+
+	keys  keylist
+	added map[string]struct{}
+	pe    *ProofElements
+	polys polyCache
+}
+
+// NewProofElementsBuilder creates a builder for a proof of keys in root,
+// resolving its nodes with resolver.
+func NewProofElementsBuilder(root VerkleNode, resolver NodeResolverFn) *ProofElementsBuilder {
+	b := &ProofElementsBuilder{
+		root:     root,
+		resolver: resolver,
+		added:    make(map[string]struct{}),
+		pe:       &ProofElements{ByPath: map[string]*Point{}},
+		polys:    make(polyCache),
+	}
+	b.rootComm.Set(root.Commitment())
+	return b
+}
+
+// checkRoot returns an error if the tree was committed to another root
+// since the builder was created, which invalidates its polynomials.
+func (b *ProofElementsBuilder) checkRoot() error {
+	if !b.rootComm.Equal(b.root.Commitment()) {
+		return errors.New("tree modified since the proof builder was created")
+	}
+	return nil
+}
+
+// AddKeys adds keys to the proof, and collects the openings along their
+// paths. Keys that were already added are skipped, and keys must be
+// StemSize+1 bytes long.
+func (b *ProofElementsBuilder) AddKeys(keys ...[]byte) error {
+	if err := b.checkRoot(); err != nil {
+		return err
+	}
+	sorted, err := proofKeys(append([][]byte{}, keys...))
+	if err != nil {
+		return err
+	}
+	var fresh keylist
+	for _, key := range sorted {
+		if _, ok := b.added[string(key)]; !ok {
+			fresh = append(fresh, key)
+		}
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+	pe, _, _, err := getCommitmentsForMultiproof(b.root, fresh, b.resolver, b.polys)
+	if err != nil {
+		return fmt.Errorf("collecting proof elements: %w", err)
+	}
+	for _, key := range fresh {
+		b.added[string(key)] = struct{}{}
+		b.keys = append(b.keys, key)
+	}
+	b.Merge(pe)
+	return nil
+}
+
+// Merge adds the openings of pe, e.g. collected with
+// GetCommitmentsForMultiproof on the same tree, to those of the builder,
+// skipping those already present. Their polynomials are then reused when
+// proving, but only the keys passed to AddKeys are proven.
+func (b *ProofElementsBuilder) Merge(pe *ProofElements) {
+	for i, ci := range pe.Cis {
+		if i < len(pe.Fis) {
+			b.polys[ci] = pe.Fis[i]
+		}
+	}
+	b.pe.Merge(pe)
+}
+
+// Keys returns the keys added so far, in the order they were added. The
+// slice must not be modified.
+func (b *ProofElementsBuilder) Keys() [][]byte {
+	return b.keys
+}
+
+// Elements returns the openings collected so far. They are in the order
+// they were collected, which isn't that of a proof of all the keys, see
+// Finalize.
+func (b *ProofElementsBuilder) Elements() *ProofElements {
+	return b.pe
+}
+
+// Finalize creates one proof of all the keys added to the builder, with
+// the post-state values read from postroot, if not nil. It returns the
+// same proof as MakeVerkleMultiProof over the same keys, without
+// recomputing the polynomials that were collected by AddKeys and Merge.
+func (b *ProofElementsBuilder) Finalize(postroot VerkleNode) (*Proof, []*Point, []byte, []*Fr, error) {
+	if len(b.keys) == 0 {
+		return nil, nil, nil, nil, errors.New("no key provided for proof")
+	}
+	if err := b.checkRoot(); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	keys := append([][]byte{}, b.keys...)
+	return makeVerkleMultiProof(b.root, treePostValues(postroot, b.resolver), keys, b.resolver, b.polys)
+}
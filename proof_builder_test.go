@@ -0,0 +1,88 @@
+package verkle
+
+import (
+	mRand "math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestProofElementsBuilder(t *testing.T) {
+	t.Parallel()
+
+	kvs := genRandomKeyValues(mRand.New(mRand.NewSource(42)), 64) //skipcq: GSC-G404
+	root := New()
+	for _, kv := range kvs {
+		if err := root.Insert(kv.key, kv.value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root.Commit()
+	postroot := root.Copy()
+	if err := postroot.Insert(kvs[3].key, zeroKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	postroot.Commit()
+
+	var all [][]byte
+	for _, kv := range kvs[:20] {
+		all = append(all, kv.key)
+	}
+	absent := append(append([]byte{}, kvs[0].key[:StemSize]...), ^kvs[0].key[StemSize])
+	all = append(all, absent)
+
+	// Add the keys in several batches, some of them more than once
+	b := NewProofElementsBuilder(root, nil)
+	for _, batch := range [][][]byte{all[10:], all[:5], all[3:12], {absent}} {
+		if err := b.AddKeys(batch...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(b.Keys()) != len(all) {
+		t.Fatalf("expected %d keys, got %d", len(all), len(b.Keys()))
+	}
+	if err := b.AddKeys(zeroKeyTest[:StemSize]); err == nil {
+		t.Fatal("a short key should be rejected")
+	}
+
+	proof, _, _, _, err := b.Finalize(postroot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _, _, _, err := MakeVerkleMultiProof(root, postroot, append([][]byte{}, all...), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evp, esd, err := SerializeProof(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vp, evp) || !reflect.DeepEqual(sd, esd) {
+		t.Fatal("built proof differs from a proof of all keys")
+	}
+	if err := VerifyVerkleProofWithPreState(proof, root); err != nil {
+		t.Fatal(err)
+	}
+
+	// Merged elements are deduplicated
+	pe, _, _, err := GetCommitmentsForMultiproof(root, append([][]byte{}, all[:5]...), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	openings := len(b.Elements().Cis)
+	b.Merge(pe)
+	if len(b.Elements().Cis) != openings {
+		t.Fatalf("merging known openings added %d of them", len(b.Elements().Cis)-openings)
+	}
+
+	if err := root.Insert(kvs[0].key, zeroKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	if _, _, _, _, err := b.Finalize(nil); err == nil {
+		t.Fatal("finalizing after the tree was modified should fail")
+	}
+}
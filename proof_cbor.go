@@ -0,0 +1,522 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// CBOR (RFC 8949) encoding of the proof containers. It mirrors their JSON
+// encoding: containers are maps keyed by the JSON field names, byte
+// strings are CBOR byte strings, and absent values are null. Encoders
+// only produce definite lengths and the shortest form of each integer,
+// and decoders reject indefinite lengths, duplicate keys and trailing
+// bytes, but skip unknown keys. The methods follow the conventions of
+// the CBOR libraries, so that the containers can be embedded in larger
+// CBOR documents.
+
+const (
+	cborMajorUint  byte = 0
+	cborMajorBytes byte = 2
+	cborMajorText  byte = 3
+	cborMajorArray byte = 4
+	cborMajorMap   byte = 5
+	cborMajorTag   byte = 6
+	cborMajorOther byte = 7
+
+	cborNull byte = cborMajorOther<<5 | 22
+
+	// cborMaxDepth bounds the nesting of skipped values.
+	cborMaxDepth = 16
+)
+
+// MarshalCBOR returns the CBOR encoding of the IPA proof.
+func (ipp *IPAProof) MarshalCBOR() ([]byte, error) {
+	return ipp.appendCBOR(nil), nil
+}
+
+func (ipp *IPAProof) appendCBOR(buf []byte) []byte {
+	if ipp == nil {
+		return append(buf, cborNull)
+	}
+	buf = cborAppendHead(buf, cborMajorMap, 3)
+	buf = cborAppendText(buf, "cl")
+	buf = cborAppendHead(buf, cborMajorArray, IPA_PROOF_DEPTH)
+	for i := range ipp.CL {
+		buf = cborAppendBytes(buf, ipp.CL[i][:])
+	}
+	buf = cborAppendText(buf, "cr")
+	buf = cborAppendHead(buf, cborMajorArray, IPA_PROOF_DEPTH)
+	for i := range ipp.CR {
+		buf = cborAppendBytes(buf, ipp.CR[i][:])
+	}
+	buf = cborAppendText(buf, "finalEvaluation")
+	return cborAppendBytes(buf, ipp.FinalEvaluation[:])
+}
+
+// UnmarshalCBOR decodes a CBOR-encoded IPA proof.
+func (ipp *IPAProof) UnmarshalCBOR(data []byte) error {
+	d := &cborDecoder{buf: data}
+	var decoded IPAProof
+	if err := decoded.decodeCBOR(d); err != nil {
+		return err
+	}
+	if err := d.end(); err != nil {
+		return err
+	}
+	*ipp = decoded
+	return nil
+}
+
+func (ipp *IPAProof) decodeCBOR(d *cborDecoder) error {
+	return d.object("IPA proof", func(key string) error {
+		switch key {
+		case "cl", "cr":
+			points := &ipp.CL
+			if key == "cr" {
+				points = &ipp.CR
+			}
+			n, err := d.arrayLen(IPA_PROOF_DEPTH)
+			if err != nil {
+				return err
+			}
+			if n != IPA_PROOF_DEPTH {
+				return fmt.Errorf("expected %d points, got %d", IPA_PROOF_DEPTH, n)
+			}
+			for i := range points {
+				if err := d.fixedBytes(points[i][:]); err != nil {
+					return fmt.Errorf("item #%d: %w", i, err)
+				}
+			}
+			return nil
+		case "finalEvaluation":
+			return d.fixedBytes(ipp.FinalEvaluation[:])
+		default:
+			return d.skip(0)
+		}
+	})
+}
+
+// MarshalCBOR returns the CBOR encoding of the proof.
+func (vp *VerkleProof) MarshalCBOR() ([]byte, error) {
+	buf := cborAppendHead(nil, cborMajorMap, 5)
+	buf = cborAppendText(buf, "otherStems")
+	buf = cborAppendHead(buf, cborMajorArray, uint64(len(vp.OtherStems)))
+	for i := range vp.OtherStems {
+		buf = cborAppendBytes(buf, vp.OtherStems[i][:])
+	}
+	buf = cborAppendText(buf, "depthExtensionPresent")
+	buf = cborAppendBytes(buf, vp.DepthExtensionPresent)
+	buf = cborAppendText(buf, "commitmentsByPath")
+	buf = cborAppendHead(buf, cborMajorArray, uint64(len(vp.CommitmentsByPath)))
+	for i := range vp.CommitmentsByPath {
+		buf = cborAppendBytes(buf, vp.CommitmentsByPath[i][:])
+	}
+	buf = cborAppendText(buf, "d")
+	buf = cborAppendBytes(buf, vp.D[:])
+	buf = cborAppendText(buf, "ipaProof")
+	return vp.IPAProof.appendCBOR(buf), nil
+}
+
+// UnmarshalCBOR decodes a CBOR-encoded proof.
+func (vp *VerkleProof) UnmarshalCBOR(data []byte) error {
+	d := &cborDecoder{buf: data}
+	var decoded VerkleProof
+	err := d.object("verkle proof", func(key string) error {
+		switch key {
+		case "otherStems":
+			n, err := d.arrayLen(-1)
+			if err != nil {
+				return err
+			}
+			decoded.OtherStems = make([][StemSize]byte, n)
+			for i := range decoded.OtherStems {
+				if err := d.fixedBytes(decoded.OtherStems[i][:]); err != nil {
+					return fmt.Errorf("item #%d: %w", i, err)
+				}
+			}
+			return nil
+		case "depthExtensionPresent":
+			statuses, err := d.bytes()
+			decoded.DepthExtensionPresent = append([]byte{}, statuses...)
+			return err
+		case "commitmentsByPath":
+			n, err := d.arrayLen(-1)
+			if err != nil {
+				return err
+			}
+			decoded.CommitmentsByPath = make([][32]byte, n)
+			for i := range decoded.CommitmentsByPath {
+				if err := d.fixedBytes(decoded.CommitmentsByPath[i][:]); err != nil {
+					return fmt.Errorf("item #%d: %w", i, err)
+				}
+			}
+			return nil
+		case "d":
+			return d.fixedBytes(decoded.D[:])
+		case "ipaProof":
+			if d.null() {
+				return nil
+			}
+			decoded.IPAProof = &IPAProof{}
+			return decoded.IPAProof.decodeCBOR(d)
+		default:
+			return d.skip(0)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if err := d.end(); err != nil {
+		return err
+	}
+	*vp = decoded
+	return nil
+}
+
+// MarshalCBOR returns the CBOR encoding of the state diff.
+func (sd StateDiff) MarshalCBOR() ([]byte, error) {
+	buf := cborAppendHead(nil, cborMajorArray, uint64(len(sd)))
+	for i := range sd {
+		buf = sd[i].appendCBOR(buf)
+	}
+	return buf, nil
+}
+
+func (sd *StemStateDiff) appendCBOR(buf []byte) []byte {
+	buf = cborAppendHead(buf, cborMajorMap, 2)
+	buf = cborAppendText(buf, "stem")
+	buf = cborAppendBytes(buf, sd.Stem[:])
+	buf = cborAppendText(buf, "suffixDiffs")
+	buf = cborAppendHead(buf, cborMajorArray, uint64(len(sd.SuffixDiffs)))
+	for _, suffix := range sd.SuffixDiffs {
+		buf = cborAppendHead(buf, cborMajorMap, 3)
+		buf = cborAppendText(buf, "suffix")
+		buf = cborAppendHead(buf, cborMajorUint, uint64(suffix.Suffix))
+		buf = cborAppendText(buf, "currentValue")
+		buf = cborAppendOptional(buf, suffix.CurrentValue)
+		buf = cborAppendText(buf, "newValue")
+		buf = cborAppendOptional(buf, suffix.NewValue)
+	}
+	return buf
+}
+
+// UnmarshalCBOR decodes a CBOR-encoded state diff.
+func (sd *StateDiff) UnmarshalCBOR(data []byte) error {
+	d := &cborDecoder{buf: data}
+	n, err := d.arrayLen(-1)
+	if err != nil {
+		return err
+	}
+	var decoded StateDiff
+	if n > 0 {
+		decoded = make(StateDiff, n)
+	}
+	for i := range decoded {
+		if err := decoded[i].decodeCBOR(d); err != nil {
+			return fmt.Errorf("stem diff %d: %w", i, err)
+		}
+	}
+	if err := d.end(); err != nil {
+		return err
+	}
+	*sd = decoded
+	return nil
+}
+
+func (sd *StemStateDiff) decodeCBOR(d *cborDecoder) error {
+	return d.object("stem diff", func(key string) error {
+		switch key {
+		case "stem":
+			return d.fixedBytes(sd.Stem[:])
+		case "suffixDiffs":
+			n, err := d.arrayLen(NodeWidth)
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				sd.SuffixDiffs = make(SuffixStateDiffs, n)
+			}
+			for i := range sd.SuffixDiffs {
+				if err := sd.SuffixDiffs[i].decodeCBOR(d); err != nil {
+					return fmt.Errorf("item #%d: %w", i, err)
+				}
+			}
+			return nil
+		default:
+			return d.skip(0)
+		}
+	})
+}
+
+func (ssd *SuffixStateDiff) decodeCBOR(d *cborDecoder) error {
+	return d.object("suffix diff", func(key string) error {
+		var err error
+		switch key {
+		case "suffix":
+			var suffix uint64
+			if suffix, err = d.uint(); err == nil && suffix >= NodeWidth {
+				err = fmt.Errorf("invalid suffix %d", suffix)
+			}
+			ssd.Suffix = byte(suffix)
+		case "currentValue":
+			ssd.CurrentValue, err = d.optional()
+		case "newValue":
+			ssd.NewValue, err = d.optional()
+		default:
+			err = d.skip(0)
+		}
+		return err
+	})
+}
+
+func cborAppendHead(buf []byte, major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return append(buf, major<<5|byte(arg))
+	case arg <= 0xff:
+		return append(buf, major<<5|24, byte(arg))
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(buf, major<<5|25), uint16(arg))
+	case arg <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(buf, major<<5|26), uint32(arg))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, major<<5|27), arg)
+	}
+}
+
+func cborAppendBytes(buf, data []byte) []byte {
+	return append(cborAppendHead(buf, cborMajorBytes, uint64(len(data))), data...)
+}
+
+func cborAppendText(buf []byte, text string) []byte {
+	return append(cborAppendHead(buf, cborMajorText, uint64(len(text))), text...)
+}
+
+func cborAppendOptional(buf []byte, value *[32]byte) []byte {
+	if value == nil {
+		return append(buf, cborNull)
+	}
+	return cborAppendBytes(buf, value[:])
+}
+
+// cborDecoder reads CBOR items from buf, which it consumes.
+type cborDecoder struct {
+	buf []byte
+}
+
+var errCBORTruncated = errors.New("truncated CBOR input")
+
+// head reads the initial byte and argument of the next item.
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if len(d.buf) == 0 {
+		return 0, 0, errCBORTruncated
+	}
+	major, info := d.buf[0]>>5, d.buf[0]&0x1f
+	d.buf = d.buf[1:]
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	if info > 27 {
+		return 0, 0, fmt.Errorf("unsupported additional information %d for major type %d", info, major)
+	}
+	size := 1 << (info - 24)
+	if len(d.buf) < size {
+		return 0, 0, errCBORTruncated
+	}
+	var arg uint64
+	for _, b := range d.buf[:size] {
+		arg = arg<<8 | uint64(b)
+	}
+	d.buf = d.buf[size:]
+	return major, arg, nil
+}
+
+// expect reads the head of an item of the given major type, and returns
+// its argument.
+func (d *cborDecoder) expect(what string, major byte) (uint64, error) {
+	m, arg, err := d.head()
+	if err != nil {
+		return 0, err
+	}
+	if m != major {
+		return 0, fmt.Errorf("expected %s, got major type %d", what, m)
+	}
+	return arg, nil
+}
+
+func (d *cborDecoder) uint() (uint64, error) {
+	return d.expect("unsigned integer", cborMajorUint)
+}
+
+// bytes reads a byte string, which still points into the input.
+func (d *cborDecoder) bytes() ([]byte, error) {
+	n, err := d.expect("byte string", cborMajorBytes)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.buf)) {
+		return nil, errCBORTruncated
+	}
+	ret := d.buf[:n]
+	d.buf = d.buf[n:]
+	return ret, nil
+}
+
+// fixedBytes reads a byte string of exactly len(dst) bytes into dst.
+func (d *cborDecoder) fixedBytes(dst []byte) error {
+	data, err := d.bytes()
+	if err != nil {
+		return err
+	}
+	if len(data) != len(dst) {
+		return fmt.Errorf("expected %d bytes, got %d", len(dst), len(data))
+	}
+	copy(dst, data)
+	return nil
+}
+
+func (d *cborDecoder) text() (string, error) {
+	n, err := d.expect("text string", cborMajorText)
+	if err != nil {
+		return "", err
+	}
+	if n > uint64(len(d.buf)) {
+		return "", errCBORTruncated
+	}
+	ret := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return ret, nil
+}
+
+// null consumes the next item and returns true if it is null.
+func (d *cborDecoder) null() bool {
+	if len(d.buf) > 0 && d.buf[0] == cborNull {
+		d.buf = d.buf[1:]
+		return true
+	}
+	return false
+}
+
+func (d *cborDecoder) optional() (*[32]byte, error) {
+	if d.null() {
+		return nil, nil
+	}
+	var value [32]byte
+	if err := d.fixedBytes(value[:]); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// arrayLen reads the head of an array, and returns its number of items,
+// which can't be more than limit, if it isn't negative.
+func (d *cborDecoder) arrayLen(limit int) (int, error) {
+	n, err := d.expect("array", cborMajorArray)
+	if err != nil {
+		return 0, err
+	}
+	// Each item takes at least one byte, which bounds the allocations
+	// made by the caller.
+	if n > uint64(len(d.buf)) {
+		return 0, errCBORTruncated
+	}
+	if limit >= 0 && n > uint64(limit) {
+		return 0, fmt.Errorf("too many items: %d > %d", n, limit)
+	}
+	return int(n), nil
+}
+
+// object calls field for each key of the next map, which must consume
+// the corresponding value. Keys must be text strings, and duplicate keys
+// are rejected.
+func (d *cborDecoder) object(what string, field func(key string) error) error {
+	n, err := d.expect("map", cborMajorMap)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", what, err)
+	}
+	if n > uint64(len(d.buf)) {
+		return fmt.Errorf("reading %s: %w", what, errCBORTruncated)
+	}
+	seen := map[string]struct{}{}
+	for i := uint64(0); i < n; i++ {
+		key, err := d.text()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", what, err)
+		}
+		if _, ok := seen[key]; ok {
+			return fmt.Errorf("reading %s: duplicate field %q", what, key)
+		}
+		seen[key] = struct{}{}
+		if err := field(key); err != nil {
+			return fmt.Errorf("reading %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// skip consumes the next item, found at the given nesting depth.
+func (d *cborDecoder) skip(depth int) error {
+	if depth > cborMaxDepth {
+		return errors.New("CBOR input is too deeply nested")
+	}
+	major, arg, err := d.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case cborMajorBytes, cborMajorText:
+		if arg > uint64(len(d.buf)) {
+			return errCBORTruncated
+		}
+		d.buf = d.buf[arg:]
+	case cborMajorArray, cborMajorMap:
+		if arg > uint64(len(d.buf)) {
+			return errCBORTruncated
+		}
+		if major == cborMajorMap {
+			arg *= 2
+		}
+		for i := uint64(0); i < arg; i++ {
+			if err := d.skip(depth + 1); err != nil {
+				return err
+			}
+		}
+	case cborMajorTag:
+		return d.skip(depth + 1)
+	}
+	return nil
+}
+
+// end checks that the whole input was consumed.
+func (d *cborDecoder) end() error {
+	if len(d.buf) != 0 {
+		return fmt.Errorf("%d trailing bytes after CBOR item", len(d.buf))
+	}
+	return nil
+}
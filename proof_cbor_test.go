@@ -0,0 +1,102 @@
+package verkle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProofCBORRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	vp, sd := proofFixture(t)
+
+	encoded, err := vp.MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decodedProof VerkleProof
+	if err := decodedProof.UnmarshalCBOR(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vp, &decodedProof) {
+		t.Fatal("proof changed after a round trip")
+	}
+	for _, l := range []int{0, 1, len(encoded) - 1} {
+		if err := decodedProof.UnmarshalCBOR(encoded[:l]); err == nil {
+			t.Fatalf("truncated proof of %d bytes was accepted", l)
+		}
+	}
+	if err := decodedProof.UnmarshalCBOR(append(encoded, 0)); err == nil {
+		t.Fatal("trailing bytes were accepted")
+	}
+
+	encoded, err = sd.MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decodedDiff StateDiff
+	if err := decodedDiff.UnmarshalCBOR(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sd, decodedDiff) {
+		t.Fatal("state diff changed after a round trip")
+	}
+
+	// The decoded proof must still verify
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(forkOneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	rootBytes := root.Commit().Bytes()
+	if err := VerifySerializedProof(&decodedProof, decodedDiff, rootBytes[:]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProofCBORDecoding(t *testing.T) {
+	t.Parallel()
+
+	// {"stem": h'00..00', "extra": [1, {"a": "b"}], "suffixDiffs": [{"suffix": 1, "currentValue": null, "newValue": h'00..00'}]}
+	stem := cborAppendBytes(nil, make([]byte, StemSize))
+	value := cborAppendBytes(nil, make([]byte, 32))
+	encoded := cborAppendHead(nil, cborMajorArray, 1)
+	encoded = cborAppendHead(encoded, cborMajorMap, 3)
+	encoded = append(cborAppendText(encoded, "stem"), stem...)
+	encoded = cborAppendText(encoded, "extra")
+	encoded = cborAppendHead(encoded, cborMajorArray, 2)
+	encoded = cborAppendHead(encoded, cborMajorUint, 1)
+	encoded = cborAppendHead(encoded, cborMajorMap, 1)
+	encoded = cborAppendText(cborAppendText(encoded, "a"), "b")
+	encoded = cborAppendText(encoded, "suffixDiffs")
+	encoded = cborAppendHead(encoded, cborMajorArray, 1)
+	encoded = cborAppendHead(encoded, cborMajorMap, 3)
+	encoded = cborAppendHead(cborAppendText(encoded, "suffix"), cborMajorUint, 1)
+	encoded = append(cborAppendText(encoded, "currentValue"), cborNull)
+	encoded = append(cborAppendText(encoded, "newValue"), value...)
+
+	var sd StateDiff
+	if err := sd.UnmarshalCBOR(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(sd) != 1 || len(sd[0].SuffixDiffs) != 1 || sd[0].SuffixDiffs[0].Suffix != 1 || sd[0].SuffixDiffs[0].CurrentValue != nil || sd[0].SuffixDiffs[0].NewValue == nil {
+		t.Fatalf("invalid decoded state diff %+v", sd)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		encoded []byte
+	}{
+		{"indefinite length", []byte{cborMajorArray<<5 | 31}},
+		{"huge array", cborAppendHead(nil, cborMajorArray, 1<<40)},
+		{"not an array", cborAppendText(nil, "stem")},
+		{"duplicate key", append(append(cborAppendText(cborAppendHead([]byte{0x81}, cborMajorMap, 2), "stem"), stem...), append(cborAppendText(nil, "stem"), stem...)...)},
+		{"short stem", append(cborAppendText([]byte{0x81, 0xa1}, "stem"), cborAppendBytes(nil, make([]byte, StemSize-1))...)},
+	} {
+		if err := sd.UnmarshalCBOR(tc.encoded); err == nil {
+			t.Errorf("%s: invalid input was accepted", tc.name)
+		}
+	}
+}
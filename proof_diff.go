@@ -0,0 +1,229 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ProofDiff lists the differences between two proofs, see CompareProofs.
+type ProofDiff struct {
+	MissingKeys [][]byte // keys proven by a, but not by b
+	ExtraKeys   [][]byte // keys proven by b, but not by a
+
+	Values      []ValueDiff      // keys proven by both, with different values
+	ExtStatuses []ExtStatusDiff  // stems proven by both, with different extension statuses
+	Commitments []CommitmentDiff // nodes whose commitment differs, or is only in one proof
+}
+
+// ValueDiff is a key whose pre-state or post-state value differs between
+// two proofs.
+type ValueDiff struct {
+	Key          []byte
+	PreA, PreB   []byte
+	PostA, PostB []byte
+}
+
+// ExtStatusDiff is a stem whose depth or extension status differs
+// between two proofs.
+type ExtStatusDiff struct {
+	Stem []byte
+	A, B byte // encoded extension statuses, see DecodeExtStatus
+}
+
+// CommitmentDiff is a node of the tree whose commitment differs between
+// two proofs, A or B being nil if the commitment isn't in that proof.
+type CommitmentDiff struct {
+	Kind CommitmentKind
+	Path []byte // path of the node, for C1 and C2 the path of their leaf
+	A, B *Point
+}
+
+// Empty returns true if no difference was found.
+func (d *ProofDiff) Empty() bool {
+	return len(d.MissingKeys) == 0 && len(d.ExtraKeys) == 0 && len(d.Values) == 0 && len(d.ExtStatuses) == 0 && len(d.Commitments) == 0
+}
+
+func (d *ProofDiff) String() string {
+	if d.Empty() {
+		return "proofs are identical\n"
+	}
+	var sb strings.Builder
+	for _, key := range d.MissingKeys {
+		fmt.Fprintf(&sb, "key %x: only in a\n", key)
+	}
+	for _, key := range d.ExtraKeys {
+		fmt.Fprintf(&sb, "key %x: only in b\n", key)
+	}
+	for _, v := range d.Values {
+		fmt.Fprintf(&sb, "key %x: pre=%s/%s post=%x/%x\n", v.Key, explainValue([][]byte{v.PreA}, 0), explainValue([][]byte{v.PreB}, 0), v.PostA, v.PostB)
+	}
+	for _, es := range d.ExtStatuses {
+		depthA, statusA := DecodeExtStatus(es.A)
+		depthB, statusB := DecodeExtStatus(es.B)
+		fmt.Fprintf(&sb, "stem %x: %s at depth %d/%s at depth %d\n", es.Stem, statusA, depthA, statusB, depthB)
+	}
+	for _, c := range d.Commitments {
+		fmt.Fprintf(&sb, "%s commitment at path %x: %x/%x\n", c.Kind, c.Path, truncatedBytes(c.A), truncatedBytes(c.B))
+	}
+	return sb.String()
+}
+
+// CompareProofs reports the differences between two proofs, e.g. the
+// witnesses produced by two clients for the same block, in terms of the
+// keys they prove, their values, the extension statuses of their stems,
+// and the commitments of each node of the tree they open. Like Explain,
+// it is meant for debugging and doesn't check the proofs.
+func CompareProofs(a, b *Proof) (*ProofDiff, error) {
+	diff := &ProofDiff{}
+
+	valuesA, valuesB := proofValues(a), proofValues(b)
+	for _, key := range a.Keys {
+		vb, ok := valuesB[string(key)]
+		if !ok {
+			diff.MissingKeys = append(diff.MissingKeys, key)
+			continue
+		}
+		va := valuesA[string(key)]
+		if !bytes.Equal(va[0], vb[0]) || !bytes.Equal(va[1], vb[1]) {
+			diff.Values = append(diff.Values, ValueDiff{Key: key, PreA: va[0], PreB: vb[0], PostA: va[1], PostB: vb[1]})
+		}
+	}
+	for _, key := range b.Keys {
+		if _, ok := valuesA[string(key)]; !ok {
+			diff.ExtraKeys = append(diff.ExtraKeys, key)
+		}
+	}
+
+	statusesA, err := proofExtStatuses(a)
+	if err != nil {
+		return nil, fmt.Errorf("proof a: %w", err)
+	}
+	statusesB, err := proofExtStatuses(b)
+	if err != nil {
+		return nil, fmt.Errorf("proof b: %w", err)
+	}
+	for _, key := range a.Keys {
+		stem := key[:StemSize]
+		esA, esB := statusesA[string(stem)], statusesB[string(stem)]
+		if _, ok := statusesB[string(stem)]; ok && esA != esB {
+			if n := len(diff.ExtStatuses); n == 0 || !bytes.Equal(diff.ExtStatuses[n-1].Stem, stem) {
+				diff.ExtStatuses = append(diff.ExtStatuses, ExtStatusDiff{Stem: stem, A: esA, B: esB})
+			}
+		}
+	}
+
+	commsA, err := proofCommitments(a)
+	if err != nil {
+		return nil, fmt.Errorf("proof a: %w", err)
+	}
+	commsB, err := proofCommitments(b)
+	if err != nil {
+		return nil, fmt.Errorf("proof b: %w", err)
+	}
+	for id, ca := range commsA {
+		if cb := commsB[id]; cb.Point == nil || !ca.Point.Equal(cb.Point) {
+			diff.Commitments = append(diff.Commitments, CommitmentDiff{Kind: ca.Kind, Path: ca.Path, A: ca.Point, B: cb.Point})
+		}
+	}
+	for id, cb := range commsB {
+		if _, ok := commsA[id]; !ok {
+			diff.Commitments = append(diff.Commitments, CommitmentDiff{Kind: cb.Kind, Path: cb.Path, B: cb.Point})
+		}
+	}
+	sort.Slice(diff.Commitments, func(i, j int) bool {
+		ci, cj := diff.Commitments[i], diff.Commitments[j]
+		if c := bytes.Compare(ci.Path, cj.Path); c != 0 {
+			return c < 0
+		}
+		return ci.Kind < cj.Kind
+	})
+	return diff, nil
+}
+
+// proofValues maps the keys of a proof to their pre-state and post-state
+// values.
+func proofValues(proof *Proof) map[string][2][]byte {
+	values := make(map[string][2][]byte, len(proof.Keys))
+	for i, key := range proof.Keys {
+		var v [2][]byte
+		if i < len(proof.PreValues) {
+			v[0] = proof.PreValues[i]
+		}
+		if i < len(proof.PostValues) {
+			v[1] = proof.PostValues[i]
+		}
+		values[string(key)] = v
+	}
+	return values
+}
+
+// proofExtStatuses maps the stems of a proof to their extension status.
+func proofExtStatuses(proof *Proof) (map[string]byte, error) {
+	statuses := make(map[string]byte, len(proof.ExtStatus))
+	var prev []byte
+	for _, key := range proof.Keys {
+		if len(key) != StemSize+1 {
+			return nil, fmt.Errorf("invalid key %x", key)
+		}
+		if prev != nil && bytes.Equal(prev, key[:StemSize]) {
+			continue
+		}
+		if len(statuses) == len(proof.ExtStatus) {
+			return nil, fmt.Errorf("more stems than the %d extension statuses", len(proof.ExtStatus))
+		}
+		prev = key[:StemSize]
+		statuses[string(prev)] = proof.ExtStatus[len(statuses)]
+	}
+	return statuses, nil
+}
+
+type proofCommitment struct {
+	CommitmentUse
+	Point *Point
+}
+
+// proofCommitments maps the nodes whose commitment is in a proof, by kind
+// and path, to their commitment.
+func proofCommitments(proof *Proof) (map[string]proofCommitment, error) {
+	uses, err := proof.CommitmentKeys()
+	if err != nil {
+		return nil, err
+	}
+	comms := make(map[string]proofCommitment, len(uses))
+	for i, use := range uses {
+		if len(use.Path) == 0 {
+			// Unused commitment
+			continue
+		}
+		id := string(append([]byte{byte(use.Kind)}, use.Path...))
+		comms[id] = proofCommitment{CommitmentUse: use, Point: proof.Cs[i]}
+	}
+	return comms, nil
+}
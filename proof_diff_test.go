@@ -0,0 +1,77 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompareProofs(t *testing.T) {
+	t.Parallel()
+
+	forkTwoKeyTest := append([]byte{}, forkOneKeyTest...)
+	forkTwoKeyTest[StemSize] = 2
+	build := func(value []byte) VerkleNode {
+		root := New()
+		for _, kv := range []keyValue{{zeroKeyTest, fourtyKeyTest}, {forkOneKeyTest, fourtyKeyTest}, {forkTwoKeyTest, value}, {ffx32KeyTest, fourtyKeyTest}} {
+			if err := root.Insert(kv.key, kv.value, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		root.Commit()
+		return root
+	}
+	prove := func(root VerkleNode, keys ...[]byte) *Proof {
+		proof, _, _, _, err := MakeVerkleMultiProof(root, nil, keys, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return proof
+	}
+
+	a := build(fourtyKeyTest)
+	diff, err := CompareProofs(prove(a, zeroKeyTest, forkTwoKeyTest), prove(a, zeroKeyTest, forkTwoKeyTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Empty() {
+		t.Fatalf("identical proofs differ: %s", diff)
+	}
+
+	// Same keys, one value differs: the leaf, its C1 and the internal
+	// node above it differ.
+	b := build(zeroKeyTest)
+	diff, err = CompareProofs(prove(a, zeroKeyTest, forkTwoKeyTest), prove(b, zeroKeyTest, forkTwoKeyTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.MissingKeys) != 0 || len(diff.ExtraKeys) != 0 || len(diff.ExtStatuses) != 0 {
+		t.Fatalf("unexpected differences: %s", diff)
+	}
+	if len(diff.Values) != 1 || !bytes.Equal(diff.Values[0].Key, forkTwoKeyTest) || !bytes.Equal(diff.Values[0].PreB, zeroKeyTest) {
+		t.Fatalf("invalid value differences: %s", diff)
+	}
+	var kinds []CommitmentKind
+	for _, c := range diff.Commitments {
+		if c.A == nil || c.B == nil || !bytes.HasPrefix(forkTwoKeyTest, c.Path) {
+			t.Fatalf("invalid commitment difference %+v", c)
+		}
+		kinds = append(kinds, c.Kind)
+	}
+	if len(kinds) != 3 || kinds[0] != InternalCommitment || kinds[1] != LeafCommitment || kinds[2] != C1Commitment {
+		t.Fatalf("invalid commitment differences: %s", diff)
+	}
+
+	// Different keys
+	diff, err = CompareProofs(prove(a, zeroKeyTest, forkOneKeyTest), prove(a, zeroKeyTest, ffx32KeyTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.MissingKeys) != 1 || !bytes.Equal(diff.MissingKeys[0], forkOneKeyTest) || len(diff.ExtraKeys) != 1 || !bytes.Equal(diff.ExtraKeys[0], ffx32KeyTest) {
+		t.Fatalf("invalid key differences: %s", diff)
+	}
+	for _, c := range diff.Commitments {
+		if (c.A == nil) == (c.B == nil) {
+			t.Fatalf("commitment at %x should only be in one proof", c.Path)
+		}
+	}
+}
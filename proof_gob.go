@@ -0,0 +1,277 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	ipa "github.com/crate-crypto/go-ipa"
+)
+
+// proofGobVersion is the first byte of the gob encoding of a proof, so
+// that the format can evolve.
+const proofGobVersion = 1
+
+// proofGobNil is the length of a nil value or commitment in the gob
+// encoding of a proof, which keeps nil and empty values apart.
+const proofGobNil = math.MaxUint32
+
+// GobEncode encodes the proof for encoding/gob. Unlike SerializeProof, the
+// encoding keeps all the fields of the proof as they are: values aren't
+// padded, and nil values, which stand for absent or unchanged keys, stay
+// distinct from empty ones, so that the decoded proof is Equal to proof.
+// Lengths are 4-byte little-endian integers, and points are in their
+// compressed form:
+//
+//	version || has multipoint || [D || len(L) || L... || len(R) || R... || A]
+//	|| len(ExtStatus) || ExtStatus || len(Cs) || Cs...
+//	|| PoaStems || Keys || PreValues || PostValues
+//
+// where each list of byte strings is its length followed by each item
+// with its length, nil items and commitments having length 0xffffffff.
+// The polynomials cached by a proof made in this process aren't encoded.
+func (proof *Proof) GobEncode() ([]byte, error) {
+	buf := []byte{proofGobVersion}
+	appendLen := func(n int) {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(n))
+	}
+	appendPoints := func(points []Point) {
+		appendLen(len(points))
+		for i := range points {
+			b := points[i].Bytes()
+			buf = append(buf, b[:]...)
+		}
+	}
+	appendList := func(list [][]byte) {
+		appendLen(len(list))
+		for _, item := range list {
+			if item == nil {
+				appendLen(proofGobNil)
+				continue
+			}
+			appendLen(len(item))
+			buf = append(buf, item...)
+		}
+	}
+
+	if proof.Multipoint == nil {
+		buf = append(buf, 0)
+	} else {
+		buf = append(buf, 1)
+		d := proof.Multipoint.D.Bytes()
+		buf = append(buf, d[:]...)
+		appendPoints(proof.Multipoint.IPA.L)
+		appendPoints(proof.Multipoint.IPA.R)
+		a := proof.Multipoint.IPA.A_scalar.Bytes()
+		buf = append(buf, a[:]...)
+	}
+	appendLen(len(proof.ExtStatus))
+	buf = append(buf, proof.ExtStatus...)
+	appendLen(len(proof.Cs))
+	for _, c := range proof.Cs {
+		if c == nil {
+			appendLen(proofGobNil)
+			continue
+		}
+		appendLen(32)
+		b := c.Bytes()
+		buf = append(buf, b[:]...)
+	}
+	for _, list := range [][][]byte{proof.PoaStems, proof.Keys, proof.PreValues, proof.PostValues} {
+		appendList(list)
+	}
+	return buf, nil
+}
+
+// GobDecode decodes a proof encoded by GobEncode, and replaces proof
+// with it. Points are checked to be on the curve.
+func (proof *Proof) GobDecode(data []byte) error {
+	r := &gobReader{buf: data}
+	if version, err := r.next(1, "version"); err != nil {
+		return err
+	} else if version[0] != proofGobVersion {
+		return fmt.Errorf("unsupported proof encoding version %d", version[0])
+	}
+
+	var decoded Proof
+	hasMultipoint, err := r.next(1, "multipoint flag")
+	if err != nil {
+		return err
+	}
+	switch hasMultipoint[0] {
+	case 0:
+	case 1:
+		decoded.Multipoint = &ipa.MultiProof{}
+		if err := r.point(&decoded.Multipoint.D, "D"); err != nil {
+			return err
+		}
+		if decoded.Multipoint.IPA.L, err = r.points("L"); err != nil {
+			return err
+		}
+		if decoded.Multipoint.IPA.R, err = r.points("R"); err != nil {
+			return err
+		}
+		a, err := r.next(32, "final evaluation")
+		if err != nil {
+			return err
+		}
+		decoded.Multipoint.IPA.A_scalar.SetBytes(a)
+	default:
+		return fmt.Errorf("invalid multipoint flag %d", hasMultipoint[0])
+	}
+
+	n, err := r.len("extension statuses")
+	if err != nil {
+		return err
+	}
+	if decoded.ExtStatus, err = r.next(n, "extension statuses"); err != nil {
+		return err
+	}
+	decoded.ExtStatus = copyBytes(decoded.ExtStatus)
+
+	if n, err = r.len("commitments"); err != nil {
+		return err
+	}
+	if n > 0 {
+		decoded.Cs = make([]*Point, n)
+	}
+	for i := range decoded.Cs {
+		size, err := r.rawLen("commitment")
+		if err != nil {
+			return err
+		}
+		switch size {
+		case proofGobNil:
+		case 32:
+			decoded.Cs[i] = new(Point)
+			if err := r.point(decoded.Cs[i], "commitment"); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid commitment size %d", size)
+		}
+	}
+
+	for _, field := range []struct {
+		list *[][]byte
+		what string
+	}{{&decoded.PoaStems, "proof of absence stems"}, {&decoded.Keys, "keys"}, {&decoded.PreValues, "pre-state values"}, {&decoded.PostValues, "post-state values"}} {
+		if *field.list, err = r.list(field.what); err != nil {
+			return err
+		}
+	}
+	if len(r.buf) != 0 {
+		return fmt.Errorf("%d trailing bytes after proof", len(r.buf))
+	}
+	*proof = decoded
+	return nil
+}
+
+// gobReader reads the gob encoding of a proof, which it consumes.
+type gobReader struct {
+	buf []byte
+}
+
+func (r *gobReader) next(n int, what string) ([]byte, error) {
+	if n > len(r.buf) {
+		return nil, fmt.Errorf("reading %s: truncated proof encoding", what)
+	}
+	ret := r.buf[:n]
+	r.buf = r.buf[n:]
+	return ret, nil
+}
+
+func (r *gobReader) rawLen(what string) (uint32, error) {
+	b, err := r.next(4, what)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+// len reads the number of items of a list, which can't be more than the
+// number of remaining bytes, so that a corrupted length doesn't cause a
+// huge allocation.
+func (r *gobReader) len(what string) (int, error) {
+	n, err := r.rawLen(what)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(n) > uint64(len(r.buf)) {
+		return 0, fmt.Errorf("reading %s: invalid length %d", what, n)
+	}
+	return int(n), nil
+}
+
+func (r *gobReader) point(p *Point, what string) error {
+	b, err := r.next(32, what)
+	if err != nil {
+		return err
+	}
+	if err := p.SetBytes(b); err != nil {
+		return fmt.Errorf("reading %s: %w", what, err)
+	}
+	return nil
+}
+
+func (r *gobReader) points(what string) ([]Point, error) {
+	n, err := r.len(what)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]Point, n)
+	for i := range points {
+		if err := r.point(&points[i], what); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+func (r *gobReader) list(what string) ([][]byte, error) {
+	n, err := r.len(what)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	list := make([][]byte, n)
+	for i := range list {
+		size, err := r.rawLen(what)
+		if err != nil {
+			return nil, err
+		}
+		if size == proofGobNil {
+			continue
+		}
+		item, err := r.next(int(size), what)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = copyBytes(item)
+	}
+	return list, nil
+}
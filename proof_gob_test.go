@@ -0,0 +1,71 @@
+package verkle
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+)
+
+func TestProofGobRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(forkOneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	postroot := root.Copy()
+	if err := postroot.Insert(zeroKeyTest, oneKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	postroot.Commit()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, postroot, [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type cached struct {
+		Block uint64
+		Proof *Proof
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&cached{Block: 1, Proof: proof}); err != nil {
+		t.Fatal(err)
+	}
+	var decoded cached
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !proof.Equal(decoded.Proof) {
+		t.Fatal("proof changed after a round trip")
+	}
+	// Absent and unchanged keys are still told apart from empty values
+	if decoded.Proof.PreValues[1] != nil || decoded.Proof.PostValues[1] != nil {
+		t.Fatal("nil values weren't preserved")
+	}
+	if err := VerifyProofAtRoot(decoded.Proof, root.Commitment().Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := proof.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Proof
+	for _, l := range []int{0, 1, 40, len(encoded) - 1} {
+		if err := p.GobDecode(encoded[:l]); err == nil {
+			t.Fatalf("truncated encoding of %d bytes was accepted", l)
+		}
+	}
+	if err := p.GobDecode(append(encoded, 0)); err == nil {
+		t.Fatal("trailing bytes were accepted")
+	}
+	corrupted := append([]byte{}, encoded...)
+	corrupted[0] = proofGobVersion + 1
+	if err := p.GobDecode(corrupted); err == nil {
+		t.Fatal("unknown version was accepted")
+	}
+}
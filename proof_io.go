@@ -0,0 +1,272 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// readLen reads a 4-byte little-endian length prefix.
+func (cr *countingReader) readLen(what string) (int, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(cr, buf[:]); err != nil {
+		return 0, fmt.Errorf("reading number of %s: %w", what, err)
+	}
+	return int(binary.LittleEndian.Uint32(buf[:])), nil
+}
+
+// readN reads n bytes. The buffer grows with the data actually read, so
+// that a corrupted length doesn't cause a huge allocation.
+func (cr *countingReader) readN(n int, what string) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, cr, int64(n)); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", what, noEOF(err))
+	}
+	return buf.Bytes(), nil
+}
+
+// noEOF turns the end of the input in the middle of an item into an
+// unexpected one.
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// WriteTo writes the proof to w, in the format of VerkleProof.Serialize,
+// without building the whole encoding in memory.
+func (vp *VerkleProof) WriteTo(w io.Writer) (int64, error) {
+	if vp.IPAProof == nil {
+		return 0, errors.New("missing IPA proof")
+	}
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	// Errors are kept by bw, and returned by Flush.
+	vp.encode(bw)
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ReadFrom reads a proof written by WriteTo, or VerkleProof.Serialize,
+// and replaces vp with it. It reads exactly the bytes of the proof, so it
+// can be followed by other data in r, which should then be buffered.
+func (vp *VerkleProof) ReadFrom(r io.Reader) (int64, error) {
+	var (
+		cr     = &countingReader{r: r}
+		parsed = VerkleProof{IPAProof: &IPAProof{}}
+	)
+
+	n, err := cr.readLen("proof of absence stems")
+	if err != nil {
+		return cr.n, err
+	}
+	stems, err := cr.readN(n*StemSize, "proof of absence stems")
+	if err != nil {
+		return cr.n, err
+	}
+	parsed.OtherStems = make([][StemSize]byte, n)
+	for i := range parsed.OtherStems {
+		copy(parsed.OtherStems[i][:], stems[i*StemSize:])
+	}
+
+	n, err = cr.readLen("extension statuses")
+	if err != nil {
+		return cr.n, err
+	}
+	if parsed.DepthExtensionPresent, err = cr.readN(n, "extension statuses"); err != nil {
+		return cr.n, err
+	}
+	if err := checkExtStatuses(parsed.DepthExtensionPresent); err != nil {
+		return cr.n, err
+	}
+
+	n, err = cr.readLen("commitments")
+	if err != nil {
+		return cr.n, err
+	}
+	commitments, err := cr.readN(n*32, "commitments")
+	if err != nil {
+		return cr.n, err
+	}
+	parsed.CommitmentsByPath = make([][32]byte, n)
+	for i := range parsed.CommitmentsByPath {
+		copy(parsed.CommitmentsByPath[i][:], commitments[i*32:])
+	}
+
+	var multipoint [rustMultiproofSize]byte
+	if _, err := io.ReadFull(cr, multipoint[:]); err != nil {
+		return cr.n, fmt.Errorf("reading multipoint proof: %w", noEOF(err))
+	}
+	offset := copy(parsed.D[:], multipoint[:])
+	for i := range parsed.IPAProof.CL {
+		offset += copy(parsed.IPAProof.CL[i][:], multipoint[offset:])
+	}
+	for i := range parsed.IPAProof.CR {
+		offset += copy(parsed.IPAProof.CR[i][:], multipoint[offset:])
+	}
+	if err := setRustFinalEvaluation(&parsed.IPAProof.FinalEvaluation, multipoint[offset:]); err != nil {
+		return cr.n, err
+	}
+
+	*vp = parsed
+	return cr.n, nil
+}
+
+// WriteTo writes the state diff to w, without building the whole
+// encoding in memory. The encoding is the one hashed by HashStateDiff,
+// without the domain: stems and suffixes are written in the order in
+// which they appear, so the hash of a normalized state diff is that of
+// the domain followed by its encoding.
+func (sd StateDiff) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	// Errors are kept by bw, and returned by Flush.
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(len(sd)))
+	bw.Write(buf[:])
+	for i := range sd {
+		if len(sd[i].SuffixDiffs) > NodeWidth {
+			return cw.n, fmt.Errorf("too many suffix diffs for stem %x: %d", sd[i].Stem, len(sd[i].SuffixDiffs))
+		}
+		bw.Write(sd[i].Stem[:])
+		binary.BigEndian.PutUint16(buf[:2], uint16(len(sd[i].SuffixDiffs)))
+		bw.Write(buf[:2])
+		for _, suffixdiff := range sd[i].SuffixDiffs {
+			var flags byte
+			if suffixdiff.CurrentValue != nil {
+				flags |= suffixDiffHasCurrent
+			}
+			if suffixdiff.NewValue != nil {
+				flags |= suffixDiffHasNew
+			}
+			bw.Write([]byte{suffixdiff.Suffix, flags})
+			if suffixdiff.CurrentValue != nil {
+				bw.Write(suffixdiff.CurrentValue[:])
+			}
+			if suffixdiff.NewValue != nil {
+				bw.Write(suffixdiff.NewValue[:])
+			}
+		}
+	}
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ReadFrom reads a state diff written by WriteTo, and replaces sd with it.
+// It reads exactly the bytes of the state diff, so it can be followed by
+// other data in r, which should then be buffered.
+func (sd *StateDiff) ReadFrom(r io.Reader) (int64, error) {
+	var (
+		cr  = &countingReader{r: r}
+		buf [4]byte
+	)
+	if _, err := io.ReadFull(cr, buf[:]); err != nil {
+		return cr.n, fmt.Errorf("reading number of stem diffs: %w", err)
+	}
+	n := binary.BigEndian.Uint32(buf[:])
+
+	// Don't trust n to allocate the state diff.
+	var parsed StateDiff
+	for i := uint32(0); i < n; i++ {
+		var stemdiff StemStateDiff
+		if _, err := io.ReadFull(cr, stemdiff.Stem[:]); err != nil {
+			return cr.n, fmt.Errorf("reading stem %d: %w", i, noEOF(err))
+		}
+		if _, err := io.ReadFull(cr, buf[:2]); err != nil {
+			return cr.n, fmt.Errorf("reading number of suffix diffs of stem %x: %w", stemdiff.Stem, noEOF(err))
+		}
+		count := int(binary.BigEndian.Uint16(buf[:2]))
+		if count > NodeWidth {
+			return cr.n, fmt.Errorf("too many suffix diffs for stem %x: %d", stemdiff.Stem, count)
+		}
+		stemdiff.SuffixDiffs = make(SuffixStateDiffs, count)
+		for j := range stemdiff.SuffixDiffs {
+			if err := readSuffixDiff(cr, &stemdiff.SuffixDiffs[j]); err != nil {
+				return cr.n, fmt.Errorf("reading suffix diff %d of stem %x: %w", j, stemdiff.Stem, err)
+			}
+		}
+		parsed = append(parsed, stemdiff)
+	}
+
+	*sd = parsed
+	return cr.n, nil
+}
+
+func readSuffixDiff(r io.Reader, suffixdiff *SuffixStateDiff) error {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return noEOF(err)
+	}
+	suffixdiff.Suffix = header[0]
+	if header[1]&^(suffixDiffHasCurrent|suffixDiffHasNew) != 0 {
+		return fmt.Errorf("invalid flags %#x", header[1])
+	}
+	if header[1]&suffixDiffHasCurrent != 0 {
+		suffixdiff.CurrentValue = new([32]byte)
+		if _, err := io.ReadFull(r, suffixdiff.CurrentValue[:]); err != nil {
+			return noEOF(err)
+		}
+	}
+	if header[1]&suffixDiffHasNew != 0 {
+		suffixdiff.NewValue = new([32]byte)
+		if _, err := io.ReadFull(r, suffixdiff.NewValue[:]); err != nil {
+			return noEOF(err)
+		}
+	}
+	return nil
+}
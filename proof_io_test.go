@@ -0,0 +1,73 @@
+package verkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestProofWriteToReadFrom(t *testing.T) {
+	t.Parallel()
+
+	vp, sd := proofFixture(t)
+
+	// Write the proof and the state diff back to back
+	var buf bytes.Buffer
+	n, err := vp.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), vp.Serialize()) || n != int64(buf.Len()) {
+		t.Fatal("streamed proof differs from the serialized one")
+	}
+	m, err := sd.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m != int64(buf.Len())-n {
+		t.Fatalf("invalid state diff size %d", m)
+	}
+	serialized := append([]byte{}, buf.Bytes()...)
+
+	var (
+		decodedProof VerkleProof
+		decodedDiff  StateDiff
+	)
+	if read, err := decodedProof.ReadFrom(&buf); err != nil || read != n {
+		t.Fatalf("reading proof: %d bytes, %v", read, err)
+	}
+	if read, err := decodedDiff.ReadFrom(&buf); err != nil || read != m {
+		t.Fatalf("reading state diff: %d bytes, %v", read, err)
+	}
+	if !decodedProof.Equal(vp) || !decodedDiff.Equal(sd) {
+		t.Fatal("decoded proof differs from the written one")
+	}
+
+	// The encoding of a normalized state diff is what HashStateDiff hashes
+	normalized, err := sd.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encoded bytes.Buffer
+	if _, err := normalized.WriteTo(&encoded); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := HashStateDiff(sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha256.Sum256(append(append([]byte{}, stateDiffHashDomain...), encoded.Bytes()...)) != hash {
+		t.Fatal("state diff encoding doesn't match its hash")
+	}
+
+	for _, l := range []int64{1, n - 1} {
+		if _, err := decodedProof.ReadFrom(bytes.NewReader(serialized[:l])); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("truncated proof of %d bytes: got %v", l, err)
+		}
+	}
+	if _, err := decodedDiff.ReadFrom(bytes.NewReader(serialized[n : n+m-1])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("truncated state diff: got %v", err)
+	}
+}
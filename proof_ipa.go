@@ -27,13 +27,15 @@ package verkle
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"sort"
-	"unsafe"
+	"time"
 
 	ipa "github.com/crate-crypto/go-ipa"
 	"github.com/crate-crypto/go-ipa/common"
+	"golang.org/x/sync/errgroup"
 )
 
 const IPA_PROOF_DEPTH = 8
@@ -49,40 +51,215 @@ type VerkleProof struct {
 	DepthExtensionPresent []byte     `json:"depthExtensionPresent"`
 	CommitmentsByPath     [][32]byte `json:"commitmentsByPath"`
 	D                     [32]byte   `json:"d"`
-	IPAProof              *IPAProof  `json:"ipa_proof"`
+	IPAProof              *IPAProof  `json:"ipaProof"`
 }
 
-func (vp *VerkleProof) Copy() *VerkleProof {
-	ret := &VerkleProof{
-		OtherStems:            make([][31]byte, len(vp.OtherStems)),
-		DepthExtensionPresent: make([]byte, len(vp.DepthExtensionPresent)),
-		CommitmentsByPath:     make([][32]byte, len(vp.CommitmentsByPath)),
-		IPAProof:              &IPAProof{},
+// Copy returns a deep copy of ip.
+func (ip *IPAProof) Copy() *IPAProof {
+	if ip == nil {
+		return nil
 	}
+	ret := *ip
+	return &ret
+}
 
-	copy(ret.OtherStems, vp.OtherStems)
-	copy(ret.DepthExtensionPresent, vp.DepthExtensionPresent)
-	copy(ret.CommitmentsByPath, vp.CommitmentsByPath)
-
-	ret.D = vp.D
-
-	if vp.IPAProof != nil {
-		ret.IPAProof = vp.IPAProof
+// Equal returns true if ip and other hold the same values.
+func (ip *IPAProof) Equal(other *IPAProof) bool {
+	if ip == nil || other == nil {
+		return ip == other
 	}
+	return *ip == *other
+}
 
+// Copy returns a deep copy of vp.
+func (vp *VerkleProof) Copy() *VerkleProof {
+	if vp == nil {
+		return nil
+	}
+	ret := &VerkleProof{
+		D:        vp.D,
+		IPAProof: vp.IPAProof.Copy(),
+	}
+	if vp.OtherStems != nil {
+		ret.OtherStems = make([][31]byte, len(vp.OtherStems))
+		copy(ret.OtherStems, vp.OtherStems)
+	}
+	if vp.DepthExtensionPresent != nil {
+		ret.DepthExtensionPresent = make([]byte, len(vp.DepthExtensionPresent))
+		copy(ret.DepthExtensionPresent, vp.DepthExtensionPresent)
+	}
+	if vp.CommitmentsByPath != nil {
+		ret.CommitmentsByPath = make([][32]byte, len(vp.CommitmentsByPath))
+		copy(ret.CommitmentsByPath, vp.CommitmentsByPath)
+	}
 	return ret
 }
 
+// Equal returns true if vp and other hold the same values. Nil and empty
+// lists are considered equal.
+func (vp *VerkleProof) Equal(other *VerkleProof) bool {
+	if vp == nil || other == nil {
+		return vp == other
+	}
+	if vp.D != other.D || !vp.IPAProof.Equal(other.IPAProof) || !bytes.Equal(vp.DepthExtensionPresent, other.DepthExtensionPresent) {
+		return false
+	}
+	if len(vp.OtherStems) != len(other.OtherStems) || len(vp.CommitmentsByPath) != len(other.CommitmentsByPath) {
+		return false
+	}
+	for i := range vp.OtherStems {
+		if vp.OtherStems[i] != other.OtherStems[i] {
+			return false
+		}
+	}
+	for i := range vp.CommitmentsByPath {
+		if vp.CommitmentsByPath[i] != other.CommitmentsByPath[i] {
+			return false
+		}
+	}
+	return true
+}
+
 type Proof struct {
 	Multipoint *ipa.MultiProof // multipoint argument
 	ExtStatus  []byte          // the extension status of each stem
 	Cs         []*Point        // commitments, sorted by their path in the tree
 	PoaStems   [][]byte        // stems proving another stem is absent
-	Keys       [][]byte
-	PreValues  [][]byte
-	PostValues [][]byte
+	Keys       [][]byte        // proven keys, sorted
+	PreValues  [][]byte        // value of each key in the proven tree, nil if absent
+	PostValues [][]byte        // value of each key after the block, nil if unchanged
+
+	// polys are the polynomials opened by the proof, if it was made
+	// from a tree, so that ExtendProof doesn't need to recompute them.
+	polys *proofPolys
+}
+
+// Copy returns a deep copy of proof.
+func (proof *Proof) Copy() *Proof {
+	if proof == nil {
+		return nil
+	}
+	ret := &Proof{
+		ExtStatus:  copyBytes(proof.ExtStatus),
+		PoaStems:   copyByteSlices(proof.PoaStems),
+		Keys:       copyByteSlices(proof.Keys),
+		PreValues:  copyByteSlices(proof.PreValues),
+		PostValues: copyByteSlices(proof.PostValues),
+		polys:      proof.polys, // never modified
+	}
+	if proof.Multipoint != nil {
+		ret.Multipoint = &ipa.MultiProof{D: proof.Multipoint.D}
+		ret.Multipoint.IPA.L = append([]Point(nil), proof.Multipoint.IPA.L...)
+		ret.Multipoint.IPA.R = append([]Point(nil), proof.Multipoint.IPA.R...)
+		ret.Multipoint.IPA.A_scalar = proof.Multipoint.IPA.A_scalar
+	}
+	if proof.Cs != nil {
+		ret.Cs = make([]*Point, len(proof.Cs))
+		for i, c := range proof.Cs {
+			if c != nil {
+				ret.Cs[i] = new(Point)
+				ret.Cs[i].Set(c)
+			}
+		}
+	}
+	return ret
+}
+
+// Equal returns true if proof and other hold the same values. Nil and
+// empty lists are considered equal, but nil and empty values aren't, as
+// a nil value stands for a missing key.
+func (proof *Proof) Equal(other *Proof) bool {
+	if proof == nil || other == nil {
+		return proof == other
+	}
+	if !bytes.Equal(proof.ExtStatus, other.ExtStatus) ||
+		!equalByteSlices(proof.PoaStems, other.PoaStems) ||
+		!equalByteSlices(proof.Keys, other.Keys) ||
+		!equalByteSlices(proof.PreValues, other.PreValues) ||
+		!equalByteSlices(proof.PostValues, other.PostValues) {
+		return false
+	}
+	if len(proof.Cs) != len(other.Cs) {
+		return false
+	}
+	for i := range proof.Cs {
+		if proof.Cs[i] == nil || other.Cs[i] == nil {
+			if proof.Cs[i] != other.Cs[i] {
+				return false
+			}
+		} else if !proof.Cs[i].Equal(other.Cs[i]) {
+			return false
+		}
+	}
+	return equalMultiproofs(proof.Multipoint, other.Multipoint)
+}
+
+func equalMultiproofs(a, b *ipa.MultiProof) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if !a.D.Equal(&b.D) || !a.IPA.A_scalar.Equal(&b.IPA.A_scalar) {
+		return false
+	}
+	if len(a.IPA.L) != len(b.IPA.L) || len(a.IPA.R) != len(b.IPA.R) {
+		return false
+	}
+	for i := range a.IPA.L {
+		if !a.IPA.L[i].Equal(&b.IPA.L[i]) {
+			return false
+		}
+	}
+	for i := range a.IPA.R {
+		if !a.IPA.R[i].Equal(&b.IPA.R[i]) {
+			return false
+		}
+	}
+	return true
 }
 
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func copyByteSlices(s [][]byte) [][]byte {
+	if s == nil {
+		return nil
+	}
+	ret := make([][]byte, len(s))
+	for i := range s {
+		ret[i] = copyBytes(s[i])
+	}
+	return ret
+}
+
+// equalByteSlices compares two lists of byte slices, telling nil and
+// empty items apart.
+func equalByteSlices(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if (a[i] == nil) != (b[i] == nil) || !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// proofPolys are the polynomials opened by a proof, which are only valid
+// as long as the root of the tree it was made from is root.
+type proofPolys struct {
+	root  Point
+	polys polyCache
+}
+
+// SuffixStateDiff holds the pre- and post-state values of a key. A nil
+// CurrentValue means that the key is absent from the pre-state tree, and
+// a nil NewValue that it isn't written to, so that a single witness can
+// be used to check both the reads and the results of a block.
 type SuffixStateDiff struct {
 	Suffix       byte      `json:"suffix"`
 	CurrentValue *[32]byte `json:"currentValue"`
@@ -98,10 +275,17 @@ type StemStateDiff struct {
 
 type StateDiff []StemStateDiff
 
+// Copy returns a deep copy of sd.
 func (sd StateDiff) Copy() StateDiff {
+	if sd == nil {
+		return nil
+	}
 	ret := make(StateDiff, len(sd))
 	for i := range sd {
 		copy(ret[i].Stem[:], sd[i].Stem[:])
+		if sd[i].SuffixDiffs == nil {
+			continue
+		}
 		ret[i].SuffixDiffs = make([]SuffixStateDiff, len(sd[i].SuffixDiffs))
 		for j := range sd[i].SuffixDiffs {
 			ret[i].SuffixDiffs[j].Suffix = sd[i].SuffixDiffs[j].Suffix
@@ -118,36 +302,121 @@ func (sd StateDiff) Copy() StateDiff {
 	return ret
 }
 
+// Equal returns true if sd and other hold the same stems and suffixes,
+// in the same order. Diffs can be compared regardless of their order by
+// normalizing them first, see Normalize.
+func (sd StateDiff) Equal(other StateDiff) bool {
+	if len(sd) != len(other) {
+		return false
+	}
+	for i := range sd {
+		if sd[i].Stem != other[i].Stem || len(sd[i].SuffixDiffs) != len(other[i].SuffixDiffs) {
+			return false
+		}
+		for j, suffix := range sd[i].SuffixDiffs {
+			o := other[i].SuffixDiffs[j]
+			if suffix.Suffix != o.Suffix || !equalDiffValues(suffix.CurrentValue, o.CurrentValue) || !equalDiffValues(suffix.NewValue, o.NewValue) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// GetCommitmentsForMultiproof collects the openings needed to prove keys
+// in root. keys is sorted in place, and the keys appearing several times
+// are only proven once, so that pe.Vals holds one value per distinct key,
+// in increasing key order. An error is returned if a key isn't
+// StemSize+1 bytes long.
 func GetCommitmentsForMultiproof(root VerkleNode, keys [][]byte, resolver NodeResolverFn) (*ProofElements, []byte, [][]byte, error) {
+	sorted, err := proofKeys(keys)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return getCommitmentsForMultiproof(root, sorted, resolver, nil)
+}
+
+// getCommitmentsForMultiproof is GetCommitmentsForMultiproof for keys
+// already returned by proofKeys, reusing the polynomials found in polys.
+func getCommitmentsForMultiproof(root VerkleNode, keys keylist, resolver NodeResolverFn, polys polyCache) (*ProofElements, []byte, [][]byte, error) {
+	return proofItems(root, keys, resolver, polys)
+}
+
+// proofKeys checks the length of keys, sorts them in place, and returns
+// them without duplicates. keys itself is left untouched beyond the
+// sorting, and a copy is returned if some keys had to be dropped.
+func proofKeys(keys [][]byte) (keylist, error) {
+	for i, key := range keys {
+		if len(key) != StemSize+1 {
+			return nil, fmt.Errorf("invalid length of key %d, expected %d, got %d", i, StemSize+1, len(key))
+		}
+	}
 	sort.Sort(keylist(keys))
-	return root.GetProofItems(keylist(keys), resolver)
+	for i := 1; i < len(keys); i++ {
+		if !bytes.Equal(keys[i], keys[i-1]) {
+			continue
+		}
+		unique := append(make(keylist, 0, len(keys)-1), keys[:i]...)
+		for _, key := range keys[i+1:] {
+			if !bytes.Equal(key, unique[len(unique)-1]) {
+				unique = append(unique, key)
+			}
+		}
+		return unique, nil
+	}
+	return keylist(keys), nil
 }
 
 // getProofElementsFromTree factors the logic that is used both in the proving and verification methods. It takes a pre-state
 // tree and an optional post-state tree, extracts the proof data from them and returns all the items required to build/verify
 // a proof.
 func getProofElementsFromTree(preroot, postroot VerkleNode, keys [][]byte, resolver NodeResolverFn) (*ProofElements, []byte, [][]byte, [][]byte, error) {
+	pe, es, poas, postvals, _, err := getProofElements(preroot, treePostValues(postroot, resolver), keys, resolver, nil)
+	return pe, es, poas, postvals, err
+}
+
+// postValueFn returns the post-state value of a key.
+type postValueFn func(key []byte) ([]byte, error)
+
+// treePostValues reads the post-state values from postroot, if not nil.
+func treePostValues(postroot VerkleNode, resolver NodeResolverFn) postValueFn {
+	if postroot == nil {
+		return nil
+	}
+	return func(key []byte) ([]byte, error) {
+		return postroot.Get(key, resolver)
+	}
+}
+
+// getProofElements is getProofElementsFromTree, with the post-state values
+// returned by post, if not nil, and reusing the polynomials in polys. It
+// also returns the sorted and deduplicated keys the elements are for.
+func getProofElements(preroot VerkleNode, post postValueFn, keys [][]byte, resolver NodeResolverFn, polys polyCache) (*ProofElements, []byte, [][]byte, [][]byte, keylist, error) {
 	// go-ipa won't accept no key as an input, catch this corner case
 	// and return an empty result.
 	if len(keys) == 0 {
-		return nil, nil, nil, nil, errors.New("no key provided for proof")
+		return nil, nil, nil, nil, nil, errors.New("no key provided for proof")
 	}
 
-	pe, es, poas, err := GetCommitmentsForMultiproof(preroot, keys, resolver)
+	sorted, err := proofKeys(keys)
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("error getting pre-state proof data: %w", err)
+		return nil, nil, nil, nil, nil, err
+	}
+	pe, es, poas, err := getCommitmentsForMultiproof(preroot, sorted, resolver, polys)
+	if err != nil {
+		return nil, nil, nil, nil, nil, fmt.Errorf("error getting pre-state proof data: %w", err)
 	}
 
-	// if a post-state tree is present, merge its proof elements with
+	// if a post-state is present, merge its proof elements with
 	// those of the pre-state tree, so that they can be proved together.
-	postvals := make([][]byte, len(keys))
-	if postroot != nil {
+	postvals := make([][]byte, len(sorted))
+	if post != nil {
 		// keys were sorted already in the above GetcommitmentsForMultiproof.
 		// Set the post values, if they are untouched, leave them `nil`
-		for i := range keys {
-			val, err := postroot.Get(keys[i], resolver)
+		for i := range sorted {
+			val, err := post(sorted[i])
 			if err != nil {
-				return nil, nil, nil, nil, fmt.Errorf("error getting post-state value for key %x: %w", keys[i], err)
+				return nil, nil, nil, nil, nil, fmt.Errorf("error getting post-state value for key %x: %w", sorted[i], err)
 			}
 			if !bytes.Equal(pe.Vals[i], val) {
 				postvals[i] = val
@@ -157,22 +426,100 @@ func getProofElementsFromTree(preroot, postroot VerkleNode, keys [][]byte, resol
 
 	// [0:3]: proof elements of the pre-state trie for serialization,
 	// 3: values to be inserted in the post-state trie for serialization
-	return pe, es, poas, postvals, nil
+	return pe, es, poas, postvals, sorted, nil
 }
 
+// MakeVerkleMultiProof creates a proof for keys in preroot, using the
+// configuration of preroot. The pre-state values are read from preroot,
+// and the post-state ones from postroot, if not nil, resolving their
+// nodes with resolver; an error wrapping the ResolveError is returned if
+// a node along the path of a key can't be resolved. It returns ErrStatelessProof if preroot is a
+// stateless tree, e.g. one built by PreStateTreeFromProof, as it doesn't
+// hold the values and commitments needed to open its nodes.
 func MakeVerkleMultiProof(preroot, postroot VerkleNode, keys [][]byte, resolver NodeResolverFn) (*Proof, []*Point, []byte, []*Fr, error) {
-	pe, es, poas, postvals, err := getProofElementsFromTree(preroot, postroot, keys, resolver)
+	return makeVerkleMultiProof(preroot, treePostValues(postroot, resolver), keys, resolver, nil)
+}
+
+// MakeVerkleMultiProofs is MakeVerkleMultiProof, for callers that can
+// handle several proofs. If there are more keys than allowed by
+// WithMaxProofKeys and WithProofSplitting is enabled, the keys are sorted
+// and split over as many proofs as needed. Otherwise, a single proof is
+// made, and a ProofKeysError is returned if there are too many keys.
+func MakeVerkleMultiProofs(preroot, postroot VerkleNode, keys [][]byte, resolver NodeResolverFn) ([]*Proof, error) {
+	cfg := configOf(preroot)
+	if !cfg.splitProofs || cfg.maxProofKeys == 0 || len(keys) <= cfg.maxProofKeys {
+		proof, _, _, _, err := MakeVerkleMultiProof(preroot, postroot, keys, resolver)
+		if err != nil {
+			return nil, err
+		}
+		return []*Proof{proof}, nil
+	}
+
+	sort.Sort(keylist(keys))
+	var proofs []*Proof
+	for start := 0; start < len(keys); start += cfg.maxProofKeys {
+		end := start + cfg.maxProofKeys
+		if end > len(keys) {
+			end = len(keys)
+		}
+		proof, _, _, _, err := MakeVerkleMultiProof(preroot, postroot, keys[start:end:end], resolver)
+		if err != nil {
+			return nil, err
+		}
+		proofs = append(proofs, proof)
+	}
+	return proofs, nil
+}
+
+func makeVerkleMultiProof(preroot VerkleNode, post postValueFn, keys [][]byte, resolver NodeResolverFn, polys polyCache) (*Proof, []*Point, []byte, []*Fr, error) {
+	span := startSpan(SpanMakeProof)
+	defer span.End()
+	span.SetAttribute(AttrKeyCount, int64(len(keys)))
+
+	cfg := configOf(preroot)
+	prover, err := cfg.getProver()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	start := time.Now()
+	prof := startProfile()
+	proof, pe, err := prepareVerkleMultiProof(preroot, post, keys, resolver, polys)
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("get commitments for multiproof: %s", err)
+		return nil, nil, nil, nil, err
 	}
 
-	cfg := GetConfig()
-	tr := common.NewTranscript("vt")
-	mpArg, err := ipa.CreateMultiProof(tr, cfg.conf, pe.Cis, pe.Fis, pe.Zis)
+	tr := common.NewTranscript(cfg.transcriptLabel)
+	proof.Multipoint, err = prover.CreateMultiProof(tr, cfg.conf, pe.Cis, pe.Fis, pe.Zis)
 	if err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("creating multiproof: %w", err)
 	}
 
+	m := getMetrics()
+	m.UpdateTimer(MetricProofTime, time.Since(start))
+	prof.report(MetricProofAllocs, MetricProofAllocBytes, MetricProofCPU)
+	warnIfSlow("Slow proof generation", start, "keys", len(keys), "commitments", len(pe.ByPath))
+	m.IncCounter(MetricProofs, 1)
+	m.IncCounter(MetricProofKeys, int64(len(keys)))
+	span.SetAttribute(AttrNodeCount, int64(len(pe.ByPath)))
+	return proof, pe.Cis, pe.Zis, pe.Yis, nil
+}
+
+// prepareVerkleMultiProof gathers everything needed to prove keys in
+// preroot, and returns the proof without its multipoint argument.
+func prepareVerkleMultiProof(preroot VerkleNode, post postValueFn, keys [][]byte, resolver NodeResolverFn, polys polyCache) (*Proof, *ProofElements, error) {
+	if err := configOf(preroot).checkProofKeys(len(keys)); err != nil {
+		return nil, nil, err
+	}
+	pe, es, poas, postvals, keys, err := getProofElements(preroot, post, keys, resolver, polys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get commitments for multiproof: %w", err)
+	}
+	// The polynomials of a stateless tree are only partially known,
+	// which is enough to verify a proof but not to create a new one.
+	if pe.incomplete {
+		return nil, nil, ErrStatelessProof
+	}
+
 	// It's wheel-reinvention time again 🎉: reimplement a basic
 	// feature that should be part of the stdlib.
 	// "But golang is a high-productivity language!!!" 🤪
@@ -191,34 +538,291 @@ func MakeVerkleMultiProof(preroot, postroot VerkleNode, keys [][]byte, resolver
 	}
 
 	proof := &Proof{
-		Multipoint: mpArg,
 		Cs:         cis,
 		ExtStatus:  es,
 		PoaStems:   poas,
 		Keys:       keys,
 		PreValues:  pe.Vals,
 		PostValues: postvals,
+		polys:      &proofPolys{polys: pe.polys()},
 	}
-	return proof, pe.Cis, pe.Zis, pe.Yis, nil
+	proof.polys.root.Set(preroot.Commitment())
+	return proof, pe, nil
+}
+
+// ExtendProof creates a proof for the keys of existing along with
+// extraKeys, in preroot, which existing must have been made from. The
+// post-state values of existing are kept, so postroot is only read for
+// extraKeys, and can be nil if they aren't modified. If existing was made
+// by this process and the tree hasn't changed since, the polynomials it
+// opens are reused, and only those along the paths of extraKeys are
+// computed. The multipoint argument itself is always recomputed.
+func ExtendProof(preroot, postroot VerkleNode, existing *Proof, extraKeys [][]byte, resolver NodeResolverFn) (*Proof, []*Point, []byte, []*Fr, error) {
+	if len(existing.PreValues) != len(existing.Keys) || (existing.PostValues != nil && len(existing.PostValues) != len(existing.Keys)) {
+		return nil, nil, nil, nil, errors.New("invalid proof: keys and values don't match")
+	}
+
+	keys := make([][]byte, 0, len(existing.Keys)+len(extraKeys))
+	proven := make(map[string]int, len(existing.Keys))
+	for i, key := range existing.Keys {
+		keys = append(keys, key)
+		proven[string(key)] = i
+	}
+	for _, key := range extraKeys {
+		if _, ok := proven[string(key)]; !ok {
+			keys = append(keys, key)
+			proven[string(key)] = -1
+		}
+	}
+
+	post := func(key []byte) ([]byte, error) {
+		if i := proven[string(key)]; i >= 0 {
+			if existing.PostValues == nil {
+				return nil, nil
+			}
+			return existing.PostValues[i], nil
+		}
+		if postroot == nil {
+			return nil, nil
+		}
+		return postroot.Get(key, resolver)
+	}
+
+	var polys polyCache
+	if existing.polys != nil && existing.polys.root.Equal(preroot.Commitment()) {
+		polys = existing.polys.polys
+	}
+	proof, cis, zis, yis, err := makeVerkleMultiProof(preroot, post, keys, resolver, polys)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	for i, key := range proof.Keys {
+		if j := proven[string(key)]; j >= 0 && !bytes.Equal(proof.PreValues[i], existing.PreValues[j]) {
+			return nil, nil, nil, nil, fmt.Errorf("pre-state value of key %x differs from the extended proof", key)
+		}
+	}
+	return proof, cis, zis, yis, nil
+}
+
+// MultiproofInputs are the inputs of the multipoint argument of a proof:
+// the polynomials Fis, in evaluation form, of commitments Cis, opened at
+// Zis to Yis. They are those passed to ipa.CreateMultiProof, with a
+// transcript created from TranscriptLabel.
+type MultiproofInputs struct {
+	Cis []*Point
+	Zis []byte
+	Yis []*Fr
+	Fis [][]Fr
+
+	TranscriptLabel string
+
+	// conf is the configuration of the proven tree, which AttachMultipoint
+	// checks the argument with. It is nil if the inputs weren't returned by
+	// PrepareVerkleMultiProof, in which case GetConfig is used.
+	conf *Config
+}
+
+// PrepareVerkleMultiProof is MakeVerkleMultiProof, without computing the
+// multipoint argument: the proof is returned with a nil Multipoint,
+// along with the inputs of the argument. This lets an external prover
+// compute it, which can then be attached with AttachMultipoint. Unlike
+// MakeVerkleMultiProof, it is available in verkle_small builds.
+func PrepareVerkleMultiProof(preroot, postroot VerkleNode, keys [][]byte, resolver NodeResolverFn) (*Proof, *MultiproofInputs, error) {
+	conf := configOf(preroot)
+	proof, pe, err := prepareVerkleMultiProof(preroot, treePostValues(postroot, resolver), keys, resolver, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return proof, &MultiproofInputs{
+		Cis:             pe.Cis,
+		Zis:             pe.Zis,
+		Yis:             pe.Yis,
+		Fis:             pe.Fis,
+		TranscriptLabel: conf.transcriptLabel,
+		conf:            conf,
+	}, nil
+}
+
+// AttachMultipoint checks that mp is a valid multipoint argument for
+// inputs, as returned with proof by PrepareVerkleMultiProof, and sets it
+// as the argument of proof. The argument is checked with the
+// configuration of the tree that was proven.
+func AttachMultipoint(proof *Proof, inputs *MultiproofInputs, mp *ipa.MultiProof) error {
+	if mp == nil {
+		return errors.New("nil multipoint argument")
+	}
+	conf := inputs.conf
+	if conf == nil {
+		conf = GetConfig()
+	}
+	tr := common.NewTranscript(inputs.TranscriptLabel)
+	ok, err := verifyMultiProof(tr, conf.conf, mp, inputs.Cis, inputs.Yis, inputs.Zis)
+	if err != nil {
+		return fmt.Errorf("checking multipoint argument: %w", err)
+	}
+	if !ok {
+		return errors.New("multipoint argument doesn't match the proof")
+	}
+	proof.Multipoint = mp
+	return nil
 }
 
 // VerifyVerkleProofWithPreState takes a proof and a trusted tree root and verifies that the proof is valid.
+// The proof is verified with the configuration of preroot.
 func VerifyVerkleProofWithPreState(proof *Proof, preroot VerkleNode) error {
+	conf := configOf(preroot)
 	pe, _, _, _, err := getProofElementsFromTree(preroot, nil, proof.Keys, nil)
 	if err != nil {
-		return fmt.Errorf("error getting proof elements: %w", err)
+		return conf.verificationError(fmt.Errorf("error getting proof elements: %w", err))
 	}
 
-	if ok, err := VerifyVerkleProof(proof, pe.Cis, pe.Zis, pe.Yis, GetConfig()); !ok || err != nil {
-		return fmt.Errorf("error verifying proof: verifies=%v, error=%w", ok, err)
+	if err := CheckVerkleProof(proof, pe.Cis, pe.Zis, pe.Yis, conf); err != nil {
+		return conf.verificationError(fmt.Errorf("error verifying proof: %w", err))
 	}
 
 	return nil
 }
 
+// VerifyVerkleProof checks the multipoint argument of proof against the
+// openings of the pre-state tree, with the CRS and transcript label of
+// tc. It doesn't use the configuration returned by GetConfig, so it can
+// be called by any number of goroutines at once, sharing tc or not, as
+// long as the inputs aren't modified while in use. With a configuration
+// created by NewConfigWithCRS, the only package state it reads is the
+// tracer, metrics and logger set with SetTracer, SetMetrics and
+// SetLogger, which are safe for concurrent use.
 func VerifyVerkleProof(proof *Proof, Cs []*Point, indices []uint8, ys []*Fr, tc *Config) (bool, error) {
-	tr := common.NewTranscript("vt")
-	return ipa.CheckMultiProof(tr, tc.conf, proof.Multipoint, Cs, ys, indices)
+	span := startSpan(SpanVerifyProof)
+	defer span.End()
+	span.SetAttribute(AttrKeyCount, int64(len(proof.Keys)))
+	span.SetAttribute(AttrNodeCount, int64(len(proof.Cs)+1))
+
+	if err := tc.checkProofKeys(len(proof.Keys)); err != nil {
+		return false, err
+	}
+
+	start := time.Now()
+	tr := common.NewTranscript(tc.transcriptLabel)
+	ok, err := verifyMultiProof(tr, tc.conf, proof.Multipoint, Cs, ys, indices)
+
+	m := getMetrics()
+	m.UpdateTimer(MetricVerifyTime, time.Since(start))
+	warnIfSlow("Slow proof verification", start, "keys", len(proof.Keys), "commitments", len(Cs))
+	m.IncCounter(MetricVerifications, 1)
+	if !ok || err != nil {
+		m.IncCounter(MetricVerifyFailures, 1)
+	}
+	return ok, err
+}
+
+// CheckVerkleProof is VerifyVerkleProof, returning an error when the proof
+// is invalid. It is a VerificationError telling which opening, if any, or
+// which step of the verification is at fault. The openings are only
+// analyzed once the proof failed to verify, so valid proofs are verified
+// as fast as with VerifyVerkleProof. Note that an invalid evaluation or
+// commitment can't be told from an invalid multipoint argument, unless
+// the commitment is opened several times at the same point.
+func CheckVerkleProof(proof *Proof, Cs []*Point, indices []uint8, ys []*Fr, tc *Config) error {
+	if err := checkOpenings(proof, Cs, indices, ys); err != nil {
+		return tc.verificationError(err)
+	}
+	ok, err := VerifyVerkleProof(proof, Cs, indices, ys, tc)
+	if ok && err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrTooManyProofKeys) {
+		return err
+	}
+	if tc.constantTime {
+		return ErrProofInvalid
+	}
+
+	if verr := findInconsistentOpening(Cs, indices, ys); verr != nil {
+		return verr
+	}
+	if tc.transcriptLabel != defaultTranscriptLabel {
+		tr := common.NewTranscript(defaultTranscriptLabel)
+		if ok, _ := verifyMultiProof(tr, tc.conf, proof.Multipoint, Cs, ys, indices); ok {
+			return &VerificationError{Step: StepTranscript, Index: -1, Err: fmt.Errorf("the proof was made with the default transcript label, not %q", tc.transcriptLabel)}
+		}
+	}
+	if err == nil {
+		err = errors.New("invalid opening of the aggregated commitment, one of the commitments or evaluations, or the proof, is wrong")
+	}
+	return &VerificationError{Step: StepMultipoint, Index: -1, Err: err}
+}
+
+// checkOpenings checks that the openings and the multipoint argument are
+// well-formed.
+func checkOpenings(proof *Proof, Cs []*Point, indices []uint8, ys []*Fr) error {
+	mp := proof.Multipoint
+	switch {
+	case mp == nil:
+		return &VerificationError{Step: StepInputs, Index: -1, Err: errors.New("missing multipoint argument")}
+	case len(mp.IPA.L) != IPA_PROOF_DEPTH || len(mp.IPA.R) != IPA_PROOF_DEPTH:
+		return &VerificationError{Step: StepInputs, Index: -1, Err: fmt.Errorf("IPA proof has %d/%d rounds, expected %d", len(mp.IPA.L), len(mp.IPA.R), IPA_PROOF_DEPTH)}
+	case len(Cs) != len(indices) || len(Cs) != len(ys):
+		return &VerificationError{Step: StepInputs, Index: -1, Err: fmt.Errorf("got %d commitments, %d evaluation points and %d evaluations", len(Cs), len(indices), len(ys))}
+	case len(Cs) == 0:
+		return &VerificationError{Step: StepInputs, Index: -1, Err: errors.New("no opening")}
+	}
+	for i := range Cs {
+		if Cs[i] == nil || ys[i] == nil {
+			return &VerificationError{Step: StepInputs, Index: i, Err: errors.New("missing commitment or evaluation")}
+		}
+	}
+	return nil
+}
+
+// findInconsistentOpening looks for a commitment opened several times at
+// the same point, to different evaluations.
+func findInconsistentOpening(Cs []*Point, indices []uint8, ys []*Fr) *VerificationError {
+	type opening struct {
+		C [32]byte
+		z uint8
+	}
+	openings := make(map[opening]int, len(Cs))
+	for i := range Cs {
+		o := opening{Cs[i].Bytes(), indices[i]}
+		first, ok := openings[o]
+		if !ok {
+			openings[o] = i
+			continue
+		}
+		if !ys[first].Equal(ys[i]) {
+			return &VerificationError{
+				Step:  StepOpenings,
+				Index: i,
+				Err:   fmt.Errorf("commitment %x is opened at %d to %x, and to %x in opening %d", o.C, o.z, ys[i].Bytes(), ys[first].Bytes(), first),
+			}
+		}
+	}
+	return nil
+}
+
+// StemGroup is a run of consecutive keys sharing the same stem, see
+// GroupKeysByStem.
+type StemGroup struct {
+	Stem  []byte   // stem of the keys, aliasing the first of them
+	Keys  [][]byte // keys of the group, a subslice of the grouped keys
+	Start int      // index of the first key of the group in the grouped keys
+}
+
+// GroupKeysByStem splits keys, which are expected to be sorted as in a
+// proof, into runs of keys sharing the same stem. This is how the keys of
+// a proof are grouped in its state diff, and matched with its extension
+// statuses. A stem appearing in several runs of unsorted keys is found in
+// as many groups. Keys must be at least StemSize bytes long.
+func GroupKeysByStem(keys [][]byte) []StemGroup {
+	var groups []StemGroup
+	for i, key := range keys {
+		if n := len(groups); n > 0 && bytes.Equal(groups[n-1].Stem, key[:StemSize]) {
+			groups[n-1].Keys = keys[groups[n-1].Start : i+1]
+			continue
+		}
+		groups = append(groups, StemGroup{Stem: key[:StemSize], Keys: keys[i : i+1], Start: i})
+	}
+	return groups
 }
 
 // SerializeProof serializes the proof in the rust-verkle format:
@@ -226,7 +830,8 @@ func VerifyVerkleProof(proof *Proof, Cs []*Point, indices []uint8, ys []*Fr, tc
 // * len(depths) || serialize(depth || ext statusi)
 // * len(commitments) || serialize(commitment)
 // * Multipoint proof
-// it also returns the serialized keys and values
+// it also returns the serialized keys and values. VerkleProof.Serialize
+// produces the corresponding binary encoding.
 func SerializeProof(proof *Proof) (*VerkleProof, StateDiff, error) {
 	otherstems := make([][31]byte, len(proof.PoaStems))
 	for i, stem := range proof.PoaStems {
@@ -248,41 +853,17 @@ func SerializeProof(proof *Proof) (*VerkleProof, StateDiff, error) {
 		copy(crs[i][:], r[:])
 	}
 
-	var stemdiff *StemStateDiff
-	var statediff StateDiff
-	for i, key := range proof.Keys {
-		if stemdiff == nil || !bytes.Equal(stemdiff.Stem[:], key[:31]) {
-			statediff = append(statediff, StemStateDiff{})
-			stemdiff = &statediff[len(statediff)-1]
-			copy(stemdiff.Stem[:], key[:31])
-		}
-		stemdiff.SuffixDiffs = append(stemdiff.SuffixDiffs, SuffixStateDiff{Suffix: key[31]})
-		newsd := &stemdiff.SuffixDiffs[len(stemdiff.SuffixDiffs)-1]
-
-		var valueLen = len(proof.PreValues[i])
-		switch valueLen {
-		case 0:
-			// null value
-		case 32:
-			newsd.CurrentValue = (*[32]byte)(proof.PreValues[i])
-		default:
-			var aligned [32]byte
-			copy(aligned[:valueLen], proof.PreValues[i])
-			newsd.CurrentValue = (*[32]byte)(unsafe.Pointer(&aligned[0]))
-		}
-
-		valueLen = len(proof.PostValues[i])
-		switch valueLen {
-		case 0:
-			// null value
-		case 32:
-			newsd.NewValue = (*[32]byte)(proof.PostValues[i])
-		default:
-			// TODO remove usage of unsafe
-			var aligned [32]byte
-			copy(aligned[:valueLen], proof.PostValues[i])
-			newsd.NewValue = (*[32]byte)(unsafe.Pointer(&aligned[0]))
+	groups := GroupKeysByStem(proof.Keys)
+	statediff := make(StateDiff, 0, len(groups))
+	for _, group := range groups {
+		stemdiff := StemStateDiff{SuffixDiffs: make(SuffixStateDiffs, len(group.Keys))}
+		copy(stemdiff.Stem[:], group.Stem)
+		for j, key := range group.Keys {
+			if err := serializeSuffixDiff(&stemdiff.SuffixDiffs[j], key, proof.PreValues[group.Start+j], proof.PostValues[group.Start+j]); err != nil {
+				return nil, nil, err
+			}
 		}
+		statediff = append(statediff, stemdiff)
 	}
 
 	return &VerkleProof{
@@ -298,15 +879,34 @@ func SerializeProof(proof *Proof) (*VerkleProof, StateDiff, error) {
 	}, statediff, nil
 }
 
+// serializeSuffixDiff fills the suffix diff of key. Short values are
+// serialized in their padded form, and empty ones are null.
+func serializeSuffixDiff(sd *SuffixStateDiff, key, pre, post []byte) error {
+	sd.Suffix = key[StemSize]
+	if len(pre) > 0 {
+		padded, err := PadValue(pre, AlignLeft)
+		if err != nil {
+			return fmt.Errorf("serializing value of key %x: %w", key, err)
+		}
+		sd.CurrentValue = &padded
+	}
+	if len(post) > 0 {
+		padded, err := PadValue(post, AlignLeft)
+		if err != nil {
+			return fmt.Errorf("serializing new value of key %x: %w", key, err)
+		}
+		sd.NewValue = &padded
+	}
+	return nil
+}
+
 // DeserializeProof deserializes the proof found in blocks, into a format that
 // can be used to rebuild a stateless version of the tree.
 func DeserializeProof(vp *VerkleProof, statediff StateDiff) (*Proof, error) {
 	var (
-		poaStems, keys        [][]byte
-		prevalues, postvalues [][]byte
-		extStatus             []byte
-		commitments           []*Point
-		multipoint            ipa.MultiProof
+		poaStems    [][]byte
+		extStatus   []byte
+		commitments []*Point
 	)
 
 	poaStems = make([][]byte, len(vp.OtherStems))
@@ -326,54 +926,69 @@ func DeserializeProof(vp *VerkleProof, statediff StateDiff) (*Proof, error) {
 		commitments[i] = &commitment
 	}
 
-	if err := multipoint.D.SetBytes(vp.D[:]); err != nil {
+	multipoint, err := deserializeMultipoint(vp.D, vp.IPAProof)
+	if err != nil {
+		return nil, err
+	}
+
+	proof := Proof{
+		Multipoint: multipoint,
+		ExtStatus:  extStatus,
+		Cs:         commitments,
+		PoaStems:   poaStems,
+	}
+	// turn statediff into keys and values
+	for i := range statediff {
+		proof.appendStemDiff(&statediff[i])
+	}
+	return &proof, nil
+}
+
+// deserializeMultipoint decodes the multipoint argument of a VerkleProof.
+func deserializeMultipoint(d [32]byte, ipaProof *IPAProof) (*ipa.MultiProof, error) {
+	var multipoint ipa.MultiProof
+
+	if ipaProof == nil {
+		return nil, errors.New("missing IPA proof")
+	}
+	if err := multipoint.D.SetBytes(d[:]); err != nil {
 		return nil, fmt.Errorf("setting D: %w", err)
 	}
-	multipoint.IPA.A_scalar.SetBytes(vp.IPAProof.FinalEvaluation[:])
+	multipoint.IPA.A_scalar.SetBytes(ipaProof.FinalEvaluation[:])
 	multipoint.IPA.L = make([]Point, IPA_PROOF_DEPTH)
-	for i, b := range vp.IPAProof.CL {
+	for i, b := range ipaProof.CL {
 		if err := multipoint.IPA.L[i].SetBytes(b[:]); err != nil {
 			return nil, fmt.Errorf("setting L[%d]: %w", i, err)
 		}
 	}
 	multipoint.IPA.R = make([]Point, IPA_PROOF_DEPTH)
-	for i, b := range vp.IPAProof.CR {
+	for i, b := range ipaProof.CR {
 		if err := multipoint.IPA.R[i].SetBytes(b[:]); err != nil {
 			return nil, fmt.Errorf("setting R[%d]: %w", i, err)
 		}
 	}
+	return &multipoint, nil
+}
 
-	// turn statediff into keys and values
-	for _, stemdiff := range statediff {
-		for _, suffixdiff := range stemdiff.SuffixDiffs {
-			var k [32]byte
-			copy(k[:31], stemdiff.Stem[:])
-			k[31] = suffixdiff.Suffix
-			keys = append(keys, k[:])
-			if suffixdiff.CurrentValue != nil {
-				prevalues = append(prevalues, suffixdiff.CurrentValue[:])
-			} else {
-				prevalues = append(prevalues, nil)
-			}
-
-			if suffixdiff.NewValue != nil {
-				postvalues = append(postvalues, suffixdiff.NewValue[:])
-			} else {
-				postvalues = append(postvalues, nil)
-			}
+// appendStemDiff adds the keys and values of a stem diff to the proof.
+func (proof *Proof) appendStemDiff(stemdiff *StemStateDiff) {
+	for _, suffixdiff := range stemdiff.SuffixDiffs {
+		var k [32]byte
+		copy(k[:31], stemdiff.Stem[:])
+		k[31] = suffixdiff.Suffix
+		proof.Keys = append(proof.Keys, k[:])
+		if suffixdiff.CurrentValue != nil {
+			proof.PreValues = append(proof.PreValues, suffixdiff.CurrentValue[:])
+		} else {
+			proof.PreValues = append(proof.PreValues, nil)
 		}
-	}
 
-	proof := Proof{
-		&multipoint,
-		extStatus,
-		commitments,
-		poaStems,
-		keys,
-		prevalues,
-		postvalues,
+		if suffixdiff.NewValue != nil {
+			proof.PostValues = append(proof.PostValues, suffixdiff.NewValue[:])
+		} else {
+			proof.PostValues = append(proof.PostValues, nil)
+		}
 	}
-	return &proof, nil
 }
 
 type stemInfo struct {
@@ -392,11 +1007,10 @@ func PreStateTreeFromProof(proof *Proof, rootC *Point) (VerkleNode, error) { //
 	if len(proof.Keys) != len(proof.PostValues) {
 		return nil, fmt.Errorf("incompatible number of keys and post-values: %d != %d", len(proof.Keys), len(proof.PostValues))
 	}
-	stems := make([][]byte, 0, len(proof.Keys))
-	for _, k := range proof.Keys {
-		if len(stems) == 0 || !bytes.Equal(stems[len(stems)-1], k[:31]) {
-			stems = append(stems, k[:31])
-		}
+	groups := GroupKeysByStem(proof.Keys)
+	stems := make([][]byte, len(groups))
+	for i, group := range groups {
+		stems[i] = group.Stem
 	}
 	if len(stems) != len(proof.ExtStatus) {
 		return nil, fmt.Errorf("invalid number of stems and extension statuses: %d != %d", len(stems), len(proof.ExtStatus))
@@ -404,13 +1018,24 @@ func PreStateTreeFromProof(proof *Proof, rootC *Point) (VerkleNode, error) { //
 	var (
 		info  = map[string]stemInfo{}
 		paths [][]byte
-		err   error
 		poas  = proof.PoaStems
+
+		// indices of the keys of each stem, in proof order
+		keysByStem = make(map[string][]int, len(stems))
 	)
+	for j, k := range proof.Keys {
+		keysByStem[string(k[:StemSize])] = append(keysByStem[string(k[:StemSize])], j)
+	}
 
 	// The proof of absence stems must be sorted. If that isn't the case, the proof is invalid.
-	if !sort.IsSorted(bytesSlice(proof.PoaStems)) {
-		return nil, fmt.Errorf("proof of absence stems are not sorted")
+	// Since each of them is used once, they can't be repeated either.
+	for i, stem := range proof.PoaStems {
+		if len(stem) != StemSize {
+			return nil, fmt.Errorf("invalid proof of absence stem length %d", len(stem))
+		}
+		if i > 0 && bytes.Compare(proof.PoaStems[i-1], stem) >= 0 {
+			return nil, fmt.Errorf("proof of absence stems are not sorted, or repeated")
+		}
 	}
 
 	// We build a cache of paths that have a presence extension status.
@@ -434,16 +1059,16 @@ func PreStateTreeFromProof(proof *Proof, rootC *Point) (VerkleNode, error) { //
 		case extStatusAbsentEmpty:
 			// All keys that are part of a proof of absence, must contain empty
 			// prestate values. If that isn't the case, the proof is invalid.
-			for j := range proof.Keys { // TODO: DoS risk, use map or binary search.
-				if bytes.HasPrefix(proof.Keys[j], stems[i]) && proof.PreValues[j] != nil {
+			for _, j := range keysByStem[string(stems[i])] {
+				if proof.PreValues[j] != nil {
 					return nil, fmt.Errorf("proof of absence (empty) stem %x has a value", si.stem)
 				}
 			}
 		case extStatusAbsentOther:
 			// All keys that are part of a proof of absence, must contain empty
 			// prestate values. If that isn't the case, the proof is invalid.
-			for j := range proof.Keys { // TODO: DoS risk, use map or binary search.
-				if bytes.HasPrefix(proof.Keys[j], stems[i]) && proof.PreValues[j] != nil {
+			for _, j := range keysByStem[string(stems[i])] {
+				if proof.PreValues[j] != nil {
 					return nil, fmt.Errorf("proof of absence (other) stem %x has a value", si.stem)
 				}
 			}
@@ -463,17 +1088,24 @@ func PreStateTreeFromProof(proof *Proof, rootC *Point) (VerkleNode, error) { //
 				continue
 			}
 
+			// The proof of absence stem must be the one found at the end of
+			// this path, and can't be the absent stem itself.
+			if len(poas) == 0 {
+				return nil, fmt.Errorf("missing proof of absence stem for stem %x", stems[i])
+			}
+			if !bytes.HasPrefix(poas[0], path) || bytes.Equal(poas[0], stems[i]) {
+				return nil, fmt.Errorf("proof of absence stem %x doesn't prove the absence of stem %x", poas[0], stems[i])
+			}
 			si.stem = poas[0]
 			poas = poas[1:]
 		case extStatusPresent:
 			si.values = map[byte][]byte{}
 			si.stem = stems[i]
-			for j, k := range proof.Keys { // TODO: DoS risk, use map or binary search.
-				if bytes.Equal(k[:31], si.stem) {
-					si.values[k[31]] = proof.PreValues[j]
-					si.has_c1 = si.has_c1 || (k[31] < 128)
-					si.has_c2 = si.has_c2 || (k[31] >= 128)
-				}
+			for _, j := range keysByStem[string(si.stem)] {
+				k := proof.Keys[j]
+				si.values[k[31]] = proof.PreValues[j]
+				si.has_c1 = si.has_c1 || (k[31] < 128)
+				si.has_c2 = si.has_c2 || (k[31] >= 128)
 			}
 		default:
 			return nil, fmt.Errorf("invalid extension status: %d", si.stemType)
@@ -487,31 +1119,117 @@ func PreStateTreeFromProof(proof *Proof, rootC *Point) (VerkleNode, error) { //
 	}
 
 	root := NewStatelessInternal(0, rootC).(*InternalNode)
-	comms := proof.Cs
-	for _, p := range paths {
-		// NOTE: the reconstructed tree won't tell the
-		// difference between leaves missing from view
-		// and absent leaves. This is enough for verification
-		// but not for block validation.
-		values := make([][]byte, NodeWidth)
-		for i, k := range proof.Keys {
-			if len(proof.PreValues[i]) == 0 {
-				// Skip the nil keys, they are here to prove
-				// an absence.
-				continue
-			}
+	if err := root.createPaths(paths, info, proof, keysByStem); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
 
-			if bytes.Equal(k[:31], info[string(p)].stem) {
-				values[k[31]] = proof.PreValues[i]
-			}
+// createPaths calls CreatePath for each path, in order, with the values
+// of the keys of its stem. The commitments are consumed in the same order
+// as if the paths were created one after the other, but the subtrees of
+// the root are built concurrently.
+func (n *InternalNode) createPaths(paths [][]byte, info map[string]stemInfo, proof *Proof, keysByStem map[string][]int) error {
+	// Group the paths by root child. Since they are sorted, each group
+	// is contiguous, and so are the commitments it consumes.
+	type group struct {
+		paths [][]byte
+		comms []*Point
+	}
+	var (
+		groups []group
+		comms  = proof.Cs
+	)
+	for start := 0; start < len(paths); {
+		if len(paths[start]) == 0 {
+			return errors.New("invalid path")
+		}
+		end := start + 1
+		for end < len(paths) && len(paths[end]) > 0 && paths[end][0] == paths[start][0] {
+			end++
+		}
+		g := group{paths: paths[start:end]}
+		count := commitmentsUsed(g.paths, info)
+		if count > len(comms) {
+			// Let CreatePath report the missing commitment
+			count = len(comms)
 		}
-		comms, err = root.CreatePath(p, info[string(p)], comms, values)
+		g.comms, comms = comms[:count], comms[count:]
+		groups = append(groups, g)
+		start = end
+	}
+
+	// The groups write to distinct children of the root, and errors are
+	// reported by order of the paths, so that the result is the same as
+	// a sequential reconstruction.
+	errs := make([]error, len(groups))
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.SetLimit(n.config().numWorkers())
+	for i := range groups {
+		i := i
+		eg.Go(func() error {
+			comms := groups[i].comms
+			for _, p := range groups[i].paths {
+				si := info[string(p)]
+				// NOTE: the reconstructed tree won't tell the
+				// difference between leaves missing from view
+				// and absent leaves. This is enough for verification
+				// but not for block validation.
+				values := make([][]byte, NodeWidth)
+				for _, j := range keysByStem[string(si.stem)] {
+					// Skip the nil keys, they are here to prove
+					// an absence.
+					if len(proof.PreValues[j]) != 0 {
+						values[proof.Keys[j][31]] = proof.PreValues[j]
+					}
+				}
+				var err error
+				if comms, err = n.CreatePath(p, si, comms, values); err != nil {
+					errs[i] = err
+					return nil
+				}
+			}
+			return nil
+		})
+	}
+	_ = eg.Wait()
+	for _, err := range errs {
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
+	return nil
+}
 
-	return root, nil
+// commitmentsUsed returns the number of commitments that CreatePath
+// consumes to create paths, in order, from an empty stateless node.
+func commitmentsUsed(paths [][]byte, info map[string]stemInfo) int {
+	var (
+		count    int
+		internal = map[string]struct{}{}
+	)
+	for _, p := range paths {
+		for depth := 1; depth < len(p); depth++ {
+			if _, ok := internal[string(p[:depth])]; !ok {
+				internal[string(p[:depth])] = struct{}{}
+				count++
+			}
+		}
+		si := info[string(p)]
+		switch si.stemType & 3 {
+		case extStatusAbsentOther:
+			count++
+		case extStatusPresent:
+			count++
+			if si.has_c1 {
+				count++
+			}
+			if si.has_c2 {
+				count++
+			}
+		}
+	}
+	return count
 }
 
 // PostStateTreeFromProof uses the pre-state trie and the list of updated values
@@ -542,13 +1260,128 @@ func PostStateTreeFromStateDiff(preroot VerkleNode, statediff StateDiff) (Verkle
 			}
 		}
 	}
-	postroot.Commit()
+	if _, err := commitTree(postroot); err != nil {
+		return nil, err
+	}
 
 	return postroot, nil
 }
 
-type bytesSlice [][]byte
+// VerifyUpdate checks a claimed transition from preRoot to postRoot, in
+// which keys, with values preValues, are written postValues and no other
+// key is modified. A nil pre-state value means that the key is absent,
+// and a nil post-state value that it is left unchanged. proof must prove
+// all the keys in the pre-state tree; its own post-state values are
+// ignored. The update is verified with conf, which must be the
+// configuration the proof was made with; nil means GetConfig.
+func VerifyUpdate(preRoot, postRoot *Point, keys, preValues, postValues [][]byte, proof *Proof, conf *Config) error {
+	if conf == nil {
+		conf = GetConfig()
+	}
+	if len(postValues) != len(keys) {
+		return fmt.Errorf("got %d keys and %d post-state values", len(keys), len(postValues))
+	}
+	if err := CheckProofValues(proof, keys, preValues, conf); err != nil {
+		return err
+	}
+	pretree, err := PreStateTreeFromProof(proof, preRoot)
+	if err != nil {
+		return fmt.Errorf("rebuilding pre-state tree: %w", err)
+	}
+	if root, ok := pretree.(*InternalNode); ok {
+		root.SetConfig(conf)
+	}
+	if err := VerifyVerkleProofWithPreState(proof, pretree); err != nil {
+		return err
+	}
+
+	// Apply the writes to the pre-state tree, and check the resulting
+	// root: since the tree only holds what the proof covers, this fails
+	// if the transition depends on anything else.
+	var (
+		statediff StateDiff
+		stems     = make(map[string]int)
+	)
+	for i, key := range keys {
+		if postValues[i] == nil {
+			continue
+		}
+		padded, err := PadValue(postValues[i], AlignLeft)
+		if err != nil {
+			return fmt.Errorf("post-state value of key %x: %w", key, err)
+		}
+		idx, ok := stems[string(key[:StemSize])]
+		if !ok {
+			idx = len(statediff)
+			stems[string(key[:StemSize])] = idx
+			statediff = append(statediff, StemStateDiff{})
+			copy(statediff[idx].Stem[:], key[:StemSize])
+		}
+		statediff[idx].SuffixDiffs = append(statediff[idx].SuffixDiffs, SuffixStateDiff{Suffix: key[StemSize], NewValue: &padded})
+	}
+	posttree, err := PostStateTreeFromStateDiff(pretree, statediff)
+	if err != nil {
+		return fmt.Errorf("applying the update: %w", err)
+	}
+	if !posttree.Commitment().Equal(postRoot) {
+		return conf.verificationError(fmt.Errorf("post-state root %x doesn't match the update, expected %x", postRoot.Bytes(), posttree.Commitment().Bytes()))
+	}
+	return nil
+}
+
+// BuildPartialTreeFromDiff builds a view of the pre-state values found in
+// statediff, for tools that need to inspect what a witness touches when
+// no proof is available. Nothing is verified: the root commitment is set
+// to root, if not nil, but the other commitments are unknown, and the
+// depth of each leaf is only deduced from the other stems of statediff.
+// Nodes that statediff doesn't cover are UnknownNode, and the tree can't
+// be used to make or verify proofs.
+func BuildPartialTreeFromDiff(statediff StateDiff, root *Point) (VerkleNode, error) {
+	normalized, err := statediff.Normalize()
+	if err != nil {
+		return nil, err
+	}
 
-func (x bytesSlice) Len() int           { return len(x) }
-func (x bytesSlice) Less(i, j int) bool { return bytes.Compare(x[i], x[j]) < 0 }
-func (x bytesSlice) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+	if root == nil {
+		root = new(Point).SetIdentity()
+	}
+	tree := NewStatelessInternal(0, new(Point).Set(root)).(*InternalNode)
+	for _, stemdiff := range normalized {
+		leaf := &LeafNode{
+			stem:       append([]byte{}, stemdiff.Stem[:]...),
+			values:     make([][]byte, NodeWidth),
+			commitment: new(Point).SetIdentity(),
+			c1:         new(Point).SetIdentity(),
+			c2:         new(Point).SetIdentity(),
+			isPartial:  true,
+		}
+		for _, suffixdiff := range stemdiff.SuffixDiffs {
+			if suffixdiff.CurrentValue != nil {
+				leaf.values[suffixdiff.Suffix] = append([]byte{}, suffixdiff.CurrentValue[:]...)
+			}
+		}
+		tree.insertPartialLeaf(leaf)
+	}
+	return tree, nil
+}
+
+// insertPartialLeaf inserts leaf below n, splitting the leaves sharing a
+// prefix with its stem. The internal nodes created this way are stateless.
+func (n *InternalNode) insertPartialLeaf(leaf *LeafNode) {
+	idx := offset2key(leaf.stem, n.depth)
+	switch child := n.children[idx].(type) {
+	case *InternalNode:
+		child.insertPartialLeaf(leaf)
+	case *LeafNode:
+		// Stems are unique in a normalized diff, so the stems differ
+		// and the leaves have to be pushed one level down.
+		split := NewStatelessInternal(n.depth+1, new(Point).SetIdentity()).(*InternalNode)
+		n.children[idx] = split
+		child.setDepth(n.depth + 2)
+		split.children[offset2key(child.stem, n.depth+1)] = child
+		split.insertPartialLeaf(leaf)
+	default:
+		leaf.setDepth(n.depth + 1)
+		n.children[idx] = leaf
+	}
+}
@@ -26,9 +26,14 @@
 package verkle
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"unicode"
 )
 
 // HexToPrefixedString turns a byte slice into its hex representation
@@ -37,14 +42,87 @@ func HexToPrefixedString(data []byte) string {
 	return "0x" + hex.EncodeToString(data)
 }
 
-// PrefixedHexStringToBytes does the opposite of HexToPrefixedString.
+// PrefixedHexStringToBytes does the opposite of HexToPrefixedString. As
+// in the Ethereum JSON-RPC, the prefix can also be 0X, and it is optional.
 func PrefixedHexStringToBytes(input string) ([]byte, error) {
-	if input[0:2] == "0x" {
+	if len(input) >= 2 && input[0] == '0' && (input[1] == 'x' || input[1] == 'X') {
 		input = input[2:]
 	}
 	return hex.DecodeString(input)
 }
 
+// HexEncoding is the policy used to write byte strings to, and read them
+// from, the JSON encoding of proofs and state diffs. Its zero value is the
+// canonical encoding: lowercase, 0x-prefixed, and as wide as the encoded
+// field. The MarshalJSON and UnmarshalJSON methods of the proof types use
+// it; other policies are passed explicitly, to the MarshalProofJSON,
+// UnmarshalProofJSON and ReadProofJSON methods of HexEncoding.
+type HexEncoding struct {
+	// Uppercase emits the digits A-F instead of a-f.
+	Uppercase bool
+
+	// OmitPrefix emits the hex digits without the 0x prefix.
+	OmitPrefix bool
+
+	// Strict rejects any input that this policy would not have produced:
+	// mixed-case or wrongly-cased digits, a missing or unexpected prefix,
+	// an odd number of digits, or a width that doesn't match the field.
+	// Otherwise, the case and prefix are ignored and short values are
+	// zero-padded on the right.
+	Strict bool
+}
+
+// Encode returns the hex representation of data under this policy.
+func (enc HexEncoding) Encode(data []byte) string {
+	encoded := hex.EncodeToString(data)
+	if enc.Uppercase {
+		encoded = strings.ToUpper(encoded)
+	}
+	if enc.OmitPrefix {
+		return encoded
+	}
+	return "0x" + encoded
+}
+
+// Decode parses a hex string under this policy. If size isn't negative,
+// it is the number of bytes expected by the decoded field.
+func (enc HexEncoding) Decode(input string, size int) ([]byte, error) {
+	if !enc.Strict {
+		return PrefixedHexStringToBytes(input)
+	}
+
+	digits := strings.TrimPrefix(input, "0x")
+	hasPrefix := len(digits) != len(input)
+	if hasPrefix == enc.OmitPrefix {
+		if enc.OmitPrefix {
+			return nil, fmt.Errorf("unexpected 0x prefix in %q", input)
+		}
+		return nil, fmt.Errorf("missing 0x prefix in %q", input)
+	}
+	if len(digits)%2 != 0 {
+		return nil, fmt.Errorf("odd number of hex digits in %q", input)
+	}
+	if size >= 0 && len(digits) != 2*size {
+		return nil, fmt.Errorf("hex string %q should encode %d bytes", input, size)
+	}
+	for _, c := range digits {
+		if (enc.Uppercase && c >= 'a' && c <= 'f') || (!enc.Uppercase && c >= 'A' && c <= 'F') {
+			return nil, fmt.Errorf("non-canonical hex digit case in %q", input)
+		}
+	}
+	return hex.DecodeString(digits)
+}
+
+// encodeHex and decodeHex use the canonical encoding, which is the one of
+// the MarshalJSON and UnmarshalJSON methods of the package.
+func encodeHex(data []byte) string {
+	return HexEncoding{}.Encode(data)
+}
+
+func decodeHex(input string, size int) ([]byte, error) {
+	return HexEncoding{}.Decode(input, size)
+}
+
 type ipaproofMarshaller struct {
 	CL              [IPA_PROOF_DEPTH]string `json:"cl"`
 	CR              [IPA_PROOF_DEPTH]string `json:"cr"`
@@ -52,32 +130,25 @@ type ipaproofMarshaller struct {
 }
 
 func (ipp *IPAProof) MarshalJSON() ([]byte, error) {
-	return json.Marshal(&ipaproofMarshaller{
-		CL: [IPA_PROOF_DEPTH]string{
-			HexToPrefixedString(ipp.CL[0][:]),
-			HexToPrefixedString(ipp.CL[1][:]),
-			HexToPrefixedString(ipp.CL[2][:]),
-			HexToPrefixedString(ipp.CL[3][:]),
-			HexToPrefixedString(ipp.CL[4][:]),
-			HexToPrefixedString(ipp.CL[5][:]),
-			HexToPrefixedString(ipp.CL[6][:]),
-			HexToPrefixedString(ipp.CL[7][:]),
-		},
-		CR: [IPA_PROOF_DEPTH]string{
-			HexToPrefixedString(ipp.CR[0][:]),
-			HexToPrefixedString(ipp.CR[1][:]),
-			HexToPrefixedString(ipp.CR[2][:]),
-			HexToPrefixedString(ipp.CR[3][:]),
-			HexToPrefixedString(ipp.CR[4][:]),
-			HexToPrefixedString(ipp.CR[5][:]),
-			HexToPrefixedString(ipp.CR[6][:]),
-			HexToPrefixedString(ipp.CR[7][:]),
-		},
-		FinalEvaluation: HexToPrefixedString(ipp.FinalEvaluation[:]),
-	})
+	return ipp.marshalJSON(HexEncoding{})
+}
+
+func (ipp *IPAProof) marshalJSON(enc HexEncoding) ([]byte, error) {
+	aux := &ipaproofMarshaller{
+		FinalEvaluation: enc.Encode(ipp.FinalEvaluation[:]),
+	}
+	for i := range ipp.CL {
+		aux.CL[i] = enc.Encode(ipp.CL[i][:])
+		aux.CR[i] = enc.Encode(ipp.CR[i][:])
+	}
+	return json.Marshal(aux)
 }
 
 func (ipp *IPAProof) UnmarshalJSON(data []byte) error {
+	return ipp.unmarshalJSON(data, HexEncoding{})
+}
+
+func (ipp *IPAProof) unmarshalJSON(data []byte, enc HexEncoding) error {
 	aux := &ipaproofMarshaller{}
 
 	if err := json.Unmarshal(data, &aux); err != nil {
@@ -88,7 +159,7 @@ func (ipp *IPAProof) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("invalid hex string for final evaluation: %s", aux.FinalEvaluation)
 	}
 
-	currentValueBytes, err := PrefixedHexStringToBytes(aux.FinalEvaluation)
+	currentValueBytes, err := enc.Decode(aux.FinalEvaluation, 32)
 	if err != nil {
 		return fmt.Errorf("error decoding hex string for current value: %v", err)
 	}
@@ -98,7 +169,7 @@ func (ipp *IPAProof) UnmarshalJSON(data []byte) error {
 		if len(aux.CL[i]) != 64 && len(aux.CL[i]) != 66 {
 			return fmt.Errorf("invalid hex string for CL[%d]: %s", i, aux.CL[i])
 		}
-		val, err := PrefixedHexStringToBytes(aux.CL[i])
+		val, err := enc.Decode(aux.CL[i], 32)
 		if err != nil {
 			return fmt.Errorf("error decoding hex string for CL[%d]: %s", i, aux.CL[i])
 		}
@@ -106,7 +177,7 @@ func (ipp *IPAProof) UnmarshalJSON(data []byte) error {
 		if len(aux.CR[i]) != 64 && len(aux.CR[i]) != 66 {
 			return fmt.Errorf("invalid hex string for CR[%d]: %s", i, aux.CR[i])
 		}
-		val, err = PrefixedHexStringToBytes(aux.CR[i])
+		val, err = enc.Decode(aux.CR[i], 32)
 		if err != nil {
 			return fmt.Errorf("error decoding hex string for CR[%d]: %s", i, aux.CR[i])
 		}
@@ -117,54 +188,73 @@ func (ipp *IPAProof) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// isJSONNull returns true if data is absent or the JSON null.
+func isJSONNull(data json.RawMessage) bool {
+	return len(data) == 0 || string(data) == "null"
+}
+
 type verkleProofMarshaller struct {
-	OtherStems            []string  `json:"otherStems"`
-	DepthExtensionPresent string    `json:"depthExtensionPresent"`
-	CommitmentsByPath     []string  `json:"commitmentsByPath"`
-	D                     string    `json:"d"`
-	IPAProof              *IPAProof `json:"ipaProof"`
+	OtherStems            []string        `json:"otherStems"`
+	DepthExtensionPresent string          `json:"depthExtensionPresent"`
+	CommitmentsByPath     []string        `json:"commitmentsByPath"`
+	D                     string          `json:"d"`
+	IPAProof              json.RawMessage `json:"ipaProof"`
 }
 
 func (vp *VerkleProof) MarshalJSON() ([]byte, error) {
+	return vp.marshalJSON(HexEncoding{})
+}
+
+func (vp *VerkleProof) marshalJSON(enc HexEncoding) ([]byte, error) {
 	aux := &verkleProofMarshaller{
 		OtherStems:            make([]string, len(vp.OtherStems)),
-		DepthExtensionPresent: HexToPrefixedString(vp.DepthExtensionPresent),
+		DepthExtensionPresent: enc.Encode(vp.DepthExtensionPresent),
 		CommitmentsByPath:     make([]string, len(vp.CommitmentsByPath)),
-		D:                     HexToPrefixedString(vp.D[:]),
-		IPAProof:              vp.IPAProof,
+		D:                     enc.Encode(vp.D[:]),
+		IPAProof:              json.RawMessage("null"),
+	}
+	if vp.IPAProof != nil {
+		var err error
+		if aux.IPAProof, err = vp.IPAProof.marshalJSON(enc); err != nil {
+			return nil, err
+		}
 	}
 
 	for i, s := range vp.OtherStems {
-		aux.OtherStems[i] = HexToPrefixedString(s[:])
+		aux.OtherStems[i] = enc.Encode(s[:])
 	}
 	for i, c := range vp.CommitmentsByPath {
-		aux.CommitmentsByPath[i] = HexToPrefixedString(c[:])
+		aux.CommitmentsByPath[i] = enc.Encode(c[:])
 	}
 	return json.Marshal(aux)
 }
 
 func (vp *VerkleProof) UnmarshalJSON(data []byte) error {
+	return vp.unmarshalJSON(data, HexEncoding{})
+}
+
+func (vp *VerkleProof) unmarshalJSON(data []byte, enc HexEncoding) error {
 	var aux verkleProofMarshaller
 	err := json.Unmarshal(data, &aux)
 	if err != nil {
 		return fmt.Errorf("verkle proof unmarshal error: %w", err)
 	}
 
-	vp.DepthExtensionPresent, err = PrefixedHexStringToBytes(aux.DepthExtensionPresent)
+	vp.DepthExtensionPresent, err = enc.Decode(aux.DepthExtensionPresent, -1)
 	if err != nil {
 		return fmt.Errorf("error decoding hex string for depth and extension present: %v", err)
 	}
 
 	vp.CommitmentsByPath = make([][32]byte, len(aux.CommitmentsByPath))
 	for i, c := range aux.CommitmentsByPath {
-		val, err := PrefixedHexStringToBytes(c)
+		val, err := enc.Decode(c, 32)
 		if err != nil {
 			return fmt.Errorf("error decoding hex string for commitment #%d: %w", i, err)
 		}
 		copy(vp.CommitmentsByPath[i][:], val)
 	}
 
-	currentValueBytes, err := PrefixedHexStringToBytes(aux.D)
+	currentValueBytes, err := enc.Decode(aux.D, 32)
 	if err != nil {
 		return fmt.Errorf("error decoding hex string for D: %w", err)
 	}
@@ -172,41 +262,103 @@ func (vp *VerkleProof) UnmarshalJSON(data []byte) error {
 
 	vp.OtherStems = make([][31]byte, len(aux.OtherStems))
 	for i, c := range aux.OtherStems {
-		val, err := PrefixedHexStringToBytes(c)
+		val, err := enc.Decode(c, StemSize)
 		if err != nil {
 			return fmt.Errorf("error decoding hex string for other stem #%d: %w", i, err)
 		}
 		copy(vp.OtherStems[i][:], val)
 	}
 
-	vp.IPAProof = aux.IPAProof
+	vp.IPAProof = nil
+	if !isJSONNull(aux.IPAProof) {
+		vp.IPAProof = &IPAProof{}
+		if err := vp.IPAProof.unmarshalJSON(aux.IPAProof, enc); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// marshalStateDiffJSON encodes sd like encoding/json, with enc.
+func marshalStateDiffJSON(sd StateDiff, enc HexEncoding) ([]byte, error) {
+	if sd == nil {
+		return []byte("null"), nil
+	}
+	stemdiffs := make([]json.RawMessage, len(sd))
+	for i := range sd {
+		var err error
+		if stemdiffs[i], err = sd[i].marshalJSON(enc); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(stemdiffs)
+}
+
+// unmarshalStateDiffJSON decodes a state diff like encoding/json, with enc.
+func unmarshalStateDiffJSON(data []byte, enc HexEncoding) (StateDiff, error) {
+	var stemdiffs []json.RawMessage
+	if err := json.Unmarshal(data, &stemdiffs); err != nil {
+		return nil, err
+	}
+	if stemdiffs == nil {
+		return nil, nil
+	}
+	sd := make(StateDiff, len(stemdiffs))
+	for i := range stemdiffs {
+		if err := sd[i].unmarshalJSON(stemdiffs[i], enc); err != nil {
+			return nil, err
+		}
+	}
+	return sd, nil
+}
+
 type stemStateDiffMarshaller struct {
-	Stem        string           `json:"stem"`
-	SuffixDiffs SuffixStateDiffs `json:"suffixDiffs"`
+	Stem        string            `json:"stem"`
+	SuffixDiffs []json.RawMessage `json:"suffixDiffs"`
 }
 
 func (ssd StemStateDiff) MarshalJSON() ([]byte, error) {
-	return json.Marshal(&stemStateDiffMarshaller{
-		Stem:        HexToPrefixedString(ssd.Stem[:]),
-		SuffixDiffs: ssd.SuffixDiffs,
-	})
+	return ssd.marshalJSON(HexEncoding{})
+}
+
+func (ssd StemStateDiff) marshalJSON(enc HexEncoding) ([]byte, error) {
+	aux := &stemStateDiffMarshaller{
+		Stem: enc.Encode(ssd.Stem[:]),
+	}
+	if ssd.SuffixDiffs != nil {
+		aux.SuffixDiffs = make([]json.RawMessage, len(ssd.SuffixDiffs))
+		for i := range ssd.SuffixDiffs {
+			var err error
+			if aux.SuffixDiffs[i], err = ssd.SuffixDiffs[i].marshalJSON(enc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return json.Marshal(aux)
 }
 
 func (ssd *StemStateDiff) UnmarshalJSON(data []byte) error {
+	return ssd.unmarshalJSON(data, HexEncoding{})
+}
+
+func (ssd *StemStateDiff) unmarshalJSON(data []byte, enc HexEncoding) error {
 	var aux stemStateDiffMarshaller
 	if err := json.Unmarshal(data, &aux); err != nil {
 		return fmt.Errorf("stemdiff unmarshal error: %w", err)
 	}
 
-	stem, err := PrefixedHexStringToBytes(aux.Stem)
+	stem, err := enc.Decode(aux.Stem, StemSize)
 	if err != nil {
 		return fmt.Errorf("invalid hex string for stem: %w", err)
 	}
-	*ssd = StemStateDiff{
-		SuffixDiffs: aux.SuffixDiffs,
+	*ssd = StemStateDiff{}
+	if aux.SuffixDiffs != nil {
+		ssd.SuffixDiffs = make(SuffixStateDiffs, len(aux.SuffixDiffs))
+		for i := range aux.SuffixDiffs {
+			if err := ssd.SuffixDiffs[i].unmarshalJSON(aux.SuffixDiffs[i], enc); err != nil {
+				return fmt.Errorf("stemdiff unmarshal error: %w", err)
+			}
+		}
 	}
 	copy(ssd.Stem[:], stem)
 	return nil
@@ -219,13 +371,17 @@ type suffixStateDiffMarshaller struct {
 }
 
 func (ssd SuffixStateDiff) MarshalJSON() ([]byte, error) {
+	return ssd.marshalJSON(HexEncoding{})
+}
+
+func (ssd SuffixStateDiff) marshalJSON(enc HexEncoding) ([]byte, error) {
 	var cvstr, nvstr *string
 	if ssd.CurrentValue != nil {
-		tempstr := HexToPrefixedString(ssd.CurrentValue[:])
+		tempstr := enc.Encode(ssd.CurrentValue[:])
 		cvstr = &tempstr
 	}
 	if ssd.NewValue != nil {
-		tempstr := HexToPrefixedString(ssd.NewValue[:])
+		tempstr := enc.Encode(ssd.NewValue[:])
 		nvstr = &tempstr
 	}
 	return json.Marshal(&suffixStateDiffMarshaller{
@@ -236,6 +392,10 @@ func (ssd SuffixStateDiff) MarshalJSON() ([]byte, error) {
 }
 
 func (ssd *SuffixStateDiff) UnmarshalJSON(data []byte) error {
+	return ssd.unmarshalJSON(data, HexEncoding{})
+}
+
+func (ssd *SuffixStateDiff) unmarshalJSON(data []byte, enc HexEncoding) error {
 	aux := &suffixStateDiffMarshaller{}
 
 	if err := json.Unmarshal(data, &aux); err != nil {
@@ -251,7 +411,7 @@ func (ssd *SuffixStateDiff) UnmarshalJSON(data []byte) error {
 	}
 
 	if aux.CurrentValue != nil && len(*aux.CurrentValue) != 0 {
-		currentValueBytes, err := PrefixedHexStringToBytes(*aux.CurrentValue)
+		currentValueBytes, err := enc.Decode(*aux.CurrentValue, 32)
 		if err != nil {
 			return fmt.Errorf("error decoding hex string for current value: %v", err)
 		}
@@ -261,7 +421,7 @@ func (ssd *SuffixStateDiff) UnmarshalJSON(data []byte) error {
 	}
 
 	if aux.NewValue != nil && len(*aux.NewValue) != 0 {
-		newValueBytes, err := PrefixedHexStringToBytes(*aux.NewValue)
+		newValueBytes, err := enc.Decode(*aux.NewValue, 32)
 		if err != nil {
 			return fmt.Errorf("error decoding hex string for current value: %v", err)
 		}
@@ -272,3 +432,199 @@ func (ssd *SuffixStateDiff) UnmarshalJSON(data []byte) error {
 
 	return nil
 }
+
+// JSONNaming selects the field names used by MarshalProofJSON and
+// UnmarshalProofJSON. Only the names differ: values are encoded the
+// same way in both cases.
+type JSONNaming int
+
+const (
+	// CamelCaseNaming is the naming of the execution-layer JSON, as
+	// exchanged between clients on the devnets: verkleProof, stateDiff,
+	// suffixDiffs, newValue... This is also what the MarshalJSON methods
+	// of the proof types produce.
+	CamelCaseNaming JSONNaming = iota
+
+	// SnakeCaseNaming is the naming of the consensus-spec containers:
+	// verkle_proof, state_diff, suffix_diffs, new_value...
+	SnakeCaseNaming
+)
+
+// proofJSON is the envelope in which proofs and state diffs travel
+// together on the devnets. Its fields are encoded separately, with the
+// requested hex encoding.
+type proofJSON struct {
+	StateDiff   json.RawMessage `json:"stateDiff"`
+	VerkleProof json.RawMessage `json:"verkleProof"`
+}
+
+// MarshalProofJSON encodes a proof and its state diff in the
+// {"stateDiff": ..., "verkleProof": ...} envelope, with the field names
+// of the requested naming and the canonical hex encoding, see
+// HexEncoding.MarshalProofJSON for other encodings.
+func MarshalProofJSON(vp *VerkleProof, sd StateDiff, naming JSONNaming) ([]byte, error) {
+	return HexEncoding{}.MarshalProofJSON(vp, sd, naming)
+}
+
+// MarshalProofJSON is the package-level MarshalProofJSON, writing the
+// byte strings with enc.
+func (enc HexEncoding) MarshalProofJSON(vp *VerkleProof, sd StateDiff, naming JSONNaming) ([]byte, error) {
+	if vp == nil {
+		return nil, errors.New("nil verkle proof")
+	}
+	var (
+		aux proofJSON
+		err error
+	)
+	if aux.StateDiff, err = marshalStateDiffJSON(sd, enc); err != nil {
+		return nil, err
+	}
+	if aux.VerkleProof, err = vp.marshalJSON(enc); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(&aux)
+	if err != nil {
+		return nil, err
+	}
+	switch naming {
+	case CamelCaseNaming:
+		return encoded, nil
+	case SnakeCaseNaming:
+		return renameJSONKeys(encoded, camelToSnake)
+	default:
+		return nil, fmt.Errorf("unknown JSON naming %d", naming)
+	}
+}
+
+// UnmarshalProofJSON decodes an envelope produced by MarshalProofJSON
+// with the same naming, accepting any hex encoding that isn't strict.
+func UnmarshalProofJSON(data []byte, naming JSONNaming) (*VerkleProof, StateDiff, error) {
+	return HexEncoding{}.UnmarshalProofJSON(data, naming)
+}
+
+// UnmarshalProofJSON is the package-level UnmarshalProofJSON, reading
+// the byte strings with enc, e.g. to reject non-canonical inputs in
+// strict mode.
+func (enc HexEncoding) UnmarshalProofJSON(data []byte, naming JSONNaming) (*VerkleProof, StateDiff, error) {
+	switch naming {
+	case CamelCaseNaming:
+	case SnakeCaseNaming:
+		var err error
+		if data, err = renameJSONKeys(data, snakeToCamel); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown JSON naming %d", naming)
+	}
+	var aux proofJSON
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return nil, nil, err
+	}
+	if isJSONNull(aux.VerkleProof) {
+		return nil, nil, errors.New("missing verkle proof")
+	}
+	var vp VerkleProof
+	if err := vp.unmarshalJSON(aux.VerkleProof, enc); err != nil {
+		return nil, nil, err
+	}
+	var sd StateDiff
+	if !isJSONNull(aux.StateDiff) {
+		var err error
+		if sd, err = unmarshalStateDiffJSON(aux.StateDiff, enc); err != nil {
+			return nil, nil, err
+		}
+	}
+	return &vp, sd, nil
+}
+
+func camelToSnake(name string) string {
+	var sb strings.Builder
+	for _, r := range name {
+		if unicode.IsUpper(r) {
+			sb.WriteByte('_')
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func snakeToCamel(name string) string {
+	var (
+		sb    strings.Builder
+		upper bool
+	)
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// renameJSONKeys re-encodes a JSON document, passing every object key
+// through rename. Unlike a round-trip through a map, the order of the
+// fields is preserved.
+func renameJSONKeys(data []byte, rename func(string) string) ([]byte, error) {
+	type frame struct {
+		object bool
+		tokens int
+	}
+	var (
+		dec   = json.NewDecoder(bytes.NewReader(data))
+		out   bytes.Buffer
+		stack []frame
+	)
+	dec.UseNumber()
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if delim, ok := tok.(json.Delim); ok && (delim == '}' || delim == ']') {
+			out.WriteByte(byte(delim))
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		// Separate the token from the previous one in the enclosing
+		// container, and rename it if it is an object key.
+		isKey := false
+		if len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if top.tokens > 0 {
+				if top.object && top.tokens%2 == 1 {
+					out.WriteByte(':')
+				} else {
+					out.WriteByte(',')
+				}
+			}
+			isKey = top.object && top.tokens%2 == 0
+			top.tokens++
+		}
+
+		if delim, ok := tok.(json.Delim); ok {
+			out.WriteByte(byte(delim))
+			stack = append(stack, frame{object: delim == '{'})
+			continue
+		}
+		if isKey {
+			tok = rename(tok.(string))
+		}
+		encoded, err := json.Marshal(tok)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(encoded)
+	}
+	return out.Bytes(), nil
+}
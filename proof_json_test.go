@@ -1,7 +1,10 @@
 package verkle
 
 import (
+	"bytes"
 	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -22,3 +25,177 @@ func TestJSONDeserialization(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestProofJSONNaming(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, oneKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		naming  JSONNaming
+		present []string
+		absent  []string
+	}{
+		{CamelCaseNaming, []string{`"verkleProof":`, `"stateDiff":`, `"suffixDiffs":`, `"newValue":`, `"ipaProof":`, `"finalEvaluation":`}, []string{`_`}},
+		{SnakeCaseNaming, []string{`"verkle_proof":`, `"state_diff":`, `"suffix_diffs":`, `"new_value":`, `"ipa_proof":`, `"final_evaluation":`}, []string{`"verkleProof"`, `"newValue"`}},
+	} {
+		encoded, err := MarshalProofJSON(vp, sd, tc.naming)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range tc.present {
+			if !bytes.Contains(encoded, []byte(name)) {
+				t.Errorf("naming %d: missing %s in %s", tc.naming, name, encoded)
+			}
+		}
+		for _, name := range tc.absent {
+			if bytes.Contains(encoded, []byte(name)) {
+				t.Errorf("naming %d: unexpected %s in %s", tc.naming, name, encoded)
+			}
+		}
+		if !json.Valid(encoded) {
+			t.Fatalf("naming %d: invalid JSON %s", tc.naming, encoded)
+		}
+
+		gotVP, gotSD, err := UnmarshalProofJSON(encoded, tc.naming)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(gotVP, vp) || !reflect.DeepEqual(gotSD, sd) {
+			t.Fatalf("naming %d: proof didn't survive the round trip", tc.naming)
+		}
+	}
+
+	// The camel case envelope is what the MarshalJSON methods produce
+	encoded, err := json.Marshal(struct {
+		StateDiff   StateDiff    `json:"stateDiff"`
+		VerkleProof *VerkleProof `json:"verkleProof"`
+	}{sd, vp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	camel, _ := MarshalProofJSON(vp, sd, CamelCaseNaming)
+	if !bytes.Equal(encoded, camel) {
+		t.Fatalf("camel case naming differs from the default encoding:\n%s\n%s", camel, encoded)
+	}
+}
+
+func TestHexEncoding(t *testing.T) {
+	t.Parallel()
+
+	data := []byte{0xab, 0x01, 0xcd}
+	for _, tc := range []struct {
+		enc  HexEncoding
+		want string
+	}{
+		{HexEncoding{}, "0xab01cd"},
+		{HexEncoding{Uppercase: true}, "0xAB01CD"},
+		{HexEncoding{OmitPrefix: true}, "ab01cd"},
+	} {
+		if got := tc.enc.Encode(data); got != tc.want {
+			t.Errorf("%+v: got %s, want %s", tc.enc, got, tc.want)
+		}
+		// Strict mode accepts what the policy produces
+		tc.enc.Strict = true
+		decoded, err := tc.enc.Decode(tc.want, len(data))
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("%+v: could not decode %s: %v", tc.enc, tc.want, err)
+		}
+	}
+
+	strict := HexEncoding{Strict: true}
+	for _, input := range []string{"0xAb01cd", "0xAB01CD", "ab01cd", "0xab01c", "0xab01", "0Xab01cd"} {
+		if _, err := strict.Decode(input, len(data)); err == nil {
+			t.Errorf("strict mode accepted %s", input)
+		}
+	}
+	for _, input := range []string{"0xAb01cd", "ab01cd", "0Xab01cd"} {
+		if _, err := (HexEncoding{}).Decode(input, len(data)); err != nil {
+			t.Errorf("lenient mode rejected %s: %v", input, err)
+		}
+	}
+
+	// The policy applies to the JSON encoders it is passed to
+	vp, sd := proofFixture(t)
+	canonical, err := MarshalProofJSON(vp, sd, CamelCaseNaming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom := HexEncoding{Uppercase: true, OmitPrefix: true}
+	encoded, err := custom.MarshalProofJSON(vp, sd, CamelCaseNaming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encoded, []byte(`"0x`)) || !bytes.Contains(encoded, []byte(`"d":"`+custom.Encode(vp.D[:])+`"`)) {
+		t.Fatalf("policy not applied: %s", encoded)
+	}
+	if _, _, err := strict.UnmarshalProofJSON(encoded, CamelCaseNaming); err == nil {
+		t.Fatal("strict mode accepted a non-canonical proof")
+	}
+	if _, err := strict.ReadProofJSON(bytes.NewReader(encoded)); err == nil {
+		t.Fatal("strict mode accepted a non-canonical proof")
+	}
+	for _, enc := range []HexEncoding{strict, {}} {
+		decodedVP, decodedSD, err := enc.UnmarshalProofJSON(canonical, CamelCaseNaming)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decodedVP, vp) || !reflect.DeepEqual(decodedSD, sd) {
+			t.Fatal("decoded proof differs from the encoded one")
+		}
+	}
+	if _, _, err := custom.UnmarshalProofJSON(encoded, CamelCaseNaming); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProofJSONHexPrefix(t *testing.T) {
+	t.Parallel()
+
+	vp, sd := proofFixture(t)
+	encoded, err := MarshalProofJSON(vp, sd, CamelCaseNaming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields struct {
+		StateDiff []struct {
+			Stem string `json:"stem"`
+		} `json:"stateDiff"`
+		VerkleProof struct {
+			D string `json:"d"`
+		} `json:"verkleProof"`
+	}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(fields.VerkleProof.D, "0x") || !strings.HasPrefix(fields.StateDiff[0].Stem, "0x") {
+		t.Fatalf("hex strings aren't 0x-prefixed: %s", encoded)
+	}
+
+	// Unprefixed input, as produced by older encoders, is still accepted.
+	unprefixed := bytes.ReplaceAll(encoded, []byte(`"0x`), []byte(`"`))
+	for _, input := range [][]byte{encoded, unprefixed} {
+		dvp, dsd, err := UnmarshalProofJSON(input, CamelCaseNaming)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !dvp.Equal(vp) || !dsd.Equal(sd) {
+			t.Fatalf("decoding %s changed the proof", input)
+		}
+	}
+}
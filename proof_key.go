@@ -0,0 +1,157 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ProveKey proves the value of a single key in root, for light clients
+// checking one lookup at a time. It returns the serialized proof, along
+// with the value of key, nil if it is absent. Both have to be sent to the
+// client, which checks them with VerifyKey.
+func ProveKey(root VerkleNode, key []byte, resolver NodeResolverFn) (*VerkleProof, []byte, error) {
+	if len(key) != StemSize+1 {
+		return nil, nil, fmt.Errorf("invalid key length, expected %d, got %d", StemSize+1, len(key))
+	}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{key}, resolver)
+	if err != nil {
+		return nil, nil, err
+	}
+	vp, _, err := SerializeProof(proof)
+	if err != nil {
+		return nil, nil, err
+	}
+	return vp, proof.PreValues[0], nil
+}
+
+// VerifyKey checks a proof made by ProveKey: that key has the given value,
+// or is absent if value is empty, in the tree whose serialized root
+// commitment is rootCommitment. Since the value isn't part of the proof,
+// any other value fails verification.
+func VerifyKey(rootCommitment []byte, key, value []byte, proof *VerkleProof) error {
+	if len(key) != StemSize+1 {
+		return fmt.Errorf("invalid key length, expected %d, got %d", StemSize+1, len(key))
+	}
+	if proof == nil {
+		return errors.New("no proof provided")
+	}
+	stemdiff := StemStateDiff{SuffixDiffs: []SuffixStateDiff{{}}}
+	copy(stemdiff.Stem[:], key[:StemSize])
+	if err := serializeSuffixDiff(&stemdiff.SuffixDiffs[0], key, value, nil); err != nil {
+		return err
+	}
+	return VerifySerializedProof(proof, StateDiff{stemdiff}, rootCommitment)
+}
+
+// ProveStem proves the values of all the suffixes of stem in root, e.g.
+// a complete account header or a range of code chunks, in one witness
+// opening C1 and C2 fully, instead of making one proof per key. It
+// returns the serialized proof, along with the NodeWidth values of stem,
+// nil for the absent ones. Both have to be sent to the client, which
+// checks them with VerifyStem.
+func ProveStem(root VerkleNode, stem []byte, resolver NodeResolverFn) (*VerkleProof, [][]byte, error) {
+	if len(stem) != StemSize {
+		return nil, nil, fmt.Errorf("invalid stem length, expected %d, got %d", StemSize, len(stem))
+	}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, stemKeys(stem), resolver)
+	if err != nil {
+		return nil, nil, err
+	}
+	vp, _, err := SerializeProof(proof)
+	if err != nil {
+		return nil, nil, err
+	}
+	return vp, proof.PreValues, nil
+}
+
+// VerifyStem checks a proof made by ProveStem: that the suffixes of stem
+// have the given values, a nil value meaning that the suffix is absent,
+// in the tree whose serialized root commitment is rootCommitment.
+func VerifyStem(rootCommitment []byte, stem []byte, values [][]byte, proof *VerkleProof) error {
+	if len(stem) != StemSize {
+		return fmt.Errorf("invalid stem length, expected %d, got %d", StemSize, len(stem))
+	}
+	if len(values) != NodeWidth {
+		return fmt.Errorf("invalid number of values, expected %d, got %d", NodeWidth, len(values))
+	}
+	if proof == nil {
+		return errors.New("no proof provided")
+	}
+	stemdiff := StemStateDiff{SuffixDiffs: make([]SuffixStateDiff, NodeWidth)}
+	copy(stemdiff.Stem[:], stem)
+	for i, key := range stemKeys(stem) {
+		if err := serializeSuffixDiff(&stemdiff.SuffixDiffs[i], key, values[i], nil); err != nil {
+			return err
+		}
+	}
+	return VerifySerializedProof(proof, StateDiff{stemdiff}, rootCommitment)
+}
+
+// stemKeys returns the NodeWidth keys of stem, by order of suffix.
+func stemKeys(stem []byte) [][]byte {
+	keys := make([][]byte, NodeWidth)
+	for i := range keys {
+		keys[i] = append(stem[:StemSize:StemSize], byte(i))
+	}
+	return keys
+}
+
+// ProveAbsence proves that stem isn't in root, e.g. that an account
+// doesn't exist. The witness only opens the nodes along the path of stem,
+// and the leaf of the other stem found at its end, if any, whose stem is
+// then the only one in OtherStems. It returns an error if stem is in the
+// tree.
+func ProveAbsence(root VerkleNode, stem []byte, resolver NodeResolverFn) (*VerkleProof, error) {
+	if len(stem) != StemSize {
+		return nil, fmt.Errorf("invalid stem length, expected %d, got %d", StemSize, len(stem))
+	}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{append(stem[:StemSize:StemSize], 0)}, resolver)
+	if err != nil {
+		return nil, err
+	}
+	if proof.ExtStatus[0]&3 == extStatusPresent {
+		return nil, fmt.Errorf("stem %x is present in the tree", stem)
+	}
+	vp, _, err := SerializeProof(proof)
+	return vp, err
+}
+
+// VerifyAbsence checks a proof made by ProveAbsence: that stem isn't in
+// the tree whose serialized root commitment is rootCommitment.
+func VerifyAbsence(rootCommitment []byte, stem []byte, proof *VerkleProof) error {
+	if len(stem) != StemSize {
+		return fmt.Errorf("invalid stem length, expected %d, got %d", StemSize, len(stem))
+	}
+	if proof == nil {
+		return errors.New("no proof provided")
+	}
+	if len(proof.DepthExtensionPresent) != 1 || proof.DepthExtensionPresent[0]&3 == extStatusPresent {
+		return fmt.Errorf("%w: stem %x isn't proven absent", ErrProofInvalid, stem)
+	}
+	return VerifyKey(rootCommitment, append(stem[:StemSize:StemSize], 0), nil, proof)
+}
@@ -0,0 +1,133 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestProveKey(t *testing.T) {
+	t.Parallel()
+
+	root, resolver := flushedTree(t, nil, []keyValue{{zeroKeyTest, fourtyKeyTest}, {ffx32KeyTest, fourtyKeyTest}})
+	rootBytes := root.Commitment().Bytes()
+
+	absentKey := append([]byte{}, zeroKeyTest...)
+	absentKey[5] = 1
+	for _, key := range [][]byte{zeroKeyTest, oneKeyTest, absentKey, forkOneKeyTest} {
+		vp, value, err := ProveKey(root, key, resolver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyKey(rootBytes[:], key, value, vp); err != nil {
+			t.Fatalf("key %x: %v", key, err)
+		}
+		if err := VerifyKey(rootBytes[:], key, zeroKeyTest, vp); err == nil {
+			t.Fatalf("key %x: a wrong value should not verify", key)
+		}
+		// A proof of absence of a stem holds for all its suffixes
+		other := append([]byte{}, key...)
+		other[StemSize] ^= 0x80
+		if err := VerifyKey(rootBytes[:], other, value, vp); value != nil && err == nil {
+			t.Fatalf("key %x: the proof should not verify another key", key)
+		}
+	}
+
+	vp, value, err := ProveKey(root, zeroKeyTest, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRoot := New().Commit().Bytes()
+	if err := VerifyKey(otherRoot[:], zeroKeyTest, value, vp); err == nil {
+		t.Fatal("the proof should not verify against another root")
+	}
+	if _, _, err := ProveKey(root, zeroKeyTest[:StemSize], resolver); err == nil {
+		t.Fatal("invalid key should be rejected")
+	}
+}
+
+func TestProveStem(t *testing.T) {
+	t.Parallel()
+
+	root, resolver := flushedTree(t, nil, []keyValue{{zeroKeyTest, fourtyKeyTest}, {oneKeyTest, ffx32KeyTest}, {ffx32KeyTest, fourtyKeyTest}})
+	rootBytes := root.Commitment().Bytes()
+
+	for _, stem := range [][]byte{zeroKeyTest[:StemSize], ffx32KeyTest[:StemSize], forkOneKeyTest[:StemSize]} {
+		vp, values, err := ProveStem(root, stem, resolver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(values) != NodeWidth {
+			t.Fatalf("stem %x: got %d values", stem, len(values))
+		}
+		if err := VerifyStem(rootBytes[:], stem, values, vp); err != nil {
+			t.Fatalf("stem %x: %v", stem, err)
+		}
+
+		// Changing any value, or setting an absent one, fails
+		for _, suffix := range []int{0, 1, 2, 255} {
+			tampered := append([][]byte{}, values...)
+			if tampered[suffix] == nil {
+				tampered[suffix] = fourtyKeyTest
+			} else {
+				tampered[suffix] = nil
+			}
+			if err := VerifyStem(rootBytes[:], stem, tampered, vp); err == nil {
+				t.Fatalf("stem %x: tampered value at suffix %d should not verify", stem, suffix)
+			}
+		}
+	}
+
+	vp, values, err := ProveStem(root, zeroKeyTest[:StemSize], resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(values[0], fourtyKeyTest) || !bytes.Equal(values[1], ffx32KeyTest) || values[2] != nil {
+		t.Fatalf("invalid values %x", values[:3])
+	}
+	if err := VerifyStem(rootBytes[:], zeroKeyTest[:StemSize], values[:1], vp); err == nil {
+		t.Fatal("an incomplete list of values should be rejected")
+	}
+	if err := VerifyStem(rootBytes[:], ffx32KeyTest[:StemSize], values, vp); err == nil {
+		t.Fatal("the proof should not verify another stem")
+	}
+}
+
+func TestProveAbsence(t *testing.T) {
+	t.Parallel()
+
+	root, resolver := flushedTree(t, nil, []keyValue{{zeroKeyTest, fourtyKeyTest}, {ffx32KeyTest, fourtyKeyTest}})
+	rootBytes := root.Commitment().Bytes()
+
+	// The path of the first stem leads to the zero stem, that of the
+	// second one to an empty child.
+	absentStem := append([]byte{}, zeroKeyTest[:StemSize]...)
+	absentStem[5] = 1
+	for _, stem := range [][]byte{absentStem, forkOneKeyTest[:StemSize]} {
+		vp, err := ProveAbsence(root, stem, resolver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyAbsence(rootBytes[:], stem, vp); err != nil {
+			t.Fatalf("stem %x: %v", stem, err)
+		}
+		if len(vp.CommitmentsByPath) > 1 || len(vp.OtherStems) > 1 {
+			t.Fatalf("stem %x: witness isn't minimal: %d commitments, %d other stems", stem, len(vp.CommitmentsByPath), len(vp.OtherStems))
+		}
+		if err := VerifyAbsence(rootBytes[:], zeroKeyTest[:StemSize], vp); err == nil {
+			t.Fatalf("stem %x: the proof should not verify the absence of another stem", stem)
+		}
+	}
+
+	if _, err := ProveAbsence(root, zeroKeyTest[:StemSize], resolver); err == nil {
+		t.Fatal("proving the absence of a present stem should fail")
+	}
+	// A proof for an absent key of a present stem isn't a proof of
+	// absence of the stem.
+	vp, _, err := ProveKey(root, oneKeyTest, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAbsence(rootBytes[:], zeroKeyTest[:StemSize], vp); err == nil {
+		t.Fatal("a present stem should not be proven absent")
+	}
+}
@@ -0,0 +1,173 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ProveRange proves the list of stems of root in [start, end], e.g. to
+// serve a range of the state during a sync: the witness opens all the
+// children of the internal nodes covering the range, so that a stem
+// can't be left out, as well as whatever is found along the paths of
+// start and end, which proves their absence if they aren't in the tree.
+// The value of the first suffix of each stem is included. The proof and
+// the state diff have to be sent to the client, which gets the stems by
+// checking them with VerifyRange.
+func ProveRange(root VerkleNode, start, end []byte, resolver NodeResolverFn) (*VerkleProof, StateDiff, error) {
+	if err := checkStemRange(start, end); err != nil {
+		return nil, nil, err
+	}
+	rootNode, ok := root.(*InternalNode)
+	if !ok {
+		return nil, nil, errors.New("range proofs can only be made from an internal node")
+	}
+	var keys [][]byte
+	visit := func(stem []byte, _ *LeafNode) {
+		keys = append(keys, append(stem[:StemSize:StemSize], 0))
+	}
+	if err := rootNode.walkRange(nil, start, end, true, true, resolver, visit); err != nil {
+		return nil, nil, err
+	}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, keys, resolver)
+	if err != nil {
+		return nil, nil, err
+	}
+	return SerializeProof(proof)
+}
+
+// VerifyRange checks a proof made by ProveRange against the serialized
+// root commitment rootCommitment, and returns the stems of the tree in
+// [start, end], in increasing order. It fails if the proof doesn't tell
+// what all of the range holds.
+func VerifyRange(rootCommitment []byte, start, end []byte, proof *VerkleProof, statediff StateDiff) ([][]byte, error) {
+	if err := checkStemRange(start, end); err != nil {
+		return nil, err
+	}
+	if len(rootCommitment) != 32 {
+		return nil, fmt.Errorf("invalid root commitment size %d", len(rootCommitment))
+	}
+	var rootBytes [32]byte
+	copy(rootBytes[:], rootCommitment)
+
+	p, err := DecodeProof(proof, statediff)
+	if err != nil {
+		return nil, fmt.Errorf("deserializing proof: %w", err)
+	}
+	pretree, err := PreStateTreeFromRoot(p, rootBytes)
+	if err != nil {
+		return nil, fmt.Errorf("rebuilding pre-state tree: %w", err)
+	}
+	if err := VerifyVerkleProofWithPreState(p, pretree); err != nil {
+		return nil, err
+	}
+
+	var stems [][]byte
+	visit := func(stem []byte, leaf *LeafNode) {
+		if leaf != nil && bytes.Compare(stem, start) >= 0 && bytes.Compare(stem, end) <= 0 {
+			stems = append(stems, append([]byte{}, stem...))
+		}
+	}
+	if err := pretree.(*InternalNode).walkRange(nil, start, end, true, true, nil, visit); err != nil {
+		if errors.Is(err, ErrMissingNodeInStateless) {
+			return nil, fmt.Errorf("%w: range %x-%x isn't fully covered: %v", ErrProofInvalid, start, end, err)
+		}
+		return nil, err
+	}
+	return stems, nil
+}
+
+func checkStemRange(start, end []byte) error {
+	if len(start) != StemSize || len(end) != StemSize {
+		return fmt.Errorf("invalid stem range %x-%x, stems are %d bytes long", start, end, StemSize)
+	}
+	if bytes.Compare(start, end) > 0 {
+		return fmt.Errorf("invalid stem range %x-%x, start is after end", start, end)
+	}
+	return nil
+}
+
+// walkRange calls visit, in increasing order, for each child of the
+// subtree of n, found at path, that overlaps [start, end]: leaves are
+// visited with their stem, and empty children with a stem whose path
+// leads to them. left and right tell if path is that of start and end,
+// respectively, so that only the children after start and before end
+// are visited. Leaves at the boundary may be outside the range.
+func (n *InternalNode) walkRange(path, start, end []byte, left, right bool, resolver NodeResolverFn, visit func(stem []byte, leaf *LeafNode)) error {
+	first, last := 0, NodeWidth-1
+	if left {
+		first = int(start[n.depth])
+	}
+	if right {
+		last = int(end[n.depth])
+	}
+	for i := first; i <= last; i++ {
+		childpath := append(path[:len(path):len(path)], byte(i))
+		child := n.children[i]
+		if _, ok := child.(HashedNode); ok {
+			if resolver == nil {
+				return fmt.Errorf("walking path %x: %w", childpath, ErrReadFromInvalid)
+			}
+			serialized, err := resolveNode(resolver, childpath)
+			if err != nil {
+				return err
+			}
+			if child, err = n.parseChild(byte(i), serialized, childpath); err != nil {
+				return err
+			}
+			n.children[i] = child
+		}
+
+		switch c := child.(type) {
+		case Empty:
+			// Any stem leading to the empty child will do, use the
+			// boundaries when they do.
+			stem := make([]byte, StemSize)
+			switch {
+			case left && i == first:
+				copy(stem, start)
+			case right && i == last:
+				copy(stem, end)
+			default:
+				copy(stem, childpath)
+			}
+			visit(stem, nil)
+		case *LeafNode:
+			visit(c.stem, c)
+		case *InternalNode:
+			if err := c.walkRange(childpath, start, end, left && i == first, right && i == last, resolver, visit); err != nil {
+				return err
+			}
+		case UnknownNode:
+			return fmt.Errorf("walking path %x: %w", childpath, ErrMissingNodeInStateless)
+		default:
+			return fmt.Errorf("walking path %x: %w", childpath, ErrUnknownNodeType)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package verkle
+
+import (
+	"bytes"
+	mRand "math/rand"
+	"sort"
+	"testing"
+)
+
+func TestProveRange(t *testing.T) {
+	t.Parallel()
+
+	kvs := genRandomKeyValues(mRand.New(mRand.NewSource(42)), 20) //skipcq: GSC-G404
+	kvs = append(kvs, keyValue{zeroKeyTest, fourtyKeyTest}, keyValue{ffx32KeyTest, fourtyKeyTest})
+	root, resolver := flushedTree(t, nil, kvs)
+	rootBytes := root.Commitment().Bytes()
+
+	var stems [][]byte
+	for _, kv := range kvs {
+		stems = append(stems, kv.key[:StemSize])
+	}
+	sort.Slice(stems, func(i, j int) bool { return bytes.Compare(stems[i], stems[j]) < 0 })
+
+	// Boundaries that aren't in the tree
+	after := append([]byte{}, stems[3]...)
+	after[StemSize-1]++
+	before := append([]byte{}, stems[8]...)
+	before[StemSize-1]--
+
+	for _, r := range [][2][]byte{
+		{stems[0], stems[len(stems)-1]},
+		{stems[3], stems[8]},
+		{after, before},
+		{after, after},
+	} {
+		start, end := r[0], r[1]
+		vp, sd, err := ProveRange(root, start, end, resolver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := VerifyRange(rootBytes[:], start, end, vp, sd)
+		if err != nil {
+			t.Fatalf("range %x-%x: %v", start, end, err)
+		}
+		var want [][]byte
+		for _, stem := range stems {
+			if bytes.Compare(stem, start) >= 0 && bytes.Compare(stem, end) <= 0 {
+				want = append(want, stem)
+			}
+		}
+		if !equalByteSlices(got, want) {
+			t.Fatalf("range %x-%x: got stems %x, want %x", start, end, got, want)
+		}
+	}
+
+	// A proof for a range doesn't cover a wider one
+	vp, sd, err := ProveRange(root, stems[3], stems[8], resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyRange(rootBytes[:], stems[2], stems[8], vp, sd); err == nil {
+		t.Fatal("a range that isn't fully proven should be rejected")
+	}
+	otherRoot := New().Commit().Bytes()
+	if _, err := VerifyRange(otherRoot[:], stems[3], stems[8], vp, sd); err == nil {
+		t.Fatal("the proof should not verify against another root")
+	}
+
+	// A proof leaving out one of the stems isn't a range proof
+	var keys [][]byte
+	for _, stem := range stems[3:9] {
+		if !bytes.Equal(stem, stems[5]) {
+			keys = append(keys, append(append([]byte{}, stem...), 0))
+		}
+	}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, keys, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vp, sd, err = SerializeProof(proof); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyRange(rootBytes[:], stems[3], stems[8], vp, sd); err == nil {
+		t.Fatal("a proof missing a stem should be rejected")
+	}
+
+	if _, _, err := ProveRange(root, stems[8], stems[3], resolver); err == nil {
+		t.Fatal("a reversed range should be rejected")
+	}
+}
@@ -0,0 +1,206 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// rustMultiproofSize is the size of a serialized rust-verkle multipoint
+// proof: D, followed by the L and R vectors of the IPA proof and its
+// final evaluation.
+const rustMultiproofSize = 32 + 2*IPA_PROOF_DEPTH*32 + 32
+
+// ParseRustProof decodes a proof in the raw binary format produced by
+// rust-verkle, i.e.:
+// * len(Proof of absence stems) || Proof of absence stems
+// * len(depths) || serialize(depth || ext status)
+// * len(commitments) || serialize(commitment)
+// * D || L || R || final evaluation
+// where lengths are 4-byte little-endian integers, and the final
+// evaluation is a little-endian scalar. Since rust-verkle doesn't include
+// the keys and values in this serialization, the proof has to be paired
+// with its StateDiff, see DeserializeRustProof.
+func ParseRustProof(serialized []byte) (*VerkleProof, error) {
+	var (
+		vp     = &VerkleProof{IPAProof: &IPAProof{}}
+		offset int
+	)
+
+	// readLen reads a length prefix, and checks that there are enough
+	// bytes left for that many items of the given size.
+	readLen := func(what string, size int) (int, error) {
+		if len(serialized)-offset < 4 {
+			return 0, fmt.Errorf("reading number of %s: unexpected end of proof", what)
+		}
+		n := binary.LittleEndian.Uint32(serialized[offset:])
+		offset += 4
+		if uint64(n)*uint64(size) > uint64(len(serialized)-offset) {
+			return 0, fmt.Errorf("proof is too short for %d %s", n, what)
+		}
+		return int(n), nil
+	}
+
+	n, err := readLen("proof of absence stems", StemSize)
+	if err != nil {
+		return nil, err
+	}
+	vp.OtherStems = make([][StemSize]byte, n)
+	for i := range vp.OtherStems {
+		offset += copy(vp.OtherStems[i][:], serialized[offset:offset+StemSize])
+	}
+
+	n, err = readLen("extension statuses", 1)
+	if err != nil {
+		return nil, err
+	}
+	vp.DepthExtensionPresent = make([]byte, n)
+	offset += copy(vp.DepthExtensionPresent, serialized[offset:offset+n])
+	if err := checkExtStatuses(vp.DepthExtensionPresent); err != nil {
+		return nil, err
+	}
+
+	n, err = readLen("commitments", 32)
+	if err != nil {
+		return nil, err
+	}
+	vp.CommitmentsByPath = make([][32]byte, n)
+	for i := range vp.CommitmentsByPath {
+		offset += copy(vp.CommitmentsByPath[i][:], serialized[offset:offset+32])
+	}
+
+	if len(serialized)-offset != rustMultiproofSize {
+		return nil, fmt.Errorf("invalid multipoint proof size %d, expected %d", len(serialized)-offset, rustMultiproofSize)
+	}
+	offset += copy(vp.D[:], serialized[offset:offset+32])
+	for i := range vp.IPAProof.CL {
+		offset += copy(vp.IPAProof.CL[i][:], serialized[offset:offset+32])
+	}
+	for i := range vp.IPAProof.CR {
+		offset += copy(vp.IPAProof.CR[i][:], serialized[offset:offset+32])
+	}
+	if err := setRustFinalEvaluation(&vp.IPAProof.FinalEvaluation, serialized[offset:]); err != nil {
+		return nil, err
+	}
+
+	return vp, nil
+}
+
+func checkExtStatuses(statuses []byte) error {
+	for i, es := range statuses {
+		if _, status := DecodeExtStatus(es); status > ExtStatusPresent {
+			return fmt.Errorf("invalid extension status %d at index %d", status, i)
+		}
+	}
+	return nil
+}
+
+// setRustFinalEvaluation sets dst to the final evaluation serialized in
+// le. It is stored in little-endian order by rust-verkle, and in
+// big-endian order in a VerkleProof.
+func setRustFinalEvaluation(dst *[32]byte, le []byte) error {
+	for i := range dst {
+		dst[i] = le[31-i]
+	}
+	var a Fr
+	a.SetBytes(dst[:])
+	if a.Bytes() != *dst {
+		return errors.New("non-canonical final evaluation")
+	}
+	return nil
+}
+
+// Serialize encodes the proof in the rust-verkle binary format described
+// in ParseRustProof, which is the format used in block bodies. vp must
+// have an IPA proof. Like in rust-verkle, the keys and values are not
+// part of the encoding.
+func (vp *VerkleProof) Serialize() []byte {
+	var out bytes.Buffer
+	out.Grow(3*4 + len(vp.OtherStems)*StemSize + len(vp.DepthExtensionPresent) + len(vp.CommitmentsByPath)*32 + rustMultiproofSize)
+	vp.encode(&out)
+	return out.Bytes()
+}
+
+// proofWriter is implemented by bytes.Buffer and bufio.Writer, which
+// both keep the write errors for later, if any.
+type proofWriter interface {
+	io.Writer
+	io.ByteWriter
+}
+
+// encode writes the encoding of Serialize to w, which is shared with
+// WriteTo. Write errors are left to w.
+func (vp *VerkleProof) encode(w proofWriter) {
+	var buf [4]byte
+	writeLen := func(n int) {
+		binary.LittleEndian.PutUint32(buf[:], uint32(n))
+		w.Write(buf[:])
+	}
+	writeLen(len(vp.OtherStems))
+	for i := range vp.OtherStems {
+		w.Write(vp.OtherStems[i][:])
+	}
+	writeLen(len(vp.DepthExtensionPresent))
+	w.Write(vp.DepthExtensionPresent)
+	writeLen(len(vp.CommitmentsByPath))
+	for i := range vp.CommitmentsByPath {
+		w.Write(vp.CommitmentsByPath[i][:])
+	}
+
+	w.Write(vp.D[:])
+	for i := range vp.IPAProof.CL {
+		w.Write(vp.IPAProof.CL[i][:])
+	}
+	for i := range vp.IPAProof.CR {
+		w.Write(vp.IPAProof.CR[i][:])
+	}
+	for i := range vp.IPAProof.FinalEvaluation {
+		w.WriteByte(vp.IPAProof.FinalEvaluation[31-i])
+	}
+}
+
+// ParseVerkleProof decodes a proof encoded with VerkleProof.Serialize.
+// It is the same format as the one produced by rust-verkle, see
+// ParseRustProof.
+func ParseVerkleProof(serialized []byte) (*VerkleProof, error) {
+	return ParseRustProof(serialized)
+}
+
+// DeserializeRustProof decodes a proof serialized by rust-verkle, and
+// pairs it with the keys and values of statediff. The result can be
+// verified or used to rebuild the pre-state tree, like the output of
+// DeserializeProof.
+func DeserializeRustProof(serialized []byte, statediff StateDiff) (*Proof, error) {
+	vp, err := ParseRustProof(serialized)
+	if err != nil {
+		return nil, err
+	}
+	return DeserializeProof(vp, statediff)
+}
@@ -0,0 +1,122 @@
+package verkle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// rustProofBytes serializes vp the way rust-verkle does.
+func rustProofBytes(vp *VerkleProof) []byte {
+	var out []byte
+	out = appendUint32LE(out, uint32(len(vp.OtherStems)))
+	for _, stem := range vp.OtherStems {
+		out = append(out, stem[:]...)
+	}
+	out = appendUint32LE(out, uint32(len(vp.DepthExtensionPresent)))
+	out = append(out, vp.DepthExtensionPresent...)
+	out = appendUint32LE(out, uint32(len(vp.CommitmentsByPath)))
+	for _, c := range vp.CommitmentsByPath {
+		out = append(out, c[:]...)
+	}
+	out = append(out, vp.D[:]...)
+	for _, l := range vp.IPAProof.CL {
+		out = append(out, l[:]...)
+	}
+	for _, r := range vp.IPAProof.CR {
+		out = append(out, r[:]...)
+	}
+	for i := range vp.IPAProof.FinalEvaluation {
+		out = append(out, vp.IPAProof.FinalEvaluation[31-i])
+	}
+	return out
+}
+
+func appendUint32LE(out []byte, n uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], n)
+	return append(out, buf[:]...)
+}
+
+func TestDeserializeRustProof(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(forkOneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized := rustProofBytes(vp)
+
+	parsed, err := ParseRustProof(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Equal(vp) {
+		t.Fatal("parsed proof differs from the serialized one")
+	}
+	dproof, err := DeserializeRustProof(serialized, sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pretree, err := PreStateTreeFromProof(dproof, root.Commit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyVerkleProofWithPreState(dproof, pretree); err != nil {
+		t.Fatal(err)
+	}
+
+	badStatus := append([]byte{}, serialized...)
+	badStatus[4+StemSize*len(vp.OtherStems)+4] |= 3
+	hugeCount := append([]byte{}, serialized...)
+	binary.LittleEndian.PutUint32(hugeCount, 1<<31)
+	badScalar := append([]byte{}, serialized...)
+	for i := len(badScalar) - 32; i < len(badScalar); i++ {
+		badScalar[i] = 0xff
+	}
+	for _, tc := range []struct {
+		name, err  string
+		serialized []byte
+	}{
+		{"empty", "unexpected end", nil},
+		{"truncated", "invalid multipoint proof size", serialized[:len(serialized)-1]},
+		{"trailing bytes", "invalid multipoint proof size", append(append([]byte{}, serialized...), 0)},
+		{"invalid extension status", "invalid extension status", badStatus},
+		{"huge count", "too short", hugeCount},
+		{"non-canonical scalar", "non-canonical", badScalar},
+	} {
+		if _, err := ParseRustProof(tc.serialized); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestVerkleProofSerialize(t *testing.T) {
+	t.Parallel()
+
+	vp, _ := proofFixture(t)
+	serialized := vp.Serialize()
+	if !bytes.Equal(serialized, rustProofBytes(vp)) {
+		t.Fatal("serialized proof doesn't match the rust-verkle format")
+	}
+	parsed, err := ParseVerkleProof(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Equal(vp) {
+		t.Fatal("parsed proof differs from the serialized one")
+	}
+}
@@ -0,0 +1,140 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"errors"
+	"fmt"
+)
+
+// proofShape counts the items of a proof, without computing it.
+type proofShape struct {
+	paths     map[string]struct{} // paths of the opened commitments, root included
+	poaStems  int
+	stemDiffs StateDiff // pre-state values only
+}
+
+// EstimateProofSize returns the size of the witness that proving keys in
+// root would produce, i.e. the total size of the SSZ encodings of the
+// VerkleProof and StateDiff returned by SerializeProof. The tree is only
+// walked, no polynomial is computed and no multipoint argument is made,
+// so this is cheap enough to enforce witness size limits before proving.
+// New values only depend on the post-state, and are counted as absent.
+// keys isn't modified.
+func EstimateProofSize(root VerkleNode, keys [][]byte, resolver NodeResolverFn) (int, error) {
+	if len(keys) == 0 {
+		return 0, errors.New("no key provided for proof")
+	}
+	if err := configOf(root).checkProofKeys(len(keys)); err != nil {
+		return 0, err
+	}
+
+	sorted, err := proofKeys(append([][]byte{}, keys...))
+	if err != nil {
+		return 0, err
+	}
+	shape := &proofShape{paths: map[string]struct{}{}}
+	if err := shape.walk(root, sorted, resolver); err != nil {
+		return 0, fmt.Errorf("walking the tree: %w", err)
+	}
+
+	// The root commitment isn't part of the proof.
+	vp := &VerkleProof{
+		OtherStems:            make([][StemSize]byte, shape.poaStems),
+		DepthExtensionPresent: make([]byte, len(shape.stemDiffs)),
+		CommitmentsByPath:     make([][32]byte, len(shape.paths)-1),
+		IPAProof:              &IPAProof{},
+	}
+	return vp.SizeSSZ() + shape.stemDiffs.SizeSSZ(), nil
+}
+
+func (shape *proofShape) walk(node VerkleNode, keys keylist, resolver NodeResolverFn) error {
+	switch n := node.(type) {
+	case *InternalNode:
+		// Like in a proof, the commitments of all children are
+		// needed, and those of a stateless tree aren't all known.
+		for _, child := range n.children {
+			if _, ok := child.(UnknownNode); ok {
+				return ErrStatelessProof
+			}
+		}
+		shape.paths[string(keys[0][:n.depth])] = struct{}{}
+		for _, group := range groupKeys(keys, n.depth) {
+			child, err := n.resolveProofChild(offset2key(group[0], n.depth), group[0], resolver)
+			if err != nil {
+				return err
+			}
+			if err := shape.walk(child, group, resolver); err != nil {
+				return err
+			}
+		}
+	case *LeafNode:
+		if n.isPartial || n.isPOAStub {
+			return ErrStatelessProof
+		}
+		shape.paths[string(keys[0][:n.depth])] = struct{}{}
+		var present bool
+		for _, key := range keys {
+			if !equalPaths(n.stem, key) {
+				shape.addValue(key, nil)
+				continue
+			}
+			present = true
+			shape.paths[string(key[:n.depth])+string([]byte{2 + key[StemSize]/128})] = struct{}{}
+			shape.addValue(key, n.values[key[StemSize]])
+		}
+		// The stem of the leaf proves the absence of the others,
+		// unless it is proven itself.
+		if !present {
+			shape.poaStems++
+		}
+	case Empty:
+		for _, key := range keys {
+			shape.addValue(key, nil)
+		}
+	case UnknownNode:
+		return ErrMissingNodeInStateless
+	default:
+		return fmt.Errorf("can't prove keys in a %T", node)
+	}
+	return nil
+}
+
+// addValue adds the pre-state value of key to the state diff. Keys are
+// added in order.
+func (shape *proofShape) addValue(key, value []byte) {
+	last := len(shape.stemDiffs) - 1
+	if last < 0 || !equalPaths(shape.stemDiffs[last].Stem[:], key) {
+		shape.stemDiffs = append(shape.stemDiffs, StemStateDiff{})
+		last++
+		copy(shape.stemDiffs[last].Stem[:], key[:StemSize])
+	}
+	suffixDiff := SuffixStateDiff{Suffix: key[StemSize]}
+	if len(value) > 0 {
+		suffixDiff.CurrentValue = &[32]byte{}
+	}
+	shape.stemDiffs[last].SuffixDiffs = append(shape.stemDiffs[last].SuffixDiffs, suffixDiff)
+}
@@ -0,0 +1,55 @@
+package verkle
+
+import (
+	mRand "math/rand"
+	"testing"
+)
+
+func TestEstimateProofSize(t *testing.T) {
+	t.Parallel()
+
+	kvs := genRandomKeyValues(mRand.New(mRand.NewSource(42)), 200) //skipcq: GSC-G404
+	kvs = append(kvs, keyValue{zeroKeyTest, fourtyKeyTest}, keyValue{ffx32KeyTest, fourtyKeyTest})
+	root, resolver := flushedTree(t, nil, kvs)
+
+	absentSuffix := append([]byte{}, zeroKeyTest...)
+	absentSuffix[StemSize] = 0x80
+	absentOther := append([]byte{}, zeroKeyTest...)
+	absentOther[StemSize-1] = 1
+	for _, keys := range [][][]byte{
+		{zeroKeyTest},
+		{zeroKeyTest, oneKeyTest, absentSuffix},
+		{absentOther},
+		{absentOther, zeroKeyTest},
+		{kvs[10].key, kvs[3].key, forkOneKeyTest, ffx32KeyTest},
+		{kvs[0].key, kvs[1].key, kvs[2].key, kvs[150].key, absentOther, absentSuffix},
+	} {
+		estimated, err := EstimateProofSize(root, keys, resolver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof, _, _, _, err := MakeVerkleMultiProof(root, nil, append([][]byte{}, keys...), resolver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vp, sd, err := SerializeProof(proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encodedProof, err := vp.MarshalSSZ()
+		if err != nil {
+			t.Fatal(err)
+		}
+		encodedDiff, err := sd.MarshalSSZ()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := len(encodedProof) + len(encodedDiff); estimated != size {
+			t.Fatalf("estimated a size of %d bytes for %x, got %d", estimated, keys, size)
+		}
+	}
+
+	if _, err := EstimateProofSize(root, nil, resolver); err == nil {
+		t.Fatal("estimated the size of a proof without keys")
+	}
+}
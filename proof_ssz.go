@@ -0,0 +1,577 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// SSZ encoding of the proof containers, as defined by the consensus
+// specs (EIP-6800):
+//
+//	class SuffixStateDiff(Container):
+//	    suffix: Byte
+//	    current_value: Optional[Bytes32]
+//	    new_value: Optional[Bytes32]
+//
+//	class StemStateDiff(Container):
+//	    stem: Stem
+//	    suffix_diffs: List[SuffixStateDiff, VERKLE_WIDTH]
+//
+//	StateDiff = List[StemStateDiff, MAX_STEMS]
+//
+//	class IPAProof(Container):
+//	    cl: Vector[BanderwagonGroupElement, IPA_PROOF_DEPTH]
+//	    cr: Vector[BanderwagonGroupElement, IPA_PROOF_DEPTH]
+//	    final_evaluation: BanderwagonFieldElement
+//
+//	class VerkleProof(Container):
+//	    other_stems: List[Bytes31, MAX_STEMS]
+//	    depth_extension_present: ByteList[MAX_STEMS]
+//	    commitments_by_path: List[BanderwagonGroupElement, MAX_STEMS * MAX_COMMITMENTS_PER_STEM]
+//	    d: BanderwagonGroupElement
+//	    ipa_proof: IPAProof
+//
+// Optional[Bytes32] is encoded as Union[None, Bytes32].
+const (
+	SSZMaxStems              = 1 << 16
+	SSZMaxCommitmentsPerStem = 33
+
+	sszOffsetSize = 4
+
+	sszIPAProofSize           = 2*IPA_PROOF_DEPTH*32 + 32
+	sszVerkleProofFixedSize   = 3*sszOffsetSize + 32 + sszIPAProofSize
+	sszSuffixDiffFixedSize    = 1 + 2*sszOffsetSize
+	sszStemStateDiffFixedSize = StemSize + sszOffsetSize
+)
+
+// SizeSSZ returns the size of the SSZ encoding of the IPA proof.
+func (ipp *IPAProof) SizeSSZ() int {
+	return sszIPAProofSize
+}
+
+// MarshalSSZ returns the SSZ encoding of the IPA proof.
+func (ipp *IPAProof) MarshalSSZ() ([]byte, error) {
+	return ipp.MarshalSSZTo(make([]byte, 0, sszIPAProofSize))
+}
+
+// MarshalSSZTo appends the SSZ encoding of the IPA proof to buf.
+func (ipp *IPAProof) MarshalSSZTo(buf []byte) ([]byte, error) {
+	for i := range ipp.CL {
+		buf = append(buf, ipp.CL[i][:]...)
+	}
+	for i := range ipp.CR {
+		buf = append(buf, ipp.CR[i][:]...)
+	}
+	return append(buf, ipp.FinalEvaluation[:]...), nil
+}
+
+// UnmarshalSSZ decodes an SSZ-encoded IPA proof.
+func (ipp *IPAProof) UnmarshalSSZ(buf []byte) error {
+	if len(buf) != sszIPAProofSize {
+		return fmt.Errorf("invalid IPA proof size %d, expected %d", len(buf), sszIPAProofSize)
+	}
+	offset := 0
+	for i := range ipp.CL {
+		offset += copy(ipp.CL[i][:], buf[offset:])
+	}
+	for i := range ipp.CR {
+		offset += copy(ipp.CR[i][:], buf[offset:])
+	}
+	copy(ipp.FinalEvaluation[:], buf[offset:])
+	return nil
+}
+
+// HashTreeRoot returns the SSZ hash tree root of the IPA proof.
+func (ipp *IPAProof) HashTreeRoot() ([32]byte, error) {
+	return sszMerkleize([][32]byte{
+		sszMerkleize(ipp.CL[:], IPA_PROOF_DEPTH),
+		sszMerkleize(ipp.CR[:], IPA_PROOF_DEPTH),
+		ipp.FinalEvaluation,
+	}, 3), nil
+}
+
+// SizeSSZ returns the size of the SSZ encoding of the proof.
+func (vp *VerkleProof) SizeSSZ() int {
+	return sszVerkleProofFixedSize + len(vp.OtherStems)*StemSize + len(vp.DepthExtensionPresent) + len(vp.CommitmentsByPath)*32
+}
+
+// MarshalSSZ returns the SSZ encoding of the proof.
+func (vp *VerkleProof) MarshalSSZ() ([]byte, error) {
+	return vp.MarshalSSZTo(make([]byte, 0, vp.SizeSSZ()))
+}
+
+// MarshalSSZTo appends the SSZ encoding of the proof to buf.
+func (vp *VerkleProof) MarshalSSZTo(buf []byte) ([]byte, error) {
+	if err := vp.checkSSZLimits(); err != nil {
+		return nil, err
+	}
+
+	offset := sszVerkleProofFixedSize
+	buf = sszAppendOffset(buf, offset)
+	offset += len(vp.OtherStems) * StemSize
+	buf = sszAppendOffset(buf, offset)
+	offset += len(vp.DepthExtensionPresent)
+	buf = sszAppendOffset(buf, offset)
+	buf = append(buf, vp.D[:]...)
+	buf, _ = vp.IPAProof.MarshalSSZTo(buf)
+
+	for i := range vp.OtherStems {
+		buf = append(buf, vp.OtherStems[i][:]...)
+	}
+	buf = append(buf, vp.DepthExtensionPresent...)
+	for i := range vp.CommitmentsByPath {
+		buf = append(buf, vp.CommitmentsByPath[i][:]...)
+	}
+	return buf, nil
+}
+
+func (vp *VerkleProof) checkSSZLimits() error {
+	if vp.IPAProof == nil {
+		return errors.New("missing IPA proof")
+	}
+	if len(vp.OtherStems) > SSZMaxStems {
+		return fmt.Errorf("too many proof of absence stems: %d > %d", len(vp.OtherStems), SSZMaxStems)
+	}
+	if len(vp.DepthExtensionPresent) > SSZMaxStems {
+		return fmt.Errorf("too many extension statuses: %d > %d", len(vp.DepthExtensionPresent), SSZMaxStems)
+	}
+	if len(vp.CommitmentsByPath) > SSZMaxStems*SSZMaxCommitmentsPerStem {
+		return fmt.Errorf("too many commitments: %d > %d", len(vp.CommitmentsByPath), SSZMaxStems*SSZMaxCommitmentsPerStem)
+	}
+	return nil
+}
+
+// UnmarshalSSZ decodes an SSZ-encoded proof.
+func (vp *VerkleProof) UnmarshalSSZ(buf []byte) error {
+	if len(buf) < sszVerkleProofFixedSize {
+		return fmt.Errorf("proof is too short: %d < %d bytes", len(buf), sszVerkleProofFixedSize)
+	}
+	offsets, err := sszReadOffsets(buf, []int{0, sszOffsetSize, 2 * sszOffsetSize}, sszVerkleProofFixedSize)
+	if err != nil {
+		return err
+	}
+	stems, statuses, commitments := buf[offsets[0]:offsets[1]], buf[offsets[1]:offsets[2]], buf[offsets[2]:]
+
+	if len(stems)%StemSize != 0 || len(stems)/StemSize > SSZMaxStems {
+		return fmt.Errorf("invalid proof of absence stems size %d", len(stems))
+	}
+	if len(statuses) > SSZMaxStems {
+		return fmt.Errorf("too many extension statuses: %d > %d", len(statuses), SSZMaxStems)
+	}
+	if len(commitments)%32 != 0 || len(commitments)/32 > SSZMaxStems*SSZMaxCommitmentsPerStem {
+		return fmt.Errorf("invalid commitments size %d", len(commitments))
+	}
+
+	var ipp IPAProof
+	if err := ipp.UnmarshalSSZ(buf[3*sszOffsetSize+32 : sszVerkleProofFixedSize]); err != nil {
+		return err
+	}
+	*vp = VerkleProof{
+		OtherStems:            make([][StemSize]byte, len(stems)/StemSize),
+		DepthExtensionPresent: append([]byte{}, statuses...),
+		CommitmentsByPath:     make([][32]byte, len(commitments)/32),
+		IPAProof:              &ipp,
+	}
+	copy(vp.D[:], buf[3*sszOffsetSize:])
+	for i := range vp.OtherStems {
+		copy(vp.OtherStems[i][:], stems[i*StemSize:])
+	}
+	for i := range vp.CommitmentsByPath {
+		copy(vp.CommitmentsByPath[i][:], commitments[i*32:])
+	}
+	return nil
+}
+
+// HashTreeRoot returns the SSZ hash tree root of the proof.
+func (vp *VerkleProof) HashTreeRoot() ([32]byte, error) {
+	if err := vp.checkSSZLimits(); err != nil {
+		return [32]byte{}, err
+	}
+
+	stems := make([][32]byte, len(vp.OtherStems))
+	for i := range vp.OtherStems {
+		copy(stems[i][:], vp.OtherStems[i][:])
+	}
+	statuses := make([][32]byte, (len(vp.DepthExtensionPresent)+31)/32)
+	for i, es := range vp.DepthExtensionPresent {
+		statuses[i/32][i%32] = es
+	}
+	ipaRoot, _ := vp.IPAProof.HashTreeRoot()
+
+	return sszMerkleize([][32]byte{
+		sszMixInLength(sszMerkleize(stems, SSZMaxStems), len(vp.OtherStems)),
+		sszMixInLength(sszMerkleize(statuses, (SSZMaxStems+31)/32), len(vp.DepthExtensionPresent)),
+		sszMixInLength(sszMerkleize(vp.CommitmentsByPath, SSZMaxStems*SSZMaxCommitmentsPerStem), len(vp.CommitmentsByPath)),
+		vp.D,
+		ipaRoot,
+	}, 5), nil
+}
+
+// SizeSSZ returns the size of the SSZ encoding of the suffix diff.
+func (ssd *SuffixStateDiff) SizeSSZ() int {
+	return sszSuffixDiffFixedSize + sszOptionalSize(ssd.CurrentValue) + sszOptionalSize(ssd.NewValue)
+}
+
+// MarshalSSZ returns the SSZ encoding of the suffix diff.
+func (ssd *SuffixStateDiff) MarshalSSZ() ([]byte, error) {
+	return ssd.MarshalSSZTo(make([]byte, 0, ssd.SizeSSZ()))
+}
+
+// MarshalSSZTo appends the SSZ encoding of the suffix diff to buf.
+func (ssd *SuffixStateDiff) MarshalSSZTo(buf []byte) ([]byte, error) {
+	buf = append(buf, ssd.Suffix)
+	buf = sszAppendOffset(buf, sszSuffixDiffFixedSize)
+	buf = sszAppendOffset(buf, sszSuffixDiffFixedSize+sszOptionalSize(ssd.CurrentValue))
+	buf = sszAppendOptional(buf, ssd.CurrentValue)
+	return sszAppendOptional(buf, ssd.NewValue), nil
+}
+
+// UnmarshalSSZ decodes an SSZ-encoded suffix diff.
+func (ssd *SuffixStateDiff) UnmarshalSSZ(buf []byte) error {
+	if len(buf) < sszSuffixDiffFixedSize {
+		return fmt.Errorf("suffix diff is too short: %d < %d bytes", len(buf), sszSuffixDiffFixedSize)
+	}
+	offsets, err := sszReadOffsets(buf, []int{1, 1 + sszOffsetSize}, sszSuffixDiffFixedSize)
+	if err != nil {
+		return err
+	}
+	current, err := sszParseOptional(buf[offsets[0]:offsets[1]])
+	if err != nil {
+		return fmt.Errorf("current value: %w", err)
+	}
+	newValue, err := sszParseOptional(buf[offsets[1]:])
+	if err != nil {
+		return fmt.Errorf("new value: %w", err)
+	}
+	*ssd = SuffixStateDiff{Suffix: buf[0], CurrentValue: current, NewValue: newValue}
+	return nil
+}
+
+// HashTreeRoot returns the SSZ hash tree root of the suffix diff.
+func (ssd *SuffixStateDiff) HashTreeRoot() ([32]byte, error) {
+	var suffix [32]byte
+	suffix[0] = ssd.Suffix
+	return sszMerkleize([][32]byte{
+		suffix,
+		sszOptionalRoot(ssd.CurrentValue),
+		sszOptionalRoot(ssd.NewValue),
+	}, 3), nil
+}
+
+// SizeSSZ returns the size of the SSZ encoding of the stem diff.
+func (sd *StemStateDiff) SizeSSZ() int {
+	size := sszStemStateDiffFixedSize + len(sd.SuffixDiffs)*sszOffsetSize
+	for i := range sd.SuffixDiffs {
+		size += sd.SuffixDiffs[i].SizeSSZ()
+	}
+	return size
+}
+
+// MarshalSSZ returns the SSZ encoding of the stem diff.
+func (sd *StemStateDiff) MarshalSSZ() ([]byte, error) {
+	return sd.MarshalSSZTo(make([]byte, 0, sd.SizeSSZ()))
+}
+
+// MarshalSSZTo appends the SSZ encoding of the stem diff to buf.
+func (sd *StemStateDiff) MarshalSSZTo(buf []byte) ([]byte, error) {
+	if len(sd.SuffixDiffs) > NodeWidth {
+		return nil, fmt.Errorf("too many suffix diffs: %d > %d", len(sd.SuffixDiffs), NodeWidth)
+	}
+	buf = append(buf, sd.Stem[:]...)
+	buf = sszAppendOffset(buf, sszStemStateDiffFixedSize)
+
+	offset := len(sd.SuffixDiffs) * sszOffsetSize
+	for i := range sd.SuffixDiffs {
+		buf = sszAppendOffset(buf, offset)
+		offset += sd.SuffixDiffs[i].SizeSSZ()
+	}
+	for i := range sd.SuffixDiffs {
+		buf, _ = sd.SuffixDiffs[i].MarshalSSZTo(buf)
+	}
+	return buf, nil
+}
+
+// UnmarshalSSZ decodes an SSZ-encoded stem diff.
+func (sd *StemStateDiff) UnmarshalSSZ(buf []byte) error {
+	if len(buf) < sszStemStateDiffFixedSize {
+		return fmt.Errorf("stem diff is too short: %d < %d bytes", len(buf), sszStemStateDiffFixedSize)
+	}
+	if _, err := sszReadOffsets(buf, []int{StemSize}, sszStemStateDiffFixedSize); err != nil {
+		return err
+	}
+	items, err := sszSplitList(buf[sszStemStateDiffFixedSize:], NodeWidth)
+	if err != nil {
+		return fmt.Errorf("suffix diffs: %w", err)
+	}
+	var diffs SuffixStateDiffs
+	if len(items) > 0 {
+		diffs = make(SuffixStateDiffs, len(items))
+	}
+	for i, item := range items {
+		if err := diffs[i].UnmarshalSSZ(item); err != nil {
+			return fmt.Errorf("suffix diff %d: %w", i, err)
+		}
+	}
+	sd.SuffixDiffs = diffs
+	copy(sd.Stem[:], buf)
+	return nil
+}
+
+// HashTreeRoot returns the SSZ hash tree root of the stem diff.
+func (sd *StemStateDiff) HashTreeRoot() ([32]byte, error) {
+	if len(sd.SuffixDiffs) > NodeWidth {
+		return [32]byte{}, fmt.Errorf("too many suffix diffs: %d > %d", len(sd.SuffixDiffs), NodeWidth)
+	}
+	roots := make([][32]byte, len(sd.SuffixDiffs))
+	for i := range sd.SuffixDiffs {
+		roots[i], _ = sd.SuffixDiffs[i].HashTreeRoot()
+	}
+	var stem [32]byte
+	copy(stem[:], sd.Stem[:])
+	return sszMerkleize([][32]byte{
+		stem,
+		sszMixInLength(sszMerkleize(roots, NodeWidth), len(roots)),
+	}, 2), nil
+}
+
+// SizeSSZ returns the size of the SSZ encoding of the state diff.
+func (sd StateDiff) SizeSSZ() int {
+	size := len(sd) * sszOffsetSize
+	for i := range sd {
+		size += sd[i].SizeSSZ()
+	}
+	return size
+}
+
+// MarshalSSZ returns the SSZ encoding of the state diff.
+func (sd StateDiff) MarshalSSZ() ([]byte, error) {
+	return sd.MarshalSSZTo(make([]byte, 0, sd.SizeSSZ()))
+}
+
+// MarshalSSZTo appends the SSZ encoding of the state diff to buf.
+func (sd StateDiff) MarshalSSZTo(buf []byte) ([]byte, error) {
+	if len(sd) > SSZMaxStems {
+		return nil, fmt.Errorf("too many stems: %d > %d", len(sd), SSZMaxStems)
+	}
+	offset := len(sd) * sszOffsetSize
+	for i := range sd {
+		buf = sszAppendOffset(buf, offset)
+		offset += sd[i].SizeSSZ()
+	}
+	for i := range sd {
+		var err error
+		if buf, err = sd[i].MarshalSSZTo(buf); err != nil {
+			return nil, fmt.Errorf("stem %x: %w", sd[i].Stem, err)
+		}
+	}
+	return buf, nil
+}
+
+// UnmarshalSSZ decodes an SSZ-encoded state diff.
+func (sd *StateDiff) UnmarshalSSZ(buf []byte) error {
+	items, err := sszSplitList(buf, SSZMaxStems)
+	if err != nil {
+		return err
+	}
+	var diff StateDiff
+	if len(items) > 0 {
+		diff = make(StateDiff, len(items))
+	}
+	for i, item := range items {
+		if err := diff[i].UnmarshalSSZ(item); err != nil {
+			return fmt.Errorf("stem diff %d: %w", i, err)
+		}
+	}
+	*sd = diff
+	return nil
+}
+
+// HashTreeRoot returns the SSZ hash tree root of the state diff.
+func (sd StateDiff) HashTreeRoot() ([32]byte, error) {
+	if len(sd) > SSZMaxStems {
+		return [32]byte{}, fmt.Errorf("too many stems: %d > %d", len(sd), SSZMaxStems)
+	}
+	roots := make([][32]byte, len(sd))
+	for i := range sd {
+		var err error
+		if roots[i], err = sd[i].HashTreeRoot(); err != nil {
+			return [32]byte{}, fmt.Errorf("stem %x: %w", sd[i].Stem, err)
+		}
+	}
+	return sszMixInLength(sszMerkleize(roots, SSZMaxStems), len(roots)), nil
+}
+
+func sszAppendOffset(buf []byte, offset int) []byte {
+	var b [sszOffsetSize]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(offset))
+	return append(buf, b[:]...)
+}
+
+// sszReadOffsets reads the offsets found at the given positions of the
+// fixed part of a container, and checks that the first one points right
+// after the fixed part and that they are increasing and within buf.
+func sszReadOffsets(buf []byte, positions []int, fixedSize int) ([]int, error) {
+	offsets := make([]int, len(positions))
+	prev := fixedSize
+	for i, pos := range positions {
+		offsets[i] = int(binary.LittleEndian.Uint32(buf[pos:]))
+		if i == 0 && offsets[i] != fixedSize {
+			return nil, fmt.Errorf("invalid first offset %d, expected %d", offsets[i], fixedSize)
+		}
+		if offsets[i] < prev || offsets[i] > len(buf) {
+			return nil, fmt.Errorf("invalid offset %d", offsets[i])
+		}
+		prev = offsets[i]
+	}
+	return offsets, nil
+}
+
+// sszSplitList splits the encoding of a list of variable-size items,
+// which starts with the offset of each item.
+func sszSplitList(buf []byte, limit int) ([][]byte, error) {
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	if len(buf) < sszOffsetSize {
+		return nil, errors.New("list is too short")
+	}
+	first := int(binary.LittleEndian.Uint32(buf))
+	if first == 0 || first%sszOffsetSize != 0 || first > len(buf) {
+		return nil, fmt.Errorf("invalid first offset %d", first)
+	}
+	count := first / sszOffsetSize
+	if count > limit {
+		return nil, fmt.Errorf("too many items: %d > %d", count, limit)
+	}
+	positions := make([]int, count)
+	for i := range positions {
+		positions[i] = i * sszOffsetSize
+	}
+	offsets, err := sszReadOffsets(buf, positions, first)
+	if err != nil {
+		return nil, err
+	}
+	items := make([][]byte, count)
+	for i, offset := range offsets {
+		end := len(buf)
+		if i+1 < count {
+			end = offsets[i+1]
+		}
+		items[i] = buf[offset:end]
+	}
+	return items, nil
+}
+
+func sszOptionalSize(value *[32]byte) int {
+	if value == nil {
+		return 1
+	}
+	return 33
+}
+
+func sszAppendOptional(buf []byte, value *[32]byte) []byte {
+	if value == nil {
+		return append(buf, 0)
+	}
+	buf = append(buf, 1)
+	return append(buf, value[:]...)
+}
+
+func sszParseOptional(buf []byte) (*[32]byte, error) {
+	switch {
+	case len(buf) == 1 && buf[0] == 0:
+		return nil, nil
+	case len(buf) == 33 && buf[0] == 1:
+		var value [32]byte
+		copy(value[:], buf[1:])
+		return &value, nil
+	case len(buf) == 0:
+		return nil, errors.New("missing union selector")
+	default:
+		return nil, fmt.Errorf("invalid union selector %d for %d bytes", buf[0], len(buf)-1)
+	}
+}
+
+func sszOptionalRoot(value *[32]byte) [32]byte {
+	var root, selector [32]byte
+	if value != nil {
+		root = *value
+		selector[0] = 1
+	}
+	return sszHash(root, selector)
+}
+
+func sszHash(left, right [32]byte) [32]byte {
+	var buf [64]byte
+	copy(buf[:32], left[:])
+	copy(buf[32:], right[:])
+	return sha256.Sum256(buf[:])
+}
+
+func sszMixInLength(root [32]byte, length int) [32]byte {
+	var l [32]byte
+	binary.LittleEndian.PutUint64(l[:], uint64(length))
+	return sszHash(root, l)
+}
+
+// sszZeroHashes[i] is the root of a tree of depth i with only zero
+// chunks, deep enough for the largest list limit in use.
+var sszZeroHashes [32][32]byte
+
+func init() {
+	for i := 1; i < len(sszZeroHashes); i++ {
+		sszZeroHashes[i] = sszHash(sszZeroHashes[i-1], sszZeroHashes[i-1])
+	}
+}
+
+// sszMerkleize computes the root of the chunks, padded with zero
+// chunks up to the next power of two of limit, which must be at least
+// the number of chunks.
+func sszMerkleize(chunks [][32]byte, limit int) [32]byte {
+	depth := 0
+	for 1<<depth < limit {
+		depth++
+	}
+	if len(chunks) == 0 {
+		return sszZeroHashes[depth]
+	}
+
+	layer := append([][32]byte{}, chunks...)
+	for d := 0; d < depth; d++ {
+		if len(layer)%2 == 1 {
+			layer = append(layer, sszZeroHashes[d])
+		}
+		for i := 0; i < len(layer)/2; i++ {
+			layer[i] = sszHash(layer[2*i], layer[2*i+1])
+		}
+		layer = layer[:len(layer)/2]
+	}
+	return layer[0]
+}
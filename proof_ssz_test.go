@@ -0,0 +1,136 @@
+package verkle
+
+import (
+	"crypto/sha256"
+	"reflect"
+	"testing"
+)
+
+func TestProofSSZRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	vp, sd := proofFixture(t)
+
+	serialized, err := vp.MarshalSSZ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serialized) != vp.SizeSSZ() {
+		t.Fatalf("invalid proof size %d, expected %d", len(serialized), vp.SizeSSZ())
+	}
+	var decodedProof VerkleProof
+	if err := decodedProof.UnmarshalSSZ(serialized); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vp, &decodedProof) {
+		t.Fatal("proof changed after a round trip")
+	}
+
+	serialized, err = sd.MarshalSSZ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serialized) != sd.SizeSSZ() {
+		t.Fatalf("invalid state diff size %d, expected %d", len(serialized), sd.SizeSSZ())
+	}
+	var decodedDiff StateDiff
+	if err := decodedDiff.UnmarshalSSZ(serialized); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sd, decodedDiff) {
+		t.Fatal("state diff changed after a round trip")
+	}
+
+	// The decoded proof must still verify
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(forkOneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyProofAtRoot(mustDeserializeProof(t, &decodedProof, decodedDiff), root.Commit().Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Truncated encodings are rejected
+	proofBytes, _ := vp.MarshalSSZ()
+	for _, l := range []int{0, sszVerkleProofFixedSize - 1, len(proofBytes) - 1} {
+		if err := decodedProof.UnmarshalSSZ(proofBytes[:l]); err == nil {
+			t.Fatalf("truncated proof of %d bytes was accepted", l)
+		}
+	}
+	if err := decodedDiff.UnmarshalSSZ(serialized[:len(serialized)-1]); err == nil {
+		t.Fatal("truncated state diff was accepted")
+	}
+}
+
+func mustDeserializeProof(t *testing.T, vp *VerkleProof, sd StateDiff) *Proof {
+	t.Helper()
+
+	proof, err := DeserializeProof(vp, sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func TestSuffixStateDiffHashTreeRoot(t *testing.T) {
+	t.Parallel()
+
+	var value [32]byte
+	copy(value[:], fourtyKeyTest)
+	ssd := SuffixStateDiff{Suffix: 5, NewValue: &value}
+
+	// Compute the root by hand: the container has 3 fields, padded to 4
+	hash := func(a, b [32]byte) [32]byte {
+		return sha256.Sum256(append(append([]byte{}, a[:]...), b[:]...))
+	}
+	var suffix, zero, none, some [32]byte
+	suffix[0] = 5
+	some[0] = 1
+	expected := hash(hash(suffix, hash(zero, none)), hash(hash(value, some), zero))
+
+	root, err := ssd.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != expected {
+		t.Fatalf("invalid hash tree root %x, expected %x", root, expected)
+	}
+
+	serialized, err := ssd.MarshalSSZ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// suffix, offsets 9 and 10, None selector, Bytes32 selector and value
+	if len(serialized) != 9+1+33 || serialized[0] != 5 || serialized[1] != 9 || serialized[5] != 10 || serialized[9] != 0 || serialized[10] != 1 {
+		t.Fatalf("invalid encoding %x", serialized)
+	}
+}
+
+func TestProofHashTreeRootChanges(t *testing.T) {
+	t.Parallel()
+
+	vp, sd := proofFixture(t)
+	proofRoot, err := vp.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffRoot, err := sd.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vp.DepthExtensionPresent[0] ^= 1
+	if root, _ := vp.HashTreeRoot(); root == proofRoot {
+		t.Fatal("proof root didn't change with its contents")
+	}
+	sd[0].SuffixDiffs[0].Suffix++
+	if root, _ := sd.HashTreeRoot(); root == diffRoot {
+		t.Fatal("state diff root didn't change with its contents")
+	}
+	if root, _ := (StateDiff{}).HashTreeRoot(); root != sszMixInLength(sszZeroHashes[16], 0) {
+		t.Fatalf("invalid empty state diff root %x", root)
+	}
+}
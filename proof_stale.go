@@ -0,0 +1,83 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import "fmt"
+
+// StaleKeys returns the keys of proof whose value was changed by diffs,
+// the state diffs of the blocks that came after the proof, in the order
+// they were applied. The value of a key that isn't written to by the
+// proof's own block is its pre-state value, and its post-state value
+// otherwise. A caching proxy can keep serving the values of a proof as
+// long as no key is returned, and evict it otherwise. Note that the
+// proof itself only verifies against the root it was made for, as any
+// change to the tree changes that root. The keys are returned in
+// increasing order.
+func StaleKeys(proof *Proof, diffs ...StateDiff) ([][]byte, error) {
+	if len(proof.PreValues) != len(proof.Keys) || (proof.PostValues != nil && len(proof.PostValues) != len(proof.Keys)) {
+		return nil, fmt.Errorf("proof has %d keys, %d pre-state and %d post-state values", len(proof.Keys), len(proof.PreValues), len(proof.PostValues))
+	}
+
+	// Values are compared in their serialized form, so that a short
+	// value matches its padded version in the diffs.
+	proven := make(map[string]*[32]byte, len(proof.Keys))
+	for i, key := range proof.Keys {
+		value := proof.PreValues[i]
+		if proof.PostValues != nil && len(proof.PostValues[i]) > 0 {
+			value = proof.PostValues[i]
+		}
+		var sd SuffixStateDiff
+		if err := serializeSuffixDiff(&sd, key, value, nil); err != nil {
+			return nil, err
+		}
+		proven[string(key)] = sd.CurrentValue
+	}
+
+	latest := make(map[string]*[32]byte)
+	for _, diff := range diffs {
+		for _, stemdiff := range diff {
+			for _, suffixdiff := range stemdiff.SuffixDiffs {
+				if suffixdiff.NewValue == nil {
+					continue
+				}
+				var k [32]byte
+				copy(k[:StemSize], stemdiff.Stem[:])
+				k[StemSize] = suffixdiff.Suffix
+				if _, ok := proven[string(k[:])]; ok {
+					latest[string(k[:])] = suffixdiff.NewValue
+				}
+			}
+		}
+	}
+
+	var stale [][]byte
+	for _, key := range proof.Keys {
+		if value, ok := latest[string(key)]; ok && !equalDiffValues(proven[string(key)], value) {
+			stale = append(stale, key)
+		}
+	}
+	return stale, nil
+}
@@ -0,0 +1,53 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStaleKeys(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, key := range [][]byte{zeroKeyTest, ffx32KeyTest} {
+		if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root.Commit()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := func(key []byte, value []byte) StateDiff {
+		stemdiff := StemStateDiff{SuffixDiffs: []SuffixStateDiff{{}}}
+		copy(stemdiff.Stem[:], key[:StemSize])
+		if err := serializeSuffixDiff(&stemdiff.SuffixDiffs[0], key, nil, value); err != nil {
+			t.Fatal(err)
+		}
+		return StateDiff{stemdiff}
+	}
+
+	stale, err := StaleKeys(proof)
+	if err != nil || len(stale) != 0 {
+		t.Fatalf("no diff should leave the proof valid, got %x %v", stale, err)
+	}
+	// Rewriting the same value, or writing an unproven key, keeps the proof valid.
+	stale, err = StaleKeys(proof, diff(zeroKeyTest, fourtyKeyTest), diff(forkOneKeyTest, oneKeyTest))
+	if err != nil || len(stale) != 0 {
+		t.Fatalf("unchanged values should leave the proof valid, got %x %v", stale, err)
+	}
+	stale, err = StaleKeys(proof, diff(ffx32KeyTest, zeroKeyTest), diff(oneKeyTest, oneKeyTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 2 || !bytes.Equal(stale[0], oneKeyTest) || !bytes.Equal(stale[1], ffx32KeyTest) {
+		t.Fatalf("invalid stale keys %x", stale)
+	}
+	// The latest value is the one that counts.
+	stale, err = StaleKeys(proof, diff(ffx32KeyTest, zeroKeyTest), diff(ffx32KeyTest, fourtyKeyTest))
+	if err != nil || len(stale) != 0 {
+		t.Fatalf("restored value should leave the proof valid, got %x %v", stale, err)
+	}
+}
@@ -0,0 +1,246 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ReadProofJSON decodes a proof from the {"stateDiff": ..., "verkleProof": ...}
+// envelope produced by MarshalProofJSON with CamelCaseNaming, reading r
+// incrementally. Unlike UnmarshalProofJSON, neither the input nor an
+// intermediate VerkleProof and StateDiff are kept in memory: state diff
+// entries and commitments are decoded one at a time, straight into the
+// returned Proof. Byte strings are read with the default, lenient, hex
+// encoding, see HexEncoding.ReadProofJSON for others.
+func ReadProofJSON(r io.Reader) (*Proof, error) {
+	return HexEncoding{}.ReadProofJSON(r)
+}
+
+// ReadProofJSON is the package-level ReadProofJSON, reading the byte
+// strings with enc.
+func (enc HexEncoding) ReadProofJSON(r io.Reader) (*Proof, error) {
+	var (
+		sd    = proofStream{dec: json.NewDecoder(r), enc: enc}
+		proof Proof
+		d     [32]byte
+		ipp   *IPAProof
+		found bool
+	)
+	err := sd.object("proof envelope", func(key string) error {
+		switch key {
+		case "stateDiff":
+			return sd.array(key, func() error {
+				var (
+					raw      json.RawMessage
+					stemdiff StemStateDiff
+				)
+				if err := sd.dec.Decode(&raw); err != nil {
+					return err
+				}
+				if err := stemdiff.unmarshalJSON(raw, sd.enc); err != nil {
+					return err
+				}
+				proof.appendStemDiff(&stemdiff)
+				return nil
+			})
+		case "verkleProof":
+			found = true
+			return sd.verkleProof(&proof, &d, &ipp)
+		default:
+			return sd.skip()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("missing verkle proof")
+	}
+	if proof.Multipoint, err = deserializeMultipoint(d, ipp); err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
+
+// VerifyProofJSON reads a proof with ReadProofJSON, and verifies it
+// against the trusted root commitment. It does not verify in constant
+// memory: only the serialized witness is never held in memory, while the
+// decoded proof and the pre-state tree rebuilt from it are. The
+// multipoint argument commits to all the openings at once, with a
+// challenge derived from all of them, so none of them can be checked, and
+// dropped, before the end of the input.
+func VerifyProofJSON(r io.Reader, root *Point) error {
+	proof, err := ReadProofJSON(r)
+	if err != nil {
+		return fmt.Errorf("reading proof: %w", err)
+	}
+	pretree, err := PreStateTreeFromProof(proof, root)
+	if err != nil {
+		return fmt.Errorf("rebuilding pre-state tree: %w", err)
+	}
+	return VerifyVerkleProofWithPreState(proof, pretree)
+}
+
+// proofStream decodes the JSON encoding of a proof token by token.
+type proofStream struct {
+	dec *json.Decoder
+	enc HexEncoding
+}
+
+func (s *proofStream) delim(what string, expected json.Delim) error {
+	tok, err := s.dec.Token()
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", what, err)
+	}
+	if tok != expected {
+		return fmt.Errorf("reading %s: expected %q, got %v", what, expected, tok)
+	}
+	return nil
+}
+
+// object calls field for each key of the next JSON object, which must
+// consume the corresponding value. Duplicate keys are rejected.
+func (s *proofStream) object(what string, field func(key string) error) error {
+	if err := s.delim(what, '{'); err != nil {
+		return err
+	}
+	seen := map[string]struct{}{}
+	for s.dec.More() {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", what, err)
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("reading %s: unexpected %v", what, tok)
+		}
+		if _, ok := seen[key]; ok {
+			return fmt.Errorf("reading %s: duplicate field %q", what, key)
+		}
+		seen[key] = struct{}{}
+		if err := field(key); err != nil {
+			return fmt.Errorf("reading %s: %w", key, err)
+		}
+	}
+	return s.delim(what, '}')
+}
+
+// array calls item for each element of the next JSON array, which must
+// consume it.
+func (s *proofStream) array(what string, item func() error) error {
+	if err := s.delim(what, '['); err != nil {
+		return err
+	}
+	for i := 0; s.dec.More(); i++ {
+		if err := item(); err != nil {
+			return fmt.Errorf("item #%d: %w", i, err)
+		}
+	}
+	return s.delim(what, ']')
+}
+
+// hex reads a hex string encoding size bytes, or any number of bytes if
+// size is negative.
+func (s *proofStream) hex(size int) ([]byte, error) {
+	var str string
+	if err := s.dec.Decode(&str); err != nil {
+		return nil, err
+	}
+	decoded, err := s.enc.Decode(str, size)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 && len(decoded) > size {
+		return nil, fmt.Errorf("hex string %q is longer than %d bytes", str, size)
+	}
+	return decoded, nil
+}
+
+func (s *proofStream) skip() error {
+	var ignored json.RawMessage
+	return s.dec.Decode(&ignored)
+}
+
+func (s *proofStream) verkleProof(proof *Proof, d *[32]byte, ipp **IPAProof) error {
+	return s.object("verkle proof", func(key string) error {
+		switch key {
+		case "otherStems":
+			return s.array(key, func() error {
+				decoded, err := s.hex(StemSize)
+				if err != nil {
+					return err
+				}
+				stem := make([]byte, StemSize)
+				copy(stem, decoded)
+				proof.PoaStems = append(proof.PoaStems, stem)
+				return nil
+			})
+		case "depthExtensionPresent":
+			var err error
+			proof.ExtStatus, err = s.hex(-1)
+			return err
+		case "commitmentsByPath":
+			return s.array(key, func() error {
+				decoded, err := s.hex(32)
+				if err != nil {
+					return err
+				}
+				var serialized [32]byte
+				copy(serialized[:], decoded)
+				var commitment Point
+				if err := commitment.SetBytes(serialized[:]); err != nil {
+					return err
+				}
+				proof.Cs = append(proof.Cs, &commitment)
+				return nil
+			})
+		case "d":
+			decoded, err := s.hex(32)
+			if err != nil {
+				return err
+			}
+			copy(d[:], decoded)
+			return nil
+		case "ipaProof":
+			var raw json.RawMessage
+			if err := s.dec.Decode(&raw); err != nil {
+				return err
+			}
+			if isJSONNull(raw) {
+				*ipp = nil
+				return nil
+			}
+			*ipp = &IPAProof{}
+			return (*ipp).unmarshalJSON(raw, s.enc)
+		default:
+			return s.skip()
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package verkle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadProofJSON(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, key := range [][]byte{zeroKeyTest, oneKeyTest, forkOneKeyTest} {
+		if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root.Commit()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := MarshalProofJSON(vp, sd, CamelCaseNaming)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	streamed, err := ReadProofJSON(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := DeserializeProof(vp, sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !streamed.Equal(expected) {
+		t.Fatal("streamed proof differs from the deserialized one")
+	}
+
+	if err := VerifyProofJSON(bytes.NewReader(encoded), root.Commit()); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyProofJSON(bytes.NewReader(encoded), new(Point)); err == nil {
+		t.Fatal("proof should not verify against another root")
+	}
+
+	for _, tc := range []struct {
+		name, input, err string
+	}{
+		{"truncated", string(encoded[:len(encoded)/2]), "EOF"},
+		{"missing proof", `{"stateDiff":[]}`, "missing verkle proof"},
+		{"duplicate field", `{"verkleProof":{"d":"0x00","d":"0x00"}}`, "duplicate field"},
+		{"not an object", `[]`, "expected"},
+		{"missing IPA proof", `{"verkleProof":{},"extra":[1]}`, "missing IPA proof"},
+	} {
+		if _, err := ReadProofJSON(strings.NewReader(tc.input)); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
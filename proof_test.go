@@ -29,6 +29,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -1003,7 +1004,10 @@ func TestProofOfAbsenceBorderCase(t *testing.T) {
 	// - key1, which is present.
 	// - key2, which isn't present.
 	// Note that all three keys will land on the same leaf value.
-	proof, _, _, _, _ := MakeVerkleMultiProof(root, nil, keylist{key1, key2}, nil)
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, keylist{key1, key2}, nil)
+	if err != nil {
+		t.Fatalf("could not create proof: %v", err)
+	}
 
 	serialized, statediff, err := SerializeProof(proof)
 	if err != nil {
@@ -1089,7 +1093,7 @@ func TestGenerateProofWithOnlyAbsentKeys(t *testing.T) {
 	}
 
 	// It must pass.
-	if ok, err := VerifyVerkleProof(proof, cis, zis, yis, cfg); !ok || err != nil {
+	if ok, err := VerifyVerkleProof(proof, cis, zis, yis, GetConfig()); !ok || err != nil {
 		t.Fatalf("original proof didn't verify: %v", err)
 	}
 
@@ -1114,7 +1118,7 @@ func TestGenerateProofWithOnlyAbsentKeys(t *testing.T) {
 	}
 
 	// It must pass.
-	if ok, err := VerifyVerkleProof(dproof, pe.Cis, pe.Zis, pe.Yis, cfg); !ok || err != nil {
+	if ok, err := VerifyVerkleProof(dproof, pe.Cis, pe.Zis, pe.Yis, GetConfig()); !ok || err != nil {
 		t.Fatalf("reconstructed proof didn't verify: %v", err)
 	}
 
@@ -1126,7 +1130,7 @@ func TestGenerateProofWithOnlyAbsentKeys(t *testing.T) {
 		var key [32]byte
 		copy(key[:], presentKey)
 		key[31] = byte(i)
-		if _, err := droot.Get(key[:], nil); err != errIsPOAStub {
+		if _, err := droot.Get(key[:], nil); !errors.Is(err, ErrIsPOAStub) {
 			t.Fatalf("expected ErrPOALeafValue, got %v", err)
 		}
 	}
@@ -1137,7 +1141,7 @@ func TestGenerateProofWithOnlyAbsentKeys(t *testing.T) {
 		var key [32]byte
 		copy(key[:], presentKey)
 		key[31] = byte(i)
-		if err := droot.Insert(key[:], zeroKeyTest, nil); err != errIsPOAStub {
+		if err := droot.Insert(key[:], zeroKeyTest, nil); !errors.Is(err, ErrIsPOAStub) {
 			t.Fatalf("expected ErrPOALeafValue, got %v", err)
 		}
 	}
@@ -1274,3 +1278,650 @@ func TestProveAbsenceInEmptyHalf(t *testing.T) {
 		t.Fatalf("invalid number of extension status: %d", len(proof.ExtStatus))
 	}
 }
+
+func TestExternalMultipoint(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+
+	proof, inputs, err := PrepareVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, forkOneKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proof.Multipoint != nil {
+		t.Fatal("multipoint argument shouldn't be computed")
+	}
+	if len(inputs.Cis) != len(inputs.Zis) || len(inputs.Cis) != len(inputs.Yis) || len(inputs.Cis) != len(inputs.Fis) {
+		t.Fatalf("inconsistent inputs: %d Cis, %d Zis, %d Yis, %d Fis", len(inputs.Cis), len(inputs.Zis), len(inputs.Yis), len(inputs.Fis))
+	}
+
+	// Same as what an external prover would do
+	mp, err := LocalProver{}.CreateMultiProof(common.NewTranscript(inputs.TranscriptLabel), GetConfig().conf, inputs.Cis, inputs.Fis, inputs.Zis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := LocalProver{}.CreateMultiProof(common.NewTranscript("other"), GetConfig().conf, inputs.Cis, inputs.Fis, inputs.Zis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AttachMultipoint(proof, inputs, other); err == nil {
+		t.Fatal("argument with another transcript was accepted")
+	}
+	if err := AttachMultipoint(proof, inputs, mp); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, forkOneKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evp, esd, err := SerializeProof(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vp, evp) || !reflect.DeepEqual(sd, esd) {
+		t.Fatal("proof differs from the one made by MakeVerkleMultiProof")
+	}
+}
+
+func TestPreStateTreeFromProofParallel(t *testing.T) {
+	root := New()
+	keys := make([][]byte, 0, 300)
+	for i := 0; i < 250; i++ {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	for i := 0; i < 50; i++ {
+		// Keys missing from the tree, or sharing a stem with a present key
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 {
+			copy(key, keys[i][:StemSize])
+		}
+		keys = append(keys, key)
+	}
+	root.Commit()
+
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, keys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := NewConfig(WithParallelism(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetConfig(conf)
+	defer SetConfig(nil)
+	sequential, err := PreStateTreeFromProof(proof, root.Commit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetConfig(nil)
+	parallel, err := PreStateTreeFromProof(proof, root.Commit())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sequential.Commit().Equal(parallel.Commit()) {
+		t.Fatal("trees rebuilt with different parallelism have different roots")
+	}
+	if ToDotCompact(sequential) != ToDotCompact(parallel) {
+		t.Fatal("trees rebuilt with different parallelism are different")
+	}
+	if err := VerifyVerkleProofWithPreState(proof, parallel); err != nil {
+		t.Fatal(err)
+	}
+
+	truncated := *proof
+	truncated.Cs = truncated.Cs[:len(truncated.Cs)/2]
+	if _, err := PreStateTreeFromProof(&truncated, root.Commit()); err == nil {
+		t.Fatal("rebuilding a tree with missing commitments should fail")
+	}
+}
+
+func TestProveFromStatelessTree(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, key := range [][]byte{zeroKeyTest, oneKeyTest, forkOneKeyTest, ffx32KeyTest} {
+		if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root.Commit()
+
+	absentKey := append([]byte{}, ffx32KeyTest...)
+	absentKey[StemSize] = 0
+	absentKey[0] = 0x80
+	keys := [][]byte{zeroKeyTest, ffx32KeyTest, absentKey}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, append([][]byte{}, keys...), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	droot, err := PreStateTreeFromProof(proof, root.Commit())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, subset := range [][][]byte{keys, keys[:1], keys[2:]} {
+		if _, _, _, _, err := MakeVerkleMultiProof(droot, nil, append([][]byte{}, subset...), nil); !errors.Is(err, ErrStatelessProof) {
+			t.Fatalf("expected ErrStatelessProof proving %x, got %v", subset, err)
+		}
+	}
+
+	// The stateless tree can still be used for verification
+	if err := VerifyVerkleProofWithPreState(proof, droot); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtendProof(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := make([][]byte, 64)
+	for i := range keys {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	root.Commit()
+	postroot := root.Copy()
+	for _, key := range keys[:4] {
+		if err := postroot.Insert(key, zeroKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	postroot.Commit()
+
+	absent := make([]byte, 32)
+	copy(absent, keys[10][:StemSize])
+	absent[StemSize] = ^keys[10][StemSize]
+	all := append(append([][]byte{}, keys[:20]...), absent)
+
+	existing, _, _, _, err := MakeVerkleMultiProof(root, postroot, append([][]byte{}, keys[:8]...), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Extra keys include one that is already proven, and one that is
+	// modified in the post-state tree.
+	extra := append(append([][]byte{}, keys[2:20]...), absent)
+	extended, _, _, _, err := ExtendProof(root, postroot, existing, extra, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _, _, _, err := MakeVerkleMultiProof(root, postroot, all, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evp, esd, err := SerializeProof(extended)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, sd, err := SerializeProof(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vp, evp) || !reflect.DeepEqual(sd, esd) {
+		t.Fatal("extended proof differs from a proof of all keys")
+	}
+	if err := VerifyVerkleProofWithPreState(extended, root); err != nil {
+		t.Fatal(err)
+	}
+
+	// A deserialized proof has no polynomials to reuse, it can still be
+	// extended.
+	dproof, err := DeserializeProof(vp, sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extended, _, _, _, err = ExtendProof(root, nil, dproof, [][]byte{keys[30]}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyVerkleProofWithPreState(extended, root); err != nil {
+		t.Fatal(err)
+	}
+
+	// Extending a proof with another tree fails.
+	if _, _, _, _, err := ExtendProof(postroot, nil, existing, extra, nil); err == nil {
+		t.Fatal("extending a proof in another tree should fail")
+	}
+}
+
+func TestProofCopyEqual(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, key := range [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest} {
+		if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root.Commit()
+	postroot := root.Copy()
+	if err := postroot.Insert(oneKeyTest, zeroKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	postroot.Commit()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, postroot, [][]byte{zeroKeyTest, oneKeyTest, fourtyKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpy := proof.Copy()
+	if !cpy.Equal(proof) {
+		t.Fatal("copy differs from the original proof")
+	}
+	cpy.Keys[0][0] ^= 1
+	cpy.Cs[0].Add(cpy.Cs[0], cpy.Cs[0])
+	cpy.Multipoint.IPA.L[0].Add(&cpy.Multipoint.IPA.L[0], &cpy.Multipoint.IPA.L[0])
+	if proof.Keys[0][0] != zeroKeyTest[0] || cpy.Equal(proof) {
+		t.Fatal("copy aliases the original proof")
+	}
+	cpy = proof.Copy()
+	cpy.PreValues[len(cpy.PreValues)-1] = []byte{}
+	if cpy.Equal(proof) {
+		t.Fatal("missing and empty values should differ")
+	}
+
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vpc, sdc := vp.Copy(), sd.Copy()
+	if !vpc.Equal(vp) || !sdc.Equal(sd) {
+		t.Fatal("copies differ from the serialized proof")
+	}
+	vpc.IPAProof.CL[0][0] ^= 1
+	if vp.IPAProof.Equal(vpc.IPAProof) || vp.Equal(vpc) {
+		t.Fatal("copy aliases the IPA proof")
+	}
+	sdc[0].SuffixDiffs[0].CurrentValue[0] ^= 1
+	if sd.Equal(sdc) {
+		t.Fatal("copy aliases the state diff values")
+	}
+
+	var (
+		nilProof *Proof
+		nilVP    *VerkleProof
+		nilIPA   *IPAProof
+	)
+	if nilProof.Copy() != nil || nilVP.Copy() != nil || nilIPA.Copy() != nil || StateDiff(nil).Copy() != nil {
+		t.Fatal("copies of nil should be nil")
+	}
+	if !nilProof.Equal(nil) || nilProof.Equal(proof) || proof.Equal(nil) || !nilVP.Equal(nil) || vp.Equal(nil) {
+		t.Fatal("invalid comparison with nil")
+	}
+}
+
+func TestPoaStemValidation(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	// Absent key leading to the leaf of zeroKeyTest
+	absent := append([]byte{}, zeroKeyTest...)
+	absent[10] = 1
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{absent}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.PoaStems) != 1 {
+		t.Fatalf("invalid number of proof-of-absence stems: %d", len(proof.PoaStems))
+	}
+	if _, err := PreStateTreeFromProof(proof, root.Commit()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		stems [][]byte
+	}{
+		{"missing", nil},
+		{"repeated", [][]byte{proof.PoaStems[0], proof.PoaStems[0]}},
+		{"dangling", [][]byte{proof.PoaStems[0], ffx32KeyTest[:StemSize]}},
+		{"unrelated", [][]byte{ffx32KeyTest[:StemSize]}},
+		{"absent stem", [][]byte{absent[:StemSize]}},
+		{"short", [][]byte{zeroKeyTest[:3]}},
+	} {
+		tampered := *proof
+		tampered.PoaStems = tc.stems
+		if _, err := PreStateTreeFromProof(&tampered, root.Commit()); err == nil {
+			t.Fatalf("%s proof of absence stem should be rejected", tc.name)
+		}
+	}
+}
+
+func TestGroupKeysByStem(t *testing.T) {
+	t.Parallel()
+
+	if groups := GroupKeysByStem(nil); len(groups) != 0 {
+		t.Fatalf("expected no group, got %d", len(groups))
+	}
+
+	keys := [][]byte{zeroKeyTest, oneKeyTest, forkOneKeyTest, ffx32KeyTest}
+	groups := GroupKeysByStem(keys)
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 groups, got %d", len(groups))
+	}
+	for i, expected := range []struct {
+		stem  []byte
+		start int
+		count int
+	}{
+		{zeroKeyTest[:StemSize], 0, 2},
+		{forkOneKeyTest[:StemSize], 2, 1},
+		{ffx32KeyTest[:StemSize], 3, 1},
+	} {
+		group := groups[i]
+		if !bytes.Equal(group.Stem, expected.stem) || group.Start != expected.start || len(group.Keys) != expected.count {
+			t.Fatalf("invalid group %d: stem %x, start %d, %d keys", i, group.Stem, group.Start, len(group.Keys))
+		}
+		for j, key := range group.Keys {
+			if !bytes.Equal(key, keys[group.Start+j]) {
+				t.Fatalf("invalid key %d in group %d", j, i)
+			}
+		}
+	}
+}
+
+func TestBuildPartialTreeFromDiff(t *testing.T) {
+	t.Parallel()
+
+	var v1, v2 [32]byte
+	v1[0], v2[0] = 1, 2
+	var stemA, stemB, stemC [StemSize]byte
+	stemB[1] = 1 // shares its first byte with stemA
+	stemC[0] = 0xff
+	sd := StateDiff{
+		{Stem: stemC, SuffixDiffs: SuffixStateDiffs{{Suffix: 3, CurrentValue: &v1}}},
+		{Stem: stemA, SuffixDiffs: SuffixStateDiffs{{Suffix: 0, CurrentValue: &v1, NewValue: &v2}, {Suffix: 1, NewValue: &v2}}},
+		{Stem: stemB, SuffixDiffs: SuffixStateDiffs{{Suffix: 0, CurrentValue: &v2}}},
+	}
+	ref := New()
+	if err := ref.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	rootC := ref.Commit()
+
+	tree, err := BuildPartialTreeFromDiff(sd, rootC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tree.Commit().Equal(rootC) {
+		t.Fatal("invalid root commitment")
+	}
+	for _, tc := range []struct {
+		stem   [StemSize]byte
+		suffix byte
+		value  []byte
+	}{
+		{stemA, 0, v1[:]},
+		{stemA, 1, nil},
+		{stemB, 0, v2[:]},
+		{stemC, 3, v1[:]},
+	} {
+		value, err := tree.Get(append(tc.stem[:], tc.suffix), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(value, tc.value) {
+			t.Fatalf("invalid value at %x/%d: %x != %x", tc.stem, tc.suffix, value, tc.value)
+		}
+	}
+	if leaf, ok := tree.(*InternalNode).children[0].(*InternalNode).children[1].(*LeafNode); !ok || leaf.depth != 2 {
+		t.Fatal("stem B should be in a leaf at depth 2")
+	}
+	if _, err := tree.Get(ffx32KeyTest[:StemSize+1], nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Get(append([]byte{0x80}, zeroKeyTest[1:]...), nil); !errors.Is(err, ErrMissingNodeInStateless) {
+		t.Fatalf("reading an uncovered path should fail, got %v", err)
+	}
+	if _, _, _, _, err := MakeVerkleMultiProof(tree, nil, [][]byte{zeroKeyTest}, nil); !errors.Is(err, ErrStatelessProof) {
+		t.Fatalf("proving from a partial tree should fail, got %v", err)
+	}
+
+	conflicting := append(sd.Copy(), StemStateDiff{Stem: stemC, SuffixDiffs: SuffixStateDiffs{{Suffix: 3, CurrentValue: &v2}}})
+	if _, err := BuildPartialTreeFromDiff(conflicting, nil); err == nil {
+		t.Fatal("conflicting values should be rejected")
+	}
+}
+
+func TestVerifyUpdate(t *testing.T) {
+	t.Parallel()
+
+	pre := New()
+	if err := pre.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := pre.Insert(forkOneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	preRoot := new(Point).Set(pre.Commit())
+
+	post := pre.Copy()
+	if err := post.Insert(zeroKeyTest, ffx32KeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := post.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	postRoot := new(Point).Set(post.Commit())
+
+	// The tree is also written an extra key, not part of the claim
+	extra := post.Copy()
+	if err := extra.Insert(oneKeyTest, ffx32KeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	extraRoot := new(Point).Set(extra.Commit())
+
+	keys := [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest}
+	proof, _, _, _, err := MakeVerkleMultiProof(pre, nil, append([][]byte{}, keys...), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preValues := [][]byte{fourtyKeyTest, nil, nil}
+	postValues := [][]byte{ffx32KeyTest, nil, fourtyKeyTest}
+
+	if err := VerifyUpdate(preRoot, postRoot, keys, preValues, postValues, proof, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyUpdate(preRoot, extraRoot, keys, preValues, postValues, proof, nil); err == nil {
+		t.Fatal("update that doesn't account for all the writes was accepted")
+	}
+	if err := VerifyUpdate(preRoot, extraRoot, keys, preValues, [][]byte{ffx32KeyTest, ffx32KeyTest, fourtyKeyTest}, proof, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyUpdate(preRoot, postRoot, keys, [][]byte{nil, nil, nil}, postValues, proof, nil); err == nil {
+		t.Fatal("update with invalid pre-state values was accepted")
+	}
+	if err := VerifyUpdate(postRoot, postRoot, keys, preValues, postValues, proof, nil); err == nil {
+		t.Fatal("update from the wrong pre-state root was accepted")
+	}
+	if err := VerifyUpdate(preRoot, postRoot, [][]byte{fourtyKeyTest}, [][]byte{nil}, [][]byte{zeroKeyTest}, proof, nil); err == nil {
+		t.Fatal("update of a key not covered by the proof was accepted")
+	}
+
+	// A proof of a tree with its own configuration is verified with it
+	conf, err := NewConfig(WithTranscriptLabel("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom := NewWithConfig(conf)
+	if err := custom.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := custom.Insert(forkOneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	custom.Commit()
+	proof, _, _, _, err = MakeVerkleMultiProof(custom, nil, append([][]byte{}, keys...), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyUpdate(preRoot, postRoot, keys, preValues, postValues, proof, conf); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyUpdate(preRoot, postRoot, keys, preValues, postValues, proof, nil); err == nil {
+		t.Fatal("proof was accepted with the wrong transcript label")
+	}
+}
+
+func TestCheckVerkleProof(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, key := range [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest} {
+		if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root.Commit()
+	proof, cis, zis, yis, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, ffx32KeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := GetConfig()
+	if err := CheckVerkleProof(proof, cis, zis, yis, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	checkStep := func(err error, step VerificationStep, index int) {
+		t.Helper()
+		var verr *VerificationError
+		if !errors.As(err, &verr) || !errors.Is(err, ErrProofInvalid) {
+			t.Fatalf("expected a verification error, got %v", err)
+		}
+		if verr.Step != step || verr.Index != index {
+			t.Fatalf("expected a failure of the %s check at opening %d, got %v", step, index, err)
+		}
+	}
+
+	checkStep(CheckVerkleProof(proof, cis, zis[1:], yis, cfg), StepInputs, -1)
+	checkStep(CheckVerkleProof(&Proof{Keys: proof.Keys}, cis, zis, yis, cfg), StepInputs, -1)
+
+	var wrong Fr
+	wrong.SetUint64(42)
+	tampered := append([]*Fr{}, yis...)
+	tampered[3] = &wrong
+	checkStep(CheckVerkleProof(proof, cis, zis, tampered, cfg), StepMultipoint, -1)
+
+	// Open the root a second time, to another value
+	dup := len(cis)
+	checkStep(CheckVerkleProof(proof, append(cis[:dup:dup], cis[0]), append(zis[:dup:dup], zis[0]), append(yis[:dup:dup], &wrong), cfg), StepOpenings, dup)
+
+	conf, err := NewConfig(WithTranscriptLabel("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStep(CheckVerkleProof(proof, cis, zis, yis, conf), StepTranscript, -1)
+
+	conf, err = NewConfig(WithConstantTimeVerification(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckVerkleProof(proof, cis, zis, tampered, conf); err != ErrProofInvalid {
+		t.Fatalf("expected ErrProofInvalid, got %v", err)
+	}
+}
+
+func TestMakeVerkleMultiProofResolvesValues(t *testing.T) {
+	t.Parallel()
+
+	root, resolver := flushedTree(t, nil, []keyValue{{zeroKeyTest, fourtyKeyTest}, {ffx32KeyTest, fourtyKeyTest}})
+	keys := [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, append([][]byte{}, keys...), resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range proof.Keys {
+		expected, err := root.Get(key, resolver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(proof.PreValues[i], expected) {
+			t.Fatalf("invalid pre-state value for key %x: %x != %x", key, proof.PreValues[i], expected)
+		}
+	}
+
+	failing := func([]byte) ([]byte, error) { return nil, errors.New("unavailable") }
+	root, _ = flushedTree(t, nil, []keyValue{{zeroKeyTest, fourtyKeyTest}, {ffx32KeyTest, fourtyKeyTest}})
+	var resolveErr *ResolveError
+	if _, _, _, _, err := MakeVerkleMultiProof(root, nil, append([][]byte{}, keys...), failing); !errors.As(err, &resolveErr) {
+		t.Fatalf("expected a resolve error, got %v", err)
+	}
+}
+
+func TestGetCommitmentsForMultiproofKeys(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+
+	expected, _, _, err := GetCommitmentsForMultiproof(root, [][]byte{zeroKeyTest, ffx32KeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe, _, _, err := GetCommitmentsForMultiproof(root, [][]byte{ffx32KeyTest, zeroKeyTest, ffx32KeyTest, zeroKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pe.Cis) != len(expected.Cis) || len(pe.Vals) != 2 {
+		t.Fatalf("duplicate keys should be proven once, got %d openings and %d values", len(pe.Cis), len(pe.Vals))
+	}
+
+	if _, _, _, err := GetCommitmentsForMultiproof(root, [][]byte{zeroKeyTest, zeroKeyTest[:StemSize]}, nil); err == nil {
+		t.Fatal("a short key should be rejected")
+	}
+
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, zeroKeyTest, ffx32KeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.Keys) != 2 || len(proof.PreValues) != 2 {
+		t.Fatalf("expected 2 proven keys, got %d keys and %d values", len(proof.Keys), len(proof.PreValues))
+	}
+	if err := VerifyVerkleProofWithPreState(proof, root); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,302 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// ErrMalformedProof is matched by the errors returned by
+// ValidateProofStructure and DeserializeProofStrict.
+var ErrMalformedProof = errors.New("malformed proof")
+
+// ValidateCommitments checks that every group element of vp, namely the
+// commitments by path, D and the L and R points of the IPA proof, is a
+// canonical encoding of a point of the prime-order subgroup. This is much
+// cheaper than verifying the multiproof, so it can be used to reject a
+// malformed proof early. The points are checked concurrently, over one
+// worker per CPU, and the error returned is that of the first invalid point, in the order above.
+func ValidateCommitments(vp *VerkleProof) error {
+	if vp == nil {
+		return errors.New("nil proof")
+	}
+	if vp.IPAProof == nil {
+		return errors.New("missing IPA proof")
+	}
+
+	points := proofPoints(vp)
+	errs := make([]error, len(points))
+	decompressPoints(nil, make([]Point, len(points)), points, errs)
+	for i, err := range errs {
+		if err != nil {
+			return pointError(vp, i, err)
+		}
+	}
+	return nil
+}
+
+// proofPoints lists the group elements of vp: the commitments by path,
+// D, and the L and R points of the IPA proof.
+func proofPoints(vp *VerkleProof) []*[32]byte {
+	points := make([]*[32]byte, 0, len(vp.CommitmentsByPath)+1+2*IPA_PROOF_DEPTH)
+	for i := range vp.CommitmentsByPath {
+		points = append(points, &vp.CommitmentsByPath[i])
+	}
+	points = append(points, &vp.D)
+	for i := range vp.IPAProof.CL {
+		points = append(points, &vp.IPAProof.CL[i])
+	}
+	for i := range vp.IPAProof.CR {
+		points = append(points, &vp.IPAProof.CR[i])
+	}
+	return points
+}
+
+// pointError describes the error decoding the i-th point returned by
+// proofPoints.
+func pointError(vp *VerkleProof, i int, err error) error {
+	switch n := len(vp.CommitmentsByPath); {
+	case i < n:
+		return fmt.Errorf("invalid commitment %d: %w", i, err)
+	case i == n:
+		return fmt.Errorf("invalid D: %w", err)
+	case i <= n+IPA_PROOF_DEPTH:
+		return fmt.Errorf("invalid L[%d]: %w", i-n-1, err)
+	default:
+		return fmt.Errorf("invalid R[%d]: %w", i-n-1-IPA_PROOF_DEPTH, err)
+	}
+}
+
+// decompressPoints decodes the points of src into dst concurrently, over
+// the workers of conf, and records the error of each point in errs. A nil
+// conf uses one worker per CPU, so that decoding proofs doesn't depend on,
+// or initialize, the default configuration.
+func decompressPoints(conf *Config, dst []Point, src []*[32]byte, errs []error) {
+	var (
+		workers = runtime.NumCPU()
+		wg      sync.WaitGroup
+	)
+	if conf != nil {
+		workers = conf.numWorkers()
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(src); i += workers {
+				errs[i] = dst[i].SetBytes(src[i][:])
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func malformedProof(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrMalformedProof, fmt.Sprintf(format, args...))
+}
+
+// DeserializeProofStrict is DeserializeProof, rejecting the inputs that
+// don't pass ValidateProofStructure and ValidateCommitments, so that
+// malformed proofs received from the network are caught before they are
+// used to rebuild a tree. The proof is decoded like by DeserializeProofs,
+// which it references the inputs of.
+func DeserializeProofStrict(vp *VerkleProof, statediff StateDiff) (*Proof, error) {
+	if err := ValidateProofStructure(vp, statediff); err != nil {
+		return nil, err
+	}
+	proofs, err := DeserializeProofs([]*VerkleProof{vp}, []StateDiff{statediff})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedProof, err)
+	}
+	return proofs[0], nil
+}
+
+// ValidateProofStructure checks that a proof and its state diff are well
+// formed, i.e. that they could have been produced by SerializeProof:
+//   - the IPA proof is present, and its final evaluation is canonical
+//   - stems, suffixes and proof-of-absence stems are sorted and unique
+//   - there is one extension status per stem, which is valid and whose
+//     depth is in range, and absent stems have no current value
+//   - the paths of the stems describe a tree, which the number of
+//     commitments and proof-of-absence stems matches
+//
+// The points aren't decoded, see ValidateCommitments, and whether the
+// proof verifies isn't checked.
+func ValidateProofStructure(vp *VerkleProof, statediff StateDiff) error {
+	if vp == nil {
+		return malformedProof("%v", errNilProof)
+	}
+	if vp.IPAProof == nil {
+		return malformedProof("missing IPA proof")
+	}
+	var a Fr
+	a.SetBytes(vp.IPAProof.FinalEvaluation[:])
+	if a.Bytes() != vp.IPAProof.FinalEvaluation {
+		return malformedProof("non-canonical final evaluation")
+	}
+	if len(vp.DepthExtensionPresent) != len(statediff) {
+		return malformedProof("%d extension statuses for %d stems", len(vp.DepthExtensionPresent), len(statediff))
+	}
+
+	for i := range statediff {
+		sd := &statediff[i]
+		if i > 0 && bytes.Compare(statediff[i-1].Stem[:], sd.Stem[:]) >= 0 {
+			return malformedProof("stem %x is not sorted, or repeated", sd.Stem)
+		}
+		if len(sd.SuffixDiffs) == 0 {
+			return malformedProof("stem %x has no suffix", sd.Stem)
+		}
+		for j := 1; j < len(sd.SuffixDiffs); j++ {
+			if sd.SuffixDiffs[j-1].Suffix >= sd.SuffixDiffs[j].Suffix {
+				return malformedProof("suffix %d of stem %x is not sorted, or repeated", sd.SuffixDiffs[j].Suffix, sd.Stem)
+			}
+		}
+
+		// The bit in between the status and the depth is unused, and
+		// ignored by DecodeExtStatus, so it must be zero.
+		if vp.DepthExtensionPresent[i]&(1<<(extStatusDepthShift-1)) != 0 {
+			return malformedProof("non-canonical extension status %#x for stem %x", vp.DepthExtensionPresent[i], sd.Stem)
+		}
+		depth, status := DecodeExtStatus(vp.DepthExtensionPresent[i])
+		if status > ExtStatusPresent {
+			return malformedProof("invalid extension status %d for stem %x", status, sd.Stem)
+		}
+		if depth == 0 || depth > StemSize {
+			return malformedProof("depth %d of stem %x is out of range", depth, sd.Stem)
+		}
+		if status != ExtStatusPresent {
+			for _, suffixDiff := range sd.SuffixDiffs {
+				if suffixDiff.CurrentValue != nil {
+					return malformedProof("stem %x is %s, but suffix %d has a value", sd.Stem, status, suffixDiff.Suffix)
+				}
+			}
+		}
+	}
+	for i := 1; i < len(vp.OtherStems); i++ {
+		if bytes.Compare(vp.OtherStems[i-1][:], vp.OtherStems[i][:]) >= 0 {
+			return malformedProof("proof-of-absence stem %x is not sorted, or repeated", vp.OtherStems[i])
+		}
+	}
+
+	return checkProofPaths(vp, statediff)
+}
+
+// proofPath is what the stems of a proof say about the node at a path.
+type proofPath struct {
+	status ExtStatus
+	stem   []byte // the proven stem found at the path, if any
+	c1, c2 bool   // whether the suffix commitments are opened
+}
+
+// checkProofPaths checks that the paths of the stems of a proof, as given
+// by their extension statuses, describe a tree, and that the proof holds
+// the commitments and proof-of-absence stems of that tree. This mirrors
+// what PreStateTreeFromProof expects.
+func checkProofPaths(vp *VerkleProof, statediff StateDiff) error {
+	var (
+		paths = make(map[string]*proofPath, len(statediff))
+		order []string // paths, in stem order
+	)
+	for i := range statediff {
+		sd := &statediff[i]
+		depth, status := DecodeExtStatus(vp.DepthExtensionPresent[i])
+		path := string(sd.Stem[:depth])
+		pp, ok := paths[path]
+		if !ok {
+			pp = &proofPath{status: status}
+			paths[path] = pp
+			order = append(order, path)
+		}
+
+		// Several stems can be absent at the same path, and the leaf
+		// proving their absence can hold a proven stem.
+		switch {
+		case status == ExtStatusAbsentEmpty && pp.status == ExtStatusAbsentEmpty:
+		case status == ExtStatusAbsentOther && pp.status != ExtStatusAbsentEmpty:
+		case status == ExtStatusPresent && pp.stem == nil && pp.status != ExtStatusAbsentEmpty:
+			pp.status, pp.stem = status, sd.Stem[:]
+			for _, suffixDiff := range sd.SuffixDiffs {
+				pp.c1 = pp.c1 || suffixDiff.Suffix < 128
+				pp.c2 = pp.c2 || suffixDiff.Suffix >= 128
+			}
+		default:
+			return malformedProof("stem %x is %s at path %x, which conflicts with another stem", sd.Stem, status, path)
+		}
+	}
+
+	// A leaf, or an empty node, can't have children.
+	internal := map[string]struct{}{}
+	for _, path := range order {
+		for depth := 1; depth < len(path); depth++ {
+			if _, ok := paths[path[:depth]]; ok {
+				return malformedProof("path %x is both a leaf, or empty, and an internal node", path[:depth])
+			}
+			internal[path[:depth]] = struct{}{}
+		}
+	}
+
+	expected := len(internal)
+	var poas []string
+	for _, path := range order {
+		switch pp := paths[path]; pp.status {
+		case ExtStatusAbsentOther:
+			expected++
+			poas = append(poas, path)
+		case ExtStatusPresent:
+			expected++
+			if pp.c1 {
+				expected++
+			}
+			if pp.c2 {
+				expected++
+			}
+		}
+	}
+	if len(vp.CommitmentsByPath) != expected {
+		return malformedProof("%d commitments, expected %d", len(vp.CommitmentsByPath), expected)
+	}
+
+	// Proof-of-absence stems are used by order of the stems whose
+	// absence they prove.
+	if len(vp.OtherStems) != len(poas) {
+		return malformedProof("%d proof-of-absence stems, expected %d", len(vp.OtherStems), len(poas))
+	}
+	stems := make(map[[StemSize]byte]struct{}, len(statediff))
+	for i := range statediff {
+		stems[statediff[i].Stem] = struct{}{}
+	}
+	for i, path := range poas {
+		stem := vp.OtherStems[i]
+		if _, ok := stems[stem]; ok || !bytes.HasPrefix(stem[:], []byte(path)) {
+			return malformedProof("proof-of-absence stem %x doesn't prove an absence at path %x", stem, path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package verkle
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateCommitments(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, key := range [][]byte{zeroKeyTest, ffx32KeyTest, fourtyKeyTest} {
+		if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root.Commit()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, oneKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, _, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateCommitments(vp); err != nil {
+		t.Fatal(err)
+	}
+
+	// Find an encoding that isn't that of a subgroup point
+	var invalid [32]byte
+	for b := byte(1); ; b++ {
+		invalid[31] = b
+		var p Point
+		if p.SetBytes(invalid[:]) != nil {
+			break
+		}
+	}
+	var nonCanonical [32]byte
+	for i := range nonCanonical {
+		nonCanonical[i] = 0xff
+	}
+
+	for _, tc := range []struct {
+		expected string
+		tamper   func(*VerkleProof)
+	}{
+		{"invalid commitment 1", func(vp *VerkleProof) { vp.CommitmentsByPath[1] = invalid }},
+		{"invalid D", func(vp *VerkleProof) { vp.D = nonCanonical }},
+		{"invalid L[3]", func(vp *VerkleProof) { vp.IPAProof.CL[3] = invalid }},
+		{"invalid R[7]", func(vp *VerkleProof) { vp.IPAProof.CR[7] = nonCanonical }},
+		{"missing IPA proof", func(vp *VerkleProof) { vp.IPAProof = nil }},
+	} {
+		tampered := vp.Copy()
+		tc.tamper(tampered)
+		err := ValidateCommitments(tampered)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Fatalf("expected %q, got %v", tc.expected, err)
+		}
+	}
+
+	// The first invalid point is reported
+	tampered := vp.Copy()
+	tampered.CommitmentsByPath[0] = invalid
+	tampered.IPAProof.CR[0] = invalid
+	if err := ValidateCommitments(tampered); err == nil || !strings.Contains(err.Error(), "invalid commitment 0") {
+		t.Fatalf("expected the first commitment to be reported, got %v", err)
+	}
+}
+
+func TestDeserializeProofStrict(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, key := range [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest} {
+		if err := root.Insert(key, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root.Commit()
+	absentEmpty := append([]byte{0x80}, zeroKeyTest[1:]...)
+	absentOther := append([]byte{}, ffx32KeyTest...)
+	absentOther[StemSize-1] = 0
+	keys := [][]byte{zeroKeyTest, oneKeyTest, absentEmpty, absentOther, forkOneKeyTest}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, keys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The serialized proof aliases the extension statuses of proof
+	fresh := func() (*VerkleProof, StateDiff) {
+		vp, sd, err := SerializeProof(proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vp.Copy(), sd.Copy()
+	}
+	vp, sd := fresh()
+	if len(vp.OtherStems) == 0 {
+		t.Fatal("the proof should have a proof-of-absence stem")
+	}
+	strict, err := DeserializeProofStrict(vp, sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lax, err := DeserializeProof(vp, sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strict.Equal(lax) {
+		t.Fatal("strict deserialization returned another proof")
+	}
+
+	for _, tc := range []struct {
+		name   string
+		mutate func(*VerkleProof, StateDiff) StateDiff
+	}{
+		{"missing IPA proof", func(vp *VerkleProof, sd StateDiff) StateDiff {
+			vp.IPAProof = nil
+			return sd
+		}},
+		{"non-canonical final evaluation", func(vp *VerkleProof, sd StateDiff) StateDiff {
+			vp.IPAProof.FinalEvaluation = [32]byte{0xff, 0xff, 0xff, 0xff}
+			return sd
+		}},
+		{"missing extension status", func(vp *VerkleProof, sd StateDiff) StateDiff {
+			vp.DepthExtensionPresent = vp.DepthExtensionPresent[1:]
+			return sd
+		}},
+		{"depth out of range", func(vp *VerkleProof, sd StateDiff) StateDiff {
+			vp.DepthExtensionPresent[0] = EncodeExtStatus(0, ExtStatusPresent)
+			return sd
+		}},
+		{"invalid extension status", func(vp *VerkleProof, sd StateDiff) StateDiff {
+			vp.DepthExtensionPresent[0] |= 3
+			return sd
+		}},
+		{"non-canonical extension status", func(vp *VerkleProof, sd StateDiff) StateDiff {
+			vp.DepthExtensionPresent[0] |= 4
+			return sd
+		}},
+		{"unsorted stems", func(vp *VerkleProof, sd StateDiff) StateDiff {
+			sd[0], sd[1] = sd[1], sd[0]
+			return sd
+		}},
+		{"unsorted suffixes", func(vp *VerkleProof, sd StateDiff) StateDiff {
+			sd[0].SuffixDiffs[0], sd[0].SuffixDiffs[1] = sd[0].SuffixDiffs[1], sd[0].SuffixDiffs[0]
+			return sd
+		}},
+		{"absent stem with a value", func(vp *VerkleProof, sd StateDiff) StateDiff {
+			sd[len(sd)-1].SuffixDiffs[0].CurrentValue = &[32]byte{}
+			return sd
+		}},
+		{"missing commitment", func(vp *VerkleProof, sd StateDiff) StateDiff {
+			vp.CommitmentsByPath = vp.CommitmentsByPath[1:]
+			return sd
+		}},
+		{"missing proof-of-absence stem", func(vp *VerkleProof, sd StateDiff) StateDiff {
+			vp.OtherStems = nil
+			return sd
+		}},
+		{"conflicting depths", func(vp *VerkleProof, sd StateDiff) StateDiff {
+			depth, _ := DecodeExtStatus(vp.DepthExtensionPresent[0])
+			vp.DepthExtensionPresent[0] = EncodeExtStatus(depth+1, ExtStatusPresent)
+			return sd
+		}},
+		{"off-curve commitment", func(vp *VerkleProof, sd StateDiff) StateDiff {
+			vp.CommitmentsByPath[0] = [32]byte{0xff, 0xff, 0xff, 0xff}
+			return sd
+		}},
+	} {
+		vp, sd := fresh()
+		sd = tc.mutate(vp, sd)
+		if _, err := DeserializeProofStrict(vp, sd); !errors.Is(err, ErrMalformedProof) {
+			t.Errorf("%s: expected ErrMalformedProof, got %v", tc.name, err)
+		}
+	}
+}
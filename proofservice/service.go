@@ -0,0 +1,281 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+// Package proofservice provides a stateless net/http handler around the
+// proof APIs of the verkle package, so that proof verification can be run
+// as a sidecar service. It exposes the following endpoints, relative to
+// where it is mounted:
+//
+//	POST verify    verify a serialized witness against a trusted root
+//	POST prove     build a tree from key-value pairs, and prove some of its keys
+//	POST hash      canonical hash of a state diff, as per verkle.HashStateDiff
+//
+// Requests and responses are JSON-encoded. Witnesses use the format of
+// the verkle command's proof files.
+package proofservice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gballet/go-verkle"
+)
+
+// DefaultMaxRequestSize is the request size limit used when
+// Config.MaxRequestSize isn't set.
+const DefaultMaxRequestSize = 16 << 20
+
+// Config describes the limits of the handler.
+type Config struct {
+	// MaxRequestSize is the maximum size, in bytes, of a request body.
+	MaxRequestSize int64
+}
+
+type handler struct {
+	config Config
+	mux    *http.ServeMux
+}
+
+// NewHandler creates a handler serving the proof APIs.
+func NewHandler(config Config) http.Handler {
+	if config.MaxRequestSize <= 0 {
+		config.MaxRequestSize = DefaultMaxRequestSize
+	}
+	h := &handler{config: config, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/verify", h.serveVerify)
+	h.mux.HandleFunc("/prove", h.serveProve)
+	h.mux.HandleFunc("/hash", h.serveHash)
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only POST requests are supported"))
+		return
+	}
+	// Accept both relative and absolute paths, so that the handler
+	// can be mounted with or without http.StripPrefix.
+	if !strings.HasPrefix(r.URL.Path, "/") {
+		r.URL.Path = "/" + r.URL.Path
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, h.config.MaxRequestSize)
+	h.mux.ServeHTTP(w, r)
+}
+
+// decodeRequest reads the JSON request body into v, and reports an
+// error to the client if it fails.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return false
+	}
+	return true
+}
+
+// Witness is a serialized proof, along with its state diff and the root
+// commitment it was made against.
+type Witness struct {
+	Root      string              `json:"root"`
+	Proof     *verkle.VerkleProof `json:"verkleProof"`
+	StateDiff verkle.StateDiff    `json:"stateDiff"`
+}
+
+// VerifyResponse is the response of the verify endpoint. Malformed
+// witnesses are rejected as client errors, but a well-formed witness that
+// doesn't verify isn't one: Valid is then false, and Error says why.
+// PostRoot is the root of the tree once the new values of the state diff
+// are applied, and is only set for valid proofs.
+type VerifyResponse struct {
+	Valid         bool   `json:"valid"`
+	Error         string `json:"error,omitempty"`
+	PostRoot      string `json:"postRoot,omitempty"`
+	StateDiffHash string `json:"stateDiffHash"`
+}
+
+func (h *handler) serveVerify(w http.ResponseWriter, r *http.Request) {
+	var req Witness
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if req.Proof == nil {
+		writeError(w, http.StatusBadRequest, errors.New("witness contains no proof"))
+		return
+	}
+	rootBytes, err := verkle.PrefixedHexStringToBytes(req.Root)
+	if err != nil || len(rootBytes) != 32 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid root %q", req.Root))
+		return
+	}
+	var root [32]byte
+	copy(root[:], rootBytes)
+	rootC, err := verkle.RootFromBytes(root)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	hash, err := verkle.HashStateDiff(req.StateDiff)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// The witness comes from an untrusted client, so it is checked for
+	// being well formed before it is used to rebuild a tree.
+	proof, err := verkle.DecodeProofStrict(req.Proof, req.StateDiff)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid witness: %w", err))
+		return
+	}
+
+	resp := VerifyResponse{StateDiffHash: verkle.HexToPrefixedString(hash[:])}
+	postRoot, err := verify(proof, req.StateDiff, rootC)
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Valid = true
+		resp.PostRoot = verkle.HexToPrefixedString(postRoot[:])
+	}
+	writeJSON(w, resp)
+}
+
+// verify checks a decoded witness against a trusted root, and returns
+// the root of the post-state tree.
+func verify(proof *verkle.Proof, sd verkle.StateDiff, rootC *verkle.Point) ([32]byte, error) {
+	preroot, err := verkle.PreStateTreeFromProof(proof, rootC)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("rebuilding pre-state tree: %w", err)
+	}
+	if err := verkle.VerifyVerkleProofWithPreState(proof, preroot); err != nil {
+		return [32]byte{}, err
+	}
+	postroot, err := verkle.PostStateTreeFromStateDiff(preroot, sd)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("rebuilding post-state tree: %w", err)
+	}
+	return postroot.Commit().Bytes(), nil
+}
+
+// KeyValue is a key-value pair, hex-encoded.
+type KeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ProveRequest is the request of the prove endpoint: the tree built
+// from Entries is used to prove Keys.
+type ProveRequest struct {
+	Entries []KeyValue `json:"entries"`
+	Keys    []string   `json:"keys"`
+}
+
+func (h *handler) serveProve(w http.ResponseWriter, r *http.Request) {
+	var req ProveRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if len(req.Keys) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("no keys to prove"))
+		return
+	}
+
+	root := verkle.New()
+	for _, entry := range req.Entries {
+		key, err := verkle.PrefixedHexStringToBytes(entry.Key)
+		if err != nil || len(key) != verkle.StemSize+1 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid key %q", entry.Key))
+			return
+		}
+		value, err := verkle.PrefixedHexStringToBytes(entry.Value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid value %q", entry.Value))
+			return
+		}
+		if err := root.Insert(key, value, nil); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("inserting key %q: %w", entry.Key, err))
+			return
+		}
+	}
+	keys := make([][]byte, len(req.Keys))
+	for i, k := range req.Keys {
+		key, err := verkle.PrefixedHexStringToBytes(k)
+		if err != nil || len(key) != verkle.StemSize+1 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid key %q", k))
+			return
+		}
+		keys[i] = key
+	}
+
+	rootBytes := root.Commit().Bytes()
+	proof, _, _, _, err := verkle.MakeVerkleMultiProof(root, nil, keys, nil)
+	if errors.Is(err, verkle.ErrTooManyProofKeys) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("creating proof: %w", err))
+		return
+	}
+	resp := Witness{Root: verkle.HexToPrefixedString(rootBytes[:])}
+	resp.Proof, resp.StateDiff, err = verkle.SerializeProof(proof)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("serializing proof: %w", err))
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// HashResponse is the response of the hash endpoint.
+type HashResponse struct {
+	Hash string `json:"hash"`
+}
+
+func (h *handler) serveHash(w http.ResponseWriter, r *http.Request) {
+	var sd verkle.StateDiff
+	if !decodeRequest(w, r, &sd) {
+		return
+	}
+	hash, err := verkle.HashStateDiff(sd)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, HashResponse{Hash: verkle.HexToPrefixedString(hash[:])})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
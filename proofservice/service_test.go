@@ -0,0 +1,141 @@
+package proofservice
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var (
+	key1  = "0x" + strings.Repeat("00", 32)
+	key2  = "0x" + strings.Repeat("ff", 32)
+	value = "0x" + strings.Repeat("01", 32)
+)
+
+func post(t *testing.T, url string, req interface{}, status int, v interface{}) {
+	t.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		t.Fatalf("POST %s: got status %d, expected %d", url, resp.StatusCode, status)
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestService(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(NewHandler(Config{}))
+	defer srv.Close()
+
+	var witness Witness
+	post(t, srv.URL+"/prove", ProveRequest{
+		Entries: []KeyValue{{key1, value}, {key2, value}},
+		Keys:    []string{key1},
+	}, http.StatusOK, &witness)
+	if witness.Proof == nil || len(witness.StateDiff) != 1 {
+		t.Fatalf("invalid witness %+v", witness)
+	}
+
+	var verified VerifyResponse
+	post(t, srv.URL+"/verify", witness, http.StatusOK, &verified)
+	if !verified.Valid || verified.Error != "" {
+		t.Fatalf("proof should be valid: %+v", verified)
+	}
+	if verified.PostRoot != witness.Root {
+		t.Fatalf("post root %s differs from pre root %s without updates", verified.PostRoot, witness.Root)
+	}
+
+	var hashed HashResponse
+	post(t, srv.URL+"/hash", witness.StateDiff, http.StatusOK, &hashed)
+	if hashed.Hash != verified.StateDiffHash {
+		t.Fatalf("hash mismatch: %s != %s", hashed.Hash, verified.StateDiffHash)
+	}
+
+	// Tampering with the state diff makes the proof invalid
+	witness.StateDiff[0].SuffixDiffs[0].CurrentValue[0] ^= 1
+	verified = VerifyResponse{}
+	post(t, srv.URL+"/verify", witness, http.StatusOK, &verified)
+	if verified.Valid || verified.Error == "" || verified.PostRoot != "" {
+		t.Fatalf("tampered proof should be invalid: %+v", verified)
+	}
+
+	witness.Root = "0x00"
+	post(t, srv.URL+"/verify", witness, http.StatusBadRequest, nil)
+	post(t, srv.URL+"/prove", ProveRequest{Entries: []KeyValue{{key1, value}}}, http.StatusBadRequest, nil)
+	post(t, srv.URL+"/prove", ProveRequest{Keys: []string{"0x01"}}, http.StatusBadRequest, nil)
+
+	resp, err := http.Get(srv.URL + "/verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET should not be allowed, got status %d", resp.StatusCode)
+	}
+}
+
+func TestServiceRequestSize(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(NewHandler(Config{MaxRequestSize: 64}))
+	defer srv.Close()
+
+	post(t, srv.URL+"/prove", ProveRequest{
+		Entries: []KeyValue{{key1, value}, {key2, value}},
+		Keys:    []string{key1},
+	}, http.StatusBadRequest, nil)
+}
+
+func TestServiceMalformedWitness(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(NewHandler(Config{}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name   string
+		mutate func(*Witness)
+	}{
+		{"missing extension status", func(w *Witness) {
+			w.Proof.DepthExtensionPresent = nil
+		}},
+		{"missing IPA proof", func(w *Witness) {
+			w.Proof.IPAProof = nil
+		}},
+		{"off-curve commitment", func(w *Witness) {
+			w.Proof.CommitmentsByPath[0] = [32]byte{0xff, 0xff, 0xff, 0xff}
+		}},
+		{"missing commitments", func(w *Witness) {
+			w.Proof.CommitmentsByPath = nil
+		}},
+		{"empty state diff", func(w *Witness) {
+			w.StateDiff = nil
+		}},
+	} {
+		var witness Witness
+		post(t, srv.URL+"/prove", ProveRequest{
+			Entries: []KeyValue{{key1, value}, {key2, value}},
+			Keys:    []string{key1, key2},
+		}, http.StatusOK, &witness)
+		tc.mutate(&witness)
+		t.Run(tc.name, func(t *testing.T) {
+			post(t, srv.URL+"/verify", witness, http.StatusBadRequest, nil)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"fmt"
+
+	ipa "github.com/crate-crypto/go-ipa"
+	"github.com/crate-crypto/go-ipa/common"
+	ipaconf "github.com/crate-crypto/go-ipa/ipa"
+)
+
+// Prover computes the multipoint argument of proofs, which is the costly
+// part of proof generation. Implementations can delegate it to a remote
+// service or to dedicated hardware. Verification is always done locally.
+type Prover interface {
+	// CreateMultiProof proves that the polynomials fis, in evaluation
+	// form, of commitments cis evaluate at zis to the values committed
+	// to in the transcript. It must behave as ipa.CreateMultiProof.
+	CreateMultiProof(transcript *common.Transcript, conf *ipaconf.IPAConfig, cis []*Point, fis [][]Fr, zis []byte) (*ipa.MultiProof, error)
+}
+
+// LocalProver is the default Prover, calling go-ipa in-process. In
+// verkle_small builds, the precomputed tables it requires are built the
+// first time it is called, which takes a few seconds and several hundred
+// megabytes, see WithProver to avoid it.
+type LocalProver struct{}
+
+func (LocalProver) CreateMultiProof(transcript *common.Transcript, conf *ipaconf.IPAConfig, cis []*Point, fis [][]Fr, zis []byte) (*ipa.MultiProof, error) {
+	settings, err := proverSettings(conf)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProvingUnsupported, err)
+	}
+	return ipa.CreateMultiProof(transcript, settings, cis, fis, zis)
+}
+
+// WithProver sets the prover used to generate proofs. Passing nil
+// restores the default, LocalProver. In verkle_small builds, a custom
+// prover avoids building the precomputed tables locally.
+func WithProver(p Prover) Option {
+	return func(conf *IPAConfig) error {
+		conf.prover = p
+		return nil
+	}
+}
+
+// getProver returns the prover of the configuration. It fails early if
+// proofs can't be generated, without gathering the proof elements.
+func (conf *IPAConfig) getProver() (Prover, error) {
+	if conf.prover != nil {
+		return conf.prover, nil
+	}
+	if _, err := proverSettings(conf.conf); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProvingUnsupported, err)
+	}
+	return LocalProver{}, nil
+}
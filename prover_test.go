@@ -0,0 +1,71 @@
+package verkle
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	ipa "github.com/crate-crypto/go-ipa"
+	"github.com/crate-crypto/go-ipa/common"
+	ipaconf "github.com/crate-crypto/go-ipa/ipa"
+)
+
+type countingProver struct {
+	calls int32
+	err   error
+}
+
+func (p *countingProver) CreateMultiProof(transcript *common.Transcript, conf *ipaconf.IPAConfig, cis []*Point, fis [][]Fr, zis []byte) (*ipa.MultiProof, error) {
+	atomic.AddInt32(&p.calls, 1)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return LocalProver{}.CreateMultiProof(transcript, conf, cis, fis, zis)
+}
+
+func TestCustomProver(t *testing.T) {
+	t.Parallel()
+
+	prover := &countingProver{}
+	conf, err := NewConfig(WithProver(prover))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := NewWithConfig(conf)
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&prover.calls) != 1 {
+		t.Fatalf("prover was called %d times", prover.calls)
+	}
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dproof, err := DeserializeProof(vp, sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pretree, err := PreStateTreeFromProof(dproof, root.Commitment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyVerkleProofWithPreState(dproof, pretree); err != nil {
+		t.Fatal(err)
+	}
+
+	errProver := errors.New("prover unavailable")
+	prover.err = errProver
+	if _, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest}, nil); !errors.Is(err, errProver) {
+		t.Fatalf("expected the prover error, got %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Operation log format: a header, followed by one record per operation.
+// Each record starts with its type:
+//
+//	insert:  <recordInsert><key: 32 bytes><value length: 1 byte><value>
+//	delete:  <recordDelete><key: 32 bytes>
+//	stem:    <recordInsertStem><stem: 31 bytes><bitlist: 32 bytes>(<value length: 1 byte><value>)*
+//	commit:  <recordCommit><root commitment: 32 bytes>
+const (
+	recordInsert     byte = 1
+	recordDelete     byte = 2
+	recordInsertStem byte = 3
+	recordCommit     byte = 4
+)
+
+var recordLogHeader = []byte("verkle-oplog-v1\n")
+
+// ErrReplayDiverged is returned by Replay when the root commitment after
+// replaying the log differs from the recorded one.
+var ErrReplayDiverged = errors.New("replayed tree diverged from the recorded one")
+
+// Recorder applies mutations to a tree and logs them to a compact binary
+// log, from which Replay reconstructs the tree. Operations are logged
+// before being applied, so that an operation that fails or panics is
+// part of the log, and is reproduced by the replay. Commits are logged
+// with the resulting root commitment, so that the replay can check that
+// it didn't diverge. A Recorder is safe for concurrent use.
+type Recorder struct {
+	lock sync.Mutex
+	root VerkleNode
+	w    io.Writer
+	err  error // first write error, after which nothing is logged
+}
+
+// NewRecorder creates a recorder for the mutations of root, writing the
+// log to w. Writes aren't buffered, so w should be buffered if it is
+// slow.
+func NewRecorder(root VerkleNode, w io.Writer) (*Recorder, error) {
+	if _, err := w.Write(recordLogHeader); err != nil {
+		return nil, fmt.Errorf("writing log header: %w", err)
+	}
+	return &Recorder{root: root, w: w}, nil
+}
+
+// Root returns the recorded tree. Mutating it directly bypasses the log.
+func (r *Recorder) Root() VerkleNode {
+	return r.root
+}
+
+// Err returns the first error that occurred while writing the log.
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+func (r *Recorder) write(record []byte) error {
+	if r.err != nil {
+		return r.err
+	}
+	if _, err := r.w.Write(record); err != nil {
+		r.err = fmt.Errorf("writing operation log: %w", err)
+	}
+	return r.err
+}
+
+func appendRecordValue(record, value []byte) ([]byte, error) {
+	if len(value) > LeafValueSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrValueTooLong, len(value))
+	}
+	record = append(record, byte(len(value)))
+	return append(record, value...), nil
+}
+
+// Insert logs and applies an insertion.
+func (r *Recorder) Insert(key []byte, value []byte, resolver NodeResolverFn) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(key) != StemSize+1 {
+		return fmt.Errorf("invalid key size: %d", len(key))
+	}
+	record, err := appendRecordValue(append([]byte{recordInsert}, key...), value)
+	if err != nil {
+		return err
+	}
+	if err := r.write(record); err != nil {
+		return err
+	}
+	return r.root.Insert(key, value, resolver)
+}
+
+// Delete logs and applies a deletion.
+func (r *Recorder) Delete(key []byte, resolver NodeResolverFn) (bool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(key) != StemSize+1 {
+		return false, fmt.Errorf("invalid key size: %d", len(key))
+	}
+	if err := r.write(append([]byte{recordDelete}, key...)); err != nil {
+		return false, err
+	}
+	return r.root.Delete(key, resolver)
+}
+
+// InsertValuesAtStem logs and applies the insertion of the non-nil
+// values at stem. The recorded tree must be an *InternalNode.
+func (r *Recorder) InsertValuesAtStem(stem []byte, values [][]byte, resolver NodeResolverFn) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	root, ok := r.root.(*InternalNode)
+	if !ok {
+		return fmt.Errorf("inserting values at stem: %w", ErrUnknownNodeType)
+	}
+	if len(stem) != StemSize || len(values) > NodeWidth {
+		return fmt.Errorf("invalid stem size %d or number of values %d", len(stem), len(values))
+	}
+	var bitlist [bitlistSize]byte
+	for i, v := range values {
+		if v != nil {
+			setBit(bitlist[:], i)
+		}
+	}
+	record := append(append([]byte{recordInsertStem}, stem...), bitlist[:]...)
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		var err error
+		if record, err = appendRecordValue(record, v); err != nil {
+			return err
+		}
+	}
+	if err := r.write(record); err != nil {
+		return err
+	}
+	return root.InsertValuesAtStem(stem, values, resolver)
+}
+
+// Commit commits the tree, and logs the resulting root commitment.
+func (r *Recorder) Commit() (*Point, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	comm, err := commitTree(r.root)
+	if err != nil {
+		return nil, err
+	}
+	commBytes := comm.Bytes()
+	return comm, r.write(append([]byte{recordCommit}, commBytes[:]...))
+}
+
+// Replay applies the operations of a log written by a Recorder to root,
+// and checks that the root commitment matches the recorded one at each
+// commit. The returned error identifies the failing record by its index.
+// A log truncated in the middle of a record, as left by a crash, is
+// replayed up to its last complete record.
+func Replay(root VerkleNode, log io.Reader, resolver NodeResolverFn) error {
+	br := bufio.NewReader(log)
+	header := make([]byte, len(recordLogHeader))
+	if _, err := io.ReadFull(br, header); err != nil || !bytes.Equal(header, recordLogHeader) {
+		return errors.New("invalid operation log header")
+	}
+
+	for index := 0; ; index++ {
+		typ, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading record %d: %w", index, err)
+		}
+		err = replayRecord(root, br, typ, resolver)
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("replaying record %d: %w", index, err)
+		}
+	}
+}
+
+func readRecordValue(br *bufio.Reader) ([]byte, error) {
+	size, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if int(size) > LeafValueSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrValueTooLong, size)
+	}
+	value := make([]byte, size)
+	if _, err := io.ReadFull(br, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func replayRecord(root VerkleNode, br *bufio.Reader, typ byte, resolver NodeResolverFn) error {
+	switch typ {
+	case recordInsert:
+		key := make([]byte, StemSize+1)
+		if _, err := io.ReadFull(br, key); err != nil {
+			return err
+		}
+		value, err := readRecordValue(br)
+		if err != nil {
+			return err
+		}
+		return root.Insert(key, value, resolver)
+	case recordDelete:
+		key := make([]byte, StemSize+1)
+		if _, err := io.ReadFull(br, key); err != nil {
+			return err
+		}
+		_, err := root.Delete(key, resolver)
+		return err
+	case recordInsertStem:
+		buf := make([]byte, StemSize+bitlistSize)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return err
+		}
+		stem, bitlist := buf[:StemSize], buf[StemSize:]
+		values := make([][]byte, NodeWidth)
+		for i := range values {
+			if !bit(bitlist, i) {
+				continue
+			}
+			value, err := readRecordValue(br)
+			if err != nil {
+				return err
+			}
+			values[i] = value
+		}
+		internal, ok := root.(*InternalNode)
+		if !ok {
+			return fmt.Errorf("inserting values at stem: %w", ErrUnknownNodeType)
+		}
+		return internal.InsertValuesAtStem(stem, values, resolver)
+	case recordCommit:
+		var expected [32]byte
+		if _, err := io.ReadFull(br, expected[:]); err != nil {
+			return err
+		}
+		if got := root.Commit().Bytes(); got != expected {
+			return fmt.Errorf("%w: root is %x, recorded %x", ErrReplayDiverged, got, expected)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown record type %d", typ)
+	}
+}
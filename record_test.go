@@ -0,0 +1,71 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	t.Parallel()
+
+	var log bytes.Buffer
+	rec, err := NewRecorder(New(), &log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Insert(forkOneKeyTest, []byte{1, 2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	values := make([][]byte, NodeWidth)
+	values[3], values[200] = testValue, []byte{}
+	if err := rec.InsertValuesAtStem(ffx32KeyTest[:StemSize], values, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rec.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rec.Delete(zeroKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	comm, err := rec.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := New()
+	if err := Replay(replayed, bytes.NewReader(log.Bytes()), nil); err != nil {
+		t.Fatal(err)
+	}
+	if !replayed.Commit().Equal(comm) {
+		t.Fatal("replayed tree differs from the recorded one")
+	}
+
+	// A truncated log is replayed up to its last complete record
+	truncated := New()
+	if err := Replay(truncated, bytes.NewReader(log.Bytes()[:log.Len()-5]), nil); err != nil {
+		t.Fatal(err)
+	}
+	if val, _ := truncated.Get(zeroKeyTest, nil); val != nil {
+		t.Fatal("deletion wasn't replayed")
+	}
+
+	// Replaying on top of another tree diverges at the first commit
+	other := New()
+	if err := other.Insert(oneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Replay(other, bytes.NewReader(log.Bytes()), nil); !errors.Is(err, ErrReplayDiverged) {
+		t.Fatalf("expected ErrReplayDiverged, got %v", err)
+	}
+
+	if err := Replay(New(), bytes.NewReader([]byte("garbage")), nil); err == nil {
+		t.Fatal("invalid log should be rejected")
+	}
+	if err := rec.Insert(zeroKeyTest, make([]byte, 33), nil); !errors.Is(err, ErrValueTooLong) {
+		t.Fatalf("expected ErrValueTooLong, got %v", err)
+	}
+}
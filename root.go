@@ -0,0 +1,116 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"fmt"
+	"sync"
+)
+
+// rootCacheSize is the number of decompressed roots kept by RootFromBytes.
+// Roots are typically reused for all the proofs of a block, and for the
+// next block, so a few entries are enough.
+const rootCacheSize = 64
+
+// rootCache holds the most recently decompressed roots. The oldest entry
+// is evicted first.
+var rootCache = struct {
+	lock   sync.Mutex
+	points map[[32]byte]Point
+	order  [rootCacheSize][32]byte
+	next   int
+}{points: make(map[[32]byte]Point, rootCacheSize)}
+
+// RootFromBytes decompresses a serialized root commitment, e.g. the state
+// root of a block header, and checks that it is a valid point. Results are
+// cached, so that verifying several proofs against the same root only
+// pays for the decompression once. The lock of the cache isn't held while
+// decompressing, so that callers verifying against different roots don't
+// wait on each other.
+func RootFromBytes(root [32]byte) (*Point, error) {
+	rootCache.lock.Lock()
+	point, ok := rootCache.points[root]
+	rootCache.lock.Unlock()
+	if ok {
+		return &point, nil
+	}
+
+	if err := point.SetBytes(root[:]); err != nil {
+		return nil, fmt.Errorf("invalid root commitment %x: %w", root, err)
+	}
+
+	rootCache.lock.Lock()
+	defer rootCache.lock.Unlock()
+	if _, ok := rootCache.points[root]; ok {
+		// Decompressed concurrently by another caller
+		return &point, nil
+	}
+	if len(rootCache.points) == rootCacheSize {
+		delete(rootCache.points, rootCache.order[rootCache.next])
+	}
+	rootCache.points[root] = point
+	rootCache.order[rootCache.next] = root
+	rootCache.next = (rootCache.next + 1) % rootCacheSize
+	return &point, nil
+}
+
+// PreStateTreeFromRoot is PreStateTreeFromProof, for a serialized root
+// commitment.
+func PreStateTreeFromRoot(proof *Proof, root [32]byte) (VerkleNode, error) {
+	rootC, err := RootFromBytes(root)
+	if err != nil {
+		return nil, err
+	}
+	return PreStateTreeFromProof(proof, rootC)
+}
+
+// VerifyProofAtRoot rebuilds the pre-state tree of a proof from its
+// serialized root commitment, and verifies the proof against it.
+func VerifyProofAtRoot(proof *Proof, root [32]byte) error {
+	pretree, err := PreStateTreeFromRoot(proof, root)
+	if err != nil {
+		return fmt.Errorf("rebuilding pre-state tree: %w", err)
+	}
+	return VerifyVerkleProofWithPreState(proof, pretree)
+}
+
+// VerifySerializedProof verifies a proof, as found in a block, against the
+// serialized root commitment of the pre-state tree. This is a single call
+// to decode the proof, rebuild the pre-state tree from it and check the
+// multipoint argument against the commitments of that tree.
+func VerifySerializedProof(vp *VerkleProof, sd StateDiff, root []byte) error {
+	if len(root) != 32 {
+		return fmt.Errorf("invalid root commitment size %d", len(root))
+	}
+	var rootBytes [32]byte
+	copy(rootBytes[:], root)
+
+	proof, err := DecodeProof(vp, sd)
+	if err != nil {
+		return fmt.Errorf("deserializing proof: %w", err)
+	}
+	return VerifyProofAtRoot(proof, rootBytes)
+}
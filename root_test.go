@@ -0,0 +1,102 @@
+package verkle
+
+import (
+	"testing"
+
+	"github.com/crate-crypto/go-ipa/banderwagon"
+)
+
+func TestVerifyProofAtRoot(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	rootBytes := root.Commit().Bytes()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, oneKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyProofAtRoot(proof, rootBytes); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cached roots are copies, which can't alter the cache
+	rootC, err := RootFromBytes(rootBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rootC.Equal(root.Commitment()) {
+		t.Fatal("invalid decompressed root")
+	}
+	rootC.Add(rootC, rootC)
+	if cached, _ := RootFromBytes(rootBytes); !cached.Equal(root.Commitment()) {
+		t.Fatal("cached root was modified")
+	}
+
+	var other [32]byte
+	other[0] = 1
+	if err := VerifyProofAtRoot(proof, other); err == nil {
+		t.Fatal("proof should not verify against another root")
+	}
+	invalid := [32]byte{0xff, 0xff, 0xff, 0xff}
+	if _, err := RootFromBytes(invalid); err == nil {
+		t.Fatal("invalid root should be rejected")
+	}
+	if _, err := PreStateTreeFromRoot(proof, invalid); err == nil {
+		t.Fatal("invalid root should be rejected")
+	}
+
+	// Fill the cache past its capacity
+	for i := 0; i < 2*rootCacheSize; i++ {
+		var p Point
+		p.ScalarMul(&banderwagon.Generator, new(Fr).SetUint64(uint64(i+1)))
+		if _, err := RootFromBytes(p.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rootCache.lock.Lock()
+	size := len(rootCache.points)
+	rootCache.lock.Unlock()
+	if size != rootCacheSize {
+		t.Fatalf("invalid cache size %d", size)
+	}
+}
+
+func TestVerifySerializedProof(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	rootBytes := root.Commit().Bytes()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, ffx32KeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifySerializedProof(vp, sd, rootBytes[:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySerializedProof(vp, sd, rootBytes[:31]); err == nil {
+		t.Fatal("short root should be rejected")
+	}
+	if err := VerifySerializedProof(nil, sd, rootBytes[:]); err == nil {
+		t.Fatal("nil proof should be rejected")
+	}
+	tampered := sd.Copy()
+	tampered[0].SuffixDiffs[0].CurrentValue[0]++
+	if err := VerifySerializedProof(vp, tampered, rootBytes[:]); err == nil {
+		t.Fatal("tampered state diff should be rejected")
+	}
+}
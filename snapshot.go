@@ -0,0 +1,376 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/crate-crypto/go-ipa/banderwagon"
+)
+
+// A snapshot is made of fixed-size node records, followed by a trailer.
+// Nodes are referenced by their offset in the snapshot plus one, 0 meaning
+// an empty child. Records are written in post-order, so that the children
+// of an internal node are written before it and the root is the last
+// record.
+//
+//   - internal node: <snapshotInternalType><padding><commitment><children refs>
+//   - leaf node:     <snapshotLeafType><stem><bitlist><comm><c1comm><c2comm><values>
+//   - trailer:       <snapshotMagic><root ref><#internal nodes><#leaf nodes>
+//
+// where commitments are uncompressed, references are 8-byte big-endian
+// integers, and all NodeWidth values of a leaf are stored, padded to
+// LeafValueSize bytes. Missing values are zeroed out, and their bit is
+// cleared in the bitlist.
+const (
+	snapshotInternalType byte = 1
+	snapshotLeafType     byte = 2
+
+	snapshotRefSize = 8
+
+	snapshotInternalCommOffset = 8
+	snapshotInternalRefsOffset = snapshotInternalCommOffset + banderwagon.UncompressedSize
+	snapshotInternalSize       = snapshotInternalRefsOffset + NodeWidth*snapshotRefSize
+
+	snapshotLeafStemOffset    = nodeTypeSize
+	snapshotLeafBitlistOffset = snapshotLeafStemOffset + StemSize
+	snapshotLeafCommOffset    = snapshotLeafBitlistOffset + bitlistSize
+	snapshotLeafValuesOffset  = snapshotLeafCommOffset + 3*banderwagon.UncompressedSize
+	snapshotLeafSize          = snapshotLeafValuesOffset + NodeWidth*LeafValueSize
+
+	snapshotTrailerSize = len(snapshotMagic) + 3*8
+)
+
+const snapshotMagic = "VKLSNAP1"
+
+// ErrInvalidSnapshot is matched by the errors returned when reading a
+// malformed snapshot.
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// WriteSnapshot commits root and writes the whole tree to w, in a format
+// meant to be memory-mapped by OpenSnapshot, so that a read-only version
+// of the tree can be served off disk without deserializing it. Subtrees
+// that aren't in memory are read with resolver, and aren't kept in memory
+// once written.
+func WriteSnapshot(w io.Writer, root VerkleNode, resolver NodeResolverFn) error {
+	if _, err := commitTree(root); err != nil {
+		return err
+	}
+	sw := &snapshotWriter{w: bufio.NewWriter(w)}
+	ref, err := sw.writeNode(root, nil, resolver)
+	if err != nil {
+		return err
+	}
+
+	trailer := make([]byte, snapshotTrailerSize)
+	copy(trailer, snapshotMagic)
+	binary.BigEndian.PutUint64(trailer[len(snapshotMagic):], ref)
+	binary.BigEndian.PutUint64(trailer[len(snapshotMagic)+8:], sw.internals)
+	binary.BigEndian.PutUint64(trailer[len(snapshotMagic)+16:], sw.leaves)
+	if _, err := sw.w.Write(trailer); err != nil {
+		return err
+	}
+	return sw.w.Flush()
+}
+
+type snapshotWriter struct {
+	w                 *bufio.Writer
+	offset            uint64
+	internals, leaves uint64
+}
+
+// writeNode writes the subtree of node, found at path, and returns the
+// reference to its record.
+func (sw *snapshotWriter) writeNode(node VerkleNode, path []byte, resolver NodeResolverFn) (uint64, error) {
+	var record []byte
+	switch n := node.(type) {
+	case Empty:
+		return 0, nil
+	case HashedNode:
+		if resolver == nil {
+			return 0, fmt.Errorf("no resolver for path %x: %w", path, ErrReadFromInvalid)
+		}
+		serialized, err := resolveNode(resolver, path)
+		if err != nil {
+			return 0, err
+		}
+		resolved, err := ParseNode(serialized, byte(len(path)))
+		if err != nil {
+			return 0, fmt.Errorf("parsing node at path %x: %w", path, err)
+		}
+		return sw.writeNode(resolved, path, resolver)
+	case *InternalNode:
+		record = make([]byte, snapshotInternalSize)
+		record[0] = snapshotInternalType
+		for i, child := range n.children {
+			ref, err := sw.writeNode(child, append(path[:len(path):len(path)], byte(i)), resolver)
+			if err != nil {
+				return 0, err
+			}
+			binary.BigEndian.PutUint64(record[snapshotInternalRefsOffset+i*snapshotRefSize:], ref)
+		}
+		comm := n.commitment.BytesUncompressed()
+		copy(record[snapshotInternalCommOffset:], comm[:])
+		sw.internals++
+	case *LeafNode:
+		if n.isPOAStub || n.isPartial {
+			return 0, fmt.Errorf("snapshotting leaf at path %x: %w", path, ErrMissingNodeInStateless)
+		}
+		record = make([]byte, snapshotLeafSize)
+		record[0] = snapshotLeafType
+		copy(record[snapshotLeafStemOffset:], n.stem[:StemSize])
+		for i, v := range n.values {
+			if v != nil {
+				setBit(record[snapshotLeafBitlistOffset:snapshotLeafCommOffset], i)
+				copy(record[snapshotLeafValuesOffset+i*LeafValueSize:], v)
+			}
+		}
+		comms := banderwagon.BatchToBytesUncompressed(n.commitment, n.c1, n.c2)
+		for i := range comms {
+			copy(record[snapshotLeafCommOffset+i*banderwagon.UncompressedSize:], comms[i][:])
+		}
+		sw.leaves++
+	default:
+		return 0, fmt.Errorf("can not snapshot node of type %T at path %x", node, path)
+	}
+
+	if _, err := sw.w.Write(record); err != nil {
+		return 0, err
+	}
+	ref := sw.offset + 1
+	sw.offset += uint64(len(record))
+	return ref, nil
+}
+
+// Snapshot is a read-only tree written by WriteSnapshot. Nodes are read
+// straight from the snapshot data, which is usually memory-mapped, so
+// opening a snapshot is cheap whatever its size. It is safe for
+// concurrent use.
+type Snapshot struct {
+	data              []byte // records, without the trailer
+	root              uint64
+	internals, leaves uint64
+	release           func() error
+}
+
+// NewSnapshot reads a snapshot from data, which must not be modified
+// while the snapshot is in use.
+func NewSnapshot(data []byte) (*Snapshot, error) {
+	if len(data) < snapshotTrailerSize {
+		return nil, fmt.Errorf("%w: %d bytes is too short", ErrInvalidSnapshot, len(data))
+	}
+	trailer := data[len(data)-snapshotTrailerSize:]
+	if string(trailer[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: invalid magic %x", ErrInvalidSnapshot, trailer[:len(snapshotMagic)])
+	}
+	trailer = trailer[len(snapshotMagic):]
+	s := &Snapshot{
+		data:      data[:len(data)-snapshotTrailerSize],
+		root:      binary.BigEndian.Uint64(trailer),
+		internals: binary.BigEndian.Uint64(trailer[8:]),
+		leaves:    binary.BigEndian.Uint64(trailer[16:]),
+	}
+	if s.internals*snapshotInternalSize+s.leaves*snapshotLeafSize != uint64(len(s.data)) {
+		return nil, fmt.Errorf("%w: %d bytes of records for %d internal and %d leaf nodes", ErrInvalidSnapshot, len(s.data), s.internals, s.leaves)
+	}
+	if s.root != 0 {
+		if _, err := s.record(s.root); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Close releases the snapshot data, if it was opened by OpenSnapshot.
+func (s *Snapshot) Close() error {
+	if s.release == nil {
+		return nil
+	}
+	release := s.release
+	s.release, s.data = nil, nil
+	return release()
+}
+
+// Stats returns the number of internal and leaf nodes in the snapshot.
+func (s *Snapshot) Stats() (internals, leaves uint64) {
+	return s.internals, s.leaves
+}
+
+// record returns the record referenced by ref, which must not be 0.
+func (s *Snapshot) record(ref uint64) ([]byte, error) {
+	offset := ref - 1
+	if ref == 0 || offset >= uint64(len(s.data)) {
+		return nil, fmt.Errorf("%w: reference %d out of range", ErrInvalidSnapshot, ref)
+	}
+	size := uint64(snapshotLeafSize)
+	switch s.data[offset] {
+	case snapshotInternalType:
+		size = snapshotInternalSize
+	case snapshotLeafType:
+	default:
+		return nil, fmt.Errorf("%w: unknown record type %d at offset %d", ErrInvalidSnapshot, s.data[offset], offset)
+	}
+	if uint64(len(s.data))-offset < size {
+		return nil, fmt.Errorf("%w: truncated record at offset %d", ErrInvalidSnapshot, offset)
+	}
+	return s.data[offset : offset+size], nil
+}
+
+// lookup returns the record found at path, nil if there is none, along
+// with its depth. It stops at the first leaf along the path.
+func (s *Snapshot) lookup(path []byte) ([]byte, int, error) {
+	if s.root == 0 {
+		return nil, 0, nil
+	}
+	record, err := s.record(s.root)
+	if err != nil {
+		return nil, 0, err
+	}
+	depth := 0
+	for ; depth < len(path) && record[0] == snapshotInternalType; depth++ {
+		ref := binary.BigEndian.Uint64(record[snapshotInternalRefsOffset+int(path[depth])*snapshotRefSize:])
+		if ref == 0 {
+			return nil, 0, nil
+		}
+		if record, err = s.record(ref); err != nil {
+			return nil, 0, err
+		}
+	}
+	return record, depth, nil
+}
+
+// Commitment returns the commitment of the root of the snapshot.
+func (s *Snapshot) Commitment() (*Point, error) {
+	record, _, err := s.lookup(nil)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil || record[0] != snapshotInternalType {
+		return nil, fmt.Errorf("%w: the root isn't an internal node", ErrInvalidSnapshot)
+	}
+	comm := new(Point)
+	if err := comm.SetBytesUncompressed(record[snapshotInternalCommOffset:snapshotInternalRefsOffset], true); err != nil {
+		return nil, fmt.Errorf("%w: invalid root commitment: %v", ErrInvalidSnapshot, err)
+	}
+	return comm, nil
+}
+
+// Get returns the value of key, or nil if it is absent. The returned
+// slice points to the snapshot data, and must be considered read-only.
+func (s *Snapshot) Get(key []byte) ([]byte, error) {
+	if len(key) != StemSize+1 {
+		return nil, fmt.Errorf("invalid key length, expected %d, got %d", StemSize+1, len(key))
+	}
+	values, err := s.GetValuesAtStem(key[:StemSize])
+	if err != nil || values == nil {
+		return nil, err
+	}
+	return values[key[StemSize]], nil
+}
+
+// GetValuesAtStem returns the NodeWidth values of stem, nil if it is
+// absent. Like with Get, the values point to the snapshot data.
+func (s *Snapshot) GetValuesAtStem(stem []byte) ([][]byte, error) {
+	record, _, err := s.lookup(stem[:StemSize])
+	if err != nil || record == nil || record[0] != snapshotLeafType {
+		return nil, err
+	}
+	if !bytes.Equal(record[snapshotLeafStemOffset:snapshotLeafBitlistOffset], stem[:StemSize]) {
+		return nil, nil
+	}
+	values := make([][]byte, NodeWidth)
+	bitlist := record[snapshotLeafBitlistOffset:snapshotLeafCommOffset]
+	for i := range values {
+		if bit(bitlist, i) {
+			offset := snapshotLeafValuesOffset + i*LeafValueSize
+			values[i] = record[offset : offset+LeafValueSize : offset+LeafValueSize]
+		}
+	}
+	return values, nil
+}
+
+// Resolver returns a resolver serving the nodes of the snapshot in the
+// format of VerkleNode.Serialize, so that a tree, e.g. the one returned by
+// Tree, can be used over the snapshot to make proofs.
+func (s *Snapshot) Resolver() NodeResolverFn {
+	return func(path []byte) ([]byte, error) {
+		record, depth, err := s.lookup(path)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil || depth != len(path) {
+			return nil, fmt.Errorf("no node at path %x in snapshot", path)
+		}
+		if record[0] == snapshotLeafType {
+			return serializeSnapshotLeaf(record), nil
+		}
+		return serializeSnapshotInternal(record), nil
+	}
+}
+
+// Tree returns a tree whose nodes are read from the snapshot when they
+// are accessed, with the resolver returned by Resolver which has to be
+// passed to all the operations on the tree.
+func (s *Snapshot) Tree() (VerkleNode, error) {
+	serialized, err := s.Resolver()(nil)
+	if err != nil {
+		return nil, err
+	}
+	return ParseNode(serialized, 0)
+}
+
+func serializeSnapshotInternal(record []byte) []byte {
+	ret := make([]byte, nodeTypeSize+bitlistSize+banderwagon.UncompressedSize)
+	ret[nodeTypeOffset] = internalRLPType
+	for i := 0; i < NodeWidth; i++ {
+		if binary.BigEndian.Uint64(record[snapshotInternalRefsOffset+i*snapshotRefSize:]) != 0 {
+			setBit(ret[internalBitlistOffset:internalCommitmentOffset], i)
+		}
+	}
+	copy(ret[internalCommitmentOffset:], record[snapshotInternalCommOffset:snapshotInternalRefsOffset])
+	return ret
+}
+
+func serializeSnapshotLeaf(record []byte) []byte {
+	bitlist := record[snapshotLeafBitlistOffset:snapshotLeafCommOffset]
+	ret := make([]byte, leafChildrenOffset, leafChildrenOffset+NodeWidth*LeafValueSize)
+	ret[nodeTypeOffset] = leafRLPType
+	copy(ret[leafSteamOffset:], record[snapshotLeafStemOffset:snapshotLeafBitlistOffset])
+	copy(ret[leafBitlistOffset:], bitlist)
+	copy(ret[leafCommitmentOffset:], record[snapshotLeafCommOffset:snapshotLeafValuesOffset])
+	for i := 0; i < NodeWidth; i++ {
+		if bit(bitlist, i) {
+			offset := snapshotLeafValuesOffset + i*LeafValueSize
+			ret = append(ret, record[offset:offset+LeafValueSize]...)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,87 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	mRand "math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	kvs := genRandomKeyValues(mRand.New(mRand.NewSource(42)), 300) //skipcq: GSC-G404
+	kvs = append(kvs, keyValue{zeroKeyTest, fourtyKeyTest}, keyValue{oneKeyTest, fourtyKeyTest})
+	root, resolver := flushedTree(t, nil, kvs)
+
+	path := filepath.Join(t.TempDir(), "snapshot")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSnapshot(f, root, resolver); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := OpenSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	comm, err := snap.Commitment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !comm.Equal(root.Commitment()) {
+		t.Fatal("invalid root commitment")
+	}
+	for _, kv := range kvs {
+		val, err := snap.Get(kv.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(val, kv.value) {
+			t.Fatalf("invalid value for key %x: %x != %x", kv.key, val, kv.value)
+		}
+	}
+	for _, key := range [][]byte{ffx32KeyTest, forkOneKeyTest} {
+		if val, err := snap.Get(key); err != nil || val != nil {
+			t.Fatalf("absent key %x has value %x (err=%v)", key, val, err)
+		}
+	}
+
+	// A tree read from the snapshot can be used to make proofs
+	tree, err := snap.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := [][]byte{kvs[0].key, kvs[100].key, ffx32KeyTest}
+	proof, _, _, _, err := MakeVerkleMultiProof(tree, nil, append([][]byte{}, keys...), snap.Resolver())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _, _, _, err := MakeVerkleMultiProof(root, nil, append([][]byte{}, keys...), resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proof.Equal(expected) {
+		t.Fatal("proofs made from the snapshot and the tree differ")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSnapshot(data[:len(data)-1]); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Fatalf("expected ErrInvalidSnapshot, got %v", err)
+	}
+	if _, err := NewSnapshot(append(data[:len(data):len(data)], 0)); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Fatalf("expected ErrInvalidSnapshot, got %v", err)
+	}
+}
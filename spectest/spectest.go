@@ -0,0 +1,281 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+// Package spectest runs verkle reference test fixtures against the
+// go-verkle API. A fixture file holds either a single fixture or a list
+// of fixtures, in the following JSON format:
+//
+//	{
+//	  "name": "description of the test",
+//	  "insert": [{"key": "0x...", "value": "0x..."}],
+//	  "delete": ["0x..."],
+//	  "root": "0x...",
+//	  "proofs": [{
+//	    "keys": ["0x..."],
+//	    "root": "0x...",
+//	    "verkleProof": {...},
+//	    "stateDiff": [...],
+//	    "valid": true
+//	  }]
+//	}
+//
+// The tree is built by applying the insertions, then the deletions, and
+// its root commitment is compared to "root" if present. Each proof is
+// then checked: if it specifies keys, a proof is generated for them and
+// its serialized form compared with the expected one. The expected proof
+// is verified against its root commitment (defaulting to the tree root),
+// and the outcome compared with "valid". verkleProof and stateDiff use
+// the same JSON encoding as the execution witness.
+package spectest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/gballet/go-verkle"
+)
+
+// KeyValue is a key and its value, hex-encoded.
+type KeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ProofFixture describes an expected proof.
+type ProofFixture struct {
+	Keys        []string            `json:"keys,omitempty"`
+	Root        string              `json:"root,omitempty"`
+	VerkleProof *verkle.VerkleProof `json:"verkleProof"`
+	StateDiff   verkle.StateDiff    `json:"stateDiff"`
+	Valid       bool                `json:"valid"`
+}
+
+// Fixture is a single reference test.
+type Fixture struct {
+	Name   string         `json:"name"`
+	Insert []KeyValue     `json:"insert,omitempty"`
+	Delete []string       `json:"delete,omitempty"`
+	Root   string         `json:"root,omitempty"`
+	Proofs []ProofFixture `json:"proofs,omitempty"`
+}
+
+// Load reads the fixtures contained in a file.
+func Load(path string) ([]Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var fixtures []Fixture
+		if err := json.Unmarshal(data, &fixtures); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", path, err)
+		}
+		return fixtures, nil
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return []Fixture{fixture}, nil
+}
+
+// LoadDir reads the fixtures of all the .json files found in dir and its
+// subdirectories, in lexicographic order of their paths.
+func LoadDir(dir string) ([]Fixture, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(path) == ".json" {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var fixtures []Fixture
+	for _, path := range paths {
+		fs, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		fixtures = append(fixtures, fs...)
+	}
+	return fixtures, nil
+}
+
+// RunDir runs every fixture found in dir as a subtest of t.
+func RunDir(t *testing.T, dir string) {
+	t.Helper()
+
+	fixtures, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatalf("no fixtures found in %s", dir)
+	}
+	for _, fixture := range fixtures {
+		fixture := fixture
+		t.Run(fixture.Name, func(t *testing.T) {
+			if err := fixture.Run(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// Run executes the fixture, and returns an error describing the first
+// divergence from the expected results.
+func (f *Fixture) Run() error {
+	root := verkle.New()
+	for _, kv := range f.Insert {
+		key, err := verkle.PrefixedHexStringToBytes(kv.Key)
+		if err != nil {
+			return fmt.Errorf("invalid key %q: %w", kv.Key, err)
+		}
+		value, err := verkle.PrefixedHexStringToBytes(kv.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value %q: %w", kv.Value, err)
+		}
+		if err := root.Insert(key, value, nil); err != nil {
+			return fmt.Errorf("inserting %x: %w", key, err)
+		}
+	}
+	for _, k := range f.Delete {
+		key, err := verkle.PrefixedHexStringToBytes(k)
+		if err != nil {
+			return fmt.Errorf("invalid key %q: %w", k, err)
+		}
+		if _, err := root.Delete(key, nil); err != nil {
+			return fmt.Errorf("deleting %x: %w", key, err)
+		}
+	}
+	rootC := root.Commit()
+	rootBytes := rootC.Bytes()
+	if f.Root != "" {
+		expected, err := verkle.PrefixedHexStringToBytes(f.Root)
+		if err != nil {
+			return fmt.Errorf("invalid root %q: %w", f.Root, err)
+		}
+		if !bytes.Equal(expected, rootBytes[:]) {
+			return fmt.Errorf("root mismatch: got %x, expected %x", rootBytes, expected)
+		}
+	}
+
+	for i := range f.Proofs {
+		if err := f.Proofs[i].run(root, rootC); err != nil {
+			return fmt.Errorf("proof #%d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (p *ProofFixture) run(root verkle.VerkleNode, rootC *verkle.Point) error {
+	if p.VerkleProof == nil {
+		return errors.New("missing proof")
+	}
+	if len(p.Keys) > 0 {
+		keys := make([][]byte, len(p.Keys))
+		for i, k := range p.Keys {
+			key, err := verkle.PrefixedHexStringToBytes(k)
+			if err != nil {
+				return fmt.Errorf("invalid key %q: %w", k, err)
+			}
+			keys[i] = key
+		}
+		proof, _, _, _, err := verkle.MakeVerkleMultiProof(root, nil, keys, nil)
+		if err != nil {
+			return fmt.Errorf("creating proof: %w", err)
+		}
+		vp, sd, err := verkle.SerializeProof(proof)
+		if err != nil {
+			return fmt.Errorf("serializing proof: %w", err)
+		}
+		if err := sameJSON(vp, p.VerkleProof); err != nil {
+			return fmt.Errorf("generated proof differs: %w", err)
+		}
+		if err := sameJSON(sd, p.StateDiff); err != nil {
+			return fmt.Errorf("generated state diff differs: %w", err)
+		}
+	}
+
+	if p.Root != "" {
+		rootBytes, err := verkle.PrefixedHexStringToBytes(p.Root)
+		if err != nil {
+			return fmt.Errorf("invalid proof root %q: %w", p.Root, err)
+		}
+		rootC = new(verkle.Point)
+		if err := rootC.SetBytes(rootBytes); err != nil {
+			return fmt.Errorf("invalid proof root %q: %w", p.Root, err)
+		}
+	}
+	err := verifyProof(p.VerkleProof, p.StateDiff, rootC)
+	if p.Valid && err != nil {
+		return fmt.Errorf("expected a valid proof: %w", err)
+	}
+	if !p.Valid && err == nil {
+		return errors.New("expected an invalid proof")
+	}
+	return nil
+}
+
+func verifyProof(vp *verkle.VerkleProof, sd verkle.StateDiff, rootC *verkle.Point) error {
+	proof, err := verkle.DecodeProof(vp, sd)
+	if err != nil {
+		return err
+	}
+	preroot, err := verkle.PreStateTreeFromProof(proof, rootC)
+	if err != nil {
+		return err
+	}
+	return verkle.VerifyVerkleProofWithPreState(proof, preroot)
+}
+
+func sameJSON(got, expected interface{}) error {
+	g, err := json.Marshal(got)
+	if err != nil {
+		return err
+	}
+	e, err := json.Marshal(expected)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(g, e) {
+		return fmt.Errorf("got %s, expected %s", g, e)
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+package spectest
+
+import "testing"
+
+func TestReferenceFixtures(t *testing.T) {
+	RunDir(t, "testdata")
+}
@@ -0,0 +1,156 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// stateDiffHashDomain is hashed first, so that the hash of a state diff
+// can't be confused with that of another structure.
+var stateDiffHashDomain = []byte("verkle-statediff-v1")
+
+const (
+	suffixDiffHasCurrent byte = 1 << iota
+	suffixDiffHasNew
+)
+
+// HashStateDiff returns a SHA256 hash of the contents of a state diff,
+// that doesn't depend on the order in which stems and suffixes appear. It
+// can be used to commit to a witness compactly. The hashed encoding is:
+//
+//	domain || stem count (u32) || stems...
+//	stem:   stem (31 bytes) || suffix count (u16) || suffixes...
+//	suffix: suffix || flags || current value (if flag 1) || new value (if flag 2)
+//
+// with stems and suffixes in ascending order, and integers big-endian.
+// Stems or suffixes appearing more than once are an error, as there is no
+// canonical way to merge them.
+func HashStateDiff(sd StateDiff) ([32]byte, error) {
+	stems := make([]*StemStateDiff, len(sd))
+	for i := range sd {
+		stems[i] = &sd[i]
+	}
+	sort.Slice(stems, func(i, j int) bool {
+		return bytes.Compare(stems[i].Stem[:], stems[j].Stem[:]) < 0
+	})
+
+	h := sha256.New()
+	h.Write(stateDiffHashDomain)
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(len(stems)))
+	h.Write(buf[:])
+	for i, stem := range stems {
+		if i > 0 && stem.Stem == stems[i-1].Stem {
+			return [32]byte{}, fmt.Errorf("duplicate stem %x in state diff", stem.Stem)
+		}
+		suffixes := make([]*SuffixStateDiff, len(stem.SuffixDiffs))
+		for j := range stem.SuffixDiffs {
+			suffixes[j] = &stem.SuffixDiffs[j]
+		}
+		sort.Slice(suffixes, func(i, j int) bool {
+			return suffixes[i].Suffix < suffixes[j].Suffix
+		})
+
+		h.Write(stem.Stem[:])
+		binary.BigEndian.PutUint16(buf[:2], uint16(len(suffixes)))
+		h.Write(buf[:2])
+		for j, suffix := range suffixes {
+			if j > 0 && suffix.Suffix == suffixes[j-1].Suffix {
+				return [32]byte{}, fmt.Errorf("duplicate suffix %d for stem %x in state diff", suffix.Suffix, stem.Stem)
+			}
+			var flags byte
+			if suffix.CurrentValue != nil {
+				flags |= suffixDiffHasCurrent
+			}
+			if suffix.NewValue != nil {
+				flags |= suffixDiffHasNew
+			}
+			h.Write([]byte{suffix.Suffix, flags})
+			if suffix.CurrentValue != nil {
+				h.Write(suffix.CurrentValue[:])
+			}
+			if suffix.NewValue != nil {
+				h.Write(suffix.NewValue[:])
+			}
+		}
+	}
+
+	var ret [32]byte
+	h.Sum(ret[:0])
+	return ret, nil
+}
+
+// Normalize returns a copy of sd in canonical form: stems in ascending
+// order, each appearing once with its suffixes in ascending order. The
+// suffixes of a stem appearing several times are merged. A suffix that
+// appears more than once for a stem is kept once if all its occurrences
+// are identical, and is an error otherwise.
+func (sd StateDiff) Normalize() (StateDiff, error) {
+	stems := sd.Copy()
+	sort.SliceStable(stems, func(i, j int) bool {
+		return bytes.Compare(stems[i].Stem[:], stems[j].Stem[:]) < 0
+	})
+
+	ret := make(StateDiff, 0, len(stems))
+	for _, stem := range stems {
+		if n := len(ret); n > 0 && ret[n-1].Stem == stem.Stem {
+			ret[n-1].SuffixDiffs = append(ret[n-1].SuffixDiffs, stem.SuffixDiffs...)
+			continue
+		}
+		ret = append(ret, stem)
+	}
+
+	for i := range ret {
+		suffixes := ret[i].SuffixDiffs
+		sort.SliceStable(suffixes, func(i, j int) bool {
+			return suffixes[i].Suffix < suffixes[j].Suffix
+		})
+		deduped := suffixes[:0]
+		for _, suffix := range suffixes {
+			if n := len(deduped); n > 0 && deduped[n-1].Suffix == suffix.Suffix {
+				if !equalDiffValues(deduped[n-1].CurrentValue, suffix.CurrentValue) || !equalDiffValues(deduped[n-1].NewValue, suffix.NewValue) {
+					return nil, fmt.Errorf("conflicting values for suffix %d of stem %x in state diff", suffix.Suffix, ret[i].Stem)
+				}
+				continue
+			}
+			deduped = append(deduped, suffix)
+		}
+		ret[i].SuffixDiffs = deduped
+	}
+	return ret, nil
+}
+
+func equalDiffValues(a, b *[32]byte) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
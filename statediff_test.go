@@ -0,0 +1,85 @@
+package verkle
+
+import "testing"
+
+func TestHashStateDiff(t *testing.T) {
+	t.Parallel()
+
+	var v1, v2 [32]byte
+	v1[0], v2[0] = 1, 2
+	sd := StateDiff{
+		{Stem: [31]byte{1}, SuffixDiffs: SuffixStateDiffs{{Suffix: 0, CurrentValue: &v1}, {Suffix: 3, NewValue: &v2}}},
+		{Stem: [31]byte{2}, SuffixDiffs: SuffixStateDiffs{{Suffix: 1, CurrentValue: &v1, NewValue: &v2}}},
+	}
+	h, err := HashStateDiff(sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same contents, different order
+	shuffled := StateDiff{
+		{Stem: [31]byte{2}, SuffixDiffs: SuffixStateDiffs{{Suffix: 1, CurrentValue: &v1, NewValue: &v2}}},
+		{Stem: [31]byte{1}, SuffixDiffs: SuffixStateDiffs{{Suffix: 3, NewValue: &v2}, {Suffix: 0, CurrentValue: &v1}}},
+	}
+	if got, err := HashStateDiff(shuffled); err != nil || got != h {
+		t.Fatalf("hash depends on ordering: %x != %x (%v)", got, h, err)
+	}
+	if shuffled[1].SuffixDiffs[0].Suffix != 3 {
+		t.Fatal("input state diff was modified")
+	}
+
+	// Moving a value from current to new changes the hash
+	changed := sd.Copy()
+	changed[0].SuffixDiffs[0].CurrentValue, changed[0].SuffixDiffs[0].NewValue = nil, &v1
+	if got, _ := HashStateDiff(changed); got == h {
+		t.Fatal("hash doesn't depend on which value is present")
+	}
+
+	dup := sd.Copy()
+	dup[1].Stem = dup[0].Stem
+	if _, err := HashStateDiff(dup); err == nil {
+		t.Fatal("duplicate stems should be rejected")
+	}
+	dup = sd.Copy()
+	dup[0].SuffixDiffs[1].Suffix = 0
+	if _, err := HashStateDiff(dup); err == nil {
+		t.Fatal("duplicate suffixes should be rejected")
+	}
+}
+
+func TestStateDiffNormalize(t *testing.T) {
+	t.Parallel()
+
+	var v1, v2 [32]byte
+	v1[0], v2[0] = 1, 2
+	sd := StateDiff{
+		{Stem: [31]byte{2}, SuffixDiffs: SuffixStateDiffs{{Suffix: 7, CurrentValue: &v1}, {Suffix: 1, NewValue: &v2}}},
+		{Stem: [31]byte{1}, SuffixDiffs: SuffixStateDiffs{{Suffix: 0, CurrentValue: &v1}}},
+		{Stem: [31]byte{2}, SuffixDiffs: SuffixStateDiffs{{Suffix: 3, CurrentValue: &v2}, {Suffix: 7, CurrentValue: &v1}}},
+	}
+	normalized, err := sd.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(normalized) != 2 || normalized[0].Stem != [31]byte{1} || normalized[1].Stem != [31]byte{2} {
+		t.Fatalf("invalid stems in normalized diff: %v", normalized)
+	}
+	var suffixes []byte
+	for _, suffix := range normalized[1].SuffixDiffs {
+		suffixes = append(suffixes, suffix.Suffix)
+	}
+	if string(suffixes) != string([]byte{1, 3, 7}) {
+		t.Fatalf("invalid suffixes in normalized diff: %v", suffixes)
+	}
+	if sd[0].SuffixDiffs[0].Suffix != 7 || len(sd) != 3 {
+		t.Fatal("input state diff was modified")
+	}
+	if _, err := HashStateDiff(normalized); err != nil {
+		t.Fatal(err)
+	}
+
+	sd[2].SuffixDiffs[1].NewValue = &v2
+	if _, err := sd.Normalize(); err == nil {
+		t.Fatal("conflicting suffixes should be rejected")
+	}
+}
@@ -0,0 +1,101 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+)
+
+// StemBitmap tells which suffixes of a stem hold a value. Bit i of
+// Bitmap, in the order of the bitlist of serialized leaves, is set if
+// suffix i is populated.
+type StemBitmap struct {
+	Stem   [StemSize]byte
+	Bitmap [bitlistSize]byte
+}
+
+// Has returns true if the suffix holds a value.
+func (b *StemBitmap) Has(suffix byte) bool {
+	return bit(b.Bitmap[:], int(suffix))
+}
+
+// Count returns the number of populated suffixes.
+func (b *StemBitmap) Count() int {
+	var count int
+	for _, x := range b.Bitmap {
+		count += bits.OnesCount8(x)
+	}
+	return count
+}
+
+// StemBitmaps returns the bitmaps of the populated suffixes of the stems
+// of the tree in [start, end), in increasing order, so that the shape of
+// the state can be measured without reading the values. A nil start
+// reads from the first stem, and a nil end up to the last one. Only the
+// subtrees holding stems of the range are resolved.
+func (n *InternalNode) StemBitmaps(start, end []byte, resolver NodeResolverFn) ([]StemBitmap, error) {
+	if start == nil {
+		start = make([]byte, StemSize)
+	}
+	if len(start) != StemSize || (end != nil && len(end) != StemSize) {
+		return nil, fmt.Errorf("invalid stem range %x-%x, stems are %d bytes long", start, end, StemSize)
+	}
+
+	var (
+		bitmaps []StemBitmap
+		err     error
+	)
+	visit := func(leaf *LeafNode) bool {
+		if bytes.Compare(leaf.stem, start) < 0 {
+			return true
+		}
+		if end != nil && bytes.Compare(leaf.stem, end) >= 0 {
+			return false
+		}
+		if leaf.isPOAStub {
+			err = fmt.Errorf("reading stem %x: %w", leaf.stem, ErrIsPOAStub)
+			return false
+		}
+		var b StemBitmap
+		copy(b.Stem[:], leaf.stem)
+		for i, v := range leaf.values {
+			if v != nil {
+				setBit(b.Bitmap[:], i)
+			}
+		}
+		bitmaps = append(bitmaps, b)
+		return true
+	}
+	if _, werr := n.walkStems(n.subtreePath(), start, true, false, resolver, visit); werr != nil {
+		return nil, werr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bitmaps, nil
+}
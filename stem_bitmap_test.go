@@ -0,0 +1,76 @@
+package verkle
+
+import (
+	"bytes"
+	mRand "math/rand"
+	"sort"
+	"testing"
+)
+
+func TestStemBitmaps(t *testing.T) {
+	t.Parallel()
+
+	kvs := genRandomKeyValues(mRand.New(mRand.NewSource(42)), 100) //skipcq: GSC-G404
+	kvs = append(kvs, keyValue{zeroKeyTest, fourtyKeyTest}, keyValue{oneKeyTest, fourtyKeyTest}, keyValue{ffx32KeyTest, fourtyKeyTest})
+	_, resolver := flushedTree(t, nil, kvs)
+	serialized, err := resolver(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := ParseNode(serialized, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	suffixes := map[string]map[byte]bool{}
+	for _, kv := range kvs {
+		stem := string(kv.key[:StemSize])
+		if suffixes[stem] == nil {
+			suffixes[stem] = map[byte]bool{}
+		}
+		suffixes[stem][kv.key[StemSize]] = true
+	}
+	var stems []string
+	for stem := range suffixes {
+		stems = append(stems, stem)
+	}
+	sort.Strings(stems)
+
+	all, err := root.(*InternalNode).StemBitmaps(nil, nil, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(stems) {
+		t.Fatalf("expected %d stems, got %d", len(stems), len(all))
+	}
+	for i, b := range all {
+		if string(b.Stem[:]) != stems[i] {
+			t.Fatalf("stem %d: %x != %x", i, b.Stem, stems[i])
+		}
+		if b.Count() != len(suffixes[stems[i]]) {
+			t.Fatalf("stem %x: %d suffixes, expected %d", b.Stem, b.Count(), len(suffixes[stems[i]]))
+		}
+		for suffix := range suffixes[stems[i]] {
+			if !b.Has(suffix) {
+				t.Fatalf("stem %x: suffix %d should be set", b.Stem, suffix)
+			}
+		}
+	}
+	if all[0].Count() != 2 || !all[0].Has(0) || !all[0].Has(1) {
+		t.Fatalf("invalid bitmap of the zero stem %x", all[0].Bitmap)
+	}
+
+	// A range starting at an existing stem, and ending at an absent one
+	start, end := []byte(stems[10]), append([]byte(stems[20][:StemSize-1]), stems[20][StemSize-1]+1)
+	bitmaps, err := root.(*InternalNode).StemBitmaps(start, end, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bitmaps) != 11 || !bytes.Equal(bitmaps[0].Stem[:], start) || string(bitmaps[10].Stem[:]) != stems[20] {
+		t.Fatalf("invalid range of %d stems", len(bitmaps))
+	}
+
+	if _, err := root.(*InternalNode).StemBitmaps(zeroKeyTest, nil, resolver); err == nil {
+		t.Fatal("a key should be rejected as range bound")
+	}
+}
@@ -0,0 +1,170 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"time"
+
+	"github.com/gballet/go-verkle"
+)
+
+// BenchmarkConfig describes a benchmark run.
+type BenchmarkConfig struct {
+	// Tree describes the tree the benchmark is run against.
+	Tree TreeConfig `json:"tree"`
+
+	// Proofs is the number of proofs generated and verified, each
+	// of them covering ProofKeys keys picked at random in the tree.
+	// They default to 10 proofs of 100 keys.
+	Proofs    int `json:"proofs"`
+	ProofKeys int `json:"proofKeys"`
+}
+
+// PhaseReport holds the measurements of a benchmark phase.
+type PhaseReport struct {
+	Name      string        `json:"name"`
+	Ops       int           `json:"ops"`
+	Duration  time.Duration `json:"durationNs"`
+	OpsPerSec float64       `json:"opsPerSec"`
+}
+
+// BenchmarkReport is the machine-readable result of a benchmark run.
+type BenchmarkReport struct {
+	Config BenchmarkConfig `json:"config"`
+
+	GoVersion  string        `json:"goVersion"`
+	GOOS       string        `json:"goos"`
+	GOARCH     string        `json:"goarch"`
+	NumCPU     int           `json:"numCPU"`
+	GOMAXPROCS int           `json:"gomaxprocs"`
+	Params     verkle.Params `json:"params"`
+
+	Keys   int           `json:"keys"`
+	Root   string        `json:"root"`
+	Phases []PhaseReport `json:"phases"`
+}
+
+func newPhaseReport(name string, ops int, d time.Duration) PhaseReport {
+	report := PhaseReport{Name: name, Ops: ops, Duration: d}
+	if d > 0 {
+		report.OpsPerSec = float64(ops) / d.Seconds()
+	}
+	return report
+}
+
+// RunBenchmark generates the tree described by the config, and measures
+// the throughput of inserting its keys, committing it, producing proofs
+// and verifying them the way a stateless client would: deserializing
+// the proof, rebuilding the pre-state tree and checking the proof
+// against it. Generating the key-values isn't measured.
+func RunBenchmark(config BenchmarkConfig) (*BenchmarkReport, error) {
+	if config.Tree.Leaves <= 0 {
+		return nil, errors.New("benchmark tree has no leaves")
+	}
+	if config.Proofs <= 0 {
+		config.Proofs = 10
+	}
+	if config.ProofKeys <= 0 {
+		config.ProofKeys = 100
+	}
+	report := &BenchmarkReport{
+		Config:     config,
+		GoVersion:  runtime.Version(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Params:     verkle.GetConfig().Params(),
+	}
+
+	kvs := RandomKeyValues(config.Tree)
+	report.Keys = len(kvs)
+	if config.ProofKeys > len(kvs) {
+		config.ProofKeys = len(kvs)
+		report.Config.ProofKeys = len(kvs)
+	}
+
+	root := verkle.New()
+	start := time.Now()
+	for _, kv := range kvs {
+		if err := root.Insert(kv.Key, kv.Value, nil); err != nil {
+			return nil, fmt.Errorf("inserting key %x: %w", kv.Key, err)
+		}
+	}
+	report.Phases = append(report.Phases, newPhaseReport("insert", len(kvs), time.Since(start)))
+
+	start = time.Now()
+	rootC := root.Commit()
+	report.Phases = append(report.Phases, newPhaseReport("commit", 1, time.Since(start)))
+	rootBytes := rootC.Bytes()
+	report.Root = verkle.HexToPrefixedString(rootBytes[:])
+
+	r := rand.New(rand.NewSource(config.Tree.Seed)) //skipcq: GSC-G404
+	keySets := make([][][]byte, config.Proofs)
+	for i := range keySets {
+		for _, idx := range r.Perm(len(kvs))[:config.ProofKeys] {
+			keySets[i] = append(keySets[i], kvs[idx].Key)
+		}
+	}
+
+	var (
+		proofs = make([]*verkle.VerkleProof, config.Proofs)
+		diffs  = make([]verkle.StateDiff, config.Proofs)
+	)
+	start = time.Now()
+	for i, keys := range keySets {
+		proof, _, _, _, err := verkle.MakeVerkleMultiProof(root, nil, keys, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating proof: %w", err)
+		}
+		if proofs[i], diffs[i], err = verkle.SerializeProof(proof); err != nil {
+			return nil, fmt.Errorf("serializing proof: %w", err)
+		}
+	}
+	report.Phases = append(report.Phases, newPhaseReport("prove", config.Proofs, time.Since(start)))
+
+	start = time.Now()
+	for i := range proofs {
+		proof, err := verkle.DeserializeProof(proofs[i], diffs[i])
+		if err != nil {
+			return nil, fmt.Errorf("deserializing proof: %w", err)
+		}
+		preroot, err := verkle.PreStateTreeFromProof(proof, rootC)
+		if err != nil {
+			return nil, fmt.Errorf("rebuilding pre-state tree: %w", err)
+		}
+		if err := verkle.VerifyVerkleProofWithPreState(proof, preroot); err != nil {
+			return nil, fmt.Errorf("verifying proof: %w", err)
+		}
+	}
+	report.Phases = append(report.Phases, newPhaseReport("verify", config.Proofs, time.Since(start)))
+
+	return report, nil
+}
@@ -0,0 +1,36 @@
+package testutil
+
+import "testing"
+
+func TestRunBenchmark(t *testing.T) {
+	t.Parallel()
+
+	report, err := RunBenchmark(BenchmarkConfig{
+		Tree:      TreeConfig{Seed: 1, Leaves: 50, ValuesPerLeaf: 2},
+		Proofs:    2,
+		ProofKeys: 200,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Keys != 100 {
+		t.Fatalf("invalid number of keys: %d", report.Keys)
+	}
+	// ProofKeys is capped at the number of keys in the tree
+	if report.Config.ProofKeys != 100 {
+		t.Fatalf("invalid number of keys per proof: %d", report.Config.ProofKeys)
+	}
+	expected := []string{"insert", "commit", "prove", "verify"}
+	if len(report.Phases) != len(expected) {
+		t.Fatalf("invalid number of phases: %d", len(report.Phases))
+	}
+	for i, phase := range report.Phases {
+		if phase.Name != expected[i] || phase.Ops == 0 || phase.Duration <= 0 {
+			t.Fatalf("invalid phase report %+v", phase)
+		}
+	}
+
+	if _, err := RunBenchmark(BenchmarkConfig{}); err == nil {
+		t.Fatal("benchmarking an empty tree should fail")
+	}
+}
@@ -0,0 +1,153 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+// Package testutil contains helpers to build verkle trees in tests. All
+// the generated data only depends on the seed, so that a failing case
+// can be reproduced exactly from its seed.
+package testutil
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/gballet/go-verkle"
+)
+
+// ValueDistribution selects how the generated values look like.
+type ValueDistribution int
+
+const (
+	// RandomValues are uniformly random.
+	RandomValues ValueDistribution = iota
+	// SmallValues are little-endian integers below 2^16,
+	// which is what most balances, nonces and counters look like.
+	SmallValues
+	// ZeroValues only contain zero bytes.
+	ZeroValues
+	// MixedValues picks one of the above distributions for each value.
+	MixedValues
+)
+
+// TreeConfig describes the tree to generate.
+type TreeConfig struct {
+	Seed int64
+
+	// Leaves is the number of distinct stems in the tree.
+	Leaves int
+
+	// ValuesPerLeaf is the number of values written at each stem.
+	// It defaults to 1 and is capped at verkle.NodeWidth.
+	ValuesPerLeaf int
+
+	// ClusterSize is the number of consecutive stems that share a
+	// common prefix of ClusterPrefixLen bytes, which produces deeper
+	// branches than uniformly random stems. A ClusterSize of 0 or 1
+	// disables clustering.
+	ClusterSize      int
+	ClusterPrefixLen int
+
+	Values ValueDistribution
+}
+
+// KeyValue is a key and the value inserted at that key.
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// RandomKeyValues generates the key-values described by the config.
+// Keys are returned in generation order, not sorted.
+func RandomKeyValues(config TreeConfig) []KeyValue {
+	r := rand.New(rand.NewSource(config.Seed)) //skipcq: GSC-G404
+
+	valuesPerLeaf := config.ValuesPerLeaf
+	if valuesPerLeaf <= 0 {
+		valuesPerLeaf = 1
+	}
+	if valuesPerLeaf > verkle.NodeWidth {
+		valuesPerLeaf = verkle.NodeWidth
+	}
+	prefixLen := config.ClusterPrefixLen
+	if prefixLen > verkle.StemSize-1 {
+		prefixLen = verkle.StemSize - 1
+	}
+
+	var (
+		kvs    = make([]KeyValue, 0, config.Leaves*valuesPerLeaf)
+		seen   = make(map[string]struct{}, config.Leaves)
+		prefix = make([]byte, prefixLen)
+	)
+	for len(seen) < config.Leaves {
+		stem := make([]byte, verkle.StemSize)
+		r.Read(stem)
+		if config.ClusterSize > 1 && prefixLen > 0 {
+			if len(seen)%config.ClusterSize == 0 {
+				r.Read(prefix)
+			}
+			copy(stem, prefix)
+		}
+		if _, ok := seen[string(stem)]; ok {
+			continue
+		}
+		seen[string(stem)] = struct{}{}
+
+		for _, suffix := range r.Perm(verkle.NodeWidth)[:valuesPerLeaf] {
+			key := make([]byte, verkle.StemSize+1)
+			copy(key, stem)
+			key[verkle.StemSize] = byte(suffix)
+			kvs = append(kvs, KeyValue{Key: key, Value: randomValue(r, config.Values)})
+		}
+	}
+	return kvs
+}
+
+func randomValue(r *rand.Rand, dist ValueDistribution) []byte {
+	value := make([]byte, verkle.LeafValueSize)
+	if dist == MixedValues {
+		dist = ValueDistribution(r.Intn(int(MixedValues)))
+	}
+	switch dist {
+	case SmallValues:
+		value[0], value[1] = byte(r.Intn(256)), byte(r.Intn(256))
+	case ZeroValues:
+	default:
+		r.Read(value)
+	}
+	return value
+}
+
+// RandomTree builds and commits the tree described by the config, and
+// returns it along with the key-values it contains.
+func RandomTree(config TreeConfig) (verkle.VerkleNode, []KeyValue, error) {
+	kvs := RandomKeyValues(config)
+	root := verkle.New()
+	for _, kv := range kvs {
+		if err := root.Insert(kv.Key, kv.Value, nil); err != nil {
+			return nil, nil, fmt.Errorf("inserting key %x: %w", kv.Key, err)
+		}
+	}
+	root.Commit()
+	return root, kvs, nil
+}
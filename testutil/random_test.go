@@ -0,0 +1,56 @@
+package testutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRandomTreeDeterministic(t *testing.T) {
+	t.Parallel()
+
+	config := TreeConfig{Seed: 42, Leaves: 100, ValuesPerLeaf: 3, Values: MixedValues}
+	root1, kvs1, err := RandomTree(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root2, kvs2, err := RandomTree(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs1) != 300 || len(kvs2) != len(kvs1) {
+		t.Fatalf("invalid number of key-values: %d, %d", len(kvs1), len(kvs2))
+	}
+	if !root1.Commit().Equal(root2.Commit()) {
+		t.Fatal("same seed produced different trees")
+	}
+
+	config.Seed = 43
+	root3, _, err := RandomTree(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root1.Commit().Equal(root3.Commit()) {
+		t.Fatal("different seeds produced the same tree")
+	}
+}
+
+func TestRandomKeyValuesClustering(t *testing.T) {
+	t.Parallel()
+
+	kvs := RandomKeyValues(TreeConfig{Seed: 1, Leaves: 20, ClusterSize: 5, ClusterPrefixLen: 4, Values: ZeroValues})
+	if len(kvs) != 20 {
+		t.Fatalf("invalid number of key-values: %d", len(kvs))
+	}
+	for i := 0; i < len(kvs); i += 5 {
+		for j := i + 1; j < i+5; j++ {
+			if !bytes.Equal(kvs[i].Key[:4], kvs[j].Key[:4]) {
+				t.Fatalf("keys %x and %x should be in the same cluster", kvs[i].Key, kvs[j].Key)
+			}
+		}
+	}
+	for _, kv := range kvs {
+		if !bytes.Equal(kv.Value, make([]byte, 32)) {
+			t.Fatalf("non-zero value %x", kv.Value)
+		}
+	}
+}
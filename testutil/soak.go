@@ -0,0 +1,297 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/gballet/go-verkle"
+)
+
+// SoakConfig describes a soak test run.
+type SoakConfig struct {
+	Seed int64
+
+	// The run stops after Duration, or after Cycles cycles, whichever
+	// comes first. At least one of them has to be set.
+	Duration time.Duration
+	Cycles   int
+
+	// Each cycle performs OpsPerCycle random writes, a DeleteRatio
+	// fraction of them being deletions of existing keys, and then
+	// commits the tree, proves ProofKeys random keys, present or not,
+	// and flushes the tree to the store. They default to 100 writes,
+	// 25% of deletions and 16 keys.
+	OpsPerCycle int
+	DeleteRatio float64
+	ProofKeys   int
+
+	// Values is the distribution of the written values.
+	Values ValueDistribution
+
+	// CheckEvery is the number of cycles between two integrity checks,
+	// which reload the tree from the store and check it against the
+	// expected key-values. It defaults to 10.
+	CheckEvery int
+
+	// Store is where the tree is flushed to, and read from. It defaults
+	// to a verkle.MemoryStore.
+	Store verkle.NodeStore
+
+	// Progress, if not nil, is called after each integrity check.
+	Progress func(SoakStats)
+}
+
+// SoakStats reports the progress of a soak test run.
+type SoakStats struct {
+	Cycles  int           `json:"cycles"`
+	Inserts int           `json:"inserts"`
+	Deletes int           `json:"deletes"`
+	Proofs  int           `json:"proofs"`
+	Checks  int           `json:"checks"`
+	Keys    int           `json:"keys"` // keys currently in the tree
+	Elapsed time.Duration `json:"elapsedNs"`
+	Root    string        `json:"root"`
+}
+
+type soakState struct {
+	config   SoakConfig
+	r        *rand.Rand
+	store    verkle.NodeStore
+	root     verkle.VerkleNode
+	expected map[string][]byte
+	keys     [][]byte // keys of expected, in insertion order
+	stats    SoakStats
+}
+
+// RunSoak runs randomized insert, delete, commit, prove and verify cycles
+// against a tree that is flushed to, and resolved from, a store, and
+// periodically checks the integrity of the stored tree. It is meant to
+// qualify releases with runs lasting hours, and stops at the first
+// failure, or when ctx is cancelled. The returned error includes the
+// cycle and seed, so that a failure can be reproduced.
+func RunSoak(ctx context.Context, config SoakConfig) (SoakStats, error) {
+	if config.Duration <= 0 && config.Cycles <= 0 {
+		return SoakStats{}, errors.New("soak test has neither a duration nor a number of cycles")
+	}
+	if config.OpsPerCycle <= 0 {
+		config.OpsPerCycle = 100
+	}
+	if config.DeleteRatio <= 0 {
+		config.DeleteRatio = 0.25
+	}
+	if config.ProofKeys <= 0 {
+		config.ProofKeys = 16
+	}
+	if config.CheckEvery <= 0 {
+		config.CheckEvery = 10
+	}
+	s := &soakState{
+		config:   config,
+		r:        rand.New(rand.NewSource(config.Seed)), //skipcq: GSC-G404
+		store:    config.Store,
+		root:     verkle.New(),
+		expected: make(map[string][]byte),
+	}
+	if s.store == nil {
+		s.store = verkle.NewMemoryStore()
+	}
+
+	start := time.Now()
+	for config.Cycles <= 0 || s.stats.Cycles < config.Cycles {
+		if config.Duration > 0 && time.Since(start) >= config.Duration {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			s.stats.Elapsed = time.Since(start)
+			return s.stats, err
+		}
+		if err := s.cycle(); err != nil {
+			s.stats.Elapsed = time.Since(start)
+			return s.stats, fmt.Errorf("soak cycle %d (seed %d): %w", s.stats.Cycles, config.Seed, err)
+		}
+		s.stats.Cycles++
+		s.stats.Elapsed = time.Since(start)
+		if s.stats.Cycles%config.CheckEvery == 0 {
+			if err := s.check(); err != nil {
+				return s.stats, fmt.Errorf("soak integrity check after cycle %d (seed %d): %w", s.stats.Cycles, config.Seed, err)
+			}
+			if config.Progress != nil {
+				config.Progress(s.stats)
+			}
+		}
+	}
+	return s.stats, nil
+}
+
+func (s *soakState) resolver(path []byte) ([]byte, error) {
+	return s.store.Get(path)
+}
+
+func (s *soakState) cycle() error {
+	for i := 0; i < s.config.OpsPerCycle; i++ {
+		if len(s.keys) > 0 && s.r.Float64() < s.config.DeleteRatio {
+			if err := s.delete(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.insert(); err != nil {
+			return err
+		}
+	}
+
+	rootC := s.root.Commit()
+	rootBytes := rootC.Bytes()
+	s.stats.Root = verkle.HexToPrefixedString(rootBytes[:])
+
+	if err := verkle.CheckProofAgreement(s.root, s.proofKeys(), s.resolver); err != nil {
+		return err
+	}
+	s.stats.Proofs++
+
+	var flushErr error
+	s.root.(*verkle.InternalNode).Flush(func(path []byte, node verkle.VerkleNode) {
+		if flushErr != nil {
+			return
+		}
+		serialized, err := node.Serialize()
+		if err != nil {
+			flushErr = fmt.Errorf("serializing node at path %x: %w", path, err)
+			return
+		}
+		flushErr = s.store.Put(path, serialized)
+	})
+	return flushErr
+}
+
+// randomKey returns a new key, at an existing stem half of the time so
+// that leaves get more than one value.
+func (s *soakState) randomKey() []byte {
+	key := make([]byte, verkle.StemSize+1)
+	if len(s.keys) > 0 && s.r.Intn(2) == 0 {
+		copy(key, s.keys[s.r.Intn(len(s.keys))][:verkle.StemSize])
+		key[verkle.StemSize] = byte(s.r.Intn(verkle.NodeWidth))
+	} else {
+		s.r.Read(key)
+	}
+	return key
+}
+
+func (s *soakState) insert() error {
+	key := s.randomKey()
+	if len(s.keys) > 0 && s.r.Intn(4) == 0 {
+		// Overwrite an existing value
+		key = s.keys[s.r.Intn(len(s.keys))]
+	}
+	value := randomValue(s.r, s.config.Values)
+	if err := s.root.Insert(key, value, s.resolver); err != nil {
+		return fmt.Errorf("inserting key %x: %w", key, err)
+	}
+	if _, ok := s.expected[string(key)]; !ok {
+		s.keys = append(s.keys, key)
+	}
+	s.expected[string(key)] = value
+	s.stats.Inserts++
+	return nil
+}
+
+func (s *soakState) delete() error {
+	i := s.r.Intn(len(s.keys))
+	key := s.keys[i]
+	if _, err := s.root.Delete(key, s.resolver); err != nil {
+		return fmt.Errorf("deleting key %x: %w", key, err)
+	}
+	delete(s.expected, string(key))
+	s.keys[i] = s.keys[len(s.keys)-1]
+	s.keys = s.keys[:len(s.keys)-1]
+	s.stats.Deletes++
+	return nil
+}
+
+// proofKeys picks keys to prove, a quarter of them being absent keys.
+func (s *soakState) proofKeys() [][]byte {
+	keys := make([][]byte, 0, s.config.ProofKeys)
+	for len(keys) < s.config.ProofKeys {
+		if len(s.keys) == 0 || s.r.Intn(4) == 0 {
+			keys = append(keys, s.randomKey())
+			continue
+		}
+		keys = append(keys, s.keys[s.r.Intn(len(s.keys))])
+	}
+	return keys
+}
+
+// check reloads the tree from the store, checks that its commitment is
+// the one of the in-memory tree, and that it contains exactly the
+// expected key-values.
+func (s *soakState) check() error {
+	s.stats.Checks++
+	s.stats.Keys = len(s.expected)
+
+	serialized, err := s.store.Get(nil)
+	if err != nil {
+		return fmt.Errorf("reading root: %w", err)
+	}
+	stored, err := verkle.ParseNode(serialized, 0)
+	if err != nil {
+		return fmt.Errorf("parsing root: %w", err)
+	}
+	if !stored.Commitment().Equal(s.root.Commitment()) {
+		return errors.New("stored root commitment differs from the in-memory one")
+	}
+
+	var count int
+	err = verkle.ExportFlatTable(stored, s.resolver, func(row *verkle.FlatStem) error {
+		for suffix, value := range row.Values {
+			if value == nil {
+				continue
+			}
+			key := append(append([]byte{}, row.Stem...), byte(suffix))
+			expected, ok := s.expected[string(key)]
+			if !ok {
+				return fmt.Errorf("unexpected key %x in stored tree", key)
+			}
+			if !bytes.Equal(expected, value) {
+				return fmt.Errorf("stored value %x for key %x, expected %x", value, key, expected)
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if count != len(s.expected) {
+		return fmt.Errorf("stored tree has %d keys, expected %d", count, len(s.expected))
+	}
+	return nil
+}
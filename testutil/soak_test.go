@@ -0,0 +1,46 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gballet/go-verkle"
+)
+
+func TestRunSoak(t *testing.T) {
+	t.Parallel()
+
+	var progress []SoakStats
+	store := verkle.NewMemoryStore()
+	stats, err := RunSoak(context.Background(), SoakConfig{
+		Seed:        7,
+		Cycles:      6,
+		OpsPerCycle: 50,
+		ProofKeys:   8,
+		CheckEvery:  3,
+		Values:      MixedValues,
+		Store:       store,
+		Progress:    func(s SoakStats) { progress = append(progress, s) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Cycles != 6 || stats.Checks != 2 || stats.Proofs != 6 || len(progress) != 2 {
+		t.Fatalf("invalid stats %+v, %d progress reports", stats, len(progress))
+	}
+	if stats.Inserts+stats.Deletes != 300 || stats.Deletes == 0 || stats.Keys == 0 {
+		t.Fatalf("invalid operation counts %+v", stats)
+	}
+	if store.Len() == 0 {
+		t.Fatal("tree wasn't flushed to the store")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := RunSoak(ctx, SoakConfig{Cycles: 1}); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := RunSoak(context.Background(), SoakConfig{}); err == nil {
+		t.Fatal("soak test without a stop condition should be rejected")
+	}
+}
@@ -0,0 +1,91 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import "sync/atomic"
+
+// Names of the spans started by the package.
+const (
+	SpanCommit      = "verkle.Commit"
+	SpanFlush       = "verkle.Flush"
+	SpanMakeProof   = "verkle.MakeVerkleMultiProof"
+	SpanVerifyProof = "verkle.VerifyVerkleProof"
+)
+
+// Names of the span attributes.
+const (
+	AttrNodeCount = "verkle.nodes" // number of nodes committed or flushed, or of commitments in a proof
+	AttrKeyCount  = "verkle.keys"  // number of keys covered by a proof
+)
+
+// Tracer starts a span around the expensive operations of the tree, so
+// that their latency can be attributed inside a wider trace. It is meant
+// to be a thin adapter over an OpenTelemetry (or similar) tracer: since
+// the tree API doesn't carry a context, the adapter is responsible for
+// parenting the spans, e.g. to the span of the block being processed.
+type Tracer interface {
+	StartSpan(name string) Span
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttribute(key string, value int64)
+	End()
+}
+
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(string) Span { return noopSpan{} }
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, int64) {}
+func (noopSpan) End()                       {}
+
+// tracerHolder keeps the concrete type stored in tracerSink constant,
+// which atomic.Value requires.
+type tracerHolder struct {
+	Tracer
+}
+
+var tracerSink atomic.Value
+
+func init() {
+	tracerSink.Store(tracerHolder{noopTracer{}})
+}
+
+// SetTracer installs the tracer used by the package. Passing nil
+// disables tracing, which is the default.
+func SetTracer(t Tracer) {
+	if t == nil {
+		t = noopTracer{}
+	}
+	tracerSink.Store(tracerHolder{t})
+}
+
+func startSpan(name string) Span {
+	return tracerSink.Load().(tracerHolder).Tracer.StartSpan(name)
+}
@@ -0,0 +1,74 @@
+package verkle
+
+import (
+	"sync"
+	"testing"
+)
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]int64
+	ended bool
+}
+
+func (s *recordedSpan) SetAttribute(key string, value int64) { s.attrs[key] = value }
+func (s *recordedSpan) End()                                 { s.ended = true }
+
+type recordingTracer struct {
+	lock  sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) StartSpan(name string) Span {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	span := &recordedSpan{name: name, attrs: map[string]int64{}}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func TestTracingSpans(t *testing.T) {
+	tracer := &recordingTracer{}
+	SetTracer(tracer)
+	defer SetTracer(nil)
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	proof, cis, zis, yis, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyVerkleProof(proof, cis, zis, yis, GetConfig()); !ok || err != nil {
+		t.Fatalf("could not verify proof: %v", err)
+	}
+	root.(*InternalNode).Flush(func([]byte, VerkleNode) {})
+
+	expected := []struct {
+		name  string
+		attrs map[string]int64
+	}{
+		{SpanCommit, map[string]int64{AttrNodeCount: 1}},
+		{SpanMakeProof, map[string]int64{AttrKeyCount: 1, AttrNodeCount: 3}},
+		{SpanVerifyProof, map[string]int64{AttrKeyCount: 1, AttrNodeCount: 3}},
+		{SpanFlush, map[string]int64{AttrNodeCount: 3}},
+	}
+	if len(tracer.spans) != len(expected) {
+		t.Fatalf("invalid number of spans: %d != %d", len(tracer.spans), len(expected))
+	}
+	for i, span := range tracer.spans {
+		if span.name != expected[i].name || !span.ended {
+			t.Fatalf("invalid span #%d: %s, ended=%v", i, span.name, span.ended)
+		}
+		for key, value := range expected[i].attrs {
+			if span.attrs[key] != value {
+				t.Fatalf("invalid attribute %s for span %s: %d != %d", key, span.name, span.attrs[key], value)
+			}
+		}
+	}
+}
@@ -30,8 +30,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/crate-crypto/go-ipa/banderwagon"
 )
@@ -80,6 +82,9 @@ type VerkleNode interface {
 	// returns them breadth-first. On top of that, it returns
 	// one "extension status" per stem, and an alternate stem
 	// if the key is missing but another stem has been found.
+	// Keys are visited in increasing order, whatever their
+	// order in the list, so that the result only depends on
+	// the tree and the set of keys.
 	GetProofItems(keylist, NodeResolverFn) (*ProofElements, []byte, [][]byte, error)
 
 	// Serialize encodes the node to RLP.
@@ -105,6 +110,37 @@ type ProofElements struct {
 
 	// dedups flags the presence of each (Ci,zi) tuple
 	dedups map[*Point]map[byte]struct{}
+
+	// incomplete is true if some of the polynomials Fis aren't fully
+	// known, which doesn't prevent verification but makes proving
+	// impossible.
+	incomplete bool
+}
+
+// polyCache maps the commitments opened by a proof to their polynomial,
+// in evaluation form, so that they aren't recomputed when the proof is
+// extended.
+type polyCache map[*Point][]Fr
+
+// polys returns the polynomials of the commitments opened in pe.
+func (pe *ProofElements) polys() polyCache {
+	polys := make(polyCache, len(pe.Cis))
+	for i, ci := range pe.Cis {
+		polys[ci] = pe.Fis[i]
+	}
+	return polys
+}
+
+// proofItems is GetProofItems, reusing the polynomials found in polys.
+func proofItems(node VerkleNode, keys keylist, resolver NodeResolverFn, polys polyCache) (*ProofElements, []byte, [][]byte, error) {
+	switch n := node.(type) {
+	case *InternalNode:
+		return n.getProofItems(keys, resolver, polys)
+	case *LeafNode:
+		return n.getProofItems(keys, polys)
+	default:
+		return node.GetProofItems(keys, resolver)
+	}
 }
 
 // Merge merges the elements of two proofs and removes duplicates.
@@ -151,6 +187,7 @@ func (pe *ProofElements) Merge(other *ProofElements) {
 	}
 
 	pe.Vals = append(pe.Vals, other.Vals...)
+	pe.incomplete = pe.incomplete || other.incomplete
 }
 
 const (
@@ -173,6 +210,37 @@ type (
 		commitment *Point
 
 		cow map[byte]*Point
+
+		// hashedComms holds the commitments of the children that were
+		// replaced with a HashedNode when flushed or evicted, when
+		// corruption detection is enabled, to check them when they are
+		// resolved again.
+		hashedComms map[byte]*Point
+
+		// deletedStems holds the stems of the leaves deleted below
+		// this node since the last commit, when a CommitHook is set.
+		deletedStems [][]byte
+
+		// pendingChanges holds the stem changes of the nodes committed
+		// by CommitPartial, until the root is fully committed and they
+		// are reported to the CommitHook.
+		pendingChanges []StemChange
+
+		// clean is true if the node was resolved, and neither it nor
+		// its descendants have been modified since, see EvictClean.
+		clean bool
+
+		// evictions is the value of the evictor's pressure counter
+		// at the last eviction, and is only used at the root.
+		evictions uint64
+
+		// busy is non-zero while the node is committed, flushed or
+		// modified, see acquire.
+		busy int32
+
+		// cfg is the configuration of the tree this node belongs to,
+		// or nil if it uses the one returned by GetConfig.
+		cfg *Config
 	}
 
 	LeafNode struct {
@@ -188,6 +256,18 @@ type (
 		// for a steam that isn't present in the tree. This flag is only
 		// true in the context of a stateless tree.
 		isPOAStub bool
+
+		// isPartial indicates that only some of the values of this leaf
+		// are known, as is the case in a stateless tree.
+		isPartial bool
+
+		// clean is true if the leaf was resolved, and hasn't been
+		// modified since, see EvictClean.
+		clean bool
+
+		// cfg is the configuration of the tree this leaf belongs to,
+		// or nil if it uses the one returned by GetConfig.
+		cfg *Config
 	}
 )
 
@@ -241,6 +321,14 @@ func New() VerkleNode {
 	return newInternalNode(0)
 }
 
+// NewWithConfig creates a new tree root using conf instead of the
+// configuration returned by GetConfig, see InternalNode.SetConfig.
+func NewWithConfig(conf *Config) VerkleNode {
+	root := newInternalNode(0).(*InternalNode)
+	root.cfg = conf
+	return root
+}
+
 func NewStatelessInternal(depth byte, comm *Point) VerkleNode {
 	node := &InternalNode{
 		children:   make([]VerkleNode, NodeWidth),
@@ -255,7 +343,16 @@ func NewStatelessInternal(depth byte, comm *Point) VerkleNode {
 
 // New creates a new leaf node
 func NewLeafNode(stem []byte, values [][]byte) (*LeafNode, error) {
-	cfg := GetConfig()
+	return newLeafNode(nil, stem, values)
+}
+
+// newLeafNode creates a leaf node of the tree using conf, or the
+// configuration returned by GetConfig if conf is nil.
+func newLeafNode(conf *Config, stem []byte, values [][]byte) (*LeafNode, error) {
+	cfg := conf
+	if cfg == nil {
+		cfg = GetConfig()
+	}
 
 	// C1.
 	var c1poly [NodeWidth]Fr
@@ -306,6 +403,7 @@ func NewLeafNode(stem []byte, values [][]byte) (*LeafNode, error) {
 		commitment: cfg.CommitToPoly(poly[:], NodeWidth-4),
 		c1:         c1,
 		c2:         c2,
+		cfg:        conf,
 	}, nil
 }
 
@@ -321,6 +419,54 @@ func NewLeafNodeWithNoComms(stem []byte, values [][]byte) *LeafNode {
 	}
 }
 
+// Config returns the configuration used by the tree this node belongs to.
+func (n *InternalNode) Config() *Config {
+	return n.config()
+}
+
+// SetConfig makes the subtree rooted at n use conf instead of the
+// configuration returned by GetConfig, so that trees with different
+// configurations can be used concurrently. The nodes created
+// or resolved later inherit it from their parent. Passing nil reverts
+// to GetConfig. All configurations share the same CRS, so this doesn't
+// invalidate the commitments of the tree.
+func (n *InternalNode) SetConfig(conf *Config) {
+	n.cfg = conf
+	for _, child := range n.children {
+		switch c := child.(type) {
+		case *InternalNode:
+			c.SetConfig(conf)
+		case *LeafNode:
+			c.cfg = conf
+		}
+	}
+}
+
+func (n *InternalNode) config() *Config {
+	if n.cfg != nil {
+		return n.cfg
+	}
+	return GetConfig()
+}
+
+func (n *LeafNode) config() *Config {
+	if n.cfg != nil {
+		return n.cfg
+	}
+	return GetConfig()
+}
+
+// configOf returns the configuration used by the tree rooted at node.
+func configOf(node VerkleNode) *Config {
+	switch n := node.(type) {
+	case *InternalNode:
+		return n.config()
+	case *LeafNode:
+		return n.config()
+	}
+	return GetConfig()
+}
+
 // Children return the children of the node. The returned slice is
 // internal to the tree, so callers *must* consider it readonly.
 func (n *InternalNode) Children() []VerkleNode {
@@ -333,10 +479,47 @@ func (n *InternalNode) SetChild(i int, c VerkleNode) error {
 		return errors.New("child index higher than node width")
 	}
 	n.children[i] = c
+	n.clean = false
 	return nil
 }
 
+// acquire marks the node as in use by a commit, flush or modification,
+// and returns false if it already was. Since the tree isn't safe for
+// concurrent use, this is cheap detection of misuse that would
+// otherwise silently corrupt the tree.
+func (n *InternalNode) acquire() bool {
+	return atomic.CompareAndSwapInt32(&n.busy, 0, 1)
+}
+
+func (n *InternalNode) release() {
+	atomic.StoreInt32(&n.busy, 0)
+}
+
+// enter acquires n and returns true if it must be released. If n is in
+// use by another goroutine, it returns ErrConcurrentAccess when strict is
+// set. Otherwise, for Commit and Flush which can't return an error, the
+// misuse is only logged and they carry on without the flag, as they did
+// before it was introduced.
+func (n *InternalNode) enter(strict bool) (bool, error) {
+	if n.acquire() {
+		return true, nil
+	}
+	if strict {
+		return false, ErrConcurrentAccess
+	}
+	getLogger().Error("Concurrent use of a tree node", "depth", n.depth, "err", ErrConcurrentAccess)
+	return false, nil
+}
+
 func (n *InternalNode) cowChild(index byte) {
+	n.clean = false
+	switch child := n.children[index].(type) {
+	case *InternalNode:
+		child.clean = false
+	case *LeafNode:
+		child.clean = false
+	}
+
 	if n.cow == nil {
 		n.cow = make(map[byte]*Point)
 	}
@@ -348,47 +531,88 @@ func (n *InternalNode) cowChild(index byte) {
 }
 
 func (n *InternalNode) Insert(key []byte, value []byte, resolver NodeResolverFn) error {
+	if _, err := PadValue(value, AlignLeft); err != nil {
+		return err
+	}
+	if err := n.config().checkValue(key, value); err != nil {
+		return err
+	}
 	values := make([][]byte, NodeWidth)
 	values[key[31]] = value
 	return n.InsertValuesAtStem(key[:31], values, resolver)
 }
 
 func (n *InternalNode) InsertValuesAtStem(stem []byte, values [][]byte, resolver NodeResolverFn) error {
+	conf := n.config()
+	if conf.valueValidation == ValuesStrict {
+		for i, value := range values {
+			if value != nil {
+				if err := conf.checkValue(append(stem[:StemSize:StemSize], byte(i)), value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if conf.valueAlignment != AlignLeft {
+		aligned := make([][]byte, len(values))
+		for i, value := range values {
+			var err error
+			if aligned[i], err = conf.alignValue(value); err != nil {
+				return err
+			}
+		}
+		values = aligned
+	}
+	if !n.acquire() {
+		return ErrConcurrentAccess
+	}
+	defer n.release()
+	n.maybeEvict()
+	if report := n.accountingReport(); report != nil {
+		return report.record(n, OpInsert, stem, resolver, func(resolver NodeResolverFn) error {
+			return n.insertValuesAtStem(stem, values, resolver)
+		})
+	}
+	return n.insertValuesAtStem(stem, values, resolver)
+}
+
+func (n *InternalNode) insertValuesAtStem(stem []byte, values [][]byte, resolver NodeResolverFn) error {
 	nChild := offset2key(stem, n.depth) // index of the child pointed by the next byte in the key
 
 	switch child := n.children[nChild].(type) {
 	case UnknownNode:
-		return errMissingNodeInStateless
+		return fmt.Errorf("inserting at path %x: %w", stem[:n.depth+1], ErrMissingNodeInStateless)
 	case Empty:
 		n.cowChild(nChild)
 		var err error
-		n.children[nChild], err = NewLeafNode(stem, values)
+		n.children[nChild], err = newLeafNode(n.cfg, stem, values)
 		if err != nil {
-			return err
+			return &CommitmentError{Path: append([]byte{}, stem[:n.depth+1]...), Err: err}
 		}
 		n.children[nChild].setDepth(n.depth + 1)
 	case HashedNode:
 		if resolver == nil {
-			return errInsertIntoHash
+			return fmt.Errorf("inserting at path %x: %w", stem[:n.depth+1], ErrInsertIntoHash)
 		}
-		serialized, err := resolver(stem[:n.depth+1])
+		serialized, err := resolveNode(resolver, stem[:n.depth+1])
 		if err != nil {
-			return fmt.Errorf("verkle tree: error resolving node %x at depth %d: %w", stem, n.depth, err)
+			return err
 		}
-		resolved, err := ParseNode(serialized, n.depth+1)
+		resolved, err := n.parseChild(nChild, serialized, stem[:n.depth+1])
 		if err != nil {
-			return fmt.Errorf("verkle tree: error parsing resolved node %x: %w", stem, err)
+			return err
 		}
 		n.children[nChild] = resolved
 		n.cowChild(nChild)
 		// recurse to handle the case of a LeafNode child that
 		// splits.
-		return n.InsertValuesAtStem(stem, values, resolver)
+		return n.insertValuesAtStem(stem, values, resolver)
 	case *LeafNode:
+		markCacheHit(child)
 		if equalPaths(child.stem, stem) {
 			// We can't insert any values into a POA leaf node.
 			if child.isPOAStub {
-				return errIsPOAStub
+				return fmt.Errorf("inserting at path %x: %w", stem[:n.depth+1], ErrIsPOAStub)
 			}
 			n.cowChild(nChild)
 			return child.insertMultiple(stem, values)
@@ -400,6 +624,7 @@ func (n *InternalNode) InsertValuesAtStem(stem []byte, values [][]byte, resolver
 		// the moved leaf node can occur.
 		nextWordInExistingKey := offset2key(child.stem, n.depth+1)
 		newBranch := newInternalNode(n.depth + 1).(*InternalNode)
+		newBranch.cfg = n.cfg
 		newBranch.cowChild(nextWordInExistingKey)
 		n.children[nChild] = newBranch
 		newBranch.children[nextWordInExistingKey] = child
@@ -407,23 +632,24 @@ func (n *InternalNode) InsertValuesAtStem(stem []byte, values [][]byte, resolver
 
 		nextWordInInsertedKey := offset2key(stem, n.depth+1)
 		if nextWordInInsertedKey == nextWordInExistingKey {
-			return newBranch.InsertValuesAtStem(stem, values, resolver)
+			return newBranch.insertValuesAtStem(stem, values, resolver)
 		}
 
 		// Next word differs, so this was the last level.
 		// Insert it directly into its final slot.
-		leaf, err := NewLeafNode(stem, values)
+		leaf, err := newLeafNode(n.cfg, stem, values)
 		if err != nil {
-			return err
+			return &CommitmentError{Path: append([]byte{}, stem[:n.depth+2]...), Err: err}
 		}
 		leaf.setDepth(n.depth + 2)
 		newBranch.cowChild(nextWordInInsertedKey)
 		newBranch.children[nextWordInInsertedKey] = leaf
 	case *InternalNode:
+		markCacheHit(child)
 		n.cowChild(nChild)
-		return child.InsertValuesAtStem(stem, values, resolver)
+		return child.insertValuesAtStem(stem, values, resolver)
 	default: // It should be an UknownNode.
-		return errUnknownNodeType
+		return fmt.Errorf("inserting at path %x: %w", stem[:n.depth+1], ErrUnknownNodeType)
 	}
 
 	return nil
@@ -461,6 +687,7 @@ func (n *InternalNode) CreatePath(path []byte, stemInfo stemInfo, comms []*Point
 				values:     nil,
 				depth:      n.depth + 1,
 				isPOAStub:  true,
+				cfg:        n.cfg,
 			}
 			n.children[path[0]] = newchild
 			comms = comms[1:]
@@ -477,6 +704,8 @@ func (n *InternalNode) CreatePath(path []byte, stemInfo stemInfo, comms []*Point
 				stem:       stemInfo.stem,
 				values:     values,
 				depth:      n.depth + 1,
+				isPartial:  true,
+				cfg:        n.cfg,
 			}
 			n.children[path[0]] = newchild
 			comms = comms[1:]
@@ -510,7 +739,12 @@ func (n *InternalNode) CreatePath(path []byte, stemInfo stemInfo, comms []*Point
 	switch child := n.children[path[0]].(type) {
 	case UnknownNode:
 		// create the child node if missing
-		n.children[path[0]] = NewStatelessInternal(n.depth+1, comms[0])
+		if len(comms) == 0 {
+			return comms, fmt.Errorf("missing commitment for internal node on the path of stem %x", stemInfo.stem)
+		}
+		newChild := NewStatelessInternal(n.depth+1, comms[0]).(*InternalNode)
+		newChild.cfg = n.cfg
+		n.children[path[0]] = newChild
 		comms = comms[1:]
 	case *InternalNode:
 	// nothing else to do
@@ -531,67 +765,114 @@ func (n *InternalNode) CreatePath(path []byte, stemInfo stemInfo, comms []*Point
 
 // GetValuesAtStem returns the all NodeWidth values of the stem.
 // The returned slice is internal to the tree, so it *must* be considered readonly
-// for callers.
+// for callers. Since resolved nodes are stored in the tree, reads return
+// ErrConcurrentAccess like writes if the node is in use.
 func (n *InternalNode) GetValuesAtStem(stem []byte, resolver NodeResolverFn) ([][]byte, error) {
+	values, _, err := n.readValuesAtStem(stem, resolver)
+	return values, err
+}
+
+// readValuesAtStem is getValuesAtStem, recording its cost if n is the
+// root of a tree with accounting enabled.
+func (n *InternalNode) readValuesAtStem(stem []byte, resolver NodeResolverFn) (values [][]byte, poaStem []byte, err error) {
+	if !n.acquire() {
+		return nil, nil, ErrConcurrentAccess
+	}
+	defer n.release()
+	report := n.accountingReport()
+	if report == nil {
+		return n.getValuesAtStem(stem, resolver)
+	}
+	err = report.record(n, OpGet, stem, resolver, func(resolver NodeResolverFn) error {
+		var err error
+		values, poaStem, err = n.getValuesAtStem(stem, resolver)
+		return err
+	})
+	return values, poaStem, err
+}
+
+// getValuesAtStem is GetValuesAtStem, which also returns the stem of the
+// leaf found at the path of stem if it is another stem.
+func (n *InternalNode) getValuesAtStem(stem []byte, resolver NodeResolverFn) ([][]byte, []byte, error) {
 	nchild := offset2key(stem, n.depth) // index of the child pointed by the next byte in the key
-	switch child := n.children[nchild].(type) {
-	case UnknownNode:
-		return nil, errMissingNodeInStateless
-	case Empty:
-		return nil, nil
-	case HashedNode:
+	child := n.children[nchild]
+	if hashed, ok := child.(HashedNode); ok {
 		if resolver == nil {
-			return nil, fmt.Errorf("hashed node %x at depth %d along stem %x could not be resolved: %w", child.Commitment().Bytes(), n.depth, stem, errReadFromInvalid)
+			return nil, nil, fmt.Errorf("hashed node %x at path %x could not be resolved: %w", hashed.Commitment().Bytes(), stem[:n.depth+1], ErrReadFromInvalid)
 		}
-		serialized, err := resolver(stem[:n.depth+1])
+		serialized, err := resolveNode(resolver, stem[:n.depth+1])
 		if err != nil {
-			return nil, fmt.Errorf("resolving node %x at depth %d: %w", stem, n.depth, err)
+			return nil, nil, err
 		}
-		resolved, err := ParseNode(serialized, n.depth+1)
-		if err != nil {
-			return nil, fmt.Errorf("verkle tree: error parsing resolved node %x: %w", stem, err)
+		if child, err = n.parseChild(nchild, serialized, stem[:n.depth+1]); err != nil {
+			return nil, nil, err
 		}
-		n.children[nchild] = resolved
-		// recurse to handle the case of a LeafNode child that
-		// splits.
-		return n.GetValuesAtStem(stem, resolver)
+		n.children[nchild] = child
+	} else {
+		markCacheHit(child)
+	}
+	switch child := child.(type) {
+	case UnknownNode:
+		return nil, nil, fmt.Errorf("reading at path %x: %w", stem[:n.depth+1], ErrMissingNodeInStateless)
+	case Empty:
+		return nil, nil, nil
 	case *LeafNode:
 		if equalPaths(child.stem, stem) {
 			// We can't return the values since it's a POA leaf node, so we know nothing
 			// about its values.
 			if child.isPOAStub {
-				return nil, errIsPOAStub
+				return nil, nil, fmt.Errorf("reading at path %x: %w", stem[:n.depth+1], ErrIsPOAStub)
 			}
-			return child.values, nil
+			return child.values, nil, nil
 		}
-		return nil, nil
+		return nil, child.stem, nil
 	case *InternalNode:
-		return child.GetValuesAtStem(stem, resolver)
+		return child.getValuesAtStem(stem, resolver)
 	default:
-		return nil, errUnknownNodeType
+		return nil, nil, fmt.Errorf("reading at path %x: %w", stem[:n.depth+1], ErrUnknownNodeType)
 	}
 }
 
 func (n *InternalNode) Delete(key []byte, resolver NodeResolverFn) (bool, error) {
+	if !n.acquire() {
+		return false, ErrConcurrentAccess
+	}
+	defer n.release()
+	n.maybeEvict()
+	if report := n.accountingReport(); report != nil {
+		var deleted bool
+		err := report.record(n, OpDelete, key, resolver, func(resolver NodeResolverFn) error {
+			var err error
+			deleted, err = n.delete(key, resolver)
+			return err
+		})
+		return deleted, err
+	}
+	return n.delete(key, resolver)
+}
+
+func (n *InternalNode) delete(key []byte, resolver NodeResolverFn) (bool, error) {
 	nChild := offset2key(key, n.depth)
-	switch child := n.children[nChild].(type) {
-	case Empty:
-		return false, nil
-	case HashedNode:
+	child := n.children[nChild]
+	if _, ok := child.(HashedNode); ok {
 		if resolver == nil {
-			return false, errDeleteHash
+			return false, fmt.Errorf("deleting at path %x: %w", key[:n.depth+1], ErrDeleteHash)
 		}
-		payload, err := resolver(key[:n.depth+1])
+		payload, err := resolveNode(resolver, key[:n.depth+1])
 		if err != nil {
 			return false, err
 		}
 		// deserialize the payload and set it as the child
-		c, err := ParseNode(payload, n.depth+1)
-		if err != nil {
+		if child, err = n.parseChild(nChild, payload, key[:n.depth+1]); err != nil {
 			return false, err
 		}
-		n.children[nChild] = c
-		return n.Delete(key, resolver)
+		n.children[nChild] = child
+	} else {
+		markCacheHit(child)
+	}
+	switch child.(type) {
+	case Empty:
+		return false, nil
 	default:
 		n.cowChild(nChild)
 		del, err := child.Delete(key, resolver)
@@ -602,6 +883,7 @@ func (n *InternalNode) Delete(key []byte, resolver NodeResolverFn) (bool, error)
 		// delete the entire child if instructed to by
 		// the recursive algorigthm.
 		if del {
+			n.recordDeletion(child)
 			n.children[nChild] = Empty{}
 
 			// Check if all children are gone, if so
@@ -609,7 +891,7 @@ func (n *InternalNode) Delete(key []byte, resolver NodeResolverFn) (bool, error)
 			// as well.
 			for _, c := range n.children {
 				if _, ok := c.(Empty); !ok {
-					break
+					return false, nil
 				}
 			}
 
@@ -620,33 +902,180 @@ func (n *InternalNode) Delete(key []byte, resolver NodeResolverFn) (bool, error)
 	}
 }
 
+// DeleteStem deletes all the values of stem at once, e.g. to clear the
+// state of a destroyed account, and returns false if stem isn't in the
+// tree. The leaf is removed without updating its commitments, and the
+// internal nodes left empty are removed along with it, so that each
+// remaining ancestor only sees the commitment of one child change. The
+// resulting tree is the same as after deleting each value of stem.
+func (n *InternalNode) DeleteStem(stem []byte, resolver NodeResolverFn) (bool, error) {
+	if len(stem) != StemSize {
+		return false, fmt.Errorf("invalid stem length, expected %d, got %d", StemSize, len(stem))
+	}
+	if !n.acquire() {
+		return false, ErrConcurrentAccess
+	}
+	defer n.release()
+	n.maybeEvict()
+	var found bool
+	deleteStem := func(resolver NodeResolverFn) error {
+		var err error
+		found, _, err = n.deleteStem(stem, resolver)
+		return err
+	}
+	if report := n.accountingReport(); report != nil {
+		err := report.record(n, OpDelete, stem, resolver, deleteStem)
+		return found, err
+	}
+	err := deleteStem(resolver)
+	return found, err
+}
+
+// deleteStem returns whether stem was found, and whether n is left empty
+// and should be removed by its parent.
+func (n *InternalNode) deleteStem(stem []byte, resolver NodeResolverFn) (bool, bool, error) {
+	nChild := offset2key(stem, n.depth)
+	child := n.children[nChild]
+	if _, ok := child.(HashedNode); ok {
+		if resolver == nil {
+			return false, false, fmt.Errorf("deleting at path %x: %w", stem[:n.depth+1], ErrDeleteHash)
+		}
+		payload, err := resolveNode(resolver, stem[:n.depth+1])
+		if err != nil {
+			return false, false, err
+		}
+		if child, err = n.parseChild(nChild, payload, stem[:n.depth+1]); err != nil {
+			return false, false, err
+		}
+		n.children[nChild] = child
+	} else {
+		markCacheHit(child)
+	}
+	switch child := child.(type) {
+	case Empty:
+		return false, false, nil
+	case UnknownNode:
+		return false, false, fmt.Errorf("deleting at path %x: %w", stem[:n.depth+1], ErrMissingNodeInStateless)
+	case *LeafNode:
+		if !equalPaths(child.stem, stem) {
+			return false, false, nil
+		}
+		n.cowChild(nChild)
+	case *InternalNode:
+		found, del, err := child.deleteStem(stem, resolver)
+		if err != nil || !found {
+			return found, false, err
+		}
+		n.cowChild(nChild)
+		if !del {
+			return true, false, nil
+		}
+	default:
+		return false, false, fmt.Errorf("deleting at path %x: %w", stem[:n.depth+1], ErrUnknownNodeType)
+	}
+
+	n.recordDeletion(n.children[nChild])
+	n.children[nChild] = Empty{}
+	for _, c := range n.children {
+		if _, ok := c.(Empty); !ok {
+			return true, false, nil
+		}
+	}
+	return true, true, nil
+}
+
 // Flush hashes the children of an internal node and replaces them
 // with HashedNode. It also sends the current node on the flush channel.
+// Nodes are flushed depth-first, in increasing child index order, and
+// each internal node after its children, so that the sequence of calls
+// to flush only depends on the contents of the tree. The evicted
+// subtrees are also reported to the FlushWitnessFn of the configuration,
+// see WithFlushWitnesses. If the node is being committed, flushed or
+// modified by another goroutine, the misuse is logged, see TryFlush to
+// detect it.
 func (n *InternalNode) Flush(flush NodeFlushFn) {
-	//
+	// Can't fail, as the nodes in use aren't skipped
+	_ = n.flushTree(flush, false)
+}
+
+// TryFlush is Flush, except that it returns ErrConcurrentAccess if the
+// node is in use by another goroutine, in which case nothing is flushed.
+func (n *InternalNode) TryFlush(flush NodeFlushFn) error {
+	return n.flushTree(flush, true)
+}
+
+func (n *InternalNode) flushTree(flush NodeFlushFn, strict bool) error {
+	witnesses, err := n.buildFlushWitnesses(0, strict)
+	if err != nil {
+		return err
+	}
+	if err := n.flushAt(n.subtreePath(), flush, strict); err != nil {
+		return err
+	}
+	n.reportFlushWitnesses(witnesses)
+	return nil
+}
+
+// flushAt is Flush for a node whose path is known.
+func (n *InternalNode) flushAt(path []byte, flush NodeFlushFn, strict bool) error {
+	if acquired, err := n.enter(strict); err != nil {
+		return err
+	} else if acquired {
+		defer n.release()
+	}
+
+	span := startSpan(SpanFlush)
+	defer span.End()
+
 	var (
-		path                []byte
-		flushAndCapturePath = func(p []byte, vn VerkleNode) {
-			// wrap the flush function into a function that will
-			// capture the path of the first leaf being flushed,
-			// so that it can be used as the path to call `flush`.
-			if len(path) == 0 {
-				path = p[:n.depth]
+		start   = time.Now()
+		flushed int64
+	)
+	n.flush(path, func(path []byte, vn VerkleNode) {
+		flushed++
+		flush(path, vn)
+	})
+
+	m := getMetrics()
+	m.UpdateTimer(MetricFlushTime, time.Since(start))
+	warnIfSlow("Slow flush", start, "nodes", flushed)
+	m.IncCounter(MetricFlushNodes, flushed)
+	span.SetAttribute(AttrNodeCount, flushed)
+	return nil
+}
+
+// subtreePath returns the path of n. Internal nodes don't store their
+// path, so below the root it is deduced from the stem of a leaf of the
+// subtree, and is nil if none of them is in memory.
+func (n *InternalNode) subtreePath() []byte {
+	if n.depth == 0 {
+		return nil
+	}
+	for _, child := range n.children {
+		switch c := child.(type) {
+		case *LeafNode:
+			return c.stem[:n.depth]
+		case *InternalNode:
+			if path := c.subtreePath(); path != nil {
+				return path[:n.depth]
 			}
-			flush(p, vn)
 		}
-	)
+	}
+	return nil
+}
 
-	n.Commit()
+// flush flushes the subtree rooted at n, whose path is passed along so
+// that nodes whose leaves aren't in memory are flushed at the right path.
+func (n *InternalNode) flush(path []byte, flush NodeFlushFn) {
+	n.commit()
 	for i, child := range n.children {
 		if c, ok := child.(*InternalNode); ok {
-			c.Commit()
-			c.Flush(flushAndCapturePath)
-			n.children[i] = HashedNode{}
+			c.flush(append(append([]byte{}, path...), byte(i)), flush)
+			n.hashChild(i)
 		} else if c, ok := child.(*LeafNode); ok {
 			c.Commit()
-			flushAndCapturePath(c.stem[:n.depth+1], n.children[i])
-			n.children[i] = HashedNode{}
+			flush(append(append([]byte{}, path...), byte(i)), n.children[i])
+			n.hashChild(i)
 		}
 	}
 	flush(path, n)
@@ -654,30 +1083,60 @@ func (n *InternalNode) Flush(flush NodeFlushFn) {
 
 // FlushAtDepth goes over all internal nodes of a given depth, and
 // flushes them to disk. Its purpose it to free up space if memory
-// is running scarce.
+// is running scarce. Nodes are flushed in the same order as Flush, and
+// witnesses are reported in the same way. Like Flush, it logs the misuse
+// if a flushed node is in use, see TryFlushAtDepth to detect it.
 func (n *InternalNode) FlushAtDepth(depth uint8, flush NodeFlushFn) {
+	// Can't fail, as the nodes in use aren't skipped
+	_ = n.flushDepth(depth, flush, false)
+}
+
+// TryFlushAtDepth is FlushAtDepth, except that it returns
+// ErrConcurrentAccess if a flushed node is in use by another goroutine.
+// The subtrees flushed before it was detected stay flushed.
+func (n *InternalNode) TryFlushAtDepth(depth uint8, flush NodeFlushFn) error {
+	return n.flushDepth(depth, flush, true)
+}
+
+func (n *InternalNode) flushDepth(depth uint8, flush NodeFlushFn, strict bool) error {
+	witnesses, err := n.buildFlushWitnesses(depth, strict)
+	if err != nil {
+		return err
+	}
+	if err := n.flushAtDepth(n.subtreePath(), depth, flush, strict); err != nil {
+		return err
+	}
+	n.reportFlushWitnesses(witnesses)
+	return nil
+}
+
+func (n *InternalNode) flushAtDepth(path []byte, depth uint8, flush NodeFlushFn, strict bool) error {
 	for i, child := range n.children {
 		// Skip non-internal nodes
 		c, ok := child.(*InternalNode)
 		if !ok {
 			if c, ok := child.(*LeafNode); ok {
 				c.Commit()
-				flush(c.stem[:c.depth], c)
-				n.children[i] = HashedNode{}
+				flush(append(append([]byte{}, path...), byte(i)), c)
+				n.hashChild(i)
 			}
 			continue
 		}
 
 		// Not deep enough, recurse
 		if n.depth < depth {
-			c.FlushAtDepth(depth, flush)
+			if err := c.flushAtDepth(append(append([]byte{}, path...), byte(i)), depth, flush, strict); err != nil {
+				return err
+			}
 			continue
 		}
 
-		child.Commit()
-		c.Flush(flush)
-		n.children[i] = HashedNode{}
+		if err := c.flushAt(append(append([]byte{}, path...), byte(i)), flush, strict); err != nil {
+			return err
+		}
+		n.hashChild(i)
 	}
+	return nil
 }
 
 func (n *InternalNode) Get(key []byte, resolver NodeResolverFn) ([]byte, error) {
@@ -700,6 +1159,111 @@ func (n *InternalNode) Get(key []byte, resolver NodeResolverFn) ([]byte, error)
 	return stemValues[key[StemSize]], nil
 }
 
+// GetWithStem is Get, except that if the path of key leads to a leaf
+// holding another stem, that stem is also returned. This is the stem
+// proving the absence of key, which a proof of key would include in its
+// PoaStems.
+func (n *InternalNode) GetWithStem(key []byte, resolver NodeResolverFn) ([]byte, []byte, error) {
+	if len(key) != StemSize+1 {
+		return nil, nil, fmt.Errorf("invalid key length, expected %d, got %d", StemSize+1, len(key))
+	}
+	stemValues, poaStem, err := n.readValuesAtStem(key[:StemSize], resolver)
+	if err != nil {
+		return nil, nil, err
+	}
+	if poaStem != nil {
+		return nil, append([]byte{}, poaStem...), nil
+	}
+	if stemValues == nil {
+		return nil, nil, nil
+	}
+	return stemValues[key[StemSize]], nil, nil
+}
+
+// GetMany returns the values of keys, in the same order, with nil for the
+// absent keys. The keys are walked in increasing order, so that the nodes
+// on their common paths, and the leaves holding several of them, are only
+// visited and resolved once. keys isn't modified. Like GetValuesAtStem, it
+// returns ErrConcurrentAccess if the node is in use.
+func (n *InternalNode) GetMany(keys [][]byte, resolver NodeResolverFn) ([][]byte, error) {
+	for _, key := range keys {
+		if len(key) != StemSize+1 {
+			return nil, fmt.Errorf("invalid key length, expected %d, got %d", StemSize+1, len(key))
+		}
+	}
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return bytes.Compare(keys[order[i]], keys[order[j]]) < 0 })
+	sorted := make(keylist, len(keys))
+	for i, idx := range order {
+		sorted[i] = keys[idx]
+	}
+
+	if !n.acquire() {
+		return nil, ErrConcurrentAccess
+	}
+	defer n.release()
+	values := make([][]byte, len(keys))
+	if err := n.getMany(sorted, order, values, resolver); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// getMany reads the values of the sorted keys, whose positions in the
+// values are given by order, in the subtree of n.
+func (n *InternalNode) getMany(keys keylist, order []int, values [][]byte, resolver NodeResolverFn) error {
+	var offset int
+	for _, group := range groupKeys(keys, n.depth) {
+		positions := order[offset : offset+len(group)]
+		offset += len(group)
+
+		nchild := offset2key(group[0], n.depth)
+		path := group[0][:n.depth+1]
+		child := n.children[nchild]
+		if _, ok := child.(HashedNode); ok {
+			if resolver == nil {
+				return fmt.Errorf("hashed node at path %x could not be resolved: %w", path, ErrReadFromInvalid)
+			}
+			serialized, err := resolveNode(resolver, path)
+			if err != nil {
+				return err
+			}
+			if child, err = n.parseChild(nchild, serialized, path); err != nil {
+				return err
+			}
+			n.children[nchild] = child
+		} else {
+			markCacheHit(child)
+		}
+
+		switch c := child.(type) {
+		case Empty:
+		case *LeafNode:
+			for i, key := range group {
+				if !equalPaths(c.stem, key) {
+					continue
+				}
+				if c.isPOAStub {
+					return fmt.Errorf("reading at path %x: %w", path, ErrIsPOAStub)
+				}
+				values[positions[i]] = c.values[key[StemSize]]
+			}
+		case *InternalNode:
+			if err := c.getMany(group, positions, values, resolver); err != nil {
+				return err
+			}
+		case UnknownNode:
+			return fmt.Errorf("reading at path %x: %w", path, ErrMissingNodeInStateless)
+		default:
+			return fmt.Errorf("reading at path %x: %w", path, ErrUnknownNodeType)
+		}
+	}
+	return nil
+}
+
 func (n *InternalNode) Hash() *Fr {
 	var hash Fr
 	n.Commitment().MapToScalarField(&hash)
@@ -723,33 +1287,130 @@ func (n *InternalNode) fillLevels(levels [][]*InternalNode) {
 	}
 }
 
+// Commit computes the commitment of the node and of its modified
+// descendants. If the node is being committed, flushed or modified by
+// another goroutine, the misuse is logged, see TryCommit to detect it.
 func (n *InternalNode) Commit() *Point {
+	if acquired, _ := n.enter(false); acquired {
+		defer n.release()
+	}
+	n.maybeEvict()
+	return n.commit()
+}
+
+// TryCommit is Commit, except that it returns ErrConcurrentAccess if the
+// node is in use by another goroutine.
+func (n *InternalNode) TryCommit() (*Point, error) {
+	if !n.acquire() {
+		return nil, ErrConcurrentAccess
+	}
+	defer n.release()
+	n.maybeEvict()
+	return n.commit(), nil
+}
+
+// commitTree commits root, returning ErrConcurrentAccess if it is an
+// internal node in use by another goroutine.
+func commitTree(root VerkleNode) (*Point, error) {
+	if n, ok := root.(*InternalNode); ok {
+		return n.TryCommit()
+	}
+	return root.Commit(), nil
+}
+
+func (n *InternalNode) commit() *Point {
+	n.commitPartial(0)
+	return n.commitment
+}
+
+// CommitPartial is Commit, except that at most maxNodes of the modified
+// internal nodes are committed, the deepest first, so that the work can
+// be spread over several calls, e.g. in between blocks. It returns true
+// if some nodes are still to be committed, in which case the commitment
+// of the node isn't up to date yet. A later call to Commit or Flush
+// finishes the work. If maxNodes is not positive, all the nodes are
+// committed. The stem changes of the commit are reported to the
+// CommitHook once the node is fully committed. Like Commit, it logs the
+// misuse if the node is in use, see TryCommitPartial to detect it.
+func (n *InternalNode) CommitPartial(maxNodes int) bool {
+	if acquired, _ := n.enter(false); acquired {
+		defer n.release()
+	}
+	n.maybeEvict()
+	return n.commitPartial(maxNodes)
+}
+
+// TryCommitPartial is CommitPartial, except that it returns
+// ErrConcurrentAccess if the node is in use by another goroutine.
+func (n *InternalNode) TryCommitPartial(maxNodes int) (bool, error) {
+	if !n.acquire() {
+		return false, ErrConcurrentAccess
+	}
+	defer n.release()
+	n.maybeEvict()
+	return n.commitPartial(maxNodes), nil
+}
+
+// commitPartial commits up to maxNodes modified internal nodes, or all of
+// them if maxNodes isn't positive, and returns true if some are left.
+func (n *InternalNode) commitPartial(maxNodes int) bool {
 	if len(n.cow) == 0 {
-		return n.commitment
+		return false
 	}
 
+	span := startSpan(SpanCommit)
+	defer span.End()
+
+	start := time.Now()
+	prof := startProfile()
 	internalNodeLevels := make([][]*InternalNode, StemSize)
 	n.fillLevels(internalNodeLevels)
+	if maxNodes > 0 {
+		// Nodes can only be committed after their modified children,
+		// and the nodes of a level are independent from each other.
+		for level := len(internalNodeLevels) - 1; level >= 0; level-- {
+			if nodes := internalNodeLevels[level]; len(nodes) > maxNodes {
+				internalNodeLevels[level] = nodes[:maxNodes]
+				for above := 0; above < level; above++ {
+					internalNodeLevels[above] = nil
+				}
+				break
+			}
+			maxNodes -= len(internalNodeLevels[level])
+		}
+	}
+	cfg := n.config()
+	hook := cfg.commitHook
+	var changes []StemChange
+	if hook != nil {
+		changes = collectStemChanges(internalNodeLevels)
+	}
 
+	var committed int
 	for level := len(internalNodeLevels) - 1; level >= 0; level-- {
 		nodes := internalNodeLevels[level]
 		if len(nodes) == 0 {
 			continue
 		}
+		committed += len(nodes)
 
 		minBatchSize := 4
 		if len(nodes) <= minBatchSize {
-			if err := commitNodesAtLevel(nodes); err != nil {
+			if err := commitNodesAtLevel(cfg, nodes); err != nil {
 				// TODO: make Commit() return an error
 				panic(err)
 			}
 		} else {
 			var wg sync.WaitGroup
-			numBatches := runtime.NumCPU()
+			numBatches := cfg.numWorkers()
 			batchSize := (len(nodes) + numBatches - 1) / numBatches
 			if batchSize < minBatchSize {
 				batchSize = minBatchSize
 			}
+			// Errors are reported by order of the batches, from the
+			// committing goroutine, so that the result doesn't depend
+			// on the scheduling of the goroutines.
+			errs := make([]error, (len(nodes)+batchSize-1)/batchSize)
 			for i := 0; i < len(nodes); i += batchSize {
 				start := i
 				end := i + batchSize
@@ -759,20 +1420,44 @@ func (n *InternalNode) Commit() *Point {
 				wg.Add(1)
 				go func() {
 					defer wg.Done()
-					if err := commitNodesAtLevel(nodes[start:end]); err != nil {
-						// TODO: make Commit() return an error
-						panic(err)
-					}
-
+					errs[start/batchSize] = commitNodesAtLevel(cfg, nodes[start:end])
 				}()
 			}
 			wg.Wait()
+			for _, err := range errs {
+				if err != nil {
+					// TODO: make Commit() return an error
+					panic(err)
+				}
+			}
 		}
 	}
-	return n.commitment
+
+	m := getMetrics()
+	m.UpdateTimer(MetricCommitTime, time.Since(start))
+	prof.report(MetricCommitAllocs, MetricCommitAllocBytes, MetricCommitCPU)
+	warnIfSlow("Slow commitment", start, "nodes", committed)
+	m.IncCounter(MetricCommitNodes, int64(committed))
+	span.SetAttribute(AttrNodeCount, int64(committed))
+	if report := n.accountingReport(); report != nil {
+		report.add(OperationCost{Op: OpCommit, Time: time.Since(start), PointsUpdated: committed})
+	}
+	remaining := len(n.cow) != 0
+	if hook != nil {
+		if len(n.pendingChanges) > 0 {
+			changes = mergeStemChanges(n.pendingChanges, changes)
+			n.pendingChanges = nil
+		}
+		if remaining {
+			n.pendingChanges = changes
+		} else {
+			hook.OnCommit(n.commitment, changes)
+		}
+	}
+	return remaining
 }
 
-func commitNodesAtLevel(nodes []*InternalNode) error {
+func commitNodesAtLevel(cfg *Config, nodes []*InternalNode) error {
 	points := make([]*Point, 0, 1024)
 	cowIndexes := make([]int, 0, 1024)
 
@@ -817,8 +1502,19 @@ func commitNodesAtLevel(nodes []*InternalNode) error {
 			frsIdx++
 			cowIndex++
 		}
+		var (
+			audit = node.config().sampleAudit()
+			prev  *Point
+			cow   = node.cow
+		)
+		if audit {
+			prev = new(Point).Set(node.commitment)
+		}
 		node.cow = nil
 		node.commitment.Add(node.commitment, cfg.CommitToPoly(poly, 0))
+		if audit {
+			auditInternalNode(node, prev, cow)
+		}
 	}
 
 	return nil
@@ -856,6 +1552,22 @@ func groupKeys(keys keylist, depth byte) []keylist {
 }
 
 func (n *InternalNode) GetProofItems(keys keylist, resolver NodeResolverFn) (*ProofElements, []byte, [][]byte, error) {
+	return n.getProofItems(sortedKeys(keys), resolver, nil)
+}
+
+// sortedKeys returns keys if it is sorted, and a sorted copy of it
+// otherwise. The proof elements are collected by grouping consecutive
+// keys, so their order has to be fixed for proofs to be reproducible.
+func sortedKeys(keys keylist) keylist {
+	if sort.IsSorted(keys) {
+		return keys
+	}
+	sorted := append(keylist{}, keys...)
+	sort.Sort(sorted)
+	return sorted
+}
+
+func (n *InternalNode) getProofItems(keys keylist, resolver NodeResolverFn, polys polyCache) (*ProofElements, []byte, [][]byte, error) {
 	var (
 		groups = groupKeys(keys, n.depth)
 		pe     = &ProofElements{
@@ -870,41 +1582,52 @@ func (n *InternalNode) GetProofItems(keys keylist, resolver NodeResolverFn) (*Pr
 		poass [][]byte       // list of proof-of-absence stems
 	)
 
-	// fill in the polynomial for this node
-	var fi [NodeWidth]Fr
-	var fiPtrs [NodeWidth]*Fr
-	var points [NodeWidth]*Point
-	for i, child := range n.children {
-		fiPtrs[i] = &fi[i]
-		if child != nil {
-			var c VerkleNode
-			if _, ok := child.(HashedNode); ok {
-				childpath := make([]byte, n.depth+1)
-				copy(childpath[:n.depth+1], keys[0][:n.depth])
-				childpath[n.depth] = byte(i)
-				if resolver == nil {
-					return nil, nil, nil, fmt.Errorf("no resolver for path %x", childpath)
-				}
-				serialized, err := resolver(childpath)
-				if err != nil {
-					return nil, nil, nil, fmt.Errorf("error resolving for path %x: %w", childpath, err)
+	// fill in the polynomial for this node, unless it's already known,
+	// in which case only the children along the proven paths need be
+	// resolved.
+	fi, known := polys[n.commitment]
+	if known {
+		for _, group := range groups {
+			if _, err := n.resolveProofChild(offset2key(group[0], n.depth), keys[0], resolver); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	} else {
+		fi = make([]Fr, NodeWidth)
+		var fiPtrs [NodeWidth]*Fr
+		var points [NodeWidth]*Point
+		var proven [NodeWidth]bool
+		for _, group := range groups {
+			proven[offset2key(group[0], n.depth)] = true
+		}
+		cache := n.config().commitments
+		for i, child := range n.children {
+			fiPtrs[i] = &fi[i]
+			if _, ok := child.(HashedNode); ok && cache != nil && !proven[i] {
+				// Only the commitment of this sibling is needed
+				childpath := append(append(make([]byte, 0, n.depth+1), keys[0][:n.depth]...), byte(i))
+				if comm, ok := cache.Get(childpath); ok {
+					points[i] = comm
+					continue
 				}
-				c, err = ParseNode(serialized, n.depth+1)
+			}
+			if child != nil {
+				c, err := n.resolveProofChild(byte(i), keys[0], resolver)
 				if err != nil {
 					return nil, nil, nil, err
 				}
-				n.children[i] = c
+				if _, ok := c.(UnknownNode); ok {
+					pe.incomplete = true
+				}
+				points[i] = c.Commitment()
 			} else {
-				c = child
+				// TODO: add a test case to cover this scenario.
+				points[i] = new(Point)
 			}
-			points[i] = c.Commitment()
-		} else {
-			// TODO: add a test case to cover this scenario.
-			points[i] = new(Point)
 		}
-	}
-	if err := banderwagon.BatchMapToScalarField(fiPtrs[:], points[:]); err != nil {
-		return nil, nil, nil, fmt.Errorf("batch mapping to scalar fields: %s", err)
+		if err := banderwagon.BatchMapToScalarField(fiPtrs[:], points[:]); err != nil {
+			return nil, nil, nil, fmt.Errorf("batch mapping to scalar fields: %s", err)
+		}
 	}
 
 	for _, group := range groups {
@@ -917,7 +1640,7 @@ func (n *InternalNode) GetProofItems(keys keylist, resolver NodeResolverFn) (*Pr
 		pe.Cis = append(pe.Cis, n.commitment)
 		pe.Zis = append(pe.Zis, childIdx)
 		pe.Yis = append(pe.Yis, &yi)
-		pe.Fis = append(pe.Fis, fi[:])
+		pe.Fis = append(pe.Fis, fi)
 		pe.ByPath[string(group[0][:n.depth])] = n.commitment
 	}
 
@@ -928,7 +1651,7 @@ func (n *InternalNode) GetProofItems(keys keylist, resolver NodeResolverFn) (*Pr
 
 		if _, isunknown := n.children[childIdx].(UnknownNode); isunknown {
 			// TODO: add a test case to cover this scenario.
-			return nil, nil, nil, errMissingNodeInStateless
+			return nil, nil, nil, ErrMissingNodeInStateless
 		}
 
 		// Special case of a proof of absence: no children
@@ -951,7 +1674,7 @@ func (n *InternalNode) GetProofItems(keys keylist, resolver NodeResolverFn) (*Pr
 			continue
 		}
 
-		pec, es, other, err := n.children[childIdx].GetProofItems(group, resolver)
+		pec, es, other, err := proofItems(n.children[childIdx], group, resolver, polys)
 		if err != nil {
 			// TODO: add a test case to cover this scenario.
 			return nil, nil, nil, err
@@ -964,6 +1687,31 @@ func (n *InternalNode) GetProofItems(keys keylist, resolver NodeResolverFn) (*Pr
 	return pe, esses, poass, nil
 }
 
+// resolveProofChild returns the child at index i, resolving it first if
+// it's a HashedNode. key is any of the proven keys going through n.
+func (n *InternalNode) resolveProofChild(i byte, key []byte, resolver NodeResolverFn) (VerkleNode, error) {
+	child := n.children[i]
+	if _, ok := child.(HashedNode); !ok {
+		return child, nil
+	}
+	childpath := make([]byte, n.depth+1)
+	copy(childpath[:n.depth+1], key[:n.depth])
+	childpath[n.depth] = i
+	if resolver == nil {
+		return nil, fmt.Errorf("no resolver for path %x: %w", childpath, ErrReadFromInvalid)
+	}
+	serialized, err := resolveNode(resolver, childpath)
+	if err != nil {
+		return nil, err
+	}
+	c, err := n.parseChild(i, serialized, childpath)
+	if err != nil {
+		return nil, err
+	}
+	n.children[i] = c
+	return c, nil
+}
+
 // Serialize returns the serialized form of the internal node.
 // The format is: <nodeType><bitlist><commitment>
 func (n *InternalNode) Serialize() ([]byte, error) {
@@ -992,6 +1740,8 @@ func (n *InternalNode) Copy() VerkleNode {
 		children:   make([]VerkleNode, len(n.children)),
 		commitment: new(Point),
 		depth:      n.depth,
+		cfg:        n.cfg,
+		clean:      n.clean,
 	}
 
 	for i, child := range n.children {
@@ -1009,6 +1759,15 @@ func (n *InternalNode) Copy() VerkleNode {
 			ret.cow[k].Set(v)
 		}
 	}
+	if n.hashedComms != nil {
+		ret.hashedComms = make(map[byte]*Point, len(n.hashedComms))
+		for k, v := range n.hashedComms {
+			ret.hashedComms[k] = new(Point).Set(v)
+		}
+	}
+	if n.deletedStems != nil {
+		ret.deletedStems = append([][]byte{}, n.deletedStems...)
+	}
 
 	return ret
 }
@@ -1041,6 +1800,9 @@ func (n *InternalNode) setDepth(d byte) {
 // This method is deprecated, use with caution.
 func MergeTrees(subroots []*InternalNode) VerkleNode {
 	root := New().(*InternalNode)
+	if len(subroots) > 0 {
+		root.cfg = subroots[0].cfg
+	}
 	for _, subroot := range subroots {
 		for i := 0; i < NodeWidth; i++ {
 			if _, ok := subroot.children[i].(Empty); ok {
@@ -1064,7 +1826,7 @@ func (n *InternalNode) touchCoW(index byte) {
 
 func (n *LeafNode) Insert(key []byte, value []byte, _ NodeResolverFn) error {
 	if n.isPOAStub {
-		return errIsPOAStub
+		return ErrIsPOAStub
 	}
 
 	if len(key) != StemSize+1 {
@@ -1073,6 +1835,10 @@ func (n *LeafNode) Insert(key []byte, value []byte, _ NodeResolverFn) error {
 	if !bytes.Equal(key[:StemSize], n.stem) {
 		return fmt.Errorf("stems doesn't match: %x != %x", key[:StemSize], n.stem)
 	}
+	value, err := n.config().alignValue(value)
+	if err != nil {
+		return err
+	}
 	values := make([][]byte, NodeWidth)
 	values[key[StemSize]] = value
 	return n.insertMultiple(key[:StemSize], values)
@@ -1081,7 +1847,7 @@ func (n *LeafNode) Insert(key []byte, value []byte, _ NodeResolverFn) error {
 func (n *LeafNode) insertMultiple(stem []byte, values [][]byte) error {
 	// Sanity check: ensure the stems are the same.
 	if !equalPaths(stem, n.stem) {
-		return errInsertIntoOtherStem
+		return ErrInsertIntoOtherStem
 	}
 
 	return n.updateMultipleLeaves(values)
@@ -1097,7 +1863,7 @@ func (n *LeafNode) updateC(cxIndex int, newC Fr, oldC Fr) {
 	poly[cxIndex] = deltaC
 
 	// Add delta to the current commitment.
-	n.commitment.Add(n.commitment, cfg.CommitToPoly(poly[:], 0))
+	n.commitment.Add(n.commitment, n.config().CommitToPoly(poly[:], 0))
 }
 
 func (n *LeafNode) updateCn(index byte, value []byte, c *Point) error {
@@ -1121,15 +1887,16 @@ func (n *LeafNode) updateCn(index byte, value []byte, c *Point) error {
 		return err
 	}
 
+	cfg := n.config()
 	newH[0].Sub(&newH[0], &old[0])
 	poly[2*(index%128)] = newH[0]
-	diff = cfg.conf.Commit(poly[:])
+	diff = *cfg.CommitToPoly(poly[:], 0)
 	poly[2*(index%128)].SetZero()
 	c.Add(c, &diff)
 
 	newH[1].Sub(&newH[1], &old[1])
 	poly[2*(index%128)+1] = newH[1]
-	diff = cfg.conf.Commit(poly[:])
+	diff = *cfg.CommitToPoly(poly[:], 0)
 	c.Add(c, &diff)
 
 	return nil
@@ -1161,6 +1928,7 @@ func (n *LeafNode) updateLeaf(index byte, value []byte) error {
 	n.updateC(cxIndex, frs[0], frs[1])
 
 	n.values[index] = value
+	auditLeaf(n)
 	return nil
 }
 
@@ -1224,6 +1992,9 @@ func (n *LeafNode) updateMultipleLeaves(values [][]byte) error { // skipcq: GO-R
 		n.updateC(c2Idx, frs[0], frs[1])
 	}
 
+	if oldC1 != nil || oldC2 != nil {
+		auditLeaf(n)
+	}
 	return nil
 }
 
@@ -1294,15 +2065,17 @@ func (n *LeafNode) Delete(k []byte, _ NodeResolverFn) (bool, error) {
 		// is more important than
 		var poly [4]Fr
 		cn.MapToScalarField(&poly[subtreeindex])
-		n.commitment.Sub(n.commitment, cfg.CommitToPoly(poly[:], 0))
+		n.commitment.Sub(n.commitment, n.config().CommitToPoly(poly[:], 0))
 
-		// Clear the corresponding commitment
+		// Reset the corresponding commitment to the one of an
+		// empty suffix tree, so that it can be written to again.
 		if k[31] < 128 {
-			n.c1 = nil
+			n.c1 = new(Point).SetIdentity()
 		} else {
-			n.c2 = nil
+			n.c2 = new(Point).SetIdentity()
 		}
 
+		auditLeaf(n)
 		return false, nil
 	}
 
@@ -1322,7 +2095,7 @@ func (n *LeafNode) Delete(k []byte, _ NodeResolverFn) (bool, error) {
 
 func (n *LeafNode) Get(k []byte, _ NodeResolverFn) ([]byte, error) {
 	if n.isPOAStub {
-		return nil, errIsPOAStub
+		return nil, ErrIsPOAStub
 	}
 
 	if !equalPaths(k, n.stem) {
@@ -1380,38 +2153,34 @@ func leafToComms(poly []Fr, val []byte) error {
 	if len(val) == 0 {
 		return nil
 	}
-	if len(val) > 32 {
-		return fmt.Errorf("invalid leaf length %d, %v", len(val), val)
-	}
-	var (
-		valLoWithMarker [17]byte
-		loEnd           = 16
-		err             error
-	)
-	if len(val) < loEnd {
-		loEnd = len(val)
+	padded, err := PadValue(val, AlignLeft)
+	if err != nil {
+		return err
 	}
-	copy(valLoWithMarker[:loEnd], val[:loEnd])
+	var valLoWithMarker [17]byte
+	copy(valLoWithMarker[:16], padded[:16])
 	valLoWithMarker[16] = 1 // 2**128
 	if err = FromLEBytes(&poly[0], valLoWithMarker[:]); err != nil {
 		return err
 	}
-	if len(val) >= 16 {
-		if err = FromLEBytes(&poly[1], val[16:]); err != nil {
-			return err
-		}
-	}
-	return nil
+	return FromLEBytes(&poly[1], padded[16:])
+}
+
+func (n *LeafNode) GetProofItems(keys keylist, _ NodeResolverFn) (*ProofElements, []byte, [][]byte, error) {
+	return n.getProofItems(sortedKeys(keys), nil)
 }
 
-func (n *LeafNode) GetProofItems(keys keylist, _ NodeResolverFn) (*ProofElements, []byte, [][]byte, error) { // skipcq: GO-R1005
+func (n *LeafNode) getProofItems(keys keylist, polys polyCache) (*ProofElements, []byte, [][]byte, error) { // skipcq: GO-R1005
+	poly, known := polys[n.commitment] // top-level polynomial
+	if !known {
+		poly = make([]Fr, NodeWidth)
+	}
 	var (
-		poly [NodeWidth]Fr // top-level polynomial
-		pe                 = &ProofElements{
+		pe = &ProofElements{
 			Cis:    []*Point{n.commitment, n.commitment},
 			Zis:    []byte{0, 1},
 			Yis:    []*Fr{&poly[0], &poly[1]}, // Should be 0
-			Fis:    [][]Fr{poly[:], poly[:]},
+			Fis:    [][]Fr{poly, poly},
 			Vals:   make([][]byte, 0, len(keys)),
 			ByPath: map[string]*Point{},
 		}
@@ -1420,10 +2189,16 @@ func (n *LeafNode) GetProofItems(keys keylist, _ NodeResolverFn) (*ProofElements
 		poass [][]byte       // list of proof-of-absence stems
 	)
 
+	// The values of stubs and partial leaves aren't all known, and
+	// neither are their polynomials.
+	pe.incomplete = n.isPOAStub || n.isPartial
+
 	// Initialize the top-level polynomial with 1 + stem + C1 + C2
-	poly[0].SetUint64(1)
-	if err := StemFromBytes(&poly[1], n.stem); err != nil {
-		return nil, nil, nil, fmt.Errorf("error serializing stem '%x': %w", n.stem, err)
+	if !known {
+		poly[0].SetUint64(1)
+		if err := StemFromBytes(&poly[1], n.stem); err != nil {
+			return nil, nil, nil, fmt.Errorf("error serializing stem '%x': %w", n.stem, err)
+		}
 	}
 
 	// First pass: add top-level elements first
@@ -1444,8 +2219,10 @@ func (n *LeafNode) GetProofItems(keys keylist, _ NodeResolverFn) (*ProofElements
 	// If this tree is a full tree (i.e: not a stateless tree), we know we have c1 and c2 values.
 	// Also, we _need_ them independently of hasC1 or hasC2 since the prover needs `Fis`.
 	if !n.isPOAStub {
-		if err := banderwagon.BatchMapToScalarField([]*Fr{&poly[2], &poly[3]}, []*Point{n.c1, n.c2}); err != nil {
-			return nil, nil, nil, fmt.Errorf("batch mapping to scalar fields: %s", err)
+		if !known {
+			if err := banderwagon.BatchMapToScalarField([]*Fr{&poly[2], &poly[3]}, []*Point{n.c1, n.c2}); err != nil {
+				return nil, nil, nil, fmt.Errorf("batch mapping to scalar fields: %s", err)
+			}
 		}
 	} else if hasC1 || hasC2 || n.c1 != nil || n.c2 != nil {
 		// This LeafNode is a proof of absence stub. It must be true that
@@ -1459,13 +2236,13 @@ func (n *LeafNode) GetProofItems(keys keylist, _ NodeResolverFn) (*ProofElements
 		pe.Cis = append(pe.Cis, n.commitment)
 		pe.Zis = append(pe.Zis, 2)
 		pe.Yis = append(pe.Yis, &poly[2])
-		pe.Fis = append(pe.Fis, poly[:])
+		pe.Fis = append(pe.Fis, poly)
 	}
 	if hasC2 {
 		pe.Cis = append(pe.Cis, n.commitment)
 		pe.Zis = append(pe.Zis, 3)
 		pe.Yis = append(pe.Yis, &poly[3])
-		pe.Fis = append(pe.Fis, poly[:])
+		pe.Fis = append(pe.Fis, poly)
 	}
 
 	addedStems := map[string]struct{}{}
@@ -1504,21 +2281,19 @@ func (n *LeafNode) GetProofItems(keys keylist, _ NodeResolverFn) (*ProofElements
 		}
 
 		var (
-			suffix   = key[31]
-			suffPoly [NodeWidth]Fr // suffix-level polynomial
-			err      error
-			scomm    *Point
+			suffix = key[31]
+			values = n.values[:128]
+			scomm  = n.c1
 		)
 		if suffix >= 128 {
-			if _, err = fillSuffixTreePoly(suffPoly[:], n.values[128:]); err != nil {
-				return nil, nil, nil, fmt.Errorf("filling suffix tree poly: %w", err)
-			}
-			scomm = n.c2
-		} else {
-			if _, err = fillSuffixTreePoly(suffPoly[:], n.values[:128]); err != nil {
+			values, scomm = n.values[128:], n.c2
+		}
+		suffPoly, known := polys[scomm] // suffix-level polynomial
+		if !known {
+			suffPoly = make([]Fr, NodeWidth)
+			if _, err := fillSuffixTreePoly(suffPoly, values); err != nil {
 				return nil, nil, nil, fmt.Errorf("filling suffix tree poly: %w", err)
 			}
-			scomm = n.c1
 		}
 
 		var leaves [2]Fr
@@ -1538,7 +2313,7 @@ func (n *LeafNode) GetProofItems(keys keylist, _ NodeResolverFn) (*ProofElements
 		pe.Cis = append(pe.Cis, scomm, scomm)
 		pe.Zis = append(pe.Zis, 2*suffix, 2*suffix+1)
 		pe.Yis = append(pe.Yis, &leaves[0], &leaves[1])
-		pe.Fis = append(pe.Fis, suffPoly[:], suffPoly[:])
+		pe.Fis = append(pe.Fis, suffPoly, suffPoly)
 		pe.Vals = append(pe.Vals, n.values[key[31]])
 
 		if _, ok := addedStems[string(key[:StemSize])]; !ok {
@@ -1583,6 +2358,9 @@ func (n *LeafNode) Copy() VerkleNode {
 		l.c2.Set(n.c2)
 	}
 	l.isPOAStub = n.isPOAStub
+	l.clean = n.clean
+	l.isPartial = n.isPartial
+	l.cfg = n.cfg
 
 	return l
 }
@@ -1645,7 +2423,9 @@ type SerializedNode struct {
 // available in memory.
 func (n *InternalNode) BatchSerialize() ([]SerializedNode, error) {
 	// Commit to the node to update all the nodes commitments.
-	n.Commit()
+	if _, err := n.TryCommit(); err != nil {
+		return nil, err
+	}
 
 	// Collect all nodes that we need to serialize.
 	nodes := make([]VerkleNode, 0, 1024)
@@ -470,7 +470,7 @@ func TestDeleteHash(t *testing.T) {
 	}
 	tree.(*InternalNode).FlushAtDepth(0, func(path []byte, vn VerkleNode) {})
 	tree.Commit()
-	if _, err := tree.Delete(key2, nil); err != errDeleteHash {
+	if _, err := tree.Delete(key2, nil); !errors.Is(err, ErrDeleteHash) {
 		t.Fatalf("did not report the correct error while deleting from a hash: %v", err)
 	}
 }
@@ -836,12 +836,12 @@ func TestGetResolveFromHash(t *testing.T) {
 		t.Fatalf("inserting into the original failed: %v", err)
 	}
 	root.(*InternalNode).FlushAtDepth(0, flush)
-	if err := root.Insert(oneKeyTest, zeroKeyTest, nil); err != errInsertIntoHash {
+	if err := root.Insert(oneKeyTest, zeroKeyTest, nil); !errors.Is(err, ErrInsertIntoHash) {
 		t.Fatal(err)
 	}
 
 	data, err := root.Get(zeroKeyTest, nil)
-	if !errors.Is(err, errReadFromInvalid) || len(data) != 0 {
+	if !errors.Is(err, ErrReadFromInvalid) || len(data) != 0 {
 		t.Fatal(err)
 	}
 
@@ -894,7 +894,7 @@ func TestInsertIntoHashedNode(t *testing.T) {
 		t.Fatalf("inserting into the original failed: %v", err)
 	}
 
-	if err := root.Insert(zeroKeyTest, zeroKeyTest, nil); err != errInsertIntoHash {
+	if err := root.Insert(zeroKeyTest, zeroKeyTest, nil); !errors.Is(err, ErrInsertIntoHash) {
 		t.Fatalf("incorrect error type: %v", err)
 	}
 
@@ -1393,6 +1393,9 @@ func TestEmptyHashCodeCachedPoint(t *testing.T) {
 
 func TestBatchMigratedKeyValues(t *testing.T) {
 	t.Parallel()
+	if smallFootprint {
+		t.Skip("too slow without the precomputed tables")
+	}
 
 	_ = GetConfig()
 
@@ -1481,6 +1484,48 @@ func TestBatchMigratedKeyValues(t *testing.T) {
 	}
 }
 
+func TestInsertMigratedLeavesSharedRoot(t *testing.T) {
+	t.Parallel()
+
+	// The subtrees of the root are filled concurrently, so this is
+	// mostly useful with the race detector: leaves are inserted both
+	// in empty children of the root, and next to the leaves that are
+	// already there.
+	conf, err := NewConfig(WithParallelism(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rand := mRand.New(mRand.NewSource(42)) //skipcq: GSC-G404
+	kvs := genRandomKeyValues(rand, 400)
+	tree, expected := NewWithConfig(conf), New()
+	for _, kv := range kvs[:100] {
+		if err := tree.Insert(kv.key, kv.value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tree.Commit()
+
+	data := make([]BatchNewLeafNodeData, 0, len(kvs))
+	for i, kv := range kvs {
+		if i >= 100 {
+			data = append(data, BatchNewLeafNodeData{Stem: kv.key[:StemSize], Values: map[byte][]byte{kv.key[StemSize]: kv.value}})
+		}
+		if err := expected.Insert(kv.key, kv.value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	leaves, err := BatchNewLeafNode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.(*InternalNode).InsertMigratedLeaves(leaves, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !tree.Commit().Equal(expected.Commit()) {
+		t.Fatal("migrated leaves produced a different tree")
+	}
+}
+
 func genRandomTree(rand *mRand.Rand, keyValueCount int) VerkleNode {
 	tree := New()
 	for _, kv := range genRandomKeyValues(rand, keyValueCount) {
@@ -1805,3 +1850,609 @@ func TestRandom(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestErrorWrapping(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.(*InternalNode).Flush(func([]byte, VerkleNode) {})
+
+	errDB := errors.New("database is closed")
+	resolver := func([]byte) ([]byte, error) {
+		return nil, errDB
+	}
+	checks := map[string]error{}
+	_, checks["get"] = root.Get(zeroKeyTest, resolver)
+	checks["insert"] = root.Insert(zeroKeyTest, ffx32KeyTest, resolver)
+	_, checks["delete"] = root.Delete(zeroKeyTest, resolver)
+	for op, err := range checks {
+		if !errors.Is(err, ErrNotResolvable) || !errors.Is(err, errDB) {
+			t.Fatalf("%s: invalid error %v", op, err)
+		}
+		var rerr *ResolveError
+		if !errors.As(err, &rerr) || !bytes.Equal(rerr.Path, zeroKeyTest[:1]) {
+			t.Fatalf("%s: invalid resolve error %v", op, err)
+		}
+	}
+
+	// Invalid nodes are reported with their path, and are not
+	// resolution errors.
+	resolver = func([]byte) ([]byte, error) {
+		return []byte{leafRLPType}, nil
+	}
+	_, err := root.Get(ffx32KeyTest, resolver)
+	if !errors.Is(err, errSerializedPayloadTooShort) || errors.Is(err, ErrNotResolvable) {
+		t.Fatalf("invalid error %v", err)
+	}
+	if !strings.Contains(err.Error(), "path ff") {
+		t.Fatalf("path missing from error %v", err)
+	}
+}
+
+func TestDeleteKeepsSiblingsOfDeletedSubtree(t *testing.T) {
+	t.Parallel()
+
+	key1, _ := hex.DecodeString("445d000000000000000000000000000000000000000000000000000000000000")
+	key2, _ := hex.DecodeString("44fa000000000000000000000000000000000000000000000000000000000000")
+	root := New()
+	if err := root.Insert(key1, testValue, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(key2, testValue, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.Delete(key2, nil); err != nil {
+		t.Fatal(err)
+	}
+	val, err := root.Get(key1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, testValue) {
+		t.Fatalf("sibling of the deleted leaf was lost, got %x", val)
+	}
+
+	expected := New()
+	if err := expected.Insert(key1, testValue, nil); err != nil {
+		t.Fatal(err)
+	}
+	// The internal node left at 44 is kept, so only its leaf can be
+	// compared.
+	if !root.(*InternalNode).children[0x44].(*InternalNode).children[0x5d].Commit().Equal(expected.(*InternalNode).children[0x44].Commit()) {
+		t.Fatal("invalid leaf commitment")
+	}
+}
+
+func TestConcurrentAccessDetection(t *testing.T) {
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	db := map[string][]byte{}
+	root.(*InternalNode).Flush(func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = s
+	})
+
+	// Block an insertion inside the resolver, to check what
+	// happens when the tree is used in the meantime.
+	started, unblock, done := make(chan struct{}), make(chan struct{}), make(chan error)
+	go func() {
+		done <- root.Insert(oneKeyTest, fourtyKeyTest, func(path []byte) ([]byte, error) {
+			close(started)
+			<-unblock
+			return db[string(path)], nil
+		})
+	}()
+	<-started
+
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); !errors.Is(err, ErrConcurrentAccess) {
+		t.Fatalf("expected ErrConcurrentAccess, got %v", err)
+	}
+	if _, err := root.Delete(zeroKeyTest, nil); !errors.Is(err, ErrConcurrentAccess) {
+		t.Fatalf("expected ErrConcurrentAccess, got %v", err)
+	}
+	if _, err := root.(*InternalNode).TryCommit(); !errors.Is(err, ErrConcurrentAccess) {
+		t.Fatalf("expected ErrConcurrentAccess, got %v", err)
+	}
+	if _, err := root.(*InternalNode).TryCommitPartial(1); !errors.Is(err, ErrConcurrentAccess) {
+		t.Fatalf("expected ErrConcurrentAccess, got %v", err)
+	}
+	if err := root.(*InternalNode).TryFlush(func([]byte, VerkleNode) {}); !errors.Is(err, ErrConcurrentAccess) {
+		t.Fatalf("expected ErrConcurrentAccess, got %v", err)
+	}
+	if _, err := root.(*InternalNode).BatchSerialize(); !errors.Is(err, ErrConcurrentAccess) {
+		t.Fatalf("expected ErrConcurrentAccess, got %v", err)
+	}
+	if _, err := root.Get(zeroKeyTest, nil); !errors.Is(err, ErrConcurrentAccess) {
+		t.Fatalf("expected ErrConcurrentAccess, got %v", err)
+	}
+	if _, err := root.(*InternalNode).GetValuesAtStem(zeroKeyTest[:StemSize], nil); !errors.Is(err, ErrConcurrentAccess) {
+		t.Fatalf("expected ErrConcurrentAccess, got %v", err)
+	}
+	if _, err := root.(*InternalNode).GetMany([][]byte{zeroKeyTest}, nil); !errors.Is(err, ErrConcurrentAccess) {
+		t.Fatalf("expected ErrConcurrentAccess, got %v", err)
+	}
+
+	// Commit can't return the error, so it only logs it.
+	logger := &recordingLogger{}
+	SetLogger(logger)
+	defer SetLogger(nil)
+	root.Commit()
+	if logger.find("error", "Concurrent use of a tree node") == nil {
+		t.Fatal("concurrent commit wasn't logged")
+	}
+
+	close(unblock)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// The tree is usable again once the insertion is over
+	if err := root.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+}
+
+func TestDeleteLastValueOfSuffixTree(t *testing.T) {
+	t.Parallel()
+
+	// Emptying C1 or C2 used to clear the suffix commitment, so the
+	// leaf could neither be serialized nor written to again.
+	for _, suffixes := range [][2]byte{{0, NodeWidth - 1}, {NodeWidth - 1, 0}} {
+		deleted := append(zeroKeyTest[:StemSize:StemSize], suffixes[0])
+		kept := append(zeroKeyTest[:StemSize:StemSize], suffixes[1])
+
+		root := New()
+		if err := root.Insert(deleted, testValue, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := root.Insert(kept, testValue, nil); err != nil {
+			t.Fatal(err)
+		}
+		root.Commit()
+		// This empties a suffix tree, but not the leaf
+		if _, err := root.Delete(deleted, nil); err != nil {
+			t.Fatal(err)
+		}
+		root.Commit()
+
+		expected := New()
+		if err := expected.Insert(kept, testValue, nil); err != nil {
+			t.Fatal(err)
+		}
+		if !root.Commit().Equal(expected.Commit()) {
+			t.Fatalf("invalid commitment after deleting suffix %d", suffixes[0])
+		}
+		if _, err := root.(*InternalNode).children[0].Serialize(); err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckProofAgreement(root, [][]byte{deleted, kept}, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		// The suffix tree can be written to again
+		if err := root.Insert(deleted, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := expected.Insert(deleted, fourtyKeyTest, nil); err != nil {
+			t.Fatal(err)
+		}
+		if !root.Commit().Equal(expected.Commit()) {
+			t.Fatalf("invalid commitment after writing to suffix %d again", suffixes[0])
+		}
+	}
+}
+
+func TestFlushInternalNodeWithoutLeaves(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(forkOneKeyTest, testValue, nil); err != nil {
+		t.Fatal(err)
+	}
+	db := map[string][]byte{}
+	flush := func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		db[string(path)] = s
+	}
+	root.(*InternalNode).Flush(flush)
+	resolver := func(path []byte) ([]byte, error) {
+		return db[string(path)], nil
+	}
+
+	// Internal node 00 is resolved, but its only in-memory leaf
+	// is deleted, so its path can't be deduced from a leaf.
+	if _, err := root.Delete(zeroKeyTest, resolver); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	root.(*InternalNode).Flush(func(path []byte, n VerkleNode) {
+		paths = append(paths, fmt.Sprintf("%x", path))
+		flush(path, n)
+	})
+	if len(paths) != 2 || paths[0] != "00" || paths[1] != "" {
+		t.Fatalf("invalid flushed paths %q", paths)
+	}
+
+	stored, err := ParseNode(db[""], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val, err := stored.Get(zeroKeyTest, resolver); err != nil || val != nil {
+		t.Fatalf("deleted key read back from the store: %x, %v", val, err)
+	}
+	if val, err := stored.Get(forkOneKeyTest, resolver); err != nil || !bytes.Equal(val, testValue) {
+		t.Fatalf("invalid value read back from the store: %x, %v", val, err)
+	}
+}
+
+func TestFlushAtDepthInternalNodeWithoutLeaves(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, key := range [][]byte{zeroKeyTest, forkOneKeyTest, fourtyKeyTest} {
+		if err := root.Insert(key, testValue, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db := map[string][]byte{}
+	flush := func(path []byte, n VerkleNode) {
+		s, err := n.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		db[string(path)] = s
+	}
+	root.(*InternalNode).Flush(flush)
+	resolver := func(path []byte) ([]byte, error) {
+		return db[string(path)], nil
+	}
+	if _, err := root.Delete(zeroKeyTest, resolver); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+
+	// Internal node 00 has no leaf in memory, it used to be flushed
+	// at the path of the root and overwrite it.
+	var paths []string
+	root.(*InternalNode).FlushAtDepth(0, func(path []byte, n VerkleNode) {
+		paths = append(paths, fmt.Sprintf("%x", path))
+		flush(path, n)
+	})
+	if len(paths) != 1 || paths[0] != "00" {
+		t.Fatalf("invalid flushed paths %q", paths)
+	}
+	root.(*InternalNode).Flush(flush)
+
+	stored, err := ParseNode(db[""], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stored.(*InternalNode); !ok {
+		t.Fatalf("root was overwritten by a %T", stored)
+	}
+	if val, err := stored.Get(forkOneKeyTest, resolver); err != nil || !bytes.Equal(val, testValue) {
+		t.Fatalf("invalid value read back from the store: %x, %v", val, err)
+	}
+}
+
+func TestGetWithStem(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+
+	value, poaStem, err := root.(*InternalNode).GetWithStem(oneKeyTest, nil)
+	if err != nil || value != nil || poaStem != nil {
+		t.Fatalf("absent key of a present stem: value=%x, stem=%x, err=%v", value, poaStem, err)
+	}
+	value, poaStem, err = root.(*InternalNode).GetWithStem(zeroKeyTest, nil)
+	if err != nil || !bytes.Equal(value, fourtyKeyTest) || poaStem != nil {
+		t.Fatalf("present key: value=%x, stem=%x, err=%v", value, poaStem, err)
+	}
+	value, poaStem, err = root.(*InternalNode).GetWithStem(ffx32KeyTest, nil)
+	if err != nil || value != nil || poaStem != nil {
+		t.Fatalf("key with an empty path: value=%x, stem=%x, err=%v", value, poaStem, err)
+	}
+
+	// A key whose path leads to the leaf of another stem
+	absentKey := append([]byte{}, zeroKeyTest...)
+	absentKey[5] = 1
+	value, poaStem, err = root.(*InternalNode).GetWithStem(absentKey, nil)
+	if err != nil || value != nil || !bytes.Equal(poaStem, zeroKeyTest[:StemSize]) {
+		t.Fatalf("key of another stem: value=%x, stem=%x, err=%v", value, poaStem, err)
+	}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{absentKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.PoaStems) != 1 || !bytes.Equal(proof.PoaStems[0], poaStem) {
+		t.Fatalf("stem %x differs from the proof of absence stems %x", poaStem, proof.PoaStems)
+	}
+
+	if _, _, err := root.(*InternalNode).GetWithStem(zeroKeyTest[:StemSize], nil); err == nil {
+		t.Fatal("invalid key should be rejected")
+	}
+}
+
+func TestGetMany(t *testing.T) {
+	t.Parallel()
+
+	kvs := genRandomKeyValues(mRand.New(mRand.NewSource(42)), 100) //skipcq: GSC-G404
+	kvs = append(kvs, keyValue{zeroKeyTest, fourtyKeyTest}, keyValue{oneKeyTest, fourtyKeyTest})
+	_, resolver := flushedTree(t, nil, kvs)
+	var resolutions int
+	counting := func(path []byte) ([]byte, error) {
+		resolutions++
+		return resolver(path)
+	}
+	serialized, err := resolver(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := ParseNode(serialized, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unsorted keys, with duplicates and absent keys
+	absentKey := append([]byte{}, zeroKeyTest...)
+	absentKey[5] = 1
+	keys := [][]byte{kvs[7].key, zeroKeyTest, absentKey, ffx32KeyTest, kvs[3].key, oneKeyTest, kvs[7].key}
+	expected := [][]byte{kvs[7].value, fourtyKeyTest, nil, nil, kvs[3].value, fourtyKeyTest, kvs[7].value}
+	input := append([][]byte{}, keys...)
+	values, err := root.(*InternalNode).GetMany(keys, counting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range expected {
+		if !bytes.Equal(values[i], expected[i]) {
+			t.Fatalf("invalid value for key %x: %x != %x", keys[i], values[i], expected[i])
+		}
+		if !bytes.Equal(keys[i], input[i]) {
+			t.Fatal("keys were modified")
+		}
+	}
+
+	// Each node along the paths is resolved once: reading the keys one by
+	// one in a fresh tree takes at least as many resolutions.
+	many := resolutions
+	resolutions = 0
+	root, _ = ParseNode(serialized, 0)
+	for _, key := range keys {
+		if _, err := root.Get(key, counting); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if many > resolutions {
+		t.Fatalf("GetMany resolved %d nodes, individual reads %d", many, resolutions)
+	}
+
+	if _, err := root.(*InternalNode).GetMany([][]byte{zeroKeyTest[:StemSize]}, nil); err == nil {
+		t.Fatal("invalid key should be rejected")
+	}
+	root, _ = ParseNode(serialized, 0)
+	if _, err := root.(*InternalNode).GetMany(keys, nil); !errors.Is(err, ErrReadFromInvalid) {
+		t.Fatalf("expected ErrReadFromInvalid, got %v", err)
+	}
+}
+
+func TestCommitPartial(t *testing.T) {
+	t.Parallel()
+
+	kvs := genRandomKeyValues(mRand.New(mRand.NewSource(42)), 300) //skipcq: GSC-G404
+	hook := &recordingHook{}
+	conf, err := NewConfig(WithCommitHook(hook))
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, partial := New(), NewWithConfig(conf)
+	for _, kv := range kvs[:250] {
+		if err := full.Insert(kv.key, kv.value, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := partial.Insert(kv.key, kv.value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Modify the tree in between the partial commits
+	var calls int
+	inserted := 250
+	for partial.(*InternalNode).CommitPartial(10) {
+		if inserted < len(kvs) {
+			kv := kvs[inserted]
+			inserted++
+			if err := full.Insert(kv.key, kv.value, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := partial.Insert(kv.key, kv.value, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if hook.calls != 0 {
+			t.Fatal("the hook should only be called once the commit is complete")
+		}
+		calls++
+	}
+	if calls < 2 {
+		t.Fatalf("the commit should have taken several calls, took %d", calls)
+	}
+	if !full.Commit().Equal(partial.Commitment()) {
+		t.Fatal("partial commits differ from a full commit")
+	}
+	if hook.calls != 1 || len(hook.changes) != inserted {
+		t.Fatalf("expected one call to the hook with %d changes, got %d calls and %d changes", inserted, hook.calls, len(hook.changes))
+	}
+	if partial.(*InternalNode).CommitPartial(10) {
+		t.Fatal("a committed tree has no work left")
+	}
+}
+
+func TestDeterministicOrder(t *testing.T) {
+	t.Parallel()
+
+	rand := mRand.New(mRand.NewSource(42)) //skipcq: GSC-G404
+	kvs := genRandomKeyValues(rand, 100)
+	keys := make([][]byte, 0, len(kvs)+1)
+	for _, kv := range kvs {
+		keys = append(keys, kv.key)
+	}
+	// An absent key, sharing the stem of a present one
+	absent := append([]byte{}, keys[0]...)
+	absent[StemSize]++
+	keys = append(keys, absent)
+
+	// Trees built with different insertion orders are flushed in the
+	// same order, children first.
+	var flushed [2][]string
+	for i := range flushed {
+		root := New()
+		for _, j := range rand.Perm(len(kvs)) {
+			if err := root.Insert(kvs[j].key, kvs[j].value, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		root.Commit()
+
+		// Proofs don't depend on the order of the keys
+		var serialized [2][]byte
+		for j := range serialized {
+			shuffled := make([][]byte, len(keys))
+			for k, l := range rand.Perm(len(keys)) {
+				shuffled[k] = keys[l]
+			}
+			unsorted := append([][]byte{}, shuffled...)
+			pe, _, _, err := root.GetProofItems(shuffled, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(shuffled, unsorted) {
+				t.Fatal("GetProofItems modified the list of keys")
+			}
+			expected, _, _, err := GetCommitmentsForMultiproof(root, append([][]byte{}, keys...), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(pe.Zis, expected.Zis) || len(pe.Cis) != len(expected.Cis) {
+				t.Fatal("proof elements depend on the order of the keys")
+			}
+
+			proof, _, _, _, err := MakeVerkleMultiProof(root, nil, shuffled, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vp, sd, err := SerializeProof(proof)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if serialized[j], err = MarshalProofJSON(vp, sd, CamelCaseNaming); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(serialized[0], serialized[1]) {
+			t.Fatal("serialized proofs depend on the order of the keys")
+		}
+
+		root.(*InternalNode).Flush(func(path []byte, _ VerkleNode) {
+			flushed[i] = append(flushed[i], string(path))
+		})
+	}
+	if !reflect.DeepEqual(flushed[0], flushed[1]) {
+		t.Fatal("flush order depends on the insertion order")
+	}
+	for i := 1; i < len(flushed[0]); i++ {
+		prev, cur := flushed[0][i-1], flushed[0][i]
+		// A node is flushed after its children, which come after
+		// their lower-indexed siblings.
+		if !strings.HasPrefix(prev, cur) && (strings.HasPrefix(cur, prev) || prev > cur) {
+			t.Fatalf("invalid flush order: %x before %x", prev, cur)
+		}
+	}
+	if flushed[0][len(flushed[0])-1] != "" {
+		t.Fatal("the root should be flushed last")
+	}
+}
+
+func TestDeleteStem(t *testing.T) {
+	t.Parallel()
+
+	kvs := []keyValue{{zeroKeyTest, testValue}, {oneKeyTest, fourtyKeyTest}, {forkOneKeyTest, testValue}, {ffx32KeyTest, testValue}}
+	build := func(kvs []keyValue) VerkleNode {
+		root := New()
+		for _, kv := range kvs {
+			if err := root.Insert(kv.key, kv.value, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		root.Commit()
+		return root
+	}
+
+	root := build(kvs)
+	found, err := root.(*InternalNode).DeleteStem(zeroKeyTest[:StemSize], nil)
+	if err != nil || !found {
+		t.Fatalf("deleting stem: %v %v", found, err)
+	}
+	expected := build(kvs)
+	for _, key := range [][]byte{zeroKeyTest, oneKeyTest} {
+		if _, err := expected.Delete(key, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !root.Commit().Equal(expected.Commit()) {
+		t.Fatal("deleting a stem differs from deleting its values")
+	}
+
+	// Deleting the last stem below an internal node removes it.
+	found, err = root.(*InternalNode).DeleteStem(forkOneKeyTest[:StemSize], nil)
+	if err != nil || !found {
+		t.Fatalf("deleting stem: %v %v", found, err)
+	}
+	if _, ok := root.(*InternalNode).children[0].(Empty); !ok {
+		t.Fatalf("emptied internal node wasn't removed: %T", root.(*InternalNode).children[0])
+	}
+	if !root.Commit().Equal(build(kvs[3:]).Commit()) {
+		t.Fatal("invalid commitment after deleting all the stems of a subtree")
+	}
+	found, err = root.(*InternalNode).DeleteStem(forkOneKeyTest[:StemSize], nil)
+	if err != nil || found {
+		t.Fatalf("absent stem shouldn't be found: %v %v", found, err)
+	}
+
+	// Flushed nodes are resolved.
+	flushed, resolver := flushedTree(t, nil, kvs)
+	if _, err := flushed.(*InternalNode).DeleteStem(ffx32KeyTest[:StemSize], nil); !errors.Is(err, ErrDeleteHash) {
+		t.Fatalf("expected ErrDeleteHash without a resolver, got %v", err)
+	}
+	found, err = flushed.(*InternalNode).DeleteStem(ffx32KeyTest[:StemSize], resolver)
+	if err != nil || !found {
+		t.Fatalf("deleting flushed stem: %v %v", found, err)
+	}
+	if !flushed.Commit().Equal(build(kvs[:3]).Commit()) {
+		t.Fatal("invalid commitment after deleting a flushed stem")
+	}
+
+	if _, err := root.(*InternalNode).DeleteStem(zeroKeyTest, nil); err == nil {
+		t.Fatal("invalid stem should be rejected")
+	}
+}
@@ -30,7 +30,7 @@ import "errors"
 type UnknownNode struct{}
 
 func (UnknownNode) Insert([]byte, []byte, NodeResolverFn) error {
-	return errMissingNodeInStateless
+	return ErrMissingNodeInStateless
 }
 
 func (UnknownNode) Delete([]byte, NodeResolverFn) (bool, error) {
@@ -7,8 +7,8 @@ func TestUnknownFuncs(t *testing.T) {
 
 	un := UnknownNode{}
 
-	if err := un.Insert(nil, nil, nil); err != errMissingNodeInStateless {
-		t.Errorf("got %v, want %v", err, errMissingNodeInStateless)
+	if err := un.Insert(nil, nil, nil); err != ErrMissingNodeInStateless {
+		t.Errorf("got %v, want %v", err, ErrMissingNodeInStateless)
 	}
 	if _, err := un.Delete(nil, nil); err == nil {
 		t.Errorf("got nil error when deleting from a hashed node")
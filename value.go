@@ -0,0 +1,83 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import "fmt"
+
+// ValueAlignment tells PadValue where to place a value shorter than
+// LeafValueSize bytes.
+type ValueAlignment int
+
+const (
+	// AlignLeft keeps the value at the start and appends zeroes. This
+	// is how short values are committed to, and how they appear in
+	// serialized proofs.
+	AlignLeft ValueAlignment = iota
+
+	// AlignRight moves the value at the end and prepends zeroes, e.g.
+	// for big-endian integers. The result must then be inserted as
+	// is, since it is committed to differently than the short value,
+	// unless the tree is configured with WithValueAlignment(AlignRight).
+	AlignRight
+)
+
+// ValueValidation tells Insert and InsertValuesAtStem which values to
+// accept, see WithValueValidation.
+type ValueValidation int
+
+const (
+	// ValuesPermissive accepts values of up to LeafValueSize bytes,
+	// shorter values being padded according to WithValueAlignment.
+	ValuesPermissive ValueValidation = iota
+
+	// ValuesStrict only accepts values of exactly LeafValueSize bytes,
+	// so that an empty or short value can't be mistaken for an absent
+	// or a padded one.
+	ValuesStrict
+)
+
+// PadValue returns value as a LeafValueSize-byte array, filling the
+// missing bytes with zeroes as specified by align. Values longer than
+// LeafValueSize are rejected with ErrValueTooLong.
+//
+// Inserting a short value in the tree is equivalent, as far as the
+// commitments are concerned, to inserting its padded form, according to
+// the alignment set with WithValueAlignment (AlignLeft by default).
+func PadValue(value []byte, align ValueAlignment) ([LeafValueSize]byte, error) {
+	var padded [LeafValueSize]byte
+	if len(value) > LeafValueSize {
+		return padded, fmt.Errorf("%w: %d bytes", ErrValueTooLong, len(value))
+	}
+	switch align {
+	case AlignLeft:
+		copy(padded[:], value)
+	case AlignRight:
+		copy(padded[LeafValueSize-len(value):], value)
+	default:
+		return padded, fmt.Errorf("invalid value alignment %d", align)
+	}
+	return padded, nil
+}
@@ -0,0 +1,157 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPadValue(t *testing.T) {
+	t.Parallel()
+
+	left, err := PadValue([]byte{1, 2}, AlignLeft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left[0] != 1 || left[1] != 2 || !bytes.Equal(left[2:], make([]byte, 30)) {
+		t.Fatalf("invalid left-aligned value %x", left)
+	}
+	right, err := PadValue([]byte{1, 2}, AlignRight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if right[30] != 1 || right[31] != 2 || !bytes.Equal(right[:30], make([]byte, 30)) {
+		t.Fatalf("invalid right-aligned value %x", right)
+	}
+	if full, err := PadValue(fourtyKeyTest, AlignRight); err != nil || !bytes.Equal(full[:], fourtyKeyTest) {
+		t.Fatalf("full-length value was modified: %x %v", full, err)
+	}
+	if _, err := PadValue(make([]byte, 33), AlignLeft); !errors.Is(err, ErrValueTooLong) {
+		t.Fatalf("expected ErrValueTooLong, got %v", err)
+	}
+}
+
+func TestShortValueCommitment(t *testing.T) {
+	t.Parallel()
+
+	short, padded := New(), New()
+	if err := short.Insert(zeroKeyTest, []byte{1, 2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	value, _ := PadValue([]byte{1, 2}, AlignLeft)
+	if err := padded.Insert(zeroKeyTest, value[:], nil); err != nil {
+		t.Fatal(err)
+	}
+	if !short.Commit().Equal(padded.Commit()) {
+		t.Fatal("short value and its padded form have different commitments")
+	}
+
+	proof, _, _, _, err := MakeVerkleMultiProof(short, nil, [][]byte{zeroKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, statediff, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sv := statediff[0].SuffixDiffs[0].CurrentValue; sv == nil || *sv != value {
+		t.Fatalf("invalid serialized value %x", sv)
+	}
+
+	if err := short.Insert(zeroKeyTest, make([]byte, 33), nil); !errors.Is(err, ErrValueTooLong) {
+		t.Fatalf("expected ErrValueTooLong, got %v", err)
+	}
+}
+
+func TestValueAlignmentConfig(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewConfig(WithValueAlignment(ValueAlignment(2))); err == nil {
+		t.Fatal("invalid alignment should be rejected")
+	}
+	conf, err := NewConfig(WithValueAlignment(AlignRight))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	right, padded := NewWithConfig(conf), New()
+	if err := right.Insert(zeroKeyTest, []byte{1, 2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := right.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	value, _ := PadValue([]byte{1, 2}, AlignRight)
+	if err := padded.Insert(zeroKeyTest, value[:], nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := padded.Insert(ffx32KeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !right.Commit().Equal(padded.Commit()) {
+		t.Fatal("short value wasn't right-aligned")
+	}
+	if got, err := right.Get(zeroKeyTest, nil); err != nil || !bytes.Equal(got, value[:]) {
+		t.Fatalf("invalid value read back: %x (%v)", got, err)
+	}
+	if err := right.Insert(oneKeyTest, make([]byte, 33), nil); !errors.Is(err, ErrValueTooLong) {
+		t.Fatalf("expected ErrValueTooLong, got %v", err)
+	}
+
+	// Pending writes are reported in their stored form
+	overlay := NewOverlay()
+	if err := overlay.Insert(oneKeyTest, []byte{3}); err != nil {
+		t.Fatal(err)
+	}
+	proof, _, _, _, err := MakeSpeculativeProof(right, overlay, [][]byte{zeroKeyTest}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, statediff, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := PadValue([]byte{3}, AlignRight)
+	if nv := statediff[0].SuffixDiffs[1].NewValue; nv == nil || *nv != expected {
+		t.Fatalf("invalid new value %x", nv)
+	}
+}
+
+func TestValueValidationConfig(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewConfig(WithValueValidation(ValueValidation(2))); err == nil {
+		t.Fatal("invalid validation mode should be rejected")
+	}
+	conf, err := NewConfig(WithValueValidation(ValuesStrict))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := NewWithConfig(conf)
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range [][]byte{nil, {}, {1, 2}} {
+		var sizeErr *ValueSizeError
+		if err := root.Insert(oneKeyTest, value, nil); !errors.As(err, &sizeErr) || !errors.Is(err, ErrInvalidValue) {
+			t.Fatalf("expected a ValueSizeError for a %d-byte value, got %v", len(value), err)
+		}
+		if !bytes.Equal(sizeErr.Key, oneKeyTest) || sizeErr.Size != len(value) {
+			t.Fatalf("invalid error %+v", sizeErr)
+		}
+	}
+	values := make([][]byte, NodeWidth)
+	values[0], values[5] = fourtyKeyTest, []byte{1}
+	if err := root.(*InternalNode).InsertValuesAtStem(ffx32KeyTest[:StemSize], values, nil); !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("expected ErrInvalidValue, got %v", err)
+	}
+	if got, err := root.Get(append(ffx32KeyTest[:StemSize:StemSize], 0), nil); err != nil || got != nil {
+		t.Fatal("rejected values should not be inserted")
+	}
+
+	// The default mode pads short values
+	if err := New().Insert(oneKeyTest, []byte{1, 2}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
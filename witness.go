@@ -0,0 +1,170 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ExecutionWitness is the witness of a block, as found in the execution
+// payloads of the verkle devnets: the proof of the values read and
+// written by the block, along with the root of the pre-state tree they
+// are proven against. Its SSZ encoding is that of:
+//
+//	class ExecutionWitness(Container):
+//	    state_diff: StateDiff
+//	    verkle_proof: VerkleProof
+//	    parent_state_root: Bytes32
+type ExecutionWitness struct {
+	StateDiff       StateDiff    `json:"stateDiff"`
+	VerkleProof     *VerkleProof `json:"verkleProof"`
+	ParentStateRoot [32]byte     `json:"parentStateRoot"`
+}
+
+const sszExecutionWitnessFixedSize = 2*sszOffsetSize + 32
+
+// Verify checks the proof of the witness against its parent state root.
+func (w *ExecutionWitness) Verify() error {
+	return VerifySerializedProof(w.VerkleProof, w.StateDiff, w.ParentStateRoot[:])
+}
+
+// ToTree rebuilds the stateless pre-state tree of the witness, rooted at
+// its parent state root. The proof isn't checked, see Verify. The
+// post-state tree can then be built with PostStateTreeFromStateDiff.
+func (w *ExecutionWitness) ToTree() (VerkleNode, error) {
+	proof, err := DecodeProof(w.VerkleProof, w.StateDiff)
+	if err != nil {
+		return nil, fmt.Errorf("deserializing proof: %w", err)
+	}
+	return PreStateTreeFromRoot(proof, w.ParentStateRoot)
+}
+
+type executionWitnessMarshaller struct {
+	StateDiff       StateDiff    `json:"stateDiff"`
+	VerkleProof     *VerkleProof `json:"verkleProof"`
+	ParentStateRoot string       `json:"parentStateRoot"`
+}
+
+func (w *ExecutionWitness) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&executionWitnessMarshaller{
+		StateDiff:       w.StateDiff,
+		VerkleProof:     w.VerkleProof,
+		ParentStateRoot: encodeHex(w.ParentStateRoot[:]),
+	})
+}
+
+func (w *ExecutionWitness) UnmarshalJSON(data []byte) error {
+	var aux executionWitnessMarshaller
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return fmt.Errorf("execution witness unmarshal error: %w", err)
+	}
+	root, err := decodeHex(aux.ParentStateRoot, 32)
+	if err != nil {
+		return fmt.Errorf("error decoding hex string for parent state root: %w", err)
+	}
+	*w = ExecutionWitness{
+		StateDiff:   aux.StateDiff,
+		VerkleProof: aux.VerkleProof,
+	}
+	copy(w.ParentStateRoot[:], root)
+	return nil
+}
+
+// SizeSSZ returns the size of the SSZ encoding of the witness.
+func (w *ExecutionWitness) SizeSSZ() int {
+	size := sszExecutionWitnessFixedSize + w.StateDiff.SizeSSZ()
+	if w.VerkleProof != nil {
+		size += w.VerkleProof.SizeSSZ()
+	}
+	return size
+}
+
+// MarshalSSZ returns the SSZ encoding of the witness.
+func (w *ExecutionWitness) MarshalSSZ() ([]byte, error) {
+	return w.MarshalSSZTo(make([]byte, 0, w.SizeSSZ()))
+}
+
+// MarshalSSZTo appends the SSZ encoding of the witness to buf.
+func (w *ExecutionWitness) MarshalSSZTo(buf []byte) ([]byte, error) {
+	if w.VerkleProof == nil {
+		return nil, errNilProof
+	}
+	buf = sszAppendOffset(buf, sszExecutionWitnessFixedSize)
+	buf = sszAppendOffset(buf, sszExecutionWitnessFixedSize+w.StateDiff.SizeSSZ())
+	buf = append(buf, w.ParentStateRoot[:]...)
+
+	var err error
+	if buf, err = w.StateDiff.MarshalSSZTo(buf); err != nil {
+		return nil, fmt.Errorf("state diff: %w", err)
+	}
+	if buf, err = w.VerkleProof.MarshalSSZTo(buf); err != nil {
+		return nil, fmt.Errorf("verkle proof: %w", err)
+	}
+	return buf, nil
+}
+
+// UnmarshalSSZ decodes an SSZ-encoded witness.
+func (w *ExecutionWitness) UnmarshalSSZ(buf []byte) error {
+	if len(buf) < sszExecutionWitnessFixedSize {
+		return fmt.Errorf("execution witness is too short: %d < %d bytes", len(buf), sszExecutionWitnessFixedSize)
+	}
+	offsets, err := sszReadOffsets(buf, []int{0, sszOffsetSize}, sszExecutionWitnessFixedSize)
+	if err != nil {
+		return err
+	}
+
+	var sd StateDiff
+	if err := sd.UnmarshalSSZ(buf[offsets[0]:offsets[1]]); err != nil {
+		return fmt.Errorf("state diff: %w", err)
+	}
+	var vp VerkleProof
+	if err := vp.UnmarshalSSZ(buf[offsets[1]:]); err != nil {
+		return fmt.Errorf("verkle proof: %w", err)
+	}
+	*w = ExecutionWitness{
+		StateDiff:   sd,
+		VerkleProof: &vp,
+	}
+	copy(w.ParentStateRoot[:], buf[2*sszOffsetSize:])
+	return nil
+}
+
+// HashTreeRoot returns the SSZ hash tree root of the witness.
+func (w *ExecutionWitness) HashTreeRoot() ([32]byte, error) {
+	if w.VerkleProof == nil {
+		return [32]byte{}, errNilProof
+	}
+	sdRoot, err := w.StateDiff.HashTreeRoot()
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("state diff: %w", err)
+	}
+	vpRoot, err := w.VerkleProof.HashTreeRoot()
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("verkle proof: %w", err)
+	}
+	return sszMerkleize([][32]byte{sdRoot, vpRoot, w.ParentStateRoot}, 3), nil
+}
@@ -0,0 +1,77 @@
+package verkle
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExecutionWitness(t *testing.T) {
+	t.Parallel()
+
+	vp, sd := proofFixture(t)
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(forkOneKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	w := &ExecutionWitness{StateDiff: sd, VerkleProof: vp, ParentStateRoot: root.Commit().Bytes()}
+
+	if err := w.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := w.ToTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tree.Commitment().Equal(root.Commitment()) {
+		t.Fatal("rebuilt tree has the wrong root")
+	}
+	if val, err := tree.Get(zeroKeyTest, nil); err != nil || string(val) != string(fourtyKeyTest) {
+		t.Fatalf("invalid value in rebuilt tree: %x %v", val, err)
+	}
+
+	encoded, err := json.Marshal(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON ExecutionWitness
+	if err := json.Unmarshal(encoded, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(w, &fromJSON) {
+		t.Fatal("witness changed after a JSON round trip")
+	}
+
+	serialized, err := w.MarshalSSZ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serialized) != w.SizeSSZ() {
+		t.Fatalf("invalid witness size %d, expected %d", len(serialized), w.SizeSSZ())
+	}
+	var fromSSZ ExecutionWitness
+	if err := fromSSZ.UnmarshalSSZ(serialized); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(w, &fromSSZ) {
+		t.Fatal("witness changed after an SSZ round trip")
+	}
+	if err := fromSSZ.UnmarshalSSZ(serialized[:len(serialized)-1]); err == nil {
+		t.Fatal("truncated witness was accepted")
+	}
+	htr, err := w.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := fromSSZ.HashTreeRoot(); other != htr {
+		t.Fatal("hash tree root changed after a round trip")
+	}
+
+	w.ParentStateRoot = New().Commit().Bytes()
+	if err := w.Verify(); err == nil {
+		t.Fatal("witness verified against the wrong root")
+	}
+}